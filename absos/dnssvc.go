@@ -1,19 +1,106 @@
 package absos
 
-import "net"
+import (
+	"context"
+	"net"
+)
 
+// DnsRecordType identifies the kind of DNS lookup, one per lookup method of DnsSvc.
+type DnsRecordType string
+
+const (
+	DnsRecordIP    DnsRecordType = "IP"    // LookupIP/LookupIPContext.
+	DnsRecordHost  DnsRecordType = "HOST"  // LookupHost.
+	DnsRecordCNAME DnsRecordType = "CNAME" // LookupCNAME.
+	DnsRecordMX    DnsRecordType = "MX"    // LookupMX.
+	DnsRecordTXT   DnsRecordType = "TXT"   // LookupTXT.
+	DnsRecordSRV   DnsRecordType = "SRV"   // LookupSRV.
+	DnsRecordAddr  DnsRecordType = "PTR"   // LookupAddr (reverse lookup).
+)
+
+// DnsSvc wraps net.Resolver lookups.
+//
+// Method semantics follow the ones of net.Resolver.
 type DnsSvc interface {
+	// LookupIP is LookupIPContext with a background context.
 	LookupIP(host string) ([]net.IP, error)
+
+	// LookupIPContext looks up host, returns its IPv4 and IPv6 addresses.
+	LookupIPContext(ctx context.Context, host string) ([]net.IP, error)
+
+	// LookupHost looks up host, returns its addresses in text form.
+	LookupHost(ctx context.Context, host string) ([]string, error)
+
+	// LookupCNAME returns the canonical name for the given host.
+	LookupCNAME(ctx context.Context, host string) (string, error)
+
+	// LookupMX returns the MX records sorted by preference.
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+
+	// LookupTXT returns the TXT records.
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+
+	// LookupSRV looks up _service._proto.name (or just name if service and proto are empty).
+	// Returns the canonical name and SRV records sorted by priority and randomized by weight.
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+
+	// LookupAddr performs a reverse lookup for the given address.
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
 }
 
-type dnsSvcImpl struct{}
+type dnsSvcImpl struct {
+	resolver *net.Resolver
+}
 
-var dnsSvcImplInstance = dnsSvcImpl{}
+var dnsSvcImplInstance = dnsSvcImpl{resolver: net.DefaultResolver}
 
+// NewDnsSvc returns DnsSvc backed by the system resolver (net.DefaultResolver).
 func NewDnsSvc() DnsSvc {
 	return dnsSvcImplInstance
 }
 
-func (dnsSvcImpl) LookupIP(host string) ([]net.IP, error) {
-	return net.LookupIP(host)
+// NewDnsSvcWithResolver returns DnsSvc backed by the given resolver.
+func NewDnsSvcWithResolver(resolver *net.Resolver) DnsSvc {
+	return dnsSvcImpl{resolver: resolver}
+}
+
+func (svc dnsSvcImpl) LookupIP(host string) ([]net.IP, error) {
+	return svc.LookupIPContext(context.Background(), host)
+}
+
+func (svc dnsSvcImpl) LookupIPContext(ctx context.Context, host string) ([]net.IP, error) {
+	return svc.resolver.LookupIP(ctx, "ip", host)
+}
+
+func (svc dnsSvcImpl) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return svc.resolver.LookupHost(ctx, host)
+}
+
+func (svc dnsSvcImpl) LookupCNAME(ctx context.Context, host string) (string, error) {
+	return svc.resolver.LookupCNAME(ctx, host)
+}
+
+func (svc dnsSvcImpl) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	return svc.resolver.LookupMX(ctx, name)
+}
+
+func (svc dnsSvcImpl) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return svc.resolver.LookupTXT(ctx, name)
+}
+
+func (svc dnsSvcImpl) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	return svc.resolver.LookupSRV(ctx, service, proto, name)
+}
+
+func (svc dnsSvcImpl) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	return svc.resolver.LookupAddr(ctx, addr)
+}
+
+// DnsSrvName returns the name LookupSRV actually queries: _service._proto.name,
+// or just name if both service and proto are empty.
+func DnsSrvName(service, proto, name string) string {
+	if service == "" && proto == "" {
+		return name
+	}
+	return "_" + service + "._" + proto + "." + name
 }
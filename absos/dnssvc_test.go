@@ -1,6 +1,8 @@
 package absos
 
 import (
+	"context"
+	"net"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -25,3 +27,61 @@ func TestDnsSvc(t *testing.T) {
 	_, err = svc.LookupIP("......invalid-hostname-that-should-not-exist.invalid.........")
 	assert.NotNil(t, err)
 }
+
+func TestDnsSvcContext(t *testing.T) {
+	svc := NewDnsSvc()
+
+	addrs, err := svc.LookupHost(context.Background(), "localhost")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, addrs)
+
+	ips, err := svc.LookupIPContext(context.Background(), "1.2.3.4")
+	assert.Nil(t, err)
+	assert.Len(t, ips, 1)
+	assert.True(t, net.ParseIP("1.2.3.4").Equal(ips[0]))
+
+	// Cancelled context must fail lookups which need to go to the network.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	const invalid = "......invalid-hostname-that-should-not-exist.invalid........."
+
+	_, err = svc.LookupIPContext(ctx, invalid)
+	assert.NotNil(t, err)
+
+	_, err = svc.LookupHost(ctx, invalid)
+	assert.NotNil(t, err)
+
+	_, err = svc.LookupCNAME(ctx, invalid)
+	assert.NotNil(t, err)
+
+	_, err = svc.LookupMX(ctx, invalid)
+	assert.NotNil(t, err)
+
+	_, err = svc.LookupTXT(ctx, invalid)
+	assert.NotNil(t, err)
+
+	_, _, err = svc.LookupSRV(ctx, "xmpp", "tcp", invalid)
+	assert.NotNil(t, err)
+
+	_, err = svc.LookupAddr(ctx, "not-an-address")
+	assert.NotNil(t, err)
+}
+
+func TestDnsSvcWithResolver(t *testing.T) {
+	resolver := &net.Resolver{PreferGo: true}
+	svc := NewDnsSvcWithResolver(resolver)
+
+	assert.NotEqual(t, NewDnsSvc(), svc)
+
+	ips, err := svc.LookupIP("10.1.2.3")
+	assert.Nil(t, err)
+	assert.Len(t, ips, 1)
+	assert.True(t, net.ParseIP("10.1.2.3").Equal(ips[0]))
+}
+
+func TestDnsSrvName(t *testing.T) {
+	assert.Equal(t, "_xmpp._tcp.example.com", DnsSrvName("xmpp", "tcp", "example.com"))
+	assert.Equal(t, "_sip._udp.example.com", DnsSrvName("sip", "udp", "example.com"))
+	assert.Equal(t, "example.com", DnsSrvName("", "", "example.com"))
+}
@@ -0,0 +1,290 @@
+package absos
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// DnsFixture is a set of recorded DNS answers, see DnsSvcRecorder and DnsSvcMockImpl.LoadFixture().
+//
+// Stored as JSON, e.g.:
+//
+//	{"records": [
+//	  {"type": "IP", "name": "example.com", "ips": ["93.184.215.14"], "duration": "12ms"},
+//	  {"type": "IP", "name": "nope.example.com", "error": {"err": "no such host", "isNotFound": true}}
+//	]}
+//
+// or as YAML with the same field names (files with a .yaml or .yml extension).
+type DnsFixture struct {
+	Records []DnsFixtureRecord `json:"records" yaml:"records"`
+}
+
+// DnsFixtureRecord is a single recorded answer for a record type and name.
+//
+// Same as with DnsMockResult, only the field(s) matching the record type are used.
+type DnsFixtureRecord struct {
+	Type DnsRecordType `json:"type" yaml:"type"`
+	Name string        `json:"name" yaml:"name"` // For DnsRecordSRV the one returned by DnsSrvName().
+
+	IPs   []string         `json:"ips,omitempty" yaml:"ips,omitempty"`
+	Addrs []string         `json:"addrs,omitempty" yaml:"addrs,omitempty"`
+	CNAME string           `json:"cname,omitempty" yaml:"cname,omitempty"`
+	MXs   []DnsFixtureMX   `json:"mxs,omitempty" yaml:"mxs,omitempty"`
+	TXTs  []string         `json:"txts,omitempty" yaml:"txts,omitempty"`
+	SRVs  []DnsFixtureSRV  `json:"srvs,omitempty" yaml:"srvs,omitempty"`
+	Names []string         `json:"names,omitempty" yaml:"names,omitempty"`
+	Error *DnsFixtureError `json:"error,omitempty" yaml:"error,omitempty"`
+
+	// Duration is the lookup latency in time.ParseDuration() format, e.g. "12ms". Optional.
+	Duration string `json:"duration,omitempty" yaml:"duration,omitempty"`
+}
+
+// DnsFixtureMX is a recorded net.MX.
+type DnsFixtureMX struct {
+	Host string `json:"host" yaml:"host"`
+	Pref uint16 `json:"pref" yaml:"pref"`
+}
+
+// DnsFixtureSRV is a recorded net.SRV.
+type DnsFixtureSRV struct {
+	Target   string `json:"target" yaml:"target"`
+	Port     uint16 `json:"port" yaml:"port"`
+	Priority uint16 `json:"priority" yaml:"priority"`
+	Weight   uint16 `json:"weight" yaml:"weight"`
+}
+
+// DnsFixtureError is a recorded lookup error. Replayed as *net.DNSError (whatever the original error was).
+type DnsFixtureError struct {
+	Err         string `json:"err" yaml:"err"`
+	Server      string `json:"server,omitempty" yaml:"server,omitempty"`
+	IsNotFound  bool   `json:"isNotFound,omitempty" yaml:"isNotFound,omitempty"`
+	IsTimeout   bool   `json:"isTimeout,omitempty" yaml:"isTimeout,omitempty"`
+	IsTemporary bool   `json:"isTemporary,omitempty" yaml:"isTemporary,omitempty"`
+}
+
+// newDnsFixtureRecord converts a lookup result into a fixture record.
+func newDnsFixtureRecord(recordType DnsRecordType, name string, result DnsMockResult) DnsFixtureRecord {
+	record := DnsFixtureRecord{
+		Type:  recordType,
+		Name:  name,
+		Addrs: result.Addrs,
+		CNAME: result.CNAME,
+		TXTs:  result.TXTs,
+		Names: result.Names,
+	}
+
+	for _, ip := range result.IPs {
+		record.IPs = append(record.IPs, ip.String())
+	}
+	for _, mx := range result.MXs {
+		record.MXs = append(record.MXs, DnsFixtureMX{Host: mx.Host, Pref: mx.Pref})
+	}
+	for _, srv := range result.SRVs {
+		record.SRVs = append(record.SRVs, DnsFixtureSRV{Target: srv.Target, Port: srv.Port, Priority: srv.Priority, Weight: srv.Weight})
+	}
+
+	if result.Err != nil {
+		record.Error = &DnsFixtureError{Err: result.Err.Error()}
+
+		var dnsErr *net.DNSError
+		if errors.As(result.Err, &dnsErr) {
+			record.Error = &DnsFixtureError{
+				Err:         dnsErr.Err,
+				Server:      dnsErr.Server,
+				IsNotFound:  dnsErr.IsNotFound,
+				IsTimeout:   dnsErr.IsTimeout,
+				IsTemporary: dnsErr.IsTemporary,
+			}
+		}
+	}
+
+	if result.Duration > 0 {
+		record.Duration = result.Duration.String()
+	}
+
+	return record
+}
+
+// mockResult converts the record into a mock result.
+func (record DnsFixtureRecord) mockResult() (DnsMockResult, error) {
+	result := DnsMockResult{
+		Addrs: record.Addrs,
+		CNAME: record.CNAME,
+		TXTs:  record.TXTs,
+		Names: record.Names,
+	}
+
+	for _, s := range record.IPs {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return DnsMockResult{}, errors.Errorf("invalid IP %q", s)
+		}
+		result.IPs = append(result.IPs, ip)
+	}
+	for _, mx := range record.MXs {
+		result.MXs = append(result.MXs, &net.MX{Host: mx.Host, Pref: mx.Pref})
+	}
+	for _, srv := range record.SRVs {
+		result.SRVs = append(result.SRVs, &net.SRV{Target: srv.Target, Port: srv.Port, Priority: srv.Priority, Weight: srv.Weight})
+	}
+
+	if record.Error != nil {
+		result.Err = &net.DNSError{
+			Err:         record.Error.Err,
+			Name:        record.Name,
+			Server:      record.Error.Server,
+			IsNotFound:  record.Error.IsNotFound,
+			IsTimeout:   record.Error.IsTimeout,
+			IsTemporary: record.Error.IsTemporary,
+		}
+	}
+
+	if record.Duration != "" {
+		d, err := time.ParseDuration(record.Duration)
+		if err != nil {
+			return DnsMockResult{}, errors.Wrap(err, "invalid duration")
+		}
+		result.Duration = d
+	}
+
+	return result, nil
+}
+
+// ApplyFixture sets mock results for all records of the fixture.
+// Later records override earlier ones for the same record type and name.
+//
+// Either all records are applied, or (if any of them is invalid) none.
+func (svc *DnsSvcMockImpl) ApplyFixture(fixture DnsFixture) error {
+	results := make(map[dnsMockKey]DnsMockResult, len(fixture.Records))
+	for i, record := range fixture.Records {
+		result, err := record.mockResult()
+		if err != nil {
+			return errors.Wrapf(err, "invalid record #%d (%s %s)", i, record.Type, record.Name)
+		}
+		results[dnsMockKey{record.Type, record.Name}] = result
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	for key, result := range results {
+		svc.results[key] = &dnsMockEntry{results: []DnsMockResult{result}}
+	}
+	return nil
+}
+
+// LoadFixture reads a JSON fixture (see DnsFixture, DnsSvcRecorder) and applies it (see ApplyFixture()).
+func (svc *DnsSvcMockImpl) LoadFixture(r io.Reader) error {
+	var fixture DnsFixture
+	if err := json.NewDecoder(r).Decode(&fixture); err != nil {
+		return errors.Wrap(err, "could not parse DNS fixture")
+	}
+	return svc.ApplyFixture(fixture)
+}
+
+// LoadFixtureYaml is LoadFixture() for a YAML fixture.
+func (svc *DnsSvcMockImpl) LoadFixtureYaml(r io.Reader) error {
+	var fixture DnsFixture
+	if err := yaml.NewDecoder(r).Decode(&fixture); err != nil {
+		return errors.Wrap(err, "could not parse DNS fixture")
+	}
+	return svc.ApplyFixture(fixture)
+}
+
+// LoadFixtureFile is LoadFixture() (or LoadFixtureYaml() for .yaml/.yml files) reading the given file.
+func (svc *DnsSvcMockImpl) LoadFixtureFile(path string) error {
+	if isYamlFixture(path) {
+		return loadFile(path, svc.LoadFixtureYaml)
+	}
+	return loadFile(path, svc.LoadFixture)
+}
+
+// isYamlFixture tells whether the fixture file at path is YAML (by extension), JSON otherwise.
+func isYamlFixture(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// LoadHosts reads an /etc/hosts style file ("IP canonical_name [aliases...]" lines, # comments)
+// and sets LookupIP(), LookupHost() and LookupAddr() results for its entries.
+//
+// Addresses of a name listed several times are merged in order of appearance. Same as with
+// the system resolver, names returned by LookupAddr() are absolute (i.e. end with a dot),
+// and lines with invalid IPs are ignored.
+func (svc *DnsSvcMockImpl) LoadHosts(r io.Reader) error {
+	var hosts []string
+	ipsByHost := make(map[string][]net.IP)
+	var addrs []string
+	namesByAddr := make(map[string][]string)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			continue
+		}
+		addr := ip.String()
+
+		for _, host := range fields[1:] {
+			if _, exists := ipsByHost[host]; !exists {
+				hosts = append(hosts, host)
+			}
+			ipsByHost[host] = append(ipsByHost[host], ip)
+
+			if _, exists := namesByAddr[addr]; !exists {
+				addrs = append(addrs, addr)
+			}
+			namesByAddr[addr] = append(namesByAddr[addr], strings.TrimSuffix(host, ".")+".")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "could not read hosts file")
+	}
+
+	var fixture DnsFixture
+	for _, host := range hosts {
+		ips := ipsByHost[host]
+		hostAddrs := make([]string, len(ips))
+		for i, ip := range ips {
+			hostAddrs[i] = ip.String()
+		}
+		fixture.Records = append(fixture.Records,
+			newDnsFixtureRecord(DnsRecordIP, host, DnsMockResult{IPs: ips}),
+			newDnsFixtureRecord(DnsRecordHost, host, DnsMockResult{Addrs: hostAddrs}))
+	}
+	for _, addr := range addrs {
+		fixture.Records = append(fixture.Records, newDnsFixtureRecord(DnsRecordAddr, addr, DnsMockResult{Names: namesByAddr[addr]}))
+	}
+
+	return svc.ApplyFixture(fixture)
+}
+
+// LoadHostsFile is LoadHosts() reading the given file, e.g. "/etc/hosts".
+func (svc *DnsSvcMockImpl) LoadHostsFile(path string) error {
+	return loadFile(path, svc.LoadHosts)
+}
+
+// loadFile opens the file at path and passes it to load.
+func loadFile(path string, load func(r io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "could not open file")
+	}
+	defer f.Close()
+
+	return errors.Wrap(load(f), path)
+}
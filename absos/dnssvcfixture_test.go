@@ -0,0 +1,148 @@
+package absos
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testDnsFixture = `{"records": [
+	{"type": "IP", "name": "example.com", "ips": ["10.0.0.1", "::1"], "duration": "12ms"},
+	{"type": "IP", "name": "nope.example.com", "error": {"err": "no such host", "server": "1.1.1.1:53", "isNotFound": true}},
+	{"type": "MX", "name": "example.com", "mxs": [{"host": "mx.example.com.", "pref": 10}]},
+	{"type": "SRV", "name": "_sip._udp.example.com", "cname": "sip.example.com.", "srvs": [{"target": "a.example.com.", "port": 5060, "priority": 1, "weight": 2}]},
+	{"type": "TXT", "name": "example.com", "txts": ["v=spf1 -all"]}
+]}`
+
+func TestDnsSvcMockLoadFixture(t *testing.T) {
+	timeSvc := NewTimeSvcMock()
+	svc := NewDnsSvcMock(timeSvc)
+	assert.Nil(t, svc.LoadFixture(strings.NewReader(testDnsFixture)))
+
+	// Latency is replayed.
+	done := make(chan []net.IP)
+	go func() {
+		ips, err := svc.LookupIP("example.com")
+		assert.Nil(t, err)
+		done <- ips
+	}()
+	timeSvc.WaitForSleepers(1)
+	timeSvc.Add(12 * time.Millisecond)
+	ips := <-done
+	assert.Len(t, ips, 2)
+	assert.True(t, ips[0].Equal(net.IPv4(10, 0, 0, 1)))
+	assert.True(t, ips[1].Equal(net.IPv6loopback))
+
+	_, err := svc.LookupIP("nope.example.com")
+	assert.Equal(t, &net.DNSError{Err: "no such host", Name: "nope.example.com", Server: "1.1.1.1:53", IsNotFound: true}, err)
+
+	mxs, err := svc.LookupMX(context.Background(), "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []*net.MX{{Host: "mx.example.com.", Pref: 10}}, mxs)
+
+	cname, srvs, err := svc.LookupSRV(context.Background(), "sip", "udp", "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "sip.example.com.", cname)
+	assert.Equal(t, []*net.SRV{{Target: "a.example.com.", Port: 5060, Priority: 1, Weight: 2}}, srvs)
+
+	txts, err := svc.LookupTXT(context.Background(), "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"v=spf1 -all"}, txts)
+}
+
+func TestDnsSvcMockLoadFixtureYaml(t *testing.T) {
+	svc := NewDnsSvcMock(NewTimeSvcMock())
+	assert.Nil(t, svc.LoadFixtureYaml(strings.NewReader(`records:
+  - type: IP
+    name: nope.example.com
+    error: {err: no such host, isNotFound: true}
+  - type: MX
+    name: example.com
+    mxs: [{host: mx.example.com., pref: 10}]
+`)))
+
+	_, err := svc.LookupIP("nope.example.com")
+	assert.Equal(t, &net.DNSError{Err: "no such host", Name: "nope.example.com", IsNotFound: true}, err)
+
+	mxs, err := svc.LookupMX(context.Background(), "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []*net.MX{{Host: "mx.example.com.", Pref: 10}}, mxs)
+
+	// By file extension.
+	path := filepath.Join(t.TempDir(), "dns.yml")
+	assert.Nil(t, os.WriteFile(path, []byte("records:\n  - {type: TXT, name: example.com, txts: [hello]}\n"), 0o600))
+	assert.Nil(t, svc.LoadFixtureFile(path))
+	txts, err := svc.LookupTXT(context.Background(), "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hello"}, txts)
+
+	assert.ErrorContains(t, svc.LoadFixtureYaml(strings.NewReader("records: {")), "could not parse DNS fixture")
+}
+
+func TestDnsSvcMockLoadFixtureInvalid(t *testing.T) {
+	svc := NewDnsSvcMock(NewTimeSvcMock())
+
+	assert.ErrorContains(t, svc.LoadFixture(strings.NewReader("{")), "could not parse DNS fixture")
+
+	err := svc.LoadFixture(strings.NewReader(`{"records": [
+		{"type": "IP", "name": "ok.com", "ips": ["10.0.0.1"]},
+		{"type": "IP", "name": "bad.com", "ips": ["10.0.0"]}
+	]}`))
+	assert.EqualError(t, err, `invalid record #1 (IP bad.com): invalid IP "10.0.0"`)
+
+	err = svc.ApplyFixture(DnsFixture{Records: []DnsFixtureRecord{{Type: DnsRecordIP, Name: "slow.com", Duration: "long"}}})
+	assert.ErrorContains(t, err, `invalid record #0 (IP slow.com): invalid duration`)
+
+	// Nothing applied.
+	_, err = svc.LookupIP("ok.com")
+	assert.ErrorContains(t, err, "no such host")
+
+	err = svc.LoadFixtureFile(filepath.Join(t.TempDir(), "missing.json"))
+	assert.ErrorContains(t, err, "could not open file")
+}
+
+func TestDnsSvcMockLoadHosts(t *testing.T) {
+	svc := NewDnsSvcMock(NewTimeSvcMock())
+
+	path := filepath.Join(t.TempDir(), "hosts")
+	assert.Nil(t, os.WriteFile(path, []byte(`
+# Comment.
+127.0.0.1   localhost
+::1         localhost ip6-localhost   # Trailing comment.
+10.0.0.1    db.local db
+not-an-ip   ignored.local
+10.0.0.2    db.local
+`), 0o600))
+	assert.Nil(t, svc.LoadHostsFile(path))
+
+	ips, err := svc.LookupIP("localhost")
+	assert.Nil(t, err)
+	assert.Len(t, ips, 2)
+	assert.True(t, ips[0].Equal(net.IPv4(127, 0, 0, 1)))
+	assert.True(t, ips[1].Equal(net.IPv6loopback))
+
+	addrs, err := svc.LookupHost(context.Background(), "db.local")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, addrs)
+
+	addrs, err = svc.LookupHost(context.Background(), "db")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.1"}, addrs)
+
+	names, err := svc.LookupAddr(context.Background(), "::1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"localhost.", "ip6-localhost."}, names)
+
+	names, err = svc.LookupAddr(context.Background(), "10.0.0.1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"db.local.", "db."}, names)
+
+	_, err = svc.LookupIP("ignored.local")
+	assert.ErrorContains(t, err, "no such host")
+}
@@ -1,46 +1,121 @@
 package absos
 
 import (
+	"context"
 	"net"
+	"strings"
 	"sync"
 	"time"
 )
 
 // DnsMockResult represents the mock data for a DNS lookup response.
+//
+// Only the field(s) matching the record type the result is set for are used,
+// e.g. IPs for DnsRecordIP or MXs for DnsRecordMX.
 type DnsMockResult struct {
-	IPs      []net.IP
+	IPs   []net.IP   // DnsRecordIP.
+	Addrs []string   // DnsRecordHost.
+	CNAME string     // DnsRecordCNAME; also the canonical name returned for DnsRecordSRV.
+	MXs   []*net.MX  // DnsRecordMX.
+	TXTs  []string   // DnsRecordTXT.
+	SRVs  []*net.SRV // DnsRecordSRV.
+	Names []string   // DnsRecordAddr.
+
 	Err      error
 	Duration time.Duration
 }
 
+// dnsMockKey identifies a mock result: the record type and the looked up name.
+type dnsMockKey struct {
+	recordType DnsRecordType
+	name       string
+}
+
+// dnsMockEntry is a sequence of mock results returned one by one, see DnsSvcMockImpl.SetResultSequence().
+type dnsMockEntry struct {
+	results []DnsMockResult
+	cycle   bool // Start over after the last result instead of repeating it.
+	next    int  // Index of the result to return next.
+}
+
+// nextResult returns the current result of the sequence and moves on.
+func (entry *dnsMockEntry) nextResult() DnsMockResult {
+	result := entry.results[entry.next]
+	if entry.next < len(entry.results)-1 {
+		entry.next++
+	} else if entry.cycle {
+		entry.next = 0
+	}
+	return result
+}
+
 // DnsSvcMockImpl provides a mock implementation of DnsSvc for testing purposes.
 // It allows controlled DNS responses and can simulate delays using TimeSvc.
+//
+// Results are set per record type and name (see DnsRecordType). Names starting with "*."
+// are wildcards matching any name with the rest as a suffix, e.g. "*.svc.local" matches
+// "db.svc.local" and "a.db.svc.local", but not "svc.local". Exact names win over wildcards,
+// longer wildcards over shorter ones. Lookups of names without a result fail with a
+// "no such host" error.
+//
+// All lookups are logged, see Calls() and AssertLookedUp().
 type DnsSvcMockImpl struct {
 	timeSvc TimeSvc
-	mu      sync.RWMutex
-	results map[string]DnsMockResult
+	mu      sync.Mutex
+	results map[dnsMockKey]*dnsMockEntry
+	calls   []DnsMockCall
 }
 
 // NewDnsSvcMock creates a new DnsSvcMockImpl instance with the provided TimeSvc.
 func NewDnsSvcMock(timeSvc TimeSvc) *DnsSvcMockImpl {
 	return &DnsSvcMockImpl{
 		timeSvc: timeSvc,
-		results: make(map[string]DnsMockResult),
+		results: make(map[dnsMockKey]*dnsMockEntry),
 	}
 }
 
-// LookupIP performs a mock DNS lookup using predefined results.
-// If a duration is set for the hostname, it will sleep using TimeSvc before returning.
-func (svc *DnsSvcMockImpl) LookupIP(host string) ([]net.IP, error) {
-	svc.mu.RLock()
-	result, exists := svc.results[host]
-	svc.mu.RUnlock()
+// findEntryLocked returns the entry for the given record type and name,
+// falling back to wildcards (see DnsSvcMockImpl). Must be called with svc.mu held.
+func (svc *DnsSvcMockImpl) findEntryLocked(recordType DnsRecordType, name string) (*dnsMockEntry, bool) {
+	if entry, exists := svc.results[dnsMockKey{recordType, name}]; exists {
+		return entry, true
+	}
+
+	for suffix := name; ; {
+		_, rest, found := strings.Cut(suffix, ".")
+		if !found || rest == "" {
+			return nil, false
+		}
+		if entry, exists := svc.results[dnsMockKey{recordType, "*." + rest}]; exists {
+			return entry, true
+		}
+		suffix = rest
+	}
+}
+
+// lookup returns the mock result for the given record type and name.
+// If a duration is set for the result, it sleeps using TimeSvc before returning,
+// but returns early if ctx gets done.
+func (svc *DnsSvcMockImpl) lookup(ctx context.Context, recordType DnsRecordType, name string) (DnsMockResult, error) {
+	svc.mu.Lock()
+	svc.calls = append(svc.calls, DnsMockCall{Type: recordType, Name: name, Time: svc.timeSvc.Now()})
+	if err := ctx.Err(); err != nil {
+		// Does not consume a result of the sequence.
+		svc.mu.Unlock()
+		return DnsMockResult{}, newDnsMockContextError(name, err)
+	}
+	entry, exists := svc.findEntryLocked(recordType, name)
+	var result DnsMockResult
+	if exists {
+		result = entry.nextResult()
+	}
+	svc.mu.Unlock()
 
 	if !exists {
 		// Return default error for unknown hosts.
-		return nil, &net.DNSError{
+		return DnsMockResult{}, &net.DNSError{
 			Err:        "no such host",
-			Name:       host,
+			Name:       name,
 			Server:     "mock",
 			IsNotFound: true,
 		}
@@ -48,10 +123,105 @@ func (svc *DnsSvcMockImpl) LookupIP(host string) ([]net.IP, error) {
 
 	// Simulate delay if duration is set.
 	if result.Duration > 0 {
-		svc.timeSvc.Sleep(result.Duration)
+		if err := SleepContext(ctx, svc.timeSvc, result.Duration); err != nil {
+			return DnsMockResult{}, newDnsMockContextError(name, err)
+		}
+	}
+
+	return result, result.Err
+}
+
+// newDnsMockContextError wraps a context error the same way net.Resolver does.
+func newDnsMockContextError(name string, err error) *net.DNSError {
+	return &net.DNSError{
+		Err:       err.Error(),
+		Name:      name,
+		Server:    "mock",
+		IsTimeout: err == context.DeadlineExceeded,
+		UnwrapErr: err,
 	}
+}
+
+// LookupIP performs a mock DNS lookup using predefined results.
+// If a duration is set for the hostname, it will sleep using TimeSvc before returning.
+func (svc *DnsSvcMockImpl) LookupIP(host string) ([]net.IP, error) {
+	return svc.LookupIPContext(context.Background(), host)
+}
+
+// LookupIPContext is like LookupIP, but returns early if ctx gets done while sleeping.
+func (svc *DnsSvcMockImpl) LookupIPContext(ctx context.Context, host string) ([]net.IP, error) {
+	result, err := svc.lookup(ctx, DnsRecordIP, host)
+	return result.IPs, err
+}
+
+// LookupHost returns the mock result set for DnsRecordHost.
+func (svc *DnsSvcMockImpl) LookupHost(ctx context.Context, host string) ([]string, error) {
+	result, err := svc.lookup(ctx, DnsRecordHost, host)
+	return result.Addrs, err
+}
 
-	return result.IPs, result.Err
+// LookupCNAME returns the mock result set for DnsRecordCNAME.
+func (svc *DnsSvcMockImpl) LookupCNAME(ctx context.Context, host string) (string, error) {
+	result, err := svc.lookup(ctx, DnsRecordCNAME, host)
+	return result.CNAME, err
+}
+
+// LookupMX returns the mock result set for DnsRecordMX.
+func (svc *DnsSvcMockImpl) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	result, err := svc.lookup(ctx, DnsRecordMX, name)
+	return result.MXs, err
+}
+
+// LookupTXT returns the mock result set for DnsRecordTXT.
+func (svc *DnsSvcMockImpl) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	result, err := svc.lookup(ctx, DnsRecordTXT, name)
+	return result.TXTs, err
+}
+
+// LookupSRV returns the mock result set for DnsRecordSRV and DnsSrvName(service, proto, name).
+func (svc *DnsSvcMockImpl) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	result, err := svc.lookup(ctx, DnsRecordSRV, DnsSrvName(service, proto, name))
+	return result.CNAME, result.SRVs, err
+}
+
+// LookupAddr returns the mock result set for DnsRecordAddr.
+func (svc *DnsSvcMockImpl) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	result, err := svc.lookup(ctx, DnsRecordAddr, addr)
+	return result.Names, err
+}
+
+// SetResult sets the mock result for a specific record type and name (or wildcard, see DnsSvcMockImpl).
+//
+// For DnsRecordSRV the name is the one returned by DnsSrvName().
+func (svc *DnsSvcMockImpl) SetResult(recordType DnsRecordType, name string, result DnsMockResult) {
+	svc.setEntry(recordType, name, false, []DnsMockResult{result})
+}
+
+// SetResultSequence sets mock results returned one by one by subsequent lookups of the record type
+// and name, e.g. two errors followed by a success. Once the sequence is exhausted, the last result
+// is repeated forever.
+//
+// Panics if no results are given.
+func (svc *DnsSvcMockImpl) SetResultSequence(recordType DnsRecordType, name string, results ...DnsMockResult) {
+	svc.setEntry(recordType, name, false, results)
+}
+
+// SetResultCycle is like SetResultSequence(), but starts over once the results are exhausted,
+// e.g. to simulate round-robin answers.
+//
+// Panics if no results are given.
+func (svc *DnsSvcMockImpl) SetResultCycle(recordType DnsRecordType, name string, results ...DnsMockResult) {
+	svc.setEntry(recordType, name, true, results)
+}
+
+func (svc *DnsSvcMockImpl) setEntry(recordType DnsRecordType, name string, cycle bool, results []DnsMockResult) {
+	if len(results) == 0 {
+		panic("no DNS mock results given")
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.results[dnsMockKey{recordType, name}] = &dnsMockEntry{results: results, cycle: cycle}
 }
 
 // SetLookupIpResult sets the mock result for a specific hostname.
@@ -61,25 +231,69 @@ func (svc *DnsSvcMockImpl) SetLookupIpResult(host string, ips []net.IP, err erro
 
 // SetLookupIpResultWithDuration sets the mock result for a specific hostname with a delay duration.
 func (svc *DnsSvcMockImpl) SetLookupIpResultWithDuration(host string, ips []net.IP, err error, duration time.Duration) {
-	svc.mu.Lock()
-	defer svc.mu.Unlock()
-	svc.results[host] = DnsMockResult{
+	svc.SetResult(DnsRecordIP, host, DnsMockResult{
 		IPs:      ips,
 		Err:      err,
 		Duration: duration,
-	}
+	})
+}
+
+// SetLookupHostResult sets the LookupHost() mock result for a specific hostname.
+func (svc *DnsSvcMockImpl) SetLookupHostResult(host string, addrs []string, err error) {
+	svc.SetResult(DnsRecordHost, host, DnsMockResult{Addrs: addrs, Err: err})
+}
+
+// SetLookupCNAMEResult sets the LookupCNAME() mock result for a specific hostname.
+func (svc *DnsSvcMockImpl) SetLookupCNAMEResult(host string, cname string, err error) {
+	svc.SetResult(DnsRecordCNAME, host, DnsMockResult{CNAME: cname, Err: err})
+}
+
+// SetLookupMXResult sets the LookupMX() mock result for a specific name.
+func (svc *DnsSvcMockImpl) SetLookupMXResult(name string, mxs []*net.MX, err error) {
+	svc.SetResult(DnsRecordMX, name, DnsMockResult{MXs: mxs, Err: err})
+}
+
+// SetLookupTXTResult sets the LookupTXT() mock result for a specific name.
+func (svc *DnsSvcMockImpl) SetLookupTXTResult(name string, txts []string, err error) {
+	svc.SetResult(DnsRecordTXT, name, DnsMockResult{TXTs: txts, Err: err})
+}
+
+// SetLookupSRVResult sets the LookupSRV() mock result for a specific service, proto and name.
+func (svc *DnsSvcMockImpl) SetLookupSRVResult(service, proto, name string, cname string, srvs []*net.SRV, err error) {
+	svc.SetResult(DnsRecordSRV, DnsSrvName(service, proto, name), DnsMockResult{CNAME: cname, SRVs: srvs, Err: err})
+}
+
+// SetLookupAddrResult sets the LookupAddr() mock result for a specific address.
+func (svc *DnsSvcMockImpl) SetLookupAddrResult(addr string, names []string, err error) {
+	svc.SetResult(DnsRecordAddr, addr, DnsMockResult{Names: names, Err: err})
+}
+
+// ClearResult removes the mock result for a specific record type and name.
+func (svc *DnsSvcMockImpl) ClearResult(recordType DnsRecordType, name string) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	delete(svc.results, dnsMockKey{recordType, name})
 }
 
 // ClearLookupIpResult removes the mock result for a specific hostname.
 func (svc *DnsSvcMockImpl) ClearLookupIpResult(host string) {
+	svc.ClearResult(DnsRecordIP, host)
+}
+
+// ClearAllLookupIpResults removes all LookupIP() mock results.
+func (svc *DnsSvcMockImpl) ClearAllLookupIpResults() {
 	svc.mu.Lock()
 	defer svc.mu.Unlock()
-	delete(svc.results, host)
+	for key := range svc.results {
+		if key.recordType == DnsRecordIP {
+			delete(svc.results, key)
+		}
+	}
 }
 
-// ClearAllLookupIpResults removes all mock results.
-func (svc *DnsSvcMockImpl) ClearAllLookupIpResults() {
+// ClearAllResults removes all mock results of all record types.
+func (svc *DnsSvcMockImpl) ClearAllResults() {
 	svc.mu.Lock()
 	defer svc.mu.Unlock()
-	svc.results = make(map[string]DnsMockResult)
+	svc.results = make(map[dnsMockKey]*dnsMockEntry)
 }
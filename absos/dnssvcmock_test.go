@@ -1,10 +1,12 @@
 package absos
 
 import (
+	"context"
 	"net"
 	"testing"
 	"time"
 
+	"github.com/kattecon/akgoli/testutils"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -125,3 +127,209 @@ func TestDnsSvcMockZeroDuration(t *testing.T) {
 	// Time should not have advanced.
 	assert.Equal(t, initialTime, timeSvc.Now())
 }
+
+func TestDnsSvcMockRecordTypes(t *testing.T) {
+	timeSvc := NewTimeSvcMock()
+	dnsSvc := NewDnsSvcMock(timeSvc)
+	ctx := context.Background()
+
+	mxs := []*net.MX{{Host: "mx1.example.com.", Pref: 10}, {Host: "mx2.example.com.", Pref: 20}}
+	srvs := []*net.SRV{{Target: "xmpp.example.com.", Port: 5222, Priority: 1, Weight: 5}}
+
+	dnsSvc.SetLookupHostResult("example.com", []string{"192.168.1.1", "::1"}, nil)
+	dnsSvc.SetLookupCNAMEResult("www.example.com", "example.com.", nil)
+	dnsSvc.SetLookupMXResult("example.com", mxs, nil)
+	dnsSvc.SetLookupTXTResult("example.com", []string{"v=spf1 -all"}, nil)
+	dnsSvc.SetLookupSRVResult("xmpp", "tcp", "example.com", "_xmpp._tcp.example.com.", srvs, nil)
+	dnsSvc.SetLookupAddrResult("192.168.1.1", []string{"example.com."}, nil)
+
+	addrs, err := dnsSvc.LookupHost(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"192.168.1.1", "::1"}, addrs)
+
+	cname, err := dnsSvc.LookupCNAME(ctx, "www.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com.", cname)
+
+	resMXs, err := dnsSvc.LookupMX(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, mxs, resMXs)
+
+	txts, err := dnsSvc.LookupTXT(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"v=spf1 -all"}, txts)
+
+	cname, resSRVs, err := dnsSvc.LookupSRV(ctx, "xmpp", "tcp", "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "_xmpp._tcp.example.com.", cname)
+	assert.Equal(t, srvs, resSRVs)
+
+	names, err := dnsSvc.LookupAddr(ctx, "192.168.1.1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"example.com."}, names)
+
+	// Record types are independent of each other.
+	_, err = dnsSvc.LookupIP("example.com")
+	assert.NotNil(t, err)
+
+	_, err = dnsSvc.LookupCNAME(ctx, "example.com")
+	assert.NotNil(t, err)
+
+	_, _, err = dnsSvc.LookupSRV(ctx, "xmpp", "udp", "example.com")
+	assert.NotNil(t, err)
+
+	// Generic setter, clearing.
+	testErr := &net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}
+	dnsSvc.SetResult(DnsRecordTXT, "example.com", DnsMockResult{Err: testErr})
+
+	_, err = dnsSvc.LookupTXT(ctx, "example.com")
+	assert.Equal(t, testErr, err)
+
+	dnsSvc.ClearResult(DnsRecordMX, "example.com")
+	_, err = dnsSvc.LookupMX(ctx, "example.com")
+	assert.NotNil(t, err)
+
+	dnsSvc.SetLookupIpResult("example.com", []net.IP{net.ParseIP("192.168.1.1")}, nil)
+	dnsSvc.ClearAllLookupIpResults()
+
+	_, err = dnsSvc.LookupIP("example.com")
+	assert.NotNil(t, err)
+
+	addrs, err = dnsSvc.LookupHost(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, addrs)
+
+	dnsSvc.ClearAllResults()
+
+	_, err = dnsSvc.LookupHost(ctx, "example.com")
+	assert.NotNil(t, err)
+}
+
+func TestDnsSvcMockContextCancel(t *testing.T) {
+	timeSvc := NewTimeSvcMock()
+	dnsSvc := NewDnsSvcMock(timeSvc)
+
+	dnsSvc.SetResult(DnsRecordTXT, "slow.com", DnsMockResult{TXTs: []string{"x"}, Duration: time.Second})
+
+	// Already cancelled context fails right away.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := dnsSvc.LookupTXT(ctx, "slow.com")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, timeSvc.SleeperCount())
+
+	// Cancelling while sleeping returns early without advancing mock time.
+	ctx, cancel = context.WithCancel(context.Background())
+
+	var resultErr error
+	done := make(chan bool)
+
+	go func() {
+		_, resultErr = dnsSvc.LookupTXT(ctx, "slow.com")
+		done <- true
+	}()
+
+	timeSvc.WaitForSleepers(1)
+	cancel()
+	<-done
+
+	var dnsErr *net.DNSError
+	assert.ErrorAs(t, resultErr, &dnsErr)
+	assert.ErrorIs(t, resultErr, context.Canceled)
+	assert.Equal(t, "slow.com", dnsErr.Name)
+	assert.False(t, dnsErr.IsTimeout)
+	assert.Equal(t, time.Time{}, timeSvc.Now())
+
+	// Deadline errors are reported as timeouts.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+
+	_, err = dnsSvc.LookupTXT(ctx, "slow.com")
+	assert.ErrorAs(t, err, &dnsErr)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, dnsErr.IsTimeout)
+}
+
+func TestDnsSvcMockSequence(t *testing.T) {
+	dnsSvc := NewDnsSvcMock(NewTimeSvcMock())
+
+	ip := net.ParseIP("10.0.0.1")
+	failure := &net.DNSError{Err: "server misbehaving", Name: "flaky.com", IsTemporary: true}
+	dnsSvc.SetResultSequence(DnsRecordIP, "flaky.com",
+		DnsMockResult{Err: failure},
+		DnsMockResult{Err: failure},
+		DnsMockResult{IPs: []net.IP{ip}})
+
+	// Fails twice, then succeeds forever.
+	for range 2 {
+		_, err := dnsSvc.LookupIP("flaky.com")
+		assert.Equal(t, failure, err)
+	}
+	for range 2 {
+		ips, err := dnsSvc.LookupIP("flaky.com")
+		assert.Nil(t, err)
+		assert.Equal(t, []net.IP{ip}, ips)
+	}
+
+	// Cancelled lookups do not consume results.
+	dnsSvc.SetResultSequence(DnsRecordIP, "flaky.com", DnsMockResult{Err: failure}, DnsMockResult{IPs: []net.IP{ip}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := dnsSvc.LookupIPContext(ctx, "flaky.com")
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = dnsSvc.LookupIP("flaky.com")
+	assert.Equal(t, failure, err)
+
+	assert.Equal(t, "no DNS mock results given", testutils.CapturePanicValue(func() {
+		dnsSvc.SetResultSequence(DnsRecordIP, "flaky.com")
+	}))
+}
+
+func TestDnsSvcMockCycle(t *testing.T) {
+	dnsSvc := NewDnsSvcMock(NewTimeSvcMock())
+
+	dnsSvc.SetResultCycle(DnsRecordHost, "rr.com",
+		DnsMockResult{Addrs: []string{"10.0.0.1"}},
+		DnsMockResult{Addrs: []string{"10.0.0.2"}},
+		DnsMockResult{Addrs: []string{"10.0.0.3"}})
+
+	var addrs []string
+	for range 7 {
+		result, err := dnsSvc.LookupHost(context.Background(), "rr.com")
+		assert.Nil(t, err)
+		addrs = append(addrs, result...)
+	}
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.1"}, addrs)
+}
+
+func TestDnsSvcMockWildcard(t *testing.T) {
+	dnsSvc := NewDnsSvcMock(NewTimeSvcMock())
+
+	dnsSvc.SetLookupHostResult("*.svc.local", []string{"10.0.0.1"}, nil)
+	dnsSvc.SetLookupHostResult("*.db.svc.local", []string{"10.0.0.2"}, nil)
+	dnsSvc.SetLookupHostResult("primary.db.svc.local", []string{"10.0.0.3"}, nil)
+
+	for name, expected := range map[string][]string{
+		"api.svc.local":          {"10.0.0.1"},
+		"a.b.api.svc.local":      {"10.0.0.1"},
+		"db.svc.local":           {"10.0.0.1"},
+		"replica.db.svc.local":   {"10.0.0.2"},
+		"x.replica.db.svc.local": {"10.0.0.2"},
+		"primary.db.svc.local":   {"10.0.0.3"},
+	} {
+		addrs, err := dnsSvc.LookupHost(context.Background(), name)
+		assert.Nil(t, err, name)
+		assert.Equal(t, expected, addrs, name)
+	}
+
+	for _, name := range []string{"svc.local", "local", "svc.local.com", ""} {
+		_, err := dnsSvc.LookupHost(context.Background(), name)
+		assert.ErrorContains(t, err, "no such host", name)
+	}
+
+	// Wildcards are per record type.
+	_, err := dnsSvc.LookupIP("api.svc.local")
+	assert.ErrorContains(t, err, "no such host")
+}
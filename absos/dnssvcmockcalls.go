@@ -0,0 +1,101 @@
+package absos
+
+import (
+	"slices"
+	"time"
+)
+
+// DnsMockCall is a logged lookup of DnsSvcMockImpl.
+type DnsMockCall struct {
+	Type DnsRecordType
+	Name string    // Looked up name; for DnsRecordSRV the one returned by DnsSrvName().
+	Time time.Time // Mock time the lookup started at.
+}
+
+// DnsMockTestingT is the subset of testing.T used by the DnsSvcMockImpl.Assert*() helpers.
+// Same as testify's assert.TestingT, so the helpers work with anything testify works with.
+type DnsMockTestingT interface {
+	Errorf(format string, args ...any)
+}
+
+// Calls returns all logged lookups in order.
+func (svc *DnsSvcMockImpl) Calls() []DnsMockCall {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	return slices.Clone(svc.calls)
+}
+
+// CallCount returns how many times the record type and name (exact, not a wildcard) was looked up.
+func (svc *DnsSvcMockImpl) CallCount(recordType DnsRecordType, name string) int {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	count := 0
+	for _, call := range svc.calls {
+		if call.Type == recordType && call.Name == name {
+			count++
+		}
+	}
+	return count
+}
+
+// CallCounts returns lookup counts of all looked up names of the record type.
+func (svc *DnsSvcMockImpl) CallCounts(recordType DnsRecordType) map[string]int {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, call := range svc.calls {
+		if call.Type == recordType {
+			counts[call.Name]++
+		}
+	}
+	return counts
+}
+
+// ClearCalls clears the lookup log.
+func (svc *DnsSvcMockImpl) ClearCalls() {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.calls = nil
+}
+
+// AssertLookedUp asserts that the record type and name was looked up at least once.
+// Returns whether the assertion succeeded.
+func (svc *DnsSvcMockImpl) AssertLookedUp(t DnsMockTestingT, recordType DnsRecordType, name string) bool {
+	markHelper(t)
+	if svc.CallCount(recordType, name) == 0 {
+		t.Errorf("expected %s lookup of %q, got none; lookups: %v", recordType, name, svc.Calls())
+		return false
+	}
+	return true
+}
+
+// AssertNotLookedUp asserts that the record type and name was never looked up.
+// Returns whether the assertion succeeded.
+func (svc *DnsSvcMockImpl) AssertNotLookedUp(t DnsMockTestingT, recordType DnsRecordType, name string) bool {
+	markHelper(t)
+	if count := svc.CallCount(recordType, name); count != 0 {
+		t.Errorf("expected no %s lookup of %q, got %d", recordType, name, count)
+		return false
+	}
+	return true
+}
+
+// AssertLookupCount asserts that the record type and name was looked up exactly count times.
+// Returns whether the assertion succeeded.
+func (svc *DnsSvcMockImpl) AssertLookupCount(t DnsMockTestingT, recordType DnsRecordType, name string, count int) bool {
+	markHelper(t)
+	if actual := svc.CallCount(recordType, name); actual != count {
+		t.Errorf("expected %d %s lookup(s) of %q, got %d", count, recordType, name, actual)
+		return false
+	}
+	return true
+}
+
+// markHelper calls t.Helper() if t has it (like testing.T does).
+func markHelper(t DnsMockTestingT) {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+}
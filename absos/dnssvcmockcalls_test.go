@@ -0,0 +1,69 @@
+package absos
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingT is a DnsMockTestingT collecting the reported errors.
+type recordingT struct {
+	errors []string
+}
+
+func (t *recordingT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestDnsSvcMockCalls(t *testing.T) {
+	timeSvc := NewTimeSvcMock()
+	dnsSvc := NewDnsSvcMock(timeSvc)
+	dnsSvc.SetLookupIpResult("*.example.com", nil, nil)
+
+	_, _ = dnsSvc.LookupIP("a.example.com")
+	timeSvc.Add(time.Second)
+	_, _ = dnsSvc.LookupIP("b.example.com")
+	_, _ = dnsSvc.LookupIP("a.example.com")
+	_, _, _ = dnsSvc.LookupSRV(context.Background(), "sip", "udp", "example.com")
+
+	assert.Equal(t, []DnsMockCall{
+		{Type: DnsRecordIP, Name: "a.example.com", Time: time.Time{}},
+		{Type: DnsRecordIP, Name: "b.example.com", Time: time.Time{}.Add(time.Second)},
+		{Type: DnsRecordIP, Name: "a.example.com", Time: time.Time{}.Add(time.Second)},
+		{Type: DnsRecordSRV, Name: "_sip._udp.example.com", Time: time.Time{}.Add(time.Second)},
+	}, dnsSvc.Calls())
+
+	assert.Equal(t, 2, dnsSvc.CallCount(DnsRecordIP, "a.example.com"))
+	assert.Equal(t, 0, dnsSvc.CallCount(DnsRecordHost, "a.example.com"))
+	assert.Equal(t, 0, dnsSvc.CallCount(DnsRecordIP, "*.example.com"))
+	assert.Equal(t, map[string]int{"a.example.com": 2, "b.example.com": 1}, dnsSvc.CallCounts(DnsRecordIP))
+
+	dnsSvc.ClearCalls()
+	assert.Empty(t, dnsSvc.Calls())
+	assert.Empty(t, dnsSvc.CallCounts(DnsRecordIP))
+}
+
+func TestDnsSvcMockAssertions(t *testing.T) {
+	dnsSvc := NewDnsSvcMock(NewTimeSvcMock())
+	_, _ = dnsSvc.LookupIP("example.com")
+	_, _ = dnsSvc.LookupIP("example.com")
+
+	// Passing.
+	assert.True(t, dnsSvc.AssertLookedUp(t, DnsRecordIP, "example.com"))
+	assert.True(t, dnsSvc.AssertNotLookedUp(t, DnsRecordMX, "example.com"))
+	assert.True(t, dnsSvc.AssertLookupCount(t, DnsRecordIP, "example.com", 2))
+
+	// Failing.
+	rt := &recordingT{}
+	assert.False(t, dnsSvc.AssertLookedUp(rt, DnsRecordMX, "example.com"))
+	assert.False(t, dnsSvc.AssertNotLookedUp(rt, DnsRecordIP, "example.com"))
+	assert.False(t, dnsSvc.AssertLookupCount(rt, DnsRecordIP, "example.com", 3))
+	assert.Equal(t, []string{
+		`expected MX lookup of "example.com", got none; lookups: [{IP example.com 0001-01-01 00:00:00 +0000 UTC} {IP example.com 0001-01-01 00:00:00 +0000 UTC}]`,
+		`expected no IP lookup of "example.com", got 2`,
+		`expected 3 IP lookup(s) of "example.com", got 2`,
+	}, rt.errors)
+}
@@ -0,0 +1,169 @@
+package absos
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// DnsSvcRecorder is a DnsSvc decorator recording answers (results, errors and latency) of the
+// wrapped DnsSvc into a DnsFixture, to be replayed by DnsSvcMockImpl.LoadFixture() later.
+//
+// Only the latest answer per record type and name is kept. Lookups interrupted by their own
+// context (cancelled or timed out by the caller) are not answers, so they are not recorded.
+type DnsSvcRecorder struct {
+	inner   DnsSvc
+	timeSvc TimeSvc
+
+	mu      sync.Mutex
+	records []DnsFixtureRecord
+	index   map[dnsMockKey]int // Index of records.
+}
+
+var _ DnsSvc = (*DnsSvcRecorder)(nil)
+
+// NewDnsSvcRecorder creates a recorder wrapping inner; the latency is measured using timeSvc.
+func NewDnsSvcRecorder(inner DnsSvc, timeSvc TimeSvc) *DnsSvcRecorder {
+	return &DnsSvcRecorder{
+		inner:   inner,
+		timeSvc: timeSvc,
+		index:   make(map[dnsMockKey]int),
+	}
+}
+
+// record runs the lookup and records its outcome.
+func (rec *DnsSvcRecorder) record(ctx context.Context, recordType DnsRecordType, name string, lookup func() (DnsMockResult, error)) (DnsMockResult, error) {
+	start := rec.timeSvc.Now()
+	result, err := lookup()
+	result.Err = err
+	result.Duration = rec.timeSvc.Now().Sub(start)
+
+	if err != nil && ctx.Err() != nil {
+		return result, err
+	}
+
+	record := newDnsFixtureRecord(recordType, name, result)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	key := dnsMockKey{recordType, name}
+	if i, exists := rec.index[key]; exists {
+		rec.records[i] = record
+	} else {
+		rec.index[key] = len(rec.records)
+		rec.records = append(rec.records, record)
+	}
+
+	return result, err
+}
+
+func (rec *DnsSvcRecorder) LookupIP(host string) ([]net.IP, error) {
+	return rec.LookupIPContext(context.Background(), host)
+}
+
+func (rec *DnsSvcRecorder) LookupIPContext(ctx context.Context, host string) ([]net.IP, error) {
+	result, err := rec.record(ctx, DnsRecordIP, host, func() (r DnsMockResult, err error) {
+		r.IPs, err = rec.inner.LookupIPContext(ctx, host)
+		return
+	})
+	return result.IPs, err
+}
+
+func (rec *DnsSvcRecorder) LookupHost(ctx context.Context, host string) ([]string, error) {
+	result, err := rec.record(ctx, DnsRecordHost, host, func() (r DnsMockResult, err error) {
+		r.Addrs, err = rec.inner.LookupHost(ctx, host)
+		return
+	})
+	return result.Addrs, err
+}
+
+func (rec *DnsSvcRecorder) LookupCNAME(ctx context.Context, host string) (string, error) {
+	result, err := rec.record(ctx, DnsRecordCNAME, host, func() (r DnsMockResult, err error) {
+		r.CNAME, err = rec.inner.LookupCNAME(ctx, host)
+		return
+	})
+	return result.CNAME, err
+}
+
+func (rec *DnsSvcRecorder) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	result, err := rec.record(ctx, DnsRecordMX, name, func() (r DnsMockResult, err error) {
+		r.MXs, err = rec.inner.LookupMX(ctx, name)
+		return
+	})
+	return result.MXs, err
+}
+
+func (rec *DnsSvcRecorder) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	result, err := rec.record(ctx, DnsRecordTXT, name, func() (r DnsMockResult, err error) {
+		r.TXTs, err = rec.inner.LookupTXT(ctx, name)
+		return
+	})
+	return result.TXTs, err
+}
+
+func (rec *DnsSvcRecorder) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	result, err := rec.record(ctx, DnsRecordSRV, DnsSrvName(service, proto, name), func() (r DnsMockResult, err error) {
+		r.CNAME, r.SRVs, err = rec.inner.LookupSRV(ctx, service, proto, name)
+		return
+	})
+	return result.CNAME, result.SRVs, err
+}
+
+func (rec *DnsSvcRecorder) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	result, err := rec.record(ctx, DnsRecordAddr, addr, func() (r DnsMockResult, err error) {
+		r.Names, err = rec.inner.LookupAddr(ctx, addr)
+		return
+	})
+	return result.Names, err
+}
+
+// Fixture returns the answers recorded so far, in order of their first lookup.
+func (rec *DnsSvcRecorder) Fixture() DnsFixture {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return DnsFixture{Records: slices.Clone(rec.records)}
+}
+
+// WriteFixture writes the answers recorded so far as (indented) JSON.
+func (rec *DnsSvcRecorder) WriteFixture(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return errors.Wrap(encoder.Encode(rec.Fixture()), "could not write DNS fixture")
+}
+
+// WriteFixtureYaml is WriteFixture() writing YAML.
+func (rec *DnsSvcRecorder) WriteFixtureYaml(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(rec.Fixture()); err != nil {
+		return errors.Wrap(err, "could not write DNS fixture")
+	}
+	return errors.Wrap(encoder.Close(), "could not write DNS fixture")
+}
+
+// SaveFixture writes the answers recorded so far to the given file (see WriteFixture()), as YAML
+// for .yaml/.yml files (see WriteFixtureYaml()).
+func (rec *DnsSvcRecorder) SaveFixture(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "could not create file")
+	}
+
+	write := rec.WriteFixture
+	if isYamlFixture(path) {
+		write = rec.WriteFixtureYaml
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return errors.Wrap(f.Close(), "could not close file")
+}
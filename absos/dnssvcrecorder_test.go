@@ -0,0 +1,124 @@
+package absos
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDnsSvcRecorder(t *testing.T) {
+	timeSvc := NewTimeSvcMock()
+	inner := NewDnsSvcMock(timeSvc)
+	inner.SetLookupIpResultWithDuration("example.com", []net.IP{net.ParseIP("10.0.0.1")}, nil, 0)
+	inner.SetLookupCNAMEResult("www.example.com", "example.com.", nil)
+	inner.SetLookupSRVResult("sip", "udp", "example.com", "sip.example.com.", []*net.SRV{{Target: "a.example.com.", Port: 5060}}, nil)
+
+	rec := NewDnsSvcRecorder(inner, timeSvc)
+
+	ips, err := rec.LookupIP("example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []net.IP{net.ParseIP("10.0.0.1")}, ips)
+
+	_, err = rec.LookupHost(context.Background(), "nope.example.com")
+	assert.ErrorContains(t, err, "no such host")
+
+	cname, err := rec.LookupCNAME(context.Background(), "www.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com.", cname)
+
+	_, _, err = rec.LookupSRV(context.Background(), "sip", "udp", "example.com")
+	assert.Nil(t, err)
+
+	// Latency is recorded, the latest answer wins.
+	inner.SetLookupIpResultWithDuration("example.com", []net.IP{net.ParseIP("10.0.0.2")}, nil, 5*time.Millisecond)
+	done := make(chan bool)
+	go func() {
+		_, _ = rec.LookupIP("example.com")
+		done <- true
+	}()
+	timeSvc.WaitForSleepers(1)
+	timeSvc.Add(5 * time.Millisecond)
+	<-done
+
+	// Lookups cancelled by the caller are not recorded.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = rec.LookupTXT(ctx, "example.com")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	assert.Equal(t, DnsFixture{Records: []DnsFixtureRecord{
+		{Type: DnsRecordIP, Name: "example.com", IPs: []string{"10.0.0.2"}, Duration: "5ms"},
+		{Type: DnsRecordHost, Name: "nope.example.com", Error: &DnsFixtureError{Err: "no such host", Server: "mock", IsNotFound: true}},
+		{Type: DnsRecordCNAME, Name: "www.example.com", CNAME: "example.com."},
+		{Type: DnsRecordSRV, Name: "_sip._udp.example.com", CNAME: "sip.example.com.", SRVs: []DnsFixtureSRV{{Target: "a.example.com.", Port: 5060}}},
+	}}, rec.Fixture())
+
+	// Round trip.
+	path := filepath.Join(t.TempDir(), "dns.json")
+	assert.Nil(t, rec.SaveFixture(path))
+
+	replayTimeSvc := NewTimeSvcMock()
+	replay := NewDnsSvcMock(replayTimeSvc)
+	assert.Nil(t, replay.LoadFixtureFile(path))
+
+	go func() {
+		ips, err := replay.LookupIP("example.com")
+		assert.Nil(t, err)
+		assert.Len(t, ips, 1)
+		assert.True(t, ips[0].Equal(net.IPv4(10, 0, 0, 2)))
+		done <- true
+	}()
+	replayTimeSvc.WaitForSleepers(1)
+	replayTimeSvc.Add(5 * time.Millisecond)
+	<-done
+
+	_, err = replay.LookupHost(context.Background(), "nope.example.com")
+	assert.Equal(t, &net.DNSError{Err: "no such host", Name: "nope.example.com", Server: "mock", IsNotFound: true}, err)
+
+	cname, err = replay.LookupCNAME(context.Background(), "www.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com.", cname)
+
+	_, srvs, err := replay.LookupSRV(context.Background(), "sip", "udp", "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []*net.SRV{{Target: "a.example.com.", Port: 5060}}, srvs)
+
+	// Written as indented JSON.
+	var buf bytes.Buffer
+	assert.Nil(t, rec.WriteFixture(&buf))
+	assert.Contains(t, buf.String(), "{\n  \"records\": [\n    {\n      \"type\": \"IP\",")
+
+	// YAML round trip.
+	buf.Reset()
+	assert.Nil(t, rec.WriteFixtureYaml(&buf))
+	assert.Contains(t, buf.String(), "records:\n  - type: IP\n    name: example.com\n")
+
+	path = filepath.Join(t.TempDir(), "dns.yaml")
+	assert.Nil(t, rec.SaveFixture(path))
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, buf.String(), string(data))
+
+	replay = NewDnsSvcMock(NewTimeSvcMock())
+	assert.Nil(t, replay.LoadFixtureFile(path))
+	cname, err = replay.LookupCNAME(context.Background(), "www.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com.", cname)
+}
+
+func TestDnsSvcRecorderNonDnsError(t *testing.T) {
+	inner := NewDnsSvcMock(NewTimeSvcMock())
+	inner.SetLookupIpResult("example.com", nil, net.UnknownNetworkError("boom"))
+
+	rec := NewDnsSvcRecorder(inner, NewTimeSvcMock())
+	_, err := rec.LookupIP("example.com")
+	assert.Equal(t, net.UnknownNetworkError("boom"), err)
+
+	assert.Equal(t, &DnsFixtureError{Err: "unknown network boom"}, rec.Fixture().Records[0].Error)
+}
@@ -0,0 +1,138 @@
+package absos
+
+import (
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kattecon/akgoli/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ErrEnvMissing is returned (wrapped, with the variable name) by EnvSvc.Required() if the variable is not set or empty.
+	ErrEnvMissing = utils.ConstError("required environment variable is not set")
+
+	// ErrEnvInvalid is returned (wrapped, with the variable name, value and reason) by the typed getters
+	// (EnvSvc.Int(), Duration(), Bool()) if the value can't be parsed.
+	ErrEnvInvalid = utils.ConstError("invalid environment variable value")
+)
+
+// EnvSvc wraps the environment and process info functions of the os pkg.
+//
+// Method semantics follow the ones of the os pkg functions of the same names, besides the typed getters.
+type EnvSvc interface {
+	Getenv(key string) string
+	LookupEnv(key string) (string, bool)
+
+	// Required returns the value of the variable; an error wrapping ErrEnvMissing if it's not set or empty.
+	Required(key string) (string, error)
+
+	// Int returns the value of the variable parsed as a (base 10) int, def if it's not set or empty.
+	// Returns an error wrapping ErrEnvInvalid if the value is not an int.
+	Int(key string, def int) (int, error)
+
+	// Duration returns the value of the variable parsed by time.ParseDuration(), def if it's not set or empty.
+	// Returns an error wrapping ErrEnvInvalid if the value is not a duration.
+	Duration(key string, def time.Duration) (time.Duration, error)
+
+	// Bool returns the value of the variable parsed as a bool, def if it's not set or empty.
+	//
+	// Accepts values of strconv.ParseBool() as well as "yes", "no", "on" and "off" (case-insensitive).
+	// Returns an error wrapping ErrEnvInvalid for anything else.
+	Bool(key string, def bool) (bool, error)
+
+	// Environ returns the environment as "key=value" strings.
+	Environ() []string
+
+	Hostname() (string, error)
+	Getpid() int
+
+	// Args returns the command-line arguments, starting with the program name (os.Args).
+	Args() []string
+}
+
+type envSvcImpl struct{}
+
+var envSvcImplInstance = envSvcImpl{}
+
+// NewEnvSvc returns EnvSvc backed by the real process environment.
+func NewEnvSvc() EnvSvc {
+	return envSvcImplInstance
+}
+
+func (envSvcImpl) Getenv(key string) string {
+	return os.Getenv(key)
+}
+
+func (envSvcImpl) LookupEnv(key string) (string, bool) {
+	return os.LookupEnv(key)
+}
+
+func (envSvcImpl) Environ() []string {
+	return os.Environ()
+}
+
+func (envSvcImpl) Hostname() (string, error) {
+	return os.Hostname()
+}
+
+func (envSvcImpl) Getpid() int {
+	return os.Getpid()
+}
+
+func (envSvcImpl) Args() []string {
+	return slices.Clone(os.Args)
+}
+
+func (svc envSvcImpl) Required(key string) (string, error) {
+	return envRequired(svc, key)
+}
+
+func (svc envSvcImpl) Int(key string, def int) (int, error) {
+	return envParse(svc, key, def, strconv.Atoi)
+}
+
+func (svc envSvcImpl) Duration(key string, def time.Duration) (time.Duration, error) {
+	return envParse(svc, key, def, time.ParseDuration)
+}
+
+func (svc envSvcImpl) Bool(key string, def bool) (bool, error) {
+	return envParse(svc, key, def, parseEnvBool)
+}
+
+// envRequired implements EnvSvc.Required() on top of Getenv().
+func envRequired(env EnvSvc, key string) (string, error) {
+	value := env.Getenv(key)
+	if value == "" {
+		return "", errors.Wrap(ErrEnvMissing, key)
+	}
+	return value, nil
+}
+
+func parseEnvBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "on":
+		return true, nil
+	case "no", "off":
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// envParse implements the typed getters of EnvSvc on top of Getenv(): returns the value of the
+// variable parsed by parse, def if it's not set or empty.
+func envParse[T any](env EnvSvc, key string, def T, parse func(string) (T, error)) (T, error) {
+	value := env.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+
+	parsed, err := parse(value)
+	if err != nil {
+		return def, errors.Wrapf(ErrEnvInvalid, "%s=%q (%v)", key, value, err)
+	}
+	return parsed, nil
+}
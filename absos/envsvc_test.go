@@ -0,0 +1,114 @@
+package absos
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvSvc(t *testing.T) {
+	svc := NewEnvSvc()
+	assert.Equal(t, svc, NewEnvSvc())
+
+	t.Setenv("AKGOLI_ENV_TEST", "value")
+	assert.Equal(t, "value", svc.Getenv("AKGOLI_ENV_TEST"))
+	assert.Contains(t, svc.Environ(), "AKGOLI_ENV_TEST=value")
+
+	_, ok := svc.LookupEnv("AKGOLI_ENV_TEST_MISSING")
+	assert.False(t, ok)
+
+	t.Setenv("AKGOLI_ENV_TEST_INT", "42")
+	n, err := svc.Int("AKGOLI_ENV_TEST_INT", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 42, n)
+
+	hostname, err := os.Hostname()
+	assert.Nil(t, err)
+	actual, err := svc.Hostname()
+	assert.Nil(t, err)
+	assert.Equal(t, hostname, actual)
+
+	assert.Equal(t, os.Getpid(), svc.Getpid())
+
+	// Returns a copy.
+	args := svc.Args()
+	assert.Equal(t, os.Args, args)
+	args[0] = "changed"
+	assert.NotEqual(t, "changed", os.Args[0])
+}
+
+func TestEnvRequired(t *testing.T) {
+	env := NewEnvSvcMock(map[string]string{"SET": "value", "EMPTY": ""})
+
+	value, err := env.Required("SET")
+	assert.Nil(t, err)
+	assert.Equal(t, "value", value)
+
+	for _, key := range []string{"EMPTY", "MISSING"} {
+		_, err = env.Required(key)
+		assert.ErrorIs(t, err, ErrEnvMissing)
+		assert.EqualError(t, err, key+": required environment variable is not set")
+	}
+}
+
+func TestEnvInt(t *testing.T) {
+	env := NewEnvSvcMock(map[string]string{"PORT": "8080", "BAD": "80x", "EMPTY": ""})
+
+	value, err := env.Int("PORT", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 8080, value)
+
+	value, err = env.Int("MISSING", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, value)
+
+	value, err = env.Int("EMPTY", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, value)
+
+	value, err = env.Int("BAD", 1)
+	assert.ErrorIs(t, err, ErrEnvInvalid)
+	assert.EqualError(t, err, `BAD="80x" (strconv.Atoi: parsing "80x": invalid syntax): invalid environment variable value`)
+	assert.Equal(t, 1, value)
+}
+
+func TestEnvDuration(t *testing.T) {
+	env := NewEnvSvcMock(map[string]string{"TIMEOUT": "1m30s", "BAD": "10"})
+
+	value, err := env.Duration("TIMEOUT", time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, 90*time.Second, value)
+
+	value, err = env.Duration("MISSING", time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Second, value)
+
+	_, err = env.Duration("BAD", time.Second)
+	assert.ErrorIs(t, err, ErrEnvInvalid)
+	assert.ErrorContains(t, err, `BAD="10"`)
+}
+
+func TestEnvBool(t *testing.T) {
+	env := NewEnvSvcMock(nil)
+
+	for value, expected := range map[string]bool{
+		"1": true, "true": true, "TRUE": true, "yes": true, "On": true,
+		"0": false, "false": false, "F": false, "no": false, "OFF": false,
+	} {
+		env.Setenv("DEBUG", value)
+		actual, err := env.Bool("DEBUG", !expected)
+		assert.Nil(t, err, value)
+		assert.Equal(t, expected, actual, value)
+	}
+
+	env.Setenv("DEBUG", "maybe")
+	_, err := env.Bool("DEBUG", false)
+	assert.ErrorIs(t, err, ErrEnvInvalid)
+
+	env.Unsetenv("DEBUG")
+	value, err := env.Bool("DEBUG", true)
+	assert.Nil(t, err)
+	assert.True(t, value)
+}
@@ -0,0 +1,131 @@
+package absos
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// EnvSvcMockImpl provides a map-backed mock implementation of EnvSvc for testing purposes.
+//
+// Starts with an empty environment, hostname "mock-host", pid 1000 and args ["mock"].
+type EnvSvcMockImpl struct {
+	mu          sync.RWMutex
+	vars        map[string]string
+	hostname    string
+	hostnameErr error
+	pid         int
+	args        []string
+}
+
+var _ EnvSvc = (*EnvSvcMockImpl)(nil)
+
+// NewEnvSvcMock creates a new EnvSvcMockImpl instance with the given variables (may be nil).
+func NewEnvSvcMock(vars map[string]string) *EnvSvcMockImpl {
+	svc := &EnvSvcMockImpl{
+		vars:     make(map[string]string, len(vars)),
+		hostname: "mock-host",
+		pid:      1000,
+		args:     []string{"mock"},
+	}
+	maps.Copy(svc.vars, vars)
+	return svc
+}
+
+func (svc *EnvSvcMockImpl) Getenv(key string) string {
+	value, _ := svc.LookupEnv(key)
+	return value
+}
+
+func (svc *EnvSvcMockImpl) LookupEnv(key string) (string, bool) {
+	svc.mu.RLock()
+	defer svc.mu.RUnlock()
+	value, ok := svc.vars[key]
+	return value, ok
+}
+
+func (svc *EnvSvcMockImpl) Required(key string) (string, error) {
+	return envRequired(svc, key)
+}
+
+func (svc *EnvSvcMockImpl) Int(key string, def int) (int, error) {
+	return envParse(svc, key, def, strconv.Atoi)
+}
+
+func (svc *EnvSvcMockImpl) Duration(key string, def time.Duration) (time.Duration, error) {
+	return envParse(svc, key, def, time.ParseDuration)
+}
+
+func (svc *EnvSvcMockImpl) Bool(key string, def bool) (bool, error) {
+	return envParse(svc, key, def, parseEnvBool)
+}
+
+// Environ returns the variables as "key=value" strings sorted by key.
+func (svc *EnvSvcMockImpl) Environ() []string {
+	svc.mu.RLock()
+	defer svc.mu.RUnlock()
+
+	environ := make([]string, 0, len(svc.vars))
+	for _, key := range slices.Sorted(maps.Keys(svc.vars)) {
+		environ = append(environ, key+"="+svc.vars[key])
+	}
+	return environ
+}
+
+func (svc *EnvSvcMockImpl) Hostname() (string, error) {
+	svc.mu.RLock()
+	defer svc.mu.RUnlock()
+	if svc.hostnameErr != nil {
+		return "", svc.hostnameErr
+	}
+	return svc.hostname, nil
+}
+
+func (svc *EnvSvcMockImpl) Getpid() int {
+	svc.mu.RLock()
+	defer svc.mu.RUnlock()
+	return svc.pid
+}
+
+func (svc *EnvSvcMockImpl) Args() []string {
+	svc.mu.RLock()
+	defer svc.mu.RUnlock()
+	return slices.Clone(svc.args)
+}
+
+// Setenv sets the variable.
+func (svc *EnvSvcMockImpl) Setenv(key, value string) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.vars[key] = value
+}
+
+// Unsetenv removes the variable.
+func (svc *EnvSvcMockImpl) Unsetenv(key string) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	delete(svc.vars, key)
+}
+
+// SetHostname sets the result of Hostname().
+func (svc *EnvSvcMockImpl) SetHostname(hostname string, err error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.hostname, svc.hostnameErr = hostname, err
+}
+
+// SetPid sets the result of Getpid().
+func (svc *EnvSvcMockImpl) SetPid(pid int) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.pid = pid
+}
+
+// SetArgs sets the result of Args(), args[0] being the program name.
+func (svc *EnvSvcMockImpl) SetArgs(args ...string) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.args = slices.Clone(args)
+}
@@ -0,0 +1,60 @@
+package absos
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvSvcMock(t *testing.T) {
+	vars := map[string]string{"B": "2", "A": "1"}
+	svc := NewEnvSvcMock(vars)
+
+	// The given map is copied.
+	vars["C"] = "3"
+	_, ok := svc.LookupEnv("C")
+	assert.False(t, ok)
+
+	assert.Equal(t, "1", svc.Getenv("A"))
+	assert.Equal(t, "", svc.Getenv("C"))
+	assert.Equal(t, []string{"A=1", "B=2"}, svc.Environ())
+
+	svc.Setenv("C", "")
+	value, ok := svc.LookupEnv("C")
+	assert.True(t, ok)
+	assert.Equal(t, "", value)
+
+	svc.Unsetenv("A")
+	assert.Equal(t, []string{"B=2", "C="}, svc.Environ())
+}
+
+func TestEnvSvcMockProcessInfo(t *testing.T) {
+	svc := NewEnvSvcMock(nil)
+	assert.Empty(t, svc.Environ())
+
+	hostname, err := svc.Hostname()
+	assert.Nil(t, err)
+	assert.Equal(t, "mock-host", hostname)
+	assert.Equal(t, 1000, svc.Getpid())
+	assert.Equal(t, []string{"mock"}, svc.Args())
+
+	hostnameErr := errors.New("no hostname")
+	svc.SetHostname("", hostnameErr)
+	_, err = svc.Hostname()
+	assert.Equal(t, hostnameErr, err)
+
+	svc.SetHostname("web-1", nil)
+	hostname, err = svc.Hostname()
+	assert.Nil(t, err)
+	assert.Equal(t, "web-1", hostname)
+
+	svc.SetPid(42)
+	assert.Equal(t, 42, svc.Getpid())
+
+	svc.SetArgs("app", "-v")
+	args := svc.Args()
+	assert.Equal(t, []string{"app", "-v"}, args)
+	args[1] = "changed"
+	assert.Equal(t, []string{"app", "-v"}, svc.Args())
+}
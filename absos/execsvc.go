@@ -0,0 +1,163 @@
+package absos
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// execWaitDelay is how long Run() waits for output pipes to close after the process exited or
+// was killed (e.g. when it left children holding them), see exec.Cmd.WaitDelay.
+const execWaitDelay = time.Second
+
+// ExecCmd describes a command run by ExecSvc.
+type ExecCmd struct {
+	// Name is the program to run, looked up in PATH unless it contains a path separator.
+	Name string
+	Args []string
+
+	// Dir is the working directory; empty means the one of the calling process.
+	Dir string
+
+	// Env is the environment as "key=value" strings; nil means the one of the calling process.
+	Env []string
+
+	// Stdin is the standard input; nil means none (empty).
+	Stdin []byte
+
+	// Timeout kills the process once exceeded; 0 means no timeout (besides the one of ctx).
+	Timeout time.Duration
+}
+
+// String returns the command line, arguments are quoted when needed.
+func (cmd ExecCmd) String() string {
+	var sb strings.Builder
+	for i, arg := range append([]string{cmd.Name}, cmd.Args...) {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\") {
+			arg = strconv.Quote(arg)
+		}
+		sb.WriteString(arg)
+	}
+	return sb.String()
+}
+
+// ExecResult is the outcome of a command run by ExecSvc.
+type ExecResult struct {
+	Stdout []byte
+	Stderr []byte
+
+	// ExitCode is the exit code of the process, -1 if it was killed or did not start.
+	ExitCode int
+
+	Duration time.Duration
+}
+
+// ExecExitError is returned by ExecSvc.Run() when the command exits with a non-zero code.
+type ExecExitError struct {
+	Cmd      string // Command line, see ExecCmd.String().
+	ExitCode int
+	Stderr   []byte
+}
+
+// Error includes the last line of stderr, usually the most telling one.
+func (e *ExecExitError) Error() string {
+	msg := fmt.Sprintf("command %s exited with code %d", e.Cmd, e.ExitCode)
+
+	stderr := strings.TrimSpace(string(e.Stderr))
+	if i := strings.LastIndexByte(stderr, '\n'); i >= 0 {
+		stderr = strings.TrimSpace(stderr[i+1:])
+	}
+	if stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+// execKilledError returns the error of a command killed because ctx is done;
+// errors.Is() matches it with ctx.Err() (e.g. context.DeadlineExceeded).
+func execKilledError(ctx context.Context, cmd ExecCmd) error {
+	return errors.Wrapf(ctx.Err(), "command %s killed", cmd)
+}
+
+// ExecSvc wraps running of subprocesses by the os/exec pkg.
+type ExecSvc interface {
+	// Run runs the command and waits for it to finish, capturing its stdout and stderr.
+	//
+	// The process is killed once ctx is done or cmd.Timeout is exceeded, the returned error then
+	// matches ctx.Err() (context.DeadlineExceeded for cmd.Timeout) using errors.Is().
+	// A non-zero exit code results in *ExecExitError. The result (e.g. output written before
+	// the process failed) is returned on errors, too.
+	Run(ctx context.Context, cmd ExecCmd) (ExecResult, error)
+}
+
+type execSvcImpl struct{}
+
+var execSvcImplInstance = execSvcImpl{}
+
+// NewExecSvc returns ExecSvc running real processes.
+func NewExecSvc() ExecSvc {
+	return execSvcImplInstance
+}
+
+func (execSvcImpl) Run(ctx context.Context, cmd ExecCmd) (ExecResult, error) {
+	if cmd.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cmd.Timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	c := exec.CommandContext(ctx, cmd.Name, cmd.Args...)
+	c.Dir = cmd.Dir
+	c.Env = cmd.Env
+	if cmd.Stdin != nil {
+		c.Stdin = bytes.NewReader(cmd.Stdin)
+	}
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	c.WaitDelay = execWaitDelay
+
+	start := time.Now()
+	err := c.Run()
+
+	result := ExecResult{
+		Stdout:   stdout.Bytes(),
+		Stderr:   stderr.Bytes(),
+		ExitCode: -1,
+		Duration: time.Since(start),
+	}
+	if c.ProcessState != nil {
+		result.ExitCode = c.ProcessState.ExitCode()
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return result, nil
+	case ctx.Err() != nil:
+		return result, execKilledError(ctx, cmd)
+	case errors.As(err, &exitErr) && result.ExitCode > 0:
+		return result, &ExecExitError{Cmd: cmd.String(), ExitCode: result.ExitCode, Stderr: result.Stderr}
+	default:
+		return result, errors.Wrapf(err, "could not run %s", cmd)
+	}
+}
+
+// ExecOutput runs the command using svc, and returns its stdout trimmed of trailing whitespace
+// (handy for e.g. "git rev-parse HEAD"). See ExecSvc.Run() for errors.
+func ExecOutput(ctx context.Context, svc ExecSvc, name string, args ...string) (string, error) {
+	result, err := svc.Run(ctx, ExecCmd{Name: name, Args: args})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(result.Stdout), " \t\r\n"), nil
+}
@@ -0,0 +1,85 @@
+package absos
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecCmdString(t *testing.T) {
+	assert.Equal(t, "git status", ExecCmd{Name: "git", Args: []string{"status"}}.String())
+	assert.Equal(t, `sh -c "echo 'hi'" ""`, ExecCmd{Name: "sh", Args: []string{"-c", "echo 'hi'", ""}}.String())
+}
+
+func TestExecExitError(t *testing.T) {
+	err := &ExecExitError{Cmd: "git push", ExitCode: 128, Stderr: []byte("hint: something\nfatal: no remote\n")}
+	assert.EqualError(t, err, "command git push exited with code 128: fatal: no remote")
+
+	err = &ExecExitError{Cmd: "false", ExitCode: 1}
+	assert.EqualError(t, err, "command false exited with code 1")
+}
+
+func TestExecSvc(t *testing.T) {
+	svc := NewExecSvc()
+	assert.Equal(t, svc, NewExecSvc())
+	ctx := context.Background()
+
+	result, err := svc.Run(ctx, ExecCmd{Name: "sh", Args: []string{"-c", "echo out; echo err >&2"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "out\n", string(result.Stdout))
+	assert.Equal(t, "err\n", string(result.Stderr))
+	assert.Equal(t, 0, result.ExitCode)
+	assert.Greater(t, result.Duration, time.Duration(0))
+
+	// Stdin, env, dir.
+	dir := t.TempDir()
+	result, err = svc.Run(ctx, ExecCmd{
+		Name:  "sh",
+		Args:  []string{"-c", `cat; echo " $FOO"; pwd`},
+		Dir:   dir,
+		Env:   []string{"FOO=bar"},
+		Stdin: []byte("in"),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "in bar\n"+dir+"\n", string(result.Stdout))
+
+	// Exit code.
+	result, err = svc.Run(ctx, ExecCmd{Name: "sh", Args: []string{"-c", "echo partial; echo oops >&2; exit 3"}})
+	var exitErr *ExecExitError
+	assert.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 3, exitErr.ExitCode)
+	assert.EqualError(t, err, `command sh -c "echo partial; echo oops >&2; exit 3" exited with code 3: oops`)
+	assert.Equal(t, "partial\n", string(result.Stdout))
+	assert.Equal(t, 3, result.ExitCode)
+
+	// Not found.
+	_, err = svc.Run(ctx, ExecCmd{Name: "no-such-program-akgoli"})
+	assert.ErrorIs(t, err, exec.ErrNotFound)
+	assert.ErrorContains(t, err, "could not run no-such-program-akgoli")
+
+	output, err := ExecOutput(ctx, svc, "echo", "hello")
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", output)
+}
+
+func TestExecSvcKill(t *testing.T) {
+	svc := NewExecSvc()
+
+	start := time.Now()
+	result, err := svc.Run(context.Background(), ExecCmd{Name: "sleep", Args: []string{"10"}, Timeout: 50 * time.Millisecond})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualError(t, err, "command sleep 10 killed: context deadline exceeded")
+	assert.Equal(t, -1, result.ExitCode)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = svc.Run(ctx, ExecCmd{Name: "sleep", Args: []string{"10"}})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = svc.Run(ctx, ExecCmd{Name: "true"})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,198 @@
+package absos
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kattecon/akgoli/utils"
+	"github.com/pkg/errors"
+)
+
+// ErrExecMockNoResponse is returned (wrapped, with the command line) by ExecSvcMockImpl.Run() for
+// commands without a scripted response.
+const ErrExecMockNoResponse = utils.ConstError("no scripted response for command")
+
+// ExecMockResponse is a scripted response of ExecSvcMockImpl.
+type ExecMockResponse struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+
+	// Duration is how long the command runs, in TimeSvc time.
+	Duration time.Duration
+
+	// Err makes the command fail to start (e.g. exec.ErrNotFound); Run() returns it wrapped.
+	Err error
+}
+
+// ExecMockCall is a logged invocation of ExecSvcMockImpl.
+type ExecMockCall struct {
+	Cmd  ExecCmd
+	Time time.Time // Mock time the command started at.
+}
+
+type execMockRule struct {
+	pattern []string
+	respond func(cmd ExecCmd) ExecMockResponse
+}
+
+// matches tells whether the command line (name followed by args) matches the pattern.
+func (rule *execMockRule) matches(cmdLine []string) bool {
+	for i, word := range rule.pattern {
+		if word == "**" && i == len(rule.pattern)-1 {
+			return true
+		}
+		if i >= len(cmdLine) {
+			return false
+		}
+		if matched, _ := path.Match(word, cmdLine[i]); !matched {
+			return false
+		}
+	}
+	return len(cmdLine) == len(rule.pattern)
+}
+
+// ExecSvcMockImpl provides scripted command responses implementing ExecSvc for testing purposes.
+//
+// Responses are set for command line patterns: space separated words matched against the program
+// name and the arguments using path.Match() (e.g. "git log -n *"); "**" as the last word matches
+// any remaining arguments (none included). When several patterns match, the latest set one wins.
+// Commands run for the response duration in TimeSvc time and are killed by ctx and ExecCmd.Timeout
+// (measured by TimeSvc, too). All invocations are logged, see Calls().
+type ExecSvcMockImpl struct {
+	timeSvc TimeSvc
+
+	mu    sync.Mutex
+	rules []execMockRule
+	calls []ExecMockCall
+}
+
+var _ ExecSvc = (*ExecSvcMockImpl)(nil)
+
+// NewExecSvcMock creates a new ExecSvcMockImpl instance without responses, running commands in timeSvc time.
+func NewExecSvcMock(timeSvc TimeSvc) *ExecSvcMockImpl {
+	return &ExecSvcMockImpl{timeSvc: timeSvc}
+}
+
+// SetResponse scripts the response for command lines matching the pattern (see ExecSvcMockImpl).
+// Panics on a malformed pattern.
+func (svc *ExecSvcMockImpl) SetResponse(pattern string, response ExecMockResponse) {
+	svc.SetResponseFunc(pattern, func(ExecCmd) ExecMockResponse {
+		return response
+	})
+}
+
+// SetResponseFunc is like SetResponse(), but the response is computed by respond for each
+// invocation, e.g. from cmd.Stdin. respond is called without any locks held.
+func (svc *ExecSvcMockImpl) SetResponseFunc(pattern string, respond func(cmd ExecCmd) ExecMockResponse) {
+	words := strings.Fields(pattern)
+	if len(words) == 0 {
+		panic("empty exec mock pattern")
+	}
+	for _, word := range words {
+		if _, err := path.Match(word, ""); err != nil {
+			panic(fmt.Sprintf("invalid exec mock pattern %q: %v", pattern, err))
+		}
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.rules = append(svc.rules, execMockRule{pattern: words, respond: respond})
+}
+
+// ClearResponses removes all scripted responses.
+func (svc *ExecSvcMockImpl) ClearResponses() {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.rules = nil
+}
+
+// Calls returns all logged invocations in order.
+func (svc *ExecSvcMockImpl) Calls() []ExecMockCall {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	return slices.Clone(svc.calls)
+}
+
+// CallCount returns the number of logged invocations matching the pattern (see ExecSvcMockImpl).
+func (svc *ExecSvcMockImpl) CallCount(pattern string) int {
+	rule := execMockRule{pattern: strings.Fields(pattern)}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	count := 0
+	for _, call := range svc.calls {
+		if rule.matches(append([]string{call.Cmd.Name}, call.Cmd.Args...)) {
+			count++
+		}
+	}
+	return count
+}
+
+// ClearCalls clears the invocation log.
+func (svc *ExecSvcMockImpl) ClearCalls() {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.calls = nil
+}
+
+func (svc *ExecSvcMockImpl) Run(ctx context.Context, cmd ExecCmd) (ExecResult, error) {
+	start := svc.timeSvc.Now()
+	cmdLine := append([]string{cmd.Name}, cmd.Args...)
+
+	svc.mu.Lock()
+	logged := cmd
+	logged.Args = slices.Clone(cmd.Args)
+	logged.Env = slices.Clone(cmd.Env)
+	logged.Stdin = slices.Clone(cmd.Stdin)
+	svc.calls = append(svc.calls, ExecMockCall{Cmd: logged, Time: start})
+
+	var respond func(cmd ExecCmd) ExecMockResponse
+	for i := len(svc.rules) - 1; i >= 0; i-- {
+		if svc.rules[i].matches(cmdLine) {
+			respond = svc.rules[i].respond
+			break
+		}
+	}
+	svc.mu.Unlock()
+
+	if respond == nil {
+		return ExecResult{ExitCode: -1}, errors.Wrap(ErrExecMockNoResponse, cmd.String())
+	}
+
+	response := respond(cmd)
+	if response.Err != nil {
+		return ExecResult{ExitCode: -1}, errors.Wrapf(response.Err, "could not run %s", cmd)
+	}
+
+	if cmd.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = WithTimeout(ctx, svc.timeSvc, cmd.Timeout)
+		defer cancel()
+	}
+
+	err := ctx.Err()
+	if err == nil && response.Duration > 0 {
+		err = SleepContext(ctx, svc.timeSvc, response.Duration)
+	}
+	if err != nil {
+		return ExecResult{ExitCode: -1, Duration: svc.timeSvc.Now().Sub(start)}, execKilledError(ctx, cmd)
+	}
+
+	result := ExecResult{
+		Stdout:   []byte(response.Stdout),
+		Stderr:   []byte(response.Stderr),
+		ExitCode: response.ExitCode,
+		Duration: response.Duration,
+	}
+	if result.ExitCode != 0 {
+		return result, &ExecExitError{Cmd: cmd.String(), ExitCode: result.ExitCode, Stderr: result.Stderr}
+	}
+	return result, nil
+}
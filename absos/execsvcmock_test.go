@@ -0,0 +1,134 @@
+package absos
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecSvcMock(t *testing.T) {
+	timeSvc := NewTimeSvcMock()
+	svc := NewExecSvcMock(timeSvc)
+	ctx := context.Background()
+
+	svc.SetResponse("git **", ExecMockResponse{Stderr: "fatal: not a git repository", ExitCode: 128})
+	svc.SetResponse("git rev-parse HEAD", ExecMockResponse{Stdout: "abc123\n"})
+	svc.SetResponse("git log -n *", ExecMockResponse{Stdout: "log"})
+
+	output, err := ExecOutput(ctx, svc, "git", "rev-parse", "HEAD")
+	assert.Nil(t, err)
+	assert.Equal(t, "abc123", output)
+
+	result, err := svc.Run(ctx, ExecCmd{Name: "git", Args: []string{"log", "-n", "5"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "log", string(result.Stdout))
+
+	// Falls back to the catch-all one.
+	result, err = svc.Run(ctx, ExecCmd{Name: "git", Args: []string{"log", "-n", "5", "--oneline"}})
+	var exitErr *ExecExitError
+	assert.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 128, result.ExitCode)
+	assert.EqualError(t, err, "command git log -n 5 --oneline exited with code 128: fatal: not a git repository")
+
+	// "**" matches no args, too.
+	_, err = svc.Run(ctx, ExecCmd{Name: "git"})
+	assert.ErrorAs(t, err, &exitErr)
+
+	_, err = svc.Run(ctx, ExecCmd{Name: "ffmpeg", Args: []string{"-i", "in.mp4"}})
+	assert.ErrorIs(t, err, ErrExecMockNoResponse)
+	assert.EqualError(t, err, "ffmpeg -i in.mp4: no scripted response for command")
+
+	svc.SetResponse("ffmpeg **", ExecMockResponse{Err: exec.ErrNotFound})
+	_, err = svc.Run(ctx, ExecCmd{Name: "ffmpeg", Args: []string{"-i", "in.mp4"}})
+	assert.ErrorIs(t, err, exec.ErrNotFound)
+
+	assert.Equal(t, 6, len(svc.Calls()))
+	assert.Equal(t, 2, svc.CallCount("git log **"))
+	assert.Equal(t, 4, svc.CallCount("git **"))
+	assert.Equal(t, 1, svc.CallCount("git log -n 5"))
+	assert.Equal(t, 2, svc.CallCount("ffmpeg -i *.mp4"))
+	assert.Equal(t, 0, svc.CallCount("ffmpeg"))
+
+	svc.ClearCalls()
+	svc.ClearResponses()
+	assert.Empty(t, svc.Calls())
+	_, err = svc.Run(ctx, ExecCmd{Name: "git"})
+	assert.ErrorIs(t, err, ErrExecMockNoResponse)
+
+	assert.Panics(t, func() { svc.SetResponse(" ", ExecMockResponse{}) })
+	assert.Panics(t, func() { svc.SetResponse("git [", ExecMockResponse{}) })
+}
+
+func TestExecSvcMockCalls(t *testing.T) {
+	timeSvc := NewTimeSvcMock()
+	timeSvc.Add(time.Minute)
+	svc := NewExecSvcMock(timeSvc)
+
+	svc.SetResponseFunc("tr a-z A-Z", func(cmd ExecCmd) ExecMockResponse {
+		return ExecMockResponse{Stdout: string(cmd.Stdin) + "!"}
+	})
+
+	cmd := ExecCmd{Name: "tr", Args: []string{"a-z", "A-Z"}, Env: []string{"A=1"}, Stdin: []byte("hi")}
+	result, err := svc.Run(context.Background(), cmd)
+	assert.Nil(t, err)
+	assert.Equal(t, "hi!", string(result.Stdout))
+
+	// Logged calls are copies.
+	cmd.Args[0] = "x"
+	cmd.Stdin[0] = 'x'
+	calls := svc.Calls()
+	assert.Len(t, calls, 1)
+	assert.Equal(t, ExecCmd{Name: "tr", Args: []string{"a-z", "A-Z"}, Env: []string{"A=1"}, Stdin: []byte("hi")}, calls[0].Cmd)
+	assert.Equal(t, time.Time{}.Add(time.Minute), calls[0].Time)
+}
+
+func TestExecSvcMockDuration(t *testing.T) {
+	timeSvc := NewTimeSvcMock()
+	svc := NewExecSvcMock(timeSvc)
+	svc.SetResponse("ffmpeg **", ExecMockResponse{Stdout: "done", Duration: time.Minute})
+
+	type runResult struct {
+		result ExecResult
+		err    error
+	}
+	run := func(ctx context.Context, cmd ExecCmd) chan runResult {
+		ch := make(chan runResult, 1)
+		go func() {
+			result, err := svc.Run(ctx, cmd)
+			ch <- runResult{result, err}
+		}()
+		return ch
+	}
+
+	ch := run(context.Background(), ExecCmd{Name: "ffmpeg"})
+	timeSvc.WaitForSleepers(1)
+	timeSvc.Add(time.Minute)
+	r := <-ch
+	assert.Nil(t, r.err)
+	assert.Equal(t, "done", string(r.result.Stdout))
+	assert.Equal(t, time.Minute, r.result.Duration)
+
+	// Killed on timeout.
+	ch = run(context.Background(), ExecCmd{Name: "ffmpeg", Timeout: 10 * time.Second})
+	timeSvc.WaitForSleepers(2)
+	timeSvc.Add(10 * time.Second)
+	r = <-ch
+	assert.ErrorIs(t, r.err, context.DeadlineExceeded)
+	assert.EqualError(t, r.err, "command ffmpeg killed: context deadline exceeded")
+	assert.Equal(t, -1, r.result.ExitCode)
+	assert.Equal(t, 10*time.Second, r.result.Duration)
+	assert.Empty(t, r.result.Stdout)
+
+	// Killed on ctx cancel.
+	ctx, cancel := context.WithCancel(context.Background())
+	ch = run(ctx, ExecCmd{Name: "ffmpeg"})
+	timeSvc.WaitForSleepers(1)
+	cancel()
+	assert.ErrorIs(t, (<-ch).err, context.Canceled)
+
+	_, err := svc.Run(ctx, ExecCmd{Name: "ffmpeg"})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,141 @@
+package absos
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FsSvc wraps the filesystem functions of the os pkg.
+//
+// Method semantics (including returned errors, e.g. *fs.PathError) follow the ones of the os pkg.
+type FsSvc interface {
+	// Open opens the named file (or directory) for reading.
+	Open(name string) (fs.File, error)
+
+	// ReadFile is os.ReadFile().
+	ReadFile(name string) ([]byte, error)
+
+	// WriteFile is os.WriteFile().
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+
+	// WriteFileAtomic is like WriteFile(), but readers see either the old content or the new one,
+	// never a partially written file. Done by writing (and syncing) a temporary file in the same
+	// directory first, and renaming it to name after. Unlike with WriteFile(), perm is not subject to umask.
+	WriteFileAtomic(name string, data []byte, perm fs.FileMode) error
+
+	// Rename is os.Rename().
+	Rename(oldName, newName string) error
+
+	// Stat is os.Stat().
+	Stat(name string) (fs.FileInfo, error)
+
+	// ReadDir is os.ReadDir(), entries are sorted by name.
+	ReadDir(name string) ([]fs.DirEntry, error)
+
+	// Mkdir is os.Mkdir().
+	Mkdir(name string, perm fs.FileMode) error
+
+	// MkdirAll is os.MkdirAll().
+	MkdirAll(name string, perm fs.FileMode) error
+
+	// Remove is os.Remove().
+	Remove(name string) error
+
+	// RemoveAll is os.RemoveAll().
+	RemoveAll(name string) error
+
+	// WalkDir is filepath.WalkDir().
+	WalkDir(root string, fn fs.WalkDirFunc) error
+}
+
+type fsSvcImpl struct{}
+
+var fsSvcImplInstance = fsSvcImpl{}
+
+// NewFsSvc returns FsSvc backed by the real filesystem.
+func NewFsSvc() FsSvc {
+	return fsSvcImplInstance
+}
+
+func (fsSvcImpl) Open(name string) (fs.File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		// Avoid returning a non-nil interface holding a nil *os.File.
+		return nil, err
+	}
+	return f, nil
+}
+
+func (fsSvcImpl) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (fsSvcImpl) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+func (fsSvcImpl) WriteFileAtomic(name string, data []byte, perm fs.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+
+	tmpName := f.Name()
+	err = writeAndSync(f, data, perm)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpName, name)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// writeAndSync writes data to f, sets its permissions and flushes it to disk.
+func writeAndSync(f *os.File, data []byte, perm fs.FileMode) error {
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func (fsSvcImpl) Rename(oldName, newName string) error {
+	return os.Rename(oldName, newName)
+}
+
+func (fsSvcImpl) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (fsSvcImpl) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (fsSvcImpl) Mkdir(name string, perm fs.FileMode) error {
+	return os.Mkdir(name, perm)
+}
+
+func (fsSvcImpl) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(name, perm)
+}
+
+func (fsSvcImpl) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (fsSvcImpl) RemoveAll(name string) error {
+	return os.RemoveAll(name)
+}
+
+func (fsSvcImpl) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return filepath.WalkDir(root, fn)
+}
@@ -0,0 +1,190 @@
+package absos
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSvc(t *testing.T) {
+	svc := NewFsSvc()
+	assert.Equal(t, svc, NewFsSvc())
+
+	testFsSvc(t, svc, t.TempDir())
+}
+
+func TestFsSvcWriteFileAtomic(t *testing.T) {
+	svc := NewFsSvc()
+	dir := t.TempDir()
+	name := filepath.Join(dir, "config.json")
+
+	assert.Nil(t, svc.WriteFileAtomic(name, []byte("v1"), 0o600))
+	assert.Nil(t, svc.WriteFileAtomic(name, []byte("v2"), 0o640))
+
+	data, err := svc.ReadFile(name)
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", string(data))
+
+	info, err := svc.Stat(name)
+	assert.Nil(t, err)
+	assert.Equal(t, fs.FileMode(0o640), info.Mode())
+
+	// No temporary files left behind, also on failure.
+	err = svc.WriteFileAtomic(filepath.Join(dir, "missing", "x"), nil, 0o600)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.IsType(t, &fs.PathError{}, err)
+
+	entries, err := svc.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+
+	err = svc.WriteFileAtomic(dir, nil, 0o600)
+	assert.NotNil(t, err)
+
+	entries, err = svc.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+}
+
+// testFsSvc checks the common FsSvc behavior within the existing empty directory root.
+// Used for both the real FsSvc and FsSvcMockImpl, to keep the mock in line with the real thing.
+func testFsSvc(t *testing.T, svc FsSvc, root string) {
+	path := func(parts ...string) string {
+		return filepath.Join(append([]string{root}, parts...)...)
+	}
+
+	// Missing.
+	_, err := svc.Stat(path("a"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = svc.ReadFile(path("a"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = svc.Open(path("a"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.ErrorIs(t, svc.WriteFile(path("a", "b"), nil, 0o644), fs.ErrNotExist)
+	assert.ErrorIs(t, svc.Mkdir(path("a", "b"), 0o755), fs.ErrNotExist)
+	assert.ErrorIs(t, svc.Remove(path("a")), fs.ErrNotExist)
+	assert.Nil(t, svc.RemoveAll(path("a")))
+
+	// Directories.
+	assert.Nil(t, svc.MkdirAll(path("a", "b", "c"), 0o755))
+	assert.Nil(t, svc.MkdirAll(path("a", "b", "c"), 0o755))
+	assert.Nil(t, svc.Mkdir(path("a", "d"), 0o700))
+	assert.ErrorIs(t, svc.Mkdir(path("a", "d"), 0o700), fs.ErrExist)
+
+	info, err := svc.Stat(path("a", "d"))
+	assert.Nil(t, err)
+	assert.True(t, info.IsDir())
+	assert.Equal(t, "d", info.Name())
+	assert.Equal(t, fs.ModeDir|0o700, info.Mode())
+
+	// Files.
+	assert.Nil(t, svc.WriteFile(path("a", "f.txt"), []byte("hello"), 0o600))
+	assert.Nil(t, svc.WriteFileAtomic(path("a", "b", "g.txt"), []byte("world"), 0o644))
+
+	data, err := svc.ReadFile(path("a", "f.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	info, err = svc.Stat(path("a", "f.txt"))
+	assert.Nil(t, err)
+	assert.False(t, info.IsDir())
+	assert.Equal(t, int64(5), info.Size())
+	assert.Equal(t, fs.FileMode(0o600), info.Mode())
+
+	f, err := svc.Open(path("a", "b", "g.txt"))
+	assert.Nil(t, err)
+	data, err = io.ReadAll(f)
+	assert.Nil(t, err)
+	assert.Equal(t, "world", string(data))
+	assert.Nil(t, f.Close())
+
+	_, err = svc.ReadFile(path("a"))
+	assert.ErrorIs(t, err, syscall.EISDIR)
+	assert.ErrorIs(t, svc.WriteFile(path("a"), nil, 0o644), syscall.EISDIR)
+	assert.ErrorIs(t, svc.WriteFile(path("a", "f.txt", "x"), nil, 0o644), syscall.ENOTDIR)
+	assert.ErrorIs(t, svc.MkdirAll(path("a", "f.txt", "x"), 0o755), syscall.ENOTDIR)
+	_, err = svc.ReadDir(path("a", "f.txt"))
+	assert.ErrorIs(t, err, syscall.ENOTDIR)
+
+	// Listing.
+	entries, err := svc.ReadDir(path("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "d", "f.txt"}, dirEntryNames(entries))
+	assert.True(t, entries[0].IsDir())
+	assert.False(t, entries[2].IsDir())
+
+	f, err = svc.Open(path("a"))
+	assert.Nil(t, err)
+	entries, err = f.(fs.ReadDirFile).ReadDir(-1)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"b", "d", "f.txt"}, dirEntryNames(entries))
+	assert.Nil(t, f.Close())
+
+	var walked []string
+	err = svc.WalkDir(path("a"), func(name string, d fs.DirEntry, err error) error {
+		assert.Nil(t, err)
+		rel, _ := filepath.Rel(root, name)
+		walked = append(walked, rel)
+		if d.Name() == "c" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "a/b", "a/b/c", "a/b/g.txt", "a/d", "a/f.txt"}, walked)
+
+	err = svc.WalkDir(path("missing"), func(name string, d fs.DirEntry, err error) error {
+		assert.Nil(t, d)
+		return err
+	})
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	// Rename.
+	assert.Nil(t, svc.Rename(path("a", "f.txt"), path("a", "d", "f2.txt")))
+	_, err = svc.Stat(path("a", "f.txt"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	data, err = svc.ReadFile(path("a", "d", "f2.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	assert.Nil(t, svc.Rename(path("a", "b"), path("e")))
+	data, err = svc.ReadFile(path("e", "g.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "world", string(data))
+
+	// Replaces existing files.
+	assert.Nil(t, svc.Rename(path("e", "g.txt"), path("a", "d", "f2.txt")))
+	data, err = svc.ReadFile(path("a", "d", "f2.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "world", string(data))
+
+	var linkErr *os.LinkError
+	err = svc.Rename(path("missing"), path("x"))
+	assert.ErrorAs(t, err, &linkErr)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.NotNil(t, svc.Rename(path("a"), path("a", "d", "x")))
+
+	// Remove.
+	assert.ErrorIs(t, svc.Remove(path("a")), syscall.ENOTEMPTY)
+	assert.Nil(t, svc.Remove(path("a", "d", "f2.txt")))
+	assert.Nil(t, svc.Remove(path("a", "d")))
+	assert.Nil(t, svc.RemoveAll(path("a")))
+	assert.Nil(t, svc.RemoveAll(path("e")))
+
+	entries, err = svc.ReadDir(root)
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
+
+func dirEntryNames(entries []fs.DirEntry) []string {
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	return names
+}
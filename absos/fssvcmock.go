@@ -0,0 +1,581 @@
+package absos
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FsOp identifies an FsSvc operation errors can be injected for, see FsSvcMockImpl.InjectError().
+// Values are the ones used as Op of the returned errors (e.g. *fs.PathError).
+type FsOp string
+
+const (
+	FsOpAny     FsOp = ""        // Any operation.
+	FsOpOpen    FsOp = "open"    // Open, ReadFile.
+	FsOpWrite   FsOp = "write"   // WriteFile, WriteFileAtomic.
+	FsOpRename  FsOp = "rename"  // Rename (matched against both the old and the new name).
+	FsOpStat    FsOp = "stat"    // Stat, WalkDir.
+	FsOpReadDir FsOp = "readdir" // ReadDir, WalkDir.
+	FsOpMkdir   FsOp = "mkdir"   // Mkdir, MkdirAll.
+	FsOpRemove  FsOp = "remove"  // Remove, RemoveAll.
+)
+
+// fsMockNode is a file or directory of FsSvcMockImpl.
+type fsMockNode struct {
+	data    []byte // Never modified in place, replaced on write.
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// fsMockInjection is an error injected by FsSvcMockImpl.InjectError().
+type fsMockInjection struct {
+	op   FsOp
+	path string
+	err  error
+}
+
+// FsSvcMockImpl provides an in-memory mock implementation of FsSvc for testing purposes.
+//
+// Relative names are resolved against "/". Mod-times are taken from TimeSvc. Permissions are
+// recorded, but not enforced; use InjectError() to simulate e.g. syscall.EACCES or syscall.ENOSPC.
+// Symlinks are not supported.
+type FsSvcMockImpl struct {
+	timeSvc    TimeSvc
+	mu         sync.Mutex
+	nodes      map[string]*fsMockNode // By clean absolute path.
+	injections []fsMockInjection
+}
+
+var _ FsSvc = (*FsSvcMockImpl)(nil)
+
+// NewFsSvcMock creates a new FsSvcMockImpl instance with an empty root directory,
+// using the provided TimeSvc for mod-times.
+func NewFsSvcMock(timeSvc TimeSvc) *FsSvcMockImpl {
+	return &FsSvcMockImpl{
+		timeSvc: timeSvc,
+		nodes: map[string]*fsMockNode{
+			"/": {mode: fs.ModeDir | 0o755, modTime: timeSvc.Now()},
+		},
+	}
+}
+
+// fsMockPath returns the clean absolute path for name.
+func fsMockPath(name string) string {
+	return filepath.Join("/", name)
+}
+
+// isWithin tells whether p is dir or within it.
+func isWithin(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// InjectError makes operations op (or all of them for FsOpAny) on name, and anything within it if
+// it's a directory, fail with err (wrapped the same way os pkg wraps errors, e.g. in *fs.PathError).
+//
+// If several injections match, the one for the longest name wins; for the same name, the one
+// for op wins over FsOpAny. A nil err exempts op and name from injections for shorter names.
+// Injecting an error for the same op and name again replaces it.
+func (svc *FsSvcMockImpl) InjectError(op FsOp, name string, err error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	p := fsMockPath(name)
+	svc.injections = slices.DeleteFunc(svc.injections, func(inj fsMockInjection) bool {
+		return inj.op == op && inj.path == p
+	})
+	svc.injections = append(svc.injections, fsMockInjection{op: op, path: p, err: err})
+}
+
+// ClearError removes the error injected for op and name.
+func (svc *FsSvcMockImpl) ClearError(op FsOp, name string) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	p := fsMockPath(name)
+	svc.injections = slices.DeleteFunc(svc.injections, func(inj fsMockInjection) bool {
+		return inj.op == op && inj.path == p
+	})
+}
+
+// ClearAllErrors removes all injected errors.
+func (svc *FsSvcMockImpl) ClearAllErrors() {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.injections = nil
+}
+
+// injectedErrLocked returns the error injected for op and p, nil if none. Must be called with svc.mu held.
+func (svc *FsSvcMockImpl) injectedErrLocked(op FsOp, p string) error {
+	var found *fsMockInjection
+	for i, inj := range svc.injections {
+		if (inj.op != FsOpAny && inj.op != op) || !isWithin(p, inj.path) {
+			continue
+		}
+		if found == nil || len(inj.path) > len(found.path) ||
+			(len(inj.path) == len(found.path) && inj.op != FsOpAny) {
+			found = &svc.injections[i]
+		}
+	}
+
+	if found == nil {
+		return nil
+	}
+	return found.err
+}
+
+// SetFile creates (or replaces) the named file with the given content and 0644 permissions,
+// creating missing parent directories. Meant for test setup, ignores injected errors.
+func (svc *FsSvcMockImpl) SetFile(name string, data []byte) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	p := fsMockPath(name)
+	now := svc.timeSvc.Now()
+	for dir := filepath.Dir(p); svc.nodes[dir] == nil; dir = filepath.Dir(dir) {
+		svc.nodes[dir] = &fsMockNode{mode: fs.ModeDir | 0o755, modTime: now}
+	}
+	svc.nodes[p] = &fsMockNode{data: bytes.Clone(data), mode: 0o644, modTime: now}
+}
+
+// checkLocked returns the injected error for op and p (if any) wrapped in *fs.PathError.
+func (svc *FsSvcMockImpl) checkLocked(op FsOp, name, p string) error {
+	if err := svc.injectedErrLocked(op, p); err != nil {
+		return &fs.PathError{Op: string(op), Path: name, Err: err}
+	}
+	return nil
+}
+
+// lookupLocked returns the node at p; fails if it, or any of its parents, does not exist
+// (or a parent is not a directory). Must be called with svc.mu held.
+func (svc *FsSvcMockImpl) lookupLocked(op FsOp, name, p string) (*fsMockNode, error) {
+	if err := svc.checkLocked(op, name, p); err != nil {
+		return nil, err
+	}
+
+	if err := svc.checkParentLocked(op, name, p); err != nil {
+		return nil, err
+	}
+
+	node := svc.nodes[p]
+	if node == nil {
+		return nil, &fs.PathError{Op: string(op), Path: name, Err: syscall.ENOENT}
+	}
+	return node, nil
+}
+
+// checkParentLocked checks that the parent directory of p exists. Must be called with svc.mu held.
+func (svc *FsSvcMockImpl) checkParentLocked(op FsOp, name, p string) error {
+	if p == "/" {
+		return nil
+	}
+
+	// Walk from the root, so the first missing (or non-directory) component determines the error.
+	dir := "/"
+	for _, part := range strings.Split(strings.TrimPrefix(filepath.Dir(p), "/"), "/") {
+		if part == "" {
+			break
+		}
+		dir = filepath.Join(dir, part)
+
+		node := svc.nodes[dir]
+		if node == nil {
+			return &fs.PathError{Op: string(op), Path: name, Err: syscall.ENOENT}
+		}
+		if !node.mode.IsDir() {
+			return &fs.PathError{Op: string(op), Path: name, Err: syscall.ENOTDIR}
+		}
+	}
+	return nil
+}
+
+func (svc *FsSvcMockImpl) Open(name string) (fs.File, error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	p := fsMockPath(name)
+	node, err := svc.lookupLocked(FsOpOpen, name, p)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &fsMockFile{
+		name:   name,
+		info:   newFsMockFileInfo(p, node),
+		Reader: bytes.NewReader(node.data),
+	}
+	if node.mode.IsDir() {
+		f.entries = svc.readDirLocked(p)
+	}
+	return f, nil
+}
+
+func (svc *FsSvcMockImpl) ReadFile(name string) ([]byte, error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	p := fsMockPath(name)
+	node, err := svc.lookupLocked(FsOpOpen, name, p)
+	if err != nil {
+		return nil, err
+	}
+	if node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: syscall.EISDIR}
+	}
+	return bytes.Clone(node.data), nil
+}
+
+func (svc *FsSvcMockImpl) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	return svc.writeFileLocked(name, data, perm)
+}
+
+// WriteFileAtomic is WriteFile() of the mock, which is atomic anyway.
+func (svc *FsSvcMockImpl) WriteFileAtomic(name string, data []byte, perm fs.FileMode) error {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	return svc.writeFileLocked(name, data, perm)
+}
+
+func (svc *FsSvcMockImpl) writeFileLocked(name string, data []byte, perm fs.FileMode) error {
+	p := fsMockPath(name)
+	if err := svc.checkLocked(FsOpWrite, name, p); err != nil {
+		return err
+	}
+	if err := svc.checkParentLocked("open", name, p); err != nil {
+		return err
+	}
+
+	node := svc.nodes[p]
+	if node == nil {
+		node = &fsMockNode{mode: perm.Perm()}
+		svc.nodes[p] = node
+	} else if node.mode.IsDir() {
+		return &fs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+
+	node.data = bytes.Clone(data)
+	node.modTime = svc.timeSvc.Now()
+	return nil
+}
+
+func (svc *FsSvcMockImpl) Rename(oldName, newName string) error {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	oldPath, newPath := fsMockPath(oldName), fsMockPath(newName)
+	linkErr := func(err error) error {
+		return &os.LinkError{Op: string(FsOpRename), Old: oldName, New: newName, Err: err}
+	}
+
+	for _, p := range []string{oldPath, newPath} {
+		if err := svc.injectedErrLocked(FsOpRename, p); err != nil {
+			return linkErr(err)
+		}
+	}
+
+	node, err := svc.lookupLocked(FsOpRename, oldName, oldPath)
+	if err != nil {
+		return linkErr(err.(*fs.PathError).Err)
+	}
+	if err := svc.checkParentLocked(FsOpRename, newName, newPath); err != nil {
+		return linkErr(err.(*fs.PathError).Err)
+	}
+
+	if oldPath == newPath {
+		return nil
+	}
+	if oldPath == "/" || isWithin(newPath, oldPath) {
+		return linkErr(syscall.EINVAL)
+	}
+
+	if existing := svc.nodes[newPath]; existing != nil {
+		switch {
+		case existing.mode.IsDir() && !node.mode.IsDir():
+			return linkErr(syscall.EISDIR)
+		case !existing.mode.IsDir() && node.mode.IsDir():
+			return linkErr(syscall.ENOTDIR)
+		case existing.mode.IsDir() && len(svc.readDirLocked(newPath)) > 0:
+			return linkErr(syscall.ENOTEMPTY)
+		}
+	}
+
+	// Move the node along with everything within it.
+	for p, n := range svc.nodes {
+		if isWithin(p, oldPath) {
+			delete(svc.nodes, p)
+			svc.nodes[newPath+strings.TrimPrefix(p, oldPath)] = n
+		}
+	}
+	return nil
+}
+
+func (svc *FsSvcMockImpl) Stat(name string) (fs.FileInfo, error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	p := fsMockPath(name)
+	node, err := svc.lookupLocked(FsOpStat, name, p)
+	if err != nil {
+		return nil, err
+	}
+	return newFsMockFileInfo(p, node), nil
+}
+
+func (svc *FsSvcMockImpl) ReadDir(name string) ([]fs.DirEntry, error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	p := fsMockPath(name)
+	node, err := svc.lookupLocked(FsOpReadDir, name, p)
+	if err != nil {
+		return nil, err
+	}
+	if !node.mode.IsDir() {
+		return nil, &fs.PathError{Op: string(FsOpReadDir), Path: name, Err: syscall.ENOTDIR}
+	}
+	return svc.readDirLocked(p), nil
+}
+
+// readDirLocked returns entries of the directory p sorted by name. Must be called with svc.mu held.
+func (svc *FsSvcMockImpl) readDirLocked(p string) []fs.DirEntry {
+	var entries []fs.DirEntry
+	for childPath, child := range svc.nodes {
+		if childPath != "/" && filepath.Dir(childPath) == p {
+			entries = append(entries, fs.FileInfoToDirEntry(newFsMockFileInfo(childPath, child)))
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries
+}
+
+func (svc *FsSvcMockImpl) Mkdir(name string, perm fs.FileMode) error {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	p := fsMockPath(name)
+	if err := svc.checkLocked(FsOpMkdir, name, p); err != nil {
+		return err
+	}
+	if err := svc.checkParentLocked(FsOpMkdir, name, p); err != nil {
+		return err
+	}
+	if svc.nodes[p] != nil {
+		return &fs.PathError{Op: string(FsOpMkdir), Path: name, Err: syscall.EEXIST}
+	}
+
+	svc.nodes[p] = &fsMockNode{mode: fs.ModeDir | perm.Perm(), modTime: svc.timeSvc.Now()}
+	return nil
+}
+
+func (svc *FsSvcMockImpl) MkdirAll(name string, perm fs.FileMode) error {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	p := fsMockPath(name)
+	if err := svc.checkLocked(FsOpMkdir, name, p); err != nil {
+		return err
+	}
+
+	// Check first, so nothing is created on failure.
+	var missing []string
+	for dir := p; ; dir = filepath.Dir(dir) {
+		if node := svc.nodes[dir]; node != nil {
+			if !node.mode.IsDir() {
+				return &fs.PathError{Op: string(FsOpMkdir), Path: dir, Err: syscall.ENOTDIR}
+			}
+			break
+		}
+		missing = append(missing, dir)
+	}
+
+	now := svc.timeSvc.Now()
+	for _, dir := range missing {
+		svc.nodes[dir] = &fsMockNode{mode: fs.ModeDir | perm.Perm(), modTime: now}
+	}
+	return nil
+}
+
+func (svc *FsSvcMockImpl) Remove(name string) error {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	p := fsMockPath(name)
+	node, err := svc.lookupLocked(FsOpRemove, name, p)
+	if err != nil {
+		return err
+	}
+	if p == "/" {
+		return &fs.PathError{Op: string(FsOpRemove), Path: name, Err: syscall.EBUSY}
+	}
+	if node.mode.IsDir() && len(svc.readDirLocked(p)) > 0 {
+		return &fs.PathError{Op: string(FsOpRemove), Path: name, Err: syscall.ENOTEMPTY}
+	}
+
+	delete(svc.nodes, p)
+	return nil
+}
+
+func (svc *FsSvcMockImpl) RemoveAll(name string) error {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	p := fsMockPath(name)
+	if err := svc.checkLocked(FsOpRemove, name, p); err != nil {
+		return err
+	}
+	if p == "/" {
+		return &fs.PathError{Op: string(FsOpRemove), Path: name, Err: syscall.EBUSY}
+	}
+
+	for nodePath := range svc.nodes {
+		if isWithin(nodePath, p) {
+			if err := svc.checkLocked(FsOpRemove, nodePath, nodePath); err != nil {
+				return err
+			}
+		}
+	}
+	for nodePath := range svc.nodes {
+		if isWithin(nodePath, p) {
+			delete(svc.nodes, nodePath)
+		}
+	}
+	return nil
+}
+
+// WalkDir is filepath.WalkDir() over the mock; the tree may be modified by fn while walking.
+func (svc *FsSvcMockImpl) WalkDir(root string, fn fs.WalkDirFunc) error {
+	info, err := svc.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = svc.walkDir(root, fs.FileInfoToDirEntry(info), fn)
+	}
+
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkDir is the recursive part of WalkDir(), mirrors the one of filepath.WalkDir().
+func (svc *FsSvcMockImpl) walkDir(name string, entry fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(name, entry, nil); err != nil || !entry.IsDir() {
+		if err == filepath.SkipDir && entry.IsDir() {
+			err = nil
+		}
+		return err
+	}
+
+	entries, err := svc.ReadDir(name)
+	if err != nil {
+		// Second call, to report the ReadDir error.
+		err = fn(name, entry, err)
+		if err != nil {
+			if err == filepath.SkipDir && entry.IsDir() {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	for _, child := range entries {
+		if err := svc.walkDir(filepath.Join(name, child.Name()), child, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// fsMockFileInfo is fs.FileInfo of FsSvcMockImpl.
+type fsMockFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func newFsMockFileInfo(p string, node *fsMockNode) fsMockFileInfo {
+	return fsMockFileInfo{
+		name:    filepath.Base(p),
+		size:    int64(len(node.data)),
+		mode:    node.mode,
+		modTime: node.modTime,
+	}
+}
+
+func (fi fsMockFileInfo) Name() string       { return fi.name }
+func (fi fsMockFileInfo) Size() int64        { return fi.size }
+func (fi fsMockFileInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi fsMockFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi fsMockFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi fsMockFileInfo) Sys() any           { return nil }
+
+// fsMockFile is fs.File of FsSvcMockImpl, a snapshot taken when it was opened.
+// Also implements io.Seeker, io.ReaderAt and (for directories) fs.ReadDirFile.
+type fsMockFile struct {
+	*bytes.Reader
+	name    string
+	info    fsMockFileInfo
+	entries []fs.DirEntry // Not yet read directory entries.
+	closed  bool
+}
+
+func (f *fsMockFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *fsMockFile) Read(b []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.info.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+	}
+	return f.Reader.Read(b)
+}
+
+func (f *fsMockFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if f.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: fs.ErrClosed}
+	}
+	if !f.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+	}
+
+	if n <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(f.entries))
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+	return entries, nil
+}
+
+func (f *fsMockFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
@@ -0,0 +1,186 @@
+package absos
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSvcMock(t *testing.T) {
+	svc := NewFsSvcMock(NewTimeSvcMock())
+	assert.Nil(t, svc.MkdirAll("/tmp/test", 0o755))
+
+	testFsSvc(t, svc, "/tmp/test")
+}
+
+func TestFsSvcMockModTime(t *testing.T) {
+	timeSvc := NewTimeSvcMock()
+	svc := NewFsSvcMock(timeSvc)
+
+	timeSvc.Add(time.Hour)
+	assert.Nil(t, svc.Mkdir("dir", 0o755))
+
+	timeSvc.Add(time.Minute)
+	assert.Nil(t, svc.WriteFile("dir/f", []byte("x"), 0o644))
+
+	info, err := svc.Stat("/dir")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Time{}.Add(time.Hour), info.ModTime())
+
+	info, err = svc.Stat("dir/f")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Time{}.Add(time.Hour+time.Minute), info.ModTime())
+
+	// Overwrite updates, rename keeps.
+	timeSvc.Add(time.Minute)
+	assert.Nil(t, svc.WriteFileAtomic("dir/f", []byte("y"), 0o644))
+	assert.Nil(t, svc.Rename("dir/f", "g"))
+
+	info, err = svc.Stat("g")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Time{}.Add(time.Hour+2*time.Minute), info.ModTime())
+	assert.Nil(t, info.Sys())
+}
+
+func TestFsSvcMockInjectError(t *testing.T) {
+	svc := NewFsSvcMock(NewTimeSvcMock())
+	svc.SetFile("/etc/app/secret", []byte("s3cr3t"))
+	svc.SetFile("/etc/app/config", []byte("{}"))
+	assert.Nil(t, svc.Mkdir("/spool", 0o755))
+
+	svc.InjectError(FsOpOpen, "/etc/app/secret", syscall.EACCES)
+	svc.InjectError(FsOpWrite, "/spool", syscall.ENOSPC)
+
+	_, err := svc.ReadFile("/etc/app/secret")
+	assert.ErrorIs(t, err, fs.ErrPermission)
+	assert.Equal(t, &fs.PathError{Op: "open", Path: "/etc/app/secret", Err: syscall.EACCES}, err)
+
+	_, err = svc.Open("/etc/app/secret")
+	assert.ErrorIs(t, err, syscall.EACCES)
+
+	// Other ops and paths are not affected.
+	_, err = svc.Stat("/etc/app/secret")
+	assert.Nil(t, err)
+	_, err = svc.ReadFile("/etc/app/config")
+	assert.Nil(t, err)
+
+	// Everything within a directory is.
+	err = svc.WriteFile("/spool/msg1", []byte("x"), 0o644)
+	assert.Equal(t, &fs.PathError{Op: "write", Path: "/spool/msg1", Err: syscall.ENOSPC}, err)
+	assert.ErrorIs(t, svc.WriteFileAtomic("/spool/a/b", nil, 0o644), syscall.ENOSPC)
+	_, err = svc.Stat("/spool/msg1")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	// The longest name wins.
+	svc.InjectError(FsOpWrite, "/spool/priority", nil)
+	assert.ErrorIs(t, svc.WriteFile("/spool/x", nil, 0o644), syscall.ENOSPC)
+	assert.Nil(t, svc.WriteFile("/spool/priority", nil, 0o644))
+	svc.InjectError(FsOpAny, "/spool/priority", syscall.EIO)
+	assert.Nil(t, svc.WriteFile("/spool/priority", nil, 0o644))
+	_, err = svc.Stat("/spool/priority")
+	assert.ErrorIs(t, err, syscall.EIO)
+	svc.ClearError(FsOpAny, "/spool/priority")
+
+	// Rename checks both names.
+	svc.InjectError(FsOpRename, "/etc/app", syscall.EROFS)
+	err = svc.Rename("/spool", "/etc/app/spool")
+	assert.Equal(t, &os.LinkError{Op: "rename", Old: "/spool", New: "/etc/app/spool", Err: syscall.EROFS}, err)
+
+	svc.InjectError(FsOpRemove, "/etc/app/config", syscall.EPERM)
+	assert.ErrorIs(t, svc.RemoveAll("/etc"), syscall.EPERM)
+	_, err = svc.Stat("/etc/app/secret")
+	assert.Nil(t, err)
+
+	svc.InjectError(FsOpReadDir, "/etc", syscall.EACCES)
+	var walkErrs []error
+	err = svc.WalkDir("/", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			walkErrs = append(walkErrs, err)
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []error{&fs.PathError{Op: "readdir", Path: "/etc", Err: syscall.EACCES}}, walkErrs)
+
+	svc.ClearError(FsOpWrite, "/spool")
+	assert.Nil(t, svc.WriteFile("/spool/msg1", []byte("x"), 0o644))
+
+	svc.ClearAllErrors()
+	_, err = svc.ReadFile("/etc/app/secret")
+	assert.Nil(t, err)
+	assert.Nil(t, svc.RemoveAll("/etc"))
+}
+
+func TestFsSvcMockFile(t *testing.T) {
+	svc := NewFsSvcMock(NewTimeSvcMock())
+	svc.SetFile("a/b.txt", []byte("hello"))
+
+	// Snapshot taken when opened.
+	f, err := svc.Open("a/b.txt")
+	assert.Nil(t, err)
+	assert.Nil(t, svc.WriteFile("a/b.txt", []byte("changed"), 0o644))
+
+	buf := make([]byte, 3)
+	_, err = f.(io.ReaderAt).ReadAt(buf, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "llo", string(buf))
+
+	data, err := io.ReadAll(f)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	info, err := f.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, "b.txt", info.Name())
+	assert.Equal(t, fs.FileMode(0o644), info.Mode())
+
+	_, err = f.(fs.ReadDirFile).ReadDir(-1)
+	assert.ErrorIs(t, err, syscall.ENOTDIR)
+
+	assert.Nil(t, f.Close())
+	assert.ErrorIs(t, f.Close(), fs.ErrClosed)
+	_, err = f.Read(buf)
+	assert.ErrorIs(t, err, fs.ErrClosed)
+
+	// Directories.
+	svc.SetFile("a/c.txt", nil)
+	dir, err := svc.Open("/a")
+	assert.Nil(t, err)
+
+	_, err = dir.Read(buf)
+	assert.ErrorIs(t, err, syscall.EISDIR)
+
+	entries, err := dir.(fs.ReadDirFile).ReadDir(1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b.txt"}, dirEntryNames(entries))
+	entries, err = dir.(fs.ReadDirFile).ReadDir(1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c.txt"}, dirEntryNames(entries))
+	_, err = dir.(fs.ReadDirFile).ReadDir(1)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestFsSvcMockRoot(t *testing.T) {
+	svc := NewFsSvcMock(NewTimeSvcMock())
+
+	info, err := svc.Stat("/")
+	assert.Nil(t, err)
+	assert.True(t, info.IsDir())
+
+	assert.ErrorIs(t, svc.Remove("/"), syscall.EBUSY)
+	assert.ErrorIs(t, svc.RemoveAll("/"), syscall.EBUSY)
+	assert.ErrorIs(t, svc.Mkdir("/", 0o755), fs.ErrExist)
+	assert.Nil(t, svc.MkdirAll("/", 0o755))
+
+	// Relative names are resolved against "/".
+	svc.SetFile("x/../y", []byte("y"))
+	data, err := svc.ReadFile(filepath.Join("/", "y"))
+	assert.Nil(t, err)
+	assert.Equal(t, "y", string(data))
+}
@@ -0,0 +1,41 @@
+package absos
+
+import (
+	"context"
+	"net"
+)
+
+// NetSvc wraps dialing and listening of the net pkg.
+//
+// Method semantics (including returned errors, e.g. *net.OpError) follow the ones of net.Dialer and net.ListenConfig.
+type NetSvc interface {
+	// DialContext connects to the address on the named network, see net.Dialer.DialContext().
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+
+	// Listen announces on the local network address, see net.Listen().
+	Listen(network, address string) (net.Listener, error)
+}
+
+type netSvcImpl struct {
+	dialer *net.Dialer
+}
+
+var netSvcImplInstance = netSvcImpl{dialer: &net.Dialer{}}
+
+// NewNetSvc returns NetSvc backed by the real network (a zero net.Dialer and net.Listen()).
+func NewNetSvc() NetSvc {
+	return netSvcImplInstance
+}
+
+// NewNetSvcWithDialer returns NetSvc dialing with the given dialer (e.g. with a timeout or keep-alive set).
+func NewNetSvcWithDialer(dialer *net.Dialer) NetSvc {
+	return netSvcImpl{dialer: dialer}
+}
+
+func (svc netSvcImpl) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return svc.dialer.DialContext(ctx, network, address)
+}
+
+func (netSvcImpl) Listen(network, address string) (net.Listener, error) {
+	return net.Listen(network, address)
+}
@@ -0,0 +1,75 @@
+package absos
+
+import (
+	"context"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetSvc(t *testing.T) {
+	svc := NewNetSvc()
+	assert.Equal(t, svc, NewNetSvc())
+
+	testNetSvcEcho(t, svc, "127.0.0.1:0")
+}
+
+func TestNetSvcWithDialer(t *testing.T) {
+	svc := NewNetSvcWithDialer(&net.Dialer{Timeout: time.Second})
+
+	l, err := svc.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	address := l.Addr().String()
+	assert.Nil(t, l.Close())
+
+	_, err = svc.DialContext(context.Background(), "tcp", address)
+	assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+}
+
+// testNetSvcEcho listens on address, dials it and checks that data flows in both directions.
+// Used for both the real NetSvc and NetSvcMockImpl, to keep the mock in line with the real thing.
+func testNetSvcEcho(t *testing.T, svc NetSvc, address string) {
+	l, err := svc.Listen("tcp", address)
+	assert.Nil(t, err)
+	defer l.Close()
+
+	_, err = svc.Listen("tcp", l.Addr().String())
+	assert.ErrorIs(t, err, syscall.EADDRINUSE)
+
+	go func() {
+		conn, err := l.Accept()
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	}()
+
+	conn, err := svc.DialContext(context.Background(), "tcp", l.Addr().String())
+	assert.Nil(t, err)
+	assert.Equal(t, l.Addr().String(), conn.RemoteAddr().String())
+
+	_, err = conn.Write([]byte("hello"))
+	assert.Nil(t, err)
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(buf))
+
+	assert.Nil(t, conn.Close())
+	assert.ErrorIs(t, conn.Close(), net.ErrClosed)
+	_, err = conn.Read(buf)
+	assert.ErrorIs(t, err, net.ErrClosed)
+
+	assert.Nil(t, l.Close())
+	_, err = l.Accept()
+	assert.ErrorIs(t, err, net.ErrClosed)
+
+	_, err = svc.Listen("udp", address)
+	assert.NotNil(t, err)
+}
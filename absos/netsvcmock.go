@@ -0,0 +1,425 @@
+package absos
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// NetMockLink describes the simulated network path to an address, see NetSvcMockImpl.SetLink().
+type NetMockLink struct {
+	// Latency is the one-way delay. Dialing takes a round trip (2x Latency), written data
+	// becomes readable by the peer Latency after it's transferred.
+	Latency time.Duration
+
+	// BytesPerSecond limits the bandwidth of each direction of a connection; 0 means unlimited.
+	// Writes don't block, data is queued and transferred at this rate (in mock time).
+	BytesPerSecond int64
+
+	// Refuse makes dials fail with ECONNREFUSED, even if there is a listener.
+	Refuse bool
+
+	// ResetAfterBytes resets connections once that many bytes were written to them (in both
+	// directions together); 0 means never. The write crossing the limit transfers only the
+	// bytes up to it and fails with ECONNRESET.
+	ResetAfterBytes int64
+}
+
+// NetMockDial is a dial recorded by NetSvcMockImpl, see Dials().
+type NetMockDial struct {
+	Network string
+	Address string   // As dialed, e.g. "db.local:5432".
+	Conn    net.Conn // The dialing end, nil if the dial failed.
+	Err     error
+}
+
+// netMockListenKey identifies a listener; ip is "" for listeners on all addresses.
+type netMockListenKey struct {
+	ip   string
+	port int
+}
+
+// NetSvcMockImpl provides an in-memory network implementing NetSvc for testing purposes.
+//
+// Only TCP ("tcp", "tcp4", "tcp6") is supported. Host names are resolved using DnsSvc (e.g.
+// DnsSvcMockImpl), latency and bandwidth are simulated using TimeSvc (see NetMockLink).
+// Connections are buffered (unlike the ones of net.Pipe()), their deadlines are in TimeSvc time.
+// Local addresses of dialed connections use the IP set by SetLocalIP() (127.0.0.1 by default)
+// and ephemeral ports.
+type NetSvcMockImpl struct {
+	timeSvc TimeSvc
+	dnsSvc  DnsSvc
+
+	mu          sync.Mutex
+	localIP     net.IP
+	nextPort    int
+	listeners   map[netMockListenKey]*netMockListener
+	defaultLink NetMockLink
+	links       map[string]NetMockLink
+	pipes       map[*netMockPipe]struct{} // Open connections.
+	dials       []NetMockDial
+}
+
+var _ NetSvc = (*NetSvcMockImpl)(nil)
+
+// NewNetSvcMock creates a new NetSvcMockImpl instance resolving host names using dnsSvc
+// and simulating delays using timeSvc.
+func NewNetSvcMock(timeSvc TimeSvc, dnsSvc DnsSvc) *NetSvcMockImpl {
+	return &NetSvcMockImpl{
+		timeSvc:   timeSvc,
+		dnsSvc:    dnsSvc,
+		localIP:   net.IPv4(127, 0, 0, 1),
+		nextPort:  49152,
+		listeners: make(map[netMockListenKey]*netMockListener),
+		links:     make(map[string]NetMockLink),
+		pipes:     make(map[*netMockPipe]struct{}),
+	}
+}
+
+// SetLocalIP sets the IP of local addresses of dialed connections.
+func (svc *NetSvcMockImpl) SetLocalIP(ip net.IP) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.localIP = ip
+}
+
+// SetDefaultLink sets the link used for addresses without their own one (see SetLink()).
+func (svc *NetSvcMockImpl) SetDefaultLink(link NetMockLink) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.defaultLink = link
+}
+
+// SetLink sets the link used for connections to address. The address is either the dialed one
+// (e.g. "db.local:5432") or the resolved one (e.g. "10.0.0.1:5432"), the dialed one wins.
+// Affects new connections only.
+func (svc *NetSvcMockImpl) SetLink(address string, link NetMockLink) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.links[address] = link
+}
+
+// ClearLinks removes links set by SetLink() and resets the default link.
+func (svc *NetSvcMockImpl) ClearLinks() {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.links = make(map[string]NetMockLink)
+	svc.defaultLink = NetMockLink{}
+}
+
+// ResetConnections resets all open connections to the address (dialed or resolved one, see SetLink()).
+// Reads and writes on both ends fail with ECONNRESET. Returns the number of reset connections.
+func (svc *NetSvcMockImpl) ResetConnections(address string) int {
+	svc.mu.Lock()
+	var pipes []*netMockPipe
+	for pipe := range svc.pipes {
+		if pipe.dialed == address || pipe.resolved == address {
+			pipes = append(pipes, pipe)
+			delete(svc.pipes, pipe)
+		}
+	}
+	svc.mu.Unlock()
+
+	for _, pipe := range pipes {
+		pipe.mu.Lock()
+		pipe.resetLocked()
+		pipe.mu.Unlock()
+	}
+	return len(pipes)
+}
+
+// ConnectionCount returns the number of open connections (not yet closed by both ends, nor reset).
+func (svc *NetSvcMockImpl) ConnectionCount() int {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	return len(svc.pipes)
+}
+
+// Dials returns all dials so far (successful or not, including connections closed since then)
+// in the order they finished.
+func (svc *NetSvcMockImpl) Dials() []NetMockDial {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	return append([]NetMockDial(nil), svc.dials...)
+}
+
+// checkNetwork returns an error for networks other than TCP ones.
+func checkNetwork(op, network string) error {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return nil
+	}
+	return &net.OpError{Op: op, Net: network, Err: net.UnknownNetworkError(network)}
+}
+
+// ipMatchesNetwork tells whether ip may be used with network (e.g. only IPv4 with "tcp4").
+func ipMatchesNetwork(ip net.IP, network string) bool {
+	switch network {
+	case "tcp4":
+		return ip.To4() != nil
+	case "tcp6":
+		return ip.To4() == nil
+	}
+	return true
+}
+
+// resolve returns IPs of host (an IP or a name to look up) usable with network.
+func (svc *NetSvcMockImpl) resolve(ctx context.Context, network, host string) ([]net.IP, error) {
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		var err error
+		if ips, err = svc.dnsSvc.LookupIPContext(ctx, host); err != nil {
+			return nil, err
+		}
+	}
+
+	var usable []net.IP
+	for _, ip := range ips {
+		if ipMatchesNetwork(ip, network) {
+			usable = append(usable, ip)
+		}
+	}
+	if len(usable) == 0 {
+		return nil, &net.AddrError{Err: "no suitable address found", Addr: host}
+	}
+	return usable, nil
+}
+
+// splitHostPort splits address into host and numeric port.
+func splitHostPort(address string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return "", 0, &net.AddrError{Err: "invalid port", Addr: address}
+	}
+	return host, int(port), nil
+}
+
+// Listen announces on the in-memory network. An empty or unspecified (e.g. "0.0.0.0") host means
+// all addresses; port 0 picks an ephemeral port.
+func (svc *NetSvcMockImpl) Listen(network, address string) (net.Listener, error) {
+	if err := checkNetwork("listen", network); err != nil {
+		return nil, err
+	}
+
+	opErr := func(addr net.Addr, err error) error {
+		return &net.OpError{Op: "listen", Net: network, Addr: addr, Err: err}
+	}
+
+	host, port, err := splitHostPort(address)
+	if err != nil {
+		return nil, opErr(nil, err)
+	}
+
+	var ip net.IP
+	if host == "" {
+		ip = net.IPv6unspecified
+		if network == "tcp4" {
+			ip = net.IPv4zero
+		}
+	} else {
+		ips, err := svc.resolve(context.Background(), network, host)
+		if err != nil {
+			return nil, opErr(nil, err)
+		}
+		ip = ips[0]
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	if port == 0 {
+		port = svc.nextPortLocked()
+	}
+	addr := &net.TCPAddr{IP: ip, Port: port}
+
+	key := netMockListenKey{ip: ip.String(), port: port}
+	if ip.IsUnspecified() {
+		key.ip = ""
+	}
+	if _, exists := svc.listeners[key]; exists {
+		return nil, opErr(addr, os.NewSyscallError("bind", syscall.EADDRINUSE))
+	}
+
+	l := &netMockListener{
+		svc:    svc,
+		key:    key,
+		addr:   addr,
+		queue:  make(chan *netMockConn, 128),
+		closed: make(chan struct{}),
+	}
+	svc.listeners[key] = l
+	return l, nil
+}
+
+// nextPortLocked returns the next ephemeral port. Must be called with svc.mu held.
+func (svc *NetSvcMockImpl) nextPortLocked() int {
+	port := svc.nextPort
+	svc.nextPort++
+	if svc.nextPort > 65535 {
+		svc.nextPort = 49152
+	}
+	return port
+}
+
+// linkLocked returns the link for the dialed and resolved address. Must be called with svc.mu held.
+func (svc *NetSvcMockImpl) linkLocked(dialed, resolved string) NetMockLink {
+	if link, exists := svc.links[dialed]; exists {
+		return link
+	}
+	if link, exists := svc.links[resolved]; exists {
+		return link
+	}
+	return svc.defaultLink
+}
+
+// DialContext connects to a listener of the in-memory network, trying resolved IPs of the host in order.
+// The dial is recorded, see Dials().
+func (svc *NetSvcMockImpl) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := svc.dial(ctx, network, address)
+
+	svc.mu.Lock()
+	svc.dials = append(svc.dials, NetMockDial{Network: network, Address: address, Conn: conn, Err: err})
+	svc.mu.Unlock()
+
+	return conn, err
+}
+
+// dial implements DialContext().
+func (svc *NetSvcMockImpl) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if err := checkNetwork("dial", network); err != nil {
+		return nil, err
+	}
+
+	host, port, err := splitHostPort(address)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+
+	ips, err := svc.resolve(ctx, network, host)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+
+	for _, ip := range ips {
+		var conn net.Conn
+		if conn, err = svc.dialIP(ctx, network, address, &net.TCPAddr{IP: ip, Port: port}); err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, err
+}
+
+// dialIP connects to the listener at addr.
+func (svc *NetSvcMockImpl) dialIP(ctx context.Context, network, dialed string, addr *net.TCPAddr) (net.Conn, error) {
+	opErr := func(err error) error {
+		return &net.OpError{Op: "dial", Net: network, Addr: addr, Err: err}
+	}
+
+	resolved := addr.String()
+
+	svc.mu.Lock()
+	link := svc.linkLocked(dialed, resolved)
+	svc.mu.Unlock()
+
+	// SYN, SYN-ACK.
+	if link.Latency > 0 {
+		if err := SleepContext(ctx, svc.timeSvc, 2*link.Latency); err != nil {
+			return nil, opErr(err)
+		}
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	l := svc.listeners[netMockListenKey{ip: addr.IP.String(), port: addr.Port}]
+	if l == nil {
+		l = svc.listeners[netMockListenKey{port: addr.Port}]
+	}
+	if l == nil || link.Refuse {
+		return nil, opErr(os.NewSyscallError("connect", syscall.ECONNREFUSED))
+	}
+
+	pipe := newNetMockPipe(svc.timeSvc, link, dialed, resolved)
+	pipe.onDone = func() {
+		svc.mu.Lock()
+		defer svc.mu.Unlock()
+		delete(svc.pipes, pipe)
+	}
+	localAddr := &net.TCPAddr{IP: svc.localIP, Port: svc.nextPortLocked()}
+	client := &netMockConn{pipe: pipe, end: 0, network: network, local: localAddr, remote: addr}
+	server := &netMockConn{pipe: pipe, end: 1, network: network, local: addr, remote: localAddr}
+
+	select {
+	case l.queue <- server:
+	default:
+		// Backlog full.
+		return nil, opErr(os.NewSyscallError("connect", syscall.ECONNREFUSED))
+	}
+
+	svc.pipes[pipe] = struct{}{}
+	return client, nil
+}
+
+// netMockListener is net.Listener of NetSvcMockImpl.
+type netMockListener struct {
+	svc       *NetSvcMockImpl
+	key       netMockListenKey
+	addr      *net.TCPAddr
+	queue     chan *netMockConn // Accept backlog.
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (l *netMockListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.queue:
+		return conn, nil
+	case <-l.closed:
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Addr: l.addr, Err: net.ErrClosed}
+	}
+}
+
+// Close stops listening; connections not accepted yet are reset.
+func (l *netMockListener) Close() error {
+	err := error(&net.OpError{Op: "close", Net: "tcp", Addr: l.addr, Err: net.ErrClosed})
+
+	l.closeOnce.Do(func() {
+		err = nil
+
+		l.svc.mu.Lock()
+		delete(l.svc.listeners, l.key)
+		l.svc.mu.Unlock()
+
+		close(l.closed)
+
+		for {
+			select {
+			case conn := <-l.queue:
+				conn.pipe.mu.Lock()
+				conn.pipe.resetLocked()
+				conn.pipe.mu.Unlock()
+			default:
+				return
+			}
+		}
+	})
+
+	return err
+}
+
+func (l *netMockListener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,215 @@
+package absos
+
+import (
+	"context"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetSvcMock(t *testing.T) {
+	svc := NewNetSvcMock(NewTimeSvcMock(), NewDnsSvcMock(NewTimeSvcMock()))
+
+	testNetSvcEcho(t, svc, "127.0.0.1:0")
+}
+
+func TestNetSvcMockResolve(t *testing.T) {
+	dnsSvc := NewDnsSvcMock(NewTimeSvcMock())
+	dnsSvc.SetLookupIpResult("db.local", []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}, nil)
+	dnsSvc.SetLookupIpResult("v6.local", []net.IP{net.ParseIP("fd00::1")}, nil)
+
+	svc := NewNetSvcMock(NewTimeSvcMock(), dnsSvc)
+	svc.SetLocalIP(net.ParseIP("10.0.0.100"))
+
+	// Only the second IP listens, the first one refuses.
+	l, err := svc.Listen("tcp", "10.0.0.2:5432")
+	assert.Nil(t, err)
+	defer l.Close()
+
+	conn, err := svc.DialContext(context.Background(), "tcp", "db.local:5432")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.2:5432", conn.RemoteAddr().String())
+	assert.Equal(t, "10.0.0.100:49152", conn.LocalAddr().String())
+
+	server, err := l.Accept()
+	assert.Nil(t, err)
+	assert.Equal(t, conn.LocalAddr(), server.RemoteAddr())
+	assert.Equal(t, conn.RemoteAddr(), server.LocalAddr())
+
+	// Resolution errors.
+	_, err = svc.DialContext(context.Background(), "tcp", "nope.local:5432")
+	var dnsErr *net.DNSError
+	assert.ErrorAs(t, err, &dnsErr)
+	assert.True(t, dnsErr.IsNotFound)
+
+	_, err = svc.DialContext(context.Background(), "tcp4", "v6.local:5432")
+	assert.ErrorContains(t, err, "no suitable address found")
+
+	// Listeners on all addresses.
+	l6, err := svc.Listen("tcp", ":80")
+	assert.Nil(t, err)
+	defer l6.Close()
+	assert.Equal(t, "[::]:80", l6.Addr().String())
+
+	conn, err = svc.DialContext(context.Background(), "tcp6", "v6.local:80")
+	assert.Nil(t, err)
+	assert.Equal(t, "[fd00::1]:80", conn.RemoteAddr().String())
+
+	// Listen resolves names, too.
+	l, err = svc.Listen("tcp", "db.local:0")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1:49154", l.Addr().String())
+	assert.Nil(t, l.Close())
+
+	_, err = svc.Listen("tcp", "db.local:http")
+	assert.ErrorContains(t, err, "invalid port")
+	_, err = svc.DialContext(context.Background(), "udp", "db.local:53")
+	assert.ErrorContains(t, err, "unknown network udp")
+}
+
+func TestNetSvcMockRefuse(t *testing.T) {
+	svc := NewNetSvcMock(NewTimeSvcMock(), NewDnsSvcMock(NewTimeSvcMock()))
+
+	// Nobody listening.
+	_, err := svc.DialContext(context.Background(), "tcp", "10.0.0.1:80")
+	assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+	assert.EqualError(t, err, "dial tcp 10.0.0.1:80: connect: connection refused")
+
+	// Refused by the link.
+	l, err := svc.Listen("tcp", "10.0.0.1:80")
+	assert.Nil(t, err)
+	svc.SetLink("10.0.0.1:80", NetMockLink{Refuse: true})
+	_, err = svc.DialContext(context.Background(), "tcp", "10.0.0.1:80")
+	assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+
+	svc.ClearLinks()
+	conn, err := svc.DialContext(context.Background(), "tcp", "10.0.0.1:80")
+	assert.Nil(t, err)
+
+	// Not accepted yet connections are reset on listener close.
+	assert.Nil(t, l.Close())
+	assert.ErrorIs(t, l.Close(), net.ErrClosed)
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+
+	_, err = svc.DialContext(context.Background(), "tcp", "10.0.0.1:80")
+	assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+
+	dials := svc.Dials()
+	assert.Len(t, dials, 4)
+	assert.Equal(t, NetMockDial{Network: "tcp", Address: "10.0.0.1:80", Conn: conn}, dials[2])
+	for _, i := range []int{0, 1, 3} {
+		assert.Nil(t, dials[i].Conn)
+		assert.ErrorIs(t, dials[i].Err, syscall.ECONNREFUSED)
+	}
+}
+
+func TestNetSvcMockResetConnections(t *testing.T) {
+	dnsSvc := NewDnsSvcMock(NewTimeSvcMock())
+	dnsSvc.SetLookupIpResult("api.local", []net.IP{net.ParseIP("10.0.0.1")}, nil)
+	svc := NewNetSvcMock(NewTimeSvcMock(), dnsSvc)
+
+	l, err := svc.Listen("tcp", ":443")
+	assert.Nil(t, err)
+	defer l.Close()
+
+	conn1, err := svc.DialContext(context.Background(), "tcp", "api.local:443")
+	assert.Nil(t, err)
+	conn2, err := svc.DialContext(context.Background(), "tcp", "10.0.0.1:443")
+	assert.Nil(t, err)
+	conn3, err := svc.DialContext(context.Background(), "tcp", "10.0.0.2:443")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, svc.ConnectionCount())
+
+	server1, err := l.Accept()
+	assert.Nil(t, err)
+
+	// Blocked reads are woken up.
+	readErr := make(chan error)
+	go func() {
+		_, err := server1.Read(make([]byte, 1))
+		readErr <- err
+	}()
+
+	assert.Equal(t, 2, svc.ResetConnections("10.0.0.1:443"))
+	assert.ErrorIs(t, <-readErr, syscall.ECONNRESET)
+	assert.Equal(t, 1, svc.ConnectionCount())
+
+	for _, conn := range []net.Conn{conn1, conn2} {
+		_, err = conn.Write([]byte("x"))
+		assert.ErrorIs(t, err, syscall.ECONNRESET)
+	}
+
+	_, err = conn3.Write([]byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, svc.ResetConnections("api.local:443"))
+}
+
+func TestNetSvcMockDialLatency(t *testing.T) {
+	timeSvc := NewTimeSvcMock()
+	svc := NewNetSvcMock(timeSvc, NewDnsSvcMock(timeSvc))
+	svc.SetDefaultLink(NetMockLink{Latency: 10 * time.Millisecond})
+
+	l, err := svc.Listen("tcp", ":80")
+	assert.Nil(t, err)
+	defer l.Close()
+
+	// Takes a round trip.
+	dialed := make(chan error)
+	go func() {
+		_, err := svc.DialContext(context.Background(), "tcp", "10.0.0.1:80")
+		dialed <- err
+	}()
+	timeSvc.WaitForSleepers(1)
+	assert.Equal(t, time.Time{}.Add(20*time.Millisecond), timeSvc.SleepersDue()[0].DueTime)
+	timeSvc.Add(20 * time.Millisecond)
+	assert.Nil(t, <-dialed)
+
+	// Honors ctx.
+	ctx, cancel := WithTimeout(context.Background(), timeSvc, 5*time.Millisecond)
+	defer cancel()
+	go func() {
+		_, err := svc.DialContext(ctx, "tcp", "10.0.0.1:80")
+		dialed <- err
+	}()
+	timeSvc.WaitForSleepers(2)
+	timeSvc.Add(5 * time.Millisecond)
+	err = <-dialed
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	var opErr *net.OpError
+	assert.ErrorAs(t, err, &opErr)
+	assert.Equal(t, "dial", opErr.Op)
+}
+
+func TestNetSvcMockEOF(t *testing.T) {
+	svc := NewNetSvcMock(NewTimeSvcMock(), NewDnsSvcMock(NewTimeSvcMock()))
+
+	l, err := svc.Listen("tcp", "127.0.0.1:80")
+	assert.Nil(t, err)
+	defer l.Close()
+
+	conn, err := svc.DialContext(context.Background(), "tcp", "127.0.0.1:80")
+	assert.Nil(t, err)
+	server, err := l.Accept()
+	assert.Nil(t, err)
+
+	// Buffered, writes don't wait for reads.
+	_, err = conn.Write([]byte("request"))
+	assert.Nil(t, err)
+	assert.Nil(t, conn.Close())
+
+	data, err := io.ReadAll(server)
+	assert.Nil(t, err)
+	assert.Equal(t, "request", string(data))
+
+	_, err = server.Write([]byte("response"))
+	assert.ErrorIs(t, err, syscall.EPIPE)
+
+	assert.Equal(t, 1, svc.ConnectionCount())
+	assert.Nil(t, server.Close())
+	assert.Equal(t, 0, svc.ConnectionCount())
+}
@@ -0,0 +1,264 @@
+package absos
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// netMockChunk is a piece of written data, readable by the peer since readyAt.
+type netMockChunk struct {
+	data    []byte
+	readyAt time.Time
+}
+
+// netMockPipe is the state of a connection of NetSvcMockImpl, shared by both of its ends.
+//
+// End 0 is the dialing one, end 1 the accepted one. Arrays are indexed by end.
+type netMockPipe struct {
+	timeSvc  TimeSvc
+	link     NetMockLink
+	dialed   string // Dialed address, e.g. "db.local:5432".
+	resolved string // Resolved address, e.g. "10.0.0.1:5432".
+	onDone   func() // Called once both ends are closed, or the connection is reset.
+
+	mu            sync.Mutex
+	changed       chan struct{} // Closed (and replaced) on every change.
+	incoming      [2][]netMockChunk
+	linkFreeAt    [2]time.Time // When the data written so far towards the end is transferred.
+	closed        [2]bool
+	readDeadline  [2]time.Time
+	writeDeadline [2]time.Time
+	transferred   int64
+	reset         bool
+	done          bool
+}
+
+func newNetMockPipe(timeSvc TimeSvc, link NetMockLink, dialed, resolved string) *netMockPipe {
+	return &netMockPipe{
+		timeSvc:  timeSvc,
+		link:     link,
+		dialed:   dialed,
+		resolved: resolved,
+		changed:  make(chan struct{}),
+	}
+}
+
+// changedLocked wakes up everybody waiting for a change. Must be called with p.mu held.
+func (p *netMockPipe) changedLocked() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// resetLocked resets the connection. Must be called with p.mu held.
+func (p *netMockPipe) resetLocked() {
+	if !p.reset {
+		p.reset = true
+		p.incoming = [2][]netMockChunk{}
+		p.changedLocked()
+		p.doneLocked()
+	}
+}
+
+// doneLocked calls onDone (once). Must be called with p.mu held.
+func (p *netMockPipe) doneLocked() {
+	if !p.done {
+		p.done = true
+		if p.onDone != nil {
+			p.onDone()
+		}
+	}
+}
+
+// wait waits (with p.mu not held) for a change, or until the wake time (if not zero) in TimeSvc time.
+func (p *netMockPipe) wait(changed chan struct{}, now, wake time.Time) {
+	if wake.IsZero() {
+		<-changed
+		return
+	}
+
+	timer := p.timeSvc.NewTimer(wake.Sub(now))
+	defer timer.Stop()
+
+	select {
+	case <-changed:
+	case <-timer.C():
+	}
+}
+
+// netMockConn is net.Conn of NetSvcMockImpl, one end of netMockPipe.
+type netMockConn struct {
+	pipe    *netMockPipe
+	end     int
+	network string
+	local   net.Addr
+	remote  net.Addr
+}
+
+func (c *netMockConn) opError(op string, err error) error {
+	return &net.OpError{Op: op, Net: c.network, Source: c.local, Addr: c.remote, Err: err}
+}
+
+func (c *netMockConn) Read(b []byte) (int, error) {
+	p := c.pipe
+	for {
+		p.mu.Lock()
+
+		if p.closed[c.end] {
+			p.mu.Unlock()
+			return 0, c.opError("read", net.ErrClosed)
+		}
+		if p.reset {
+			p.mu.Unlock()
+			return 0, c.opError("read", os.NewSyscallError("read", syscall.ECONNRESET))
+		}
+
+		now := p.timeSvc.Now()
+		deadline := p.readDeadline[c.end]
+		if !deadline.IsZero() && !now.Before(deadline) {
+			p.mu.Unlock()
+			return 0, c.opError("read", os.ErrDeadlineExceeded)
+		}
+
+		incoming := p.incoming[c.end]
+		if len(incoming) > 0 && !incoming[0].readyAt.After(now) {
+			n := copy(b, incoming[0].data)
+			if n == len(incoming[0].data) {
+				p.incoming[c.end] = incoming[1:]
+			} else {
+				p.incoming[c.end][0].data = incoming[0].data[n:]
+			}
+			p.mu.Unlock()
+			return n, nil
+		}
+
+		if len(incoming) == 0 && p.closed[1-c.end] {
+			p.mu.Unlock()
+			return 0, io.EOF
+		}
+
+		wake := deadline
+		if len(incoming) > 0 && (wake.IsZero() || incoming[0].readyAt.Before(wake)) {
+			wake = incoming[0].readyAt
+		}
+		changed := p.changed
+		p.mu.Unlock()
+
+		p.wait(changed, now, wake)
+	}
+}
+
+func (c *netMockConn) Write(b []byte) (int, error) {
+	p := c.pipe
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed[c.end] {
+		return 0, c.opError("write", net.ErrClosed)
+	}
+	if p.reset {
+		return 0, c.opError("write", os.NewSyscallError("write", syscall.ECONNRESET))
+	}
+
+	now := p.timeSvc.Now()
+	if deadline := p.writeDeadline[c.end]; !deadline.IsZero() && !now.Before(deadline) {
+		return 0, c.opError("write", os.ErrDeadlineExceeded)
+	}
+
+	if p.closed[1-c.end] {
+		return 0, c.opError("write", os.NewSyscallError("write", syscall.EPIPE))
+	}
+
+	data := b
+	limit := p.link.ResetAfterBytes
+	if limit > 0 && p.transferred+int64(len(data)) > limit {
+		data = data[:limit-p.transferred]
+	}
+
+	if len(data) > 0 {
+		peer := 1 - c.end
+		transferredAt := now
+		if p.linkFreeAt[peer].After(now) {
+			transferredAt = p.linkFreeAt[peer]
+		}
+		if bps := p.link.BytesPerSecond; bps > 0 {
+			transferredAt = transferredAt.Add(time.Duration(int64(len(data)) * int64(time.Second) / bps))
+		}
+		p.linkFreeAt[peer] = transferredAt
+
+		p.incoming[peer] = append(p.incoming[peer], netMockChunk{
+			data:    bytes.Clone(data),
+			readyAt: transferredAt.Add(p.link.Latency),
+		})
+		p.transferred += int64(len(data))
+		p.changedLocked()
+	}
+
+	if limit > 0 && p.transferred >= limit {
+		p.resetLocked()
+		return len(data), c.opError("write", os.NewSyscallError("write", syscall.ECONNRESET))
+	}
+	return len(data), nil
+}
+
+// Close closes the end; the peer reads EOF once it reads all data written so far, and its writes fail with EPIPE.
+func (c *netMockConn) Close() error {
+	p := c.pipe
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed[c.end] {
+		return c.opError("close", net.ErrClosed)
+	}
+
+	p.closed[c.end] = true
+	p.incoming[c.end] = nil
+	p.changedLocked()
+	if p.closed[1-c.end] {
+		p.doneLocked()
+	}
+	return nil
+}
+
+func (c *netMockConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *netMockConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// SetDeadline sets both the read and write deadlines, in TimeSvc time.
+func (c *netMockConn) SetDeadline(t time.Time) error {
+	p := c.pipe
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readDeadline[c.end] = t
+	p.writeDeadline[c.end] = t
+	p.changedLocked()
+	return nil
+}
+
+// SetReadDeadline sets the read deadline, in TimeSvc time.
+func (c *netMockConn) SetReadDeadline(t time.Time) error {
+	p := c.pipe
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readDeadline[c.end] = t
+	p.changedLocked()
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline, in TimeSvc time.
+func (c *netMockConn) SetWriteDeadline(t time.Time) error {
+	p := c.pipe
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.writeDeadline[c.end] = t
+	p.changedLocked()
+	return nil
+}
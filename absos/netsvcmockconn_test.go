@@ -0,0 +1,170 @@
+package absos
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// netMockConnPair returns the dialing and the accepted end of a connection over the link.
+func netMockConnPair(t *testing.T, timeSvc *TimeSvcMockImpl, link NetMockLink) (net.Conn, net.Conn) {
+	svc := NewNetSvcMock(timeSvc, NewDnsSvcMock(timeSvc))
+	svc.SetDefaultLink(link)
+
+	l, err := svc.Listen("tcp", "10.0.0.1:80")
+	assert.Nil(t, err)
+	defer l.Close()
+
+	dialed := make(chan net.Conn)
+	go func() {
+		conn, err := svc.DialContext(context.Background(), "tcp", "10.0.0.1:80")
+		assert.Nil(t, err)
+		dialed <- conn
+	}()
+
+	if link.Latency > 0 {
+		timeSvc.WaitForSleepers(1)
+		timeSvc.Add(2 * link.Latency)
+	}
+
+	server, err := l.Accept()
+	assert.Nil(t, err)
+	return <-dialed, server
+}
+
+// readAsync reads from conn in a goroutine, the result is sent as a string, or the error.
+func readAsync(conn net.Conn, size int) chan any {
+	result := make(chan any, 1)
+	go func() {
+		buf := make([]byte, size)
+		n, err := conn.Read(buf)
+		if err != nil {
+			result <- err
+		} else {
+			result <- string(buf[:n])
+		}
+	}()
+	return result
+}
+
+func TestNetMockConnPartialReads(t *testing.T) {
+	client, server := netMockConnPair(t, NewTimeSvcMock(), NetMockLink{})
+
+	_, err := client.Write([]byte("hello"))
+	assert.Nil(t, err)
+	_, err = client.Write([]byte("world"))
+	assert.Nil(t, err)
+
+	buf := make([]byte, 3)
+	var got []string
+	for range 4 {
+		n, err := server.Read(buf)
+		assert.Nil(t, err)
+		got = append(got, string(buf[:n]))
+	}
+	assert.Equal(t, []string{"hel", "lo", "wor", "ld"}, got)
+}
+
+func TestNetMockConnLatency(t *testing.T) {
+	timeSvc := NewTimeSvcMock()
+	client, server := netMockConnPair(t, timeSvc, NetMockLink{Latency: 10 * time.Millisecond})
+
+	_, err := client.Write([]byte("ping"))
+	assert.Nil(t, err)
+
+	read := readAsync(server, 10)
+	timeSvc.WaitForSleepers(1)
+	timeSvc.Add(9 * time.Millisecond)
+	timeSvc.WaitForSleepers(1)
+	assert.Len(t, read, 0)
+
+	timeSvc.Add(time.Millisecond)
+	assert.Equal(t, "ping", <-read)
+}
+
+func TestNetMockConnBandwidth(t *testing.T) {
+	timeSvc := NewTimeSvcMock()
+	client, server := netMockConnPair(t, timeSvc, NetMockLink{BytesPerSecond: 1000})
+
+	// Queued, not blocking.
+	_, err := client.Write(make([]byte, 500))
+	assert.Nil(t, err)
+	_, err = client.Write(make([]byte, 250))
+	assert.Nil(t, err)
+
+	read := readAsync(server, 1000)
+	timeSvc.WaitForSleepers(1)
+	assert.Equal(t, time.Time{}.Add(500*time.Millisecond), timeSvc.SleepersDue()[0].DueTime)
+	timeSvc.Add(500 * time.Millisecond)
+	assert.Len(t, <-read, 500)
+
+	read = readAsync(server, 1000)
+	timeSvc.WaitForSleepers(1)
+	timeSvc.Add(250 * time.Millisecond)
+	assert.Len(t, <-read, 250)
+
+	// The other direction is independent.
+	_, err = server.Write(make([]byte, 100))
+	assert.Nil(t, err)
+	read = readAsync(client, 1000)
+	timeSvc.WaitForSleepers(1)
+	timeSvc.Add(100 * time.Millisecond)
+	assert.Len(t, <-read, 100)
+}
+
+func TestNetMockConnDeadlines(t *testing.T) {
+	timeSvc := NewTimeSvcMock()
+	client, server := netMockConnPair(t, timeSvc, NetMockLink{})
+
+	assert.Nil(t, server.SetReadDeadline(timeSvc.Now().Add(10*time.Millisecond)))
+	read := readAsync(server, 10)
+	timeSvc.WaitForSleepers(1)
+	timeSvc.Add(10 * time.Millisecond)
+
+	err := (<-read).(error)
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	var netErr net.Error
+	assert.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+
+	// Extending the deadline makes reads work again.
+	assert.Nil(t, server.SetDeadline(time.Time{}))
+	_, err = client.Write([]byte("late"))
+	assert.Nil(t, err)
+	assert.Equal(t, "late", <-readAsync(server, 10))
+
+	// A deadline set while (possibly) blocked in Read.
+	read = readAsync(client, 10)
+	assert.Nil(t, client.SetReadDeadline(timeSvc.Now()))
+	assert.ErrorIs(t, (<-read).(error), os.ErrDeadlineExceeded)
+
+	assert.Nil(t, client.SetWriteDeadline(timeSvc.Now()))
+	_, err = client.Write([]byte("x"))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
+
+func TestNetMockConnResetAfterBytes(t *testing.T) {
+	client, server := netMockConnPair(t, NewTimeSvcMock(), NetMockLink{ResetAfterBytes: 8})
+
+	n, err := client.Write([]byte("hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, n)
+
+	n, err = server.Write([]byte("world"))
+	assert.Equal(t, 3, n)
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+
+	_, err = client.Read(make([]byte, 10))
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	_, err = server.Read(make([]byte, 10))
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+
+	assert.Nil(t, client.Close())
+	_, err = client.Write([]byte("x"))
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
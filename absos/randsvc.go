@@ -0,0 +1,99 @@
+package absos
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"io"
+	"math/rand/v2"
+)
+
+// RandSvc is a source of random numbers.
+//
+// The default implementation (NewRandSvc()) is cryptographically secure; RandSvcMockImpl is
+// deterministic. RandSvc is an io.Reader, so it can be passed to functions taking one
+// (e.g. utils.GenSecureRandomIdWithRand()). All methods are safe for concurrent use.
+type RandSvc interface {
+	// Read fills b with random bytes. It never fails, returning len(b) and nil.
+	Read(b []byte) (int, error)
+
+	// Bytes returns n random bytes.
+	Bytes(n int) []byte
+
+	// IntN returns a random int in [0, n). Panics if n <= 0.
+	IntN(n int) int
+
+	// IntRange returns a random int in [lo, hi). Panics if hi <= lo.
+	IntRange(lo, hi int) int
+
+	// Float64 returns a random float64 in [0.0, 1.0).
+	Float64() float64
+
+	// Shuffle pseudo-randomizes the order of n elements using swap, see rand.Shuffle().
+	Shuffle(n int, swap func(i, j int))
+}
+
+// randSource is the source of random bytes and numbers of randSvcImpl.
+type randSource interface {
+	rand.Source
+	io.Reader
+}
+
+// randSvcImpl implements RandSvc on top of randSource.
+type randSvcImpl struct {
+	src randSource
+	rnd *rand.Rand // Stateless besides src, so safe for concurrent use as long as src is.
+}
+
+func newRandSvcImpl(src randSource) randSvcImpl {
+	return randSvcImpl{src: src, rnd: rand.New(src)}
+}
+
+func (svc randSvcImpl) Read(b []byte) (int, error) {
+	return svc.src.Read(b)
+}
+
+func (svc randSvcImpl) Bytes(n int) []byte {
+	b := make([]byte, n)
+	_, _ = svc.src.Read(b)
+	return b
+}
+
+func (svc randSvcImpl) IntN(n int) int {
+	return svc.rnd.IntN(n)
+}
+
+func (svc randSvcImpl) IntRange(lo, hi int) int {
+	if hi <= lo {
+		panic("invalid argument to IntRange")
+	}
+	return lo + int(svc.rnd.Uint64N(uint64(hi-lo)))
+}
+
+func (svc randSvcImpl) Float64() float64 {
+	return svc.rnd.Float64()
+}
+
+func (svc randSvcImpl) Shuffle(n int, swap func(i, j int)) {
+	svc.rnd.Shuffle(n, swap)
+}
+
+// cryptoRandSource is randSource backed by crypto/rand.
+type cryptoRandSource struct{}
+
+func (cryptoRandSource) Read(b []byte) (int, error) {
+	// Never fails, crashes the program irrecoverably instead.
+	return cryptorand.Read(b)
+}
+
+func (cryptoRandSource) Uint64() uint64 {
+	var b [8]byte
+	_, _ = cryptorand.Read(b[:])
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+var randSvcImplInstance = newRandSvcImpl(cryptoRandSource{})
+
+// NewRandSvc returns RandSvc backed by crypto/rand.
+func NewRandSvc() RandSvc {
+	return randSvcImplInstance
+}
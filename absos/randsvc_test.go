@@ -0,0 +1,63 @@
+package absos
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRandSvc(t *testing.T) {
+	svc := NewRandSvc()
+	assert.Equal(t, svc, NewRandSvc())
+
+	testRandSvc(t, svc)
+
+	// Not reproducible.
+	assert.NotEqual(t, svc.Bytes(32), svc.Bytes(32))
+}
+
+// testRandSvc checks ranges & basic properties of values returned by svc.
+// Used for both the real RandSvc and RandSvcMockImpl.
+func testRandSvc(t *testing.T, svc RandSvc) {
+	b := make([]byte, 64)
+	n, err := svc.Read(b)
+	assert.Nil(t, err)
+	assert.Equal(t, 64, n)
+	assert.NotEqual(t, make([]byte, 64), b)
+
+	assert.Len(t, svc.Bytes(0), 0)
+	assert.Len(t, svc.Bytes(100), 100)
+
+	seen := make(map[int]bool)
+	for range 1000 {
+		v := svc.IntN(10)
+		assert.True(t, v >= 0 && v < 10)
+		seen[v] = true
+
+		v = svc.IntRange(-5, 5)
+		assert.True(t, v >= -5 && v < 5)
+
+		f := svc.Float64()
+		assert.True(t, f >= 0 && f < 1)
+	}
+	assert.Len(t, seen, 10)
+	assert.Equal(t, 7, svc.IntRange(7, 8))
+
+	assert.Panics(t, func() { svc.IntN(0) })
+	assert.Panics(t, func() { svc.IntRange(5, 5) })
+
+	s := make([]int, 100)
+	for i := range s {
+		s[i] = i
+	}
+	svc.Shuffle(len(s), func(i, j int) { s[i], s[j] = s[j], s[i] })
+	assert.False(t, slices.IsSorted(s))
+	slices.Sort(s)
+	for i, v := range s {
+		assert.Equal(t, i, v)
+	}
+
+	assert.False(t, bytes.Equal(svc.Bytes(16), svc.Bytes(16)))
+}
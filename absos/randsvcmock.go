@@ -0,0 +1,58 @@
+package absos
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"sync"
+)
+
+// lockedChaCha8Source is randSource backed by rand.ChaCha8, guarded by a mutex.
+type lockedChaCha8Source struct {
+	mu     sync.Mutex
+	chacha *rand.ChaCha8
+}
+
+func (src *lockedChaCha8Source) Read(b []byte) (int, error) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return src.chacha.Read(b)
+}
+
+func (src *lockedChaCha8Source) Uint64() uint64 {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return src.chacha.Uint64()
+}
+
+func (src *lockedChaCha8Source) seed(seed uint64) {
+	var b [32]byte
+	binary.LittleEndian.PutUint64(b[:], seed)
+
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	src.chacha = rand.NewChaCha8(b)
+}
+
+// RandSvcMockImpl provides deterministic randomness implementing RandSvc for testing purposes.
+//
+// Instances created with the same seed return the same values for the same sequence of calls,
+// so e.g. generated IDs can be compared against golden values. The values are stable across
+// Go versions (ChaCha8 based), but NOT secure; never use it outside of tests.
+type RandSvcMockImpl struct {
+	randSvcImpl
+	src *lockedChaCha8Source
+}
+
+var _ RandSvc = (*RandSvcMockImpl)(nil)
+
+// NewRandSvcMock creates a new RandSvcMockImpl instance seeded with seed.
+func NewRandSvcMock(seed uint64) *RandSvcMockImpl {
+	src := &lockedChaCha8Source{}
+	src.seed(seed)
+	return &RandSvcMockImpl{randSvcImpl: newRandSvcImpl(src), src: src}
+}
+
+// Reseed restarts the sequence of values as if the instance was created with seed.
+func (svc *RandSvcMockImpl) Reseed(seed uint64) {
+	svc.src.seed(seed)
+}
@@ -0,0 +1,45 @@
+package absos
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRandSvcMock(t *testing.T) {
+	testRandSvc(t, NewRandSvcMock(1))
+
+	// Golden values, stable across Go versions.
+	svc := NewRandSvcMock(42)
+	assert.Equal(t, "22301fb8d82978da", fmt.Sprintf("%x", svc.Bytes(8)))
+	assert.Equal(t, 20, svc.IntN(100))
+	assert.Equal(t, 12, svc.IntRange(10, 20))
+	assert.Equal(t, 0.7199765230578118, svc.Float64())
+
+	s := []int{1, 2, 3, 4, 5}
+	svc.Shuffle(len(s), func(i, j int) { s[i], s[j] = s[j], s[i] })
+	assert.Equal(t, []int{1, 3, 5, 2, 4}, s)
+
+	// Reproducible.
+	svc.Reseed(42)
+	assert.Equal(t, "22301fb8d82978da", fmt.Sprintf("%x", svc.Bytes(8)))
+	assert.Equal(t, NewRandSvcMock(7).Bytes(32), NewRandSvcMock(7).Bytes(32))
+	assert.NotEqual(t, NewRandSvcMock(7).Bytes(32), NewRandSvcMock(8).Bytes(32))
+}
+
+func TestRandSvcMockConcurrent(t *testing.T) {
+	svc := NewRandSvcMock(1)
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() {
+			for range 1000 {
+				svc.IntN(10)
+				svc.Bytes(3)
+			}
+		})
+	}
+	wg.Wait()
+}
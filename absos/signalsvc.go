@@ -0,0 +1,55 @@
+package absos
+
+import (
+	"context"
+	"os"
+	"os/signal"
+)
+
+// SignalSvc wraps OS signal handling of the os/signal pkg.
+//
+// Method semantics follow the ones of the os/signal pkg functions of the same names: incoming
+// signals are relayed to c without blocking (so c should be buffered), no sigs means all signals.
+type SignalSvc interface {
+	Notify(c chan<- os.Signal, sigs ...os.Signal)
+	Stop(c chan<- os.Signal)
+}
+
+type signalSvcImpl struct{}
+
+var signalSvcImplInstance = signalSvcImpl{}
+
+// NewSignalSvc returns SignalSvc relaying real OS signals.
+func NewSignalSvc() SignalSvc {
+	return signalSvcImplInstance
+}
+
+func (signalSvcImpl) Notify(c chan<- os.Signal, sigs ...os.Signal) {
+	signal.Notify(c, sigs...)
+}
+
+func (signalSvcImpl) Stop(c chan<- os.Signal) {
+	signal.Stop(c)
+}
+
+// SignalContext is signal.NotifyContext() using signalSvc: the returned context is cancelled
+// once one of sigs arrives, the parent is done, or stop is called (which also stops the relaying).
+func SignalContext(parent context.Context, signalSvc SignalSvc, sigs ...os.Signal) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+
+	c := make(chan os.Signal, 1)
+	signalSvc.Notify(c, sigs...)
+
+	go func() {
+		select {
+		case <-c:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		cancel()
+		signalSvc.Stop(c)
+	}
+}
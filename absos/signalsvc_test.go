@@ -0,0 +1,61 @@
+package absos
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignalSvc(t *testing.T) {
+	svc := NewSignalSvc()
+	assert.Equal(t, svc, NewSignalSvc())
+
+	c := make(chan os.Signal, 1)
+	svc.Notify(c, syscall.SIGUSR1)
+	defer svc.Stop(c)
+
+	assert.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	select {
+	case sig := <-c:
+		assert.Equal(t, syscall.SIGUSR1, sig)
+	case <-time.After(time.Second):
+		t.Fatal("signal not relayed")
+	}
+}
+
+func TestSignalContext(t *testing.T) {
+	svc := NewSignalSvcMock()
+
+	ctx, stop := SignalContext(context.Background(), svc, syscall.SIGTERM)
+	assert.Equal(t, 1, svc.ListenerCount(syscall.SIGTERM))
+	assert.Equal(t, 0, svc.Send(syscall.SIGINT))
+	assert.Nil(t, ctx.Err())
+
+	assert.Equal(t, 1, svc.Send(syscall.SIGTERM))
+	<-ctx.Done()
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+
+	stop()
+	assert.Equal(t, 0, svc.ListenerCount(syscall.SIGTERM))
+
+	// Parent done.
+	parent, cancel := context.WithCancel(context.Background())
+	ctx, stop = SignalContext(parent, svc, syscall.SIGTERM)
+	defer stop()
+	cancel()
+	<-ctx.Done()
+
+	// Real signals.
+	ctx, stop = SignalContext(context.Background(), NewSignalSvc(), syscall.SIGUSR2)
+	defer stop()
+	assert.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGUSR2))
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("ctx not cancelled")
+	}
+}
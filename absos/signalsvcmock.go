@@ -0,0 +1,84 @@
+package absos
+
+import (
+	"os"
+	"slices"
+	"sync"
+)
+
+// SignalSvcMockImpl delivers fake signals implementing SignalSvc for testing purposes.
+//
+// Signals are only delivered by Send(), never by the OS.
+type SignalSvcMockImpl struct {
+	mu        sync.Mutex
+	listeners map[chan<- os.Signal][]os.Signal // Empty signal list means all signals.
+}
+
+var _ SignalSvc = (*SignalSvcMockImpl)(nil)
+
+// NewSignalSvcMock creates a new SignalSvcMockImpl instance.
+func NewSignalSvcMock() *SignalSvcMockImpl {
+	return &SignalSvcMockImpl{listeners: make(map[chan<- os.Signal][]os.Signal)}
+}
+
+func (svc *SignalSvcMockImpl) Notify(c chan<- os.Signal, sigs ...os.Signal) {
+	if c == nil {
+		panic("signal: Notify using nil channel")
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	existing, exists := svc.listeners[c]
+	switch {
+	case len(sigs) == 0 || (exists && len(existing) == 0):
+		svc.listeners[c] = nil
+	default:
+		for _, sig := range sigs {
+			if !slices.Contains(existing, sig) {
+				existing = append(existing, sig)
+			}
+		}
+		svc.listeners[c] = existing
+	}
+}
+
+func (svc *SignalSvcMockImpl) Stop(c chan<- os.Signal) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	delete(svc.listeners, c)
+}
+
+// Send delivers sig to all channels registered for it, without blocking: like with real signals,
+// it's dropped for channels without free buffer space. Returns the number of channels delivered to.
+func (svc *SignalSvcMockImpl) Send(sig os.Signal) int {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	delivered := 0
+	for c, sigs := range svc.listeners {
+		if len(sigs) > 0 && !slices.Contains(sigs, sig) {
+			continue
+		}
+		select {
+		case c <- sig:
+			delivered++
+		default:
+		}
+	}
+	return delivered
+}
+
+// ListenerCount returns the number of channels registered for sig.
+func (svc *SignalSvcMockImpl) ListenerCount(sig os.Signal) int {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	count := 0
+	for _, sigs := range svc.listeners {
+		if len(sigs) == 0 || slices.Contains(sigs, sig) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,47 @@
+package absos
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignalSvcMock(t *testing.T) {
+	svc := NewSignalSvcMock()
+
+	term := make(chan os.Signal, 1)
+	all := make(chan os.Signal, 2)
+	svc.Notify(term, syscall.SIGTERM)
+	svc.Notify(all)
+
+	assert.Equal(t, 2, svc.ListenerCount(syscall.SIGTERM))
+	assert.Equal(t, 1, svc.ListenerCount(syscall.SIGHUP))
+
+	assert.Equal(t, 2, svc.Send(syscall.SIGTERM))
+	assert.Equal(t, syscall.SIGTERM, <-term)
+	assert.Equal(t, syscall.SIGTERM, <-all)
+
+	// Dropped when the buffer is full, like real signals.
+	assert.Equal(t, 2, svc.Send(syscall.SIGTERM))
+	assert.Equal(t, 1, svc.Send(syscall.SIGHUP))
+	assert.Equal(t, 0, svc.Send(syscall.SIGTERM))
+	assert.Equal(t, syscall.SIGTERM, <-term)
+	assert.Equal(t, syscall.SIGTERM, <-all)
+	assert.Equal(t, syscall.SIGHUP, <-all)
+
+	// Adding signals.
+	svc.Notify(term, syscall.SIGINT, syscall.SIGTERM)
+	assert.Equal(t, 2, svc.ListenerCount(syscall.SIGINT))
+	svc.Notify(all, syscall.SIGINT) // Still all signals.
+	assert.Equal(t, 1, svc.ListenerCount(syscall.SIGHUP))
+
+	svc.Stop(term)
+	svc.Stop(term)
+	assert.Equal(t, 1, svc.ListenerCount(syscall.SIGTERM))
+	svc.Stop(all)
+	assert.Equal(t, 0, svc.Send(syscall.SIGTERM))
+
+	assert.Panics(t, func() { svc.Notify(nil) })
+}
@@ -0,0 +1,108 @@
+package absos
+
+import (
+	"context"
+	"time"
+)
+
+// SleepContext sleeps for d using timeSvc, but returns ctx.Err() as soon as ctx is done.
+// Returns nil if the whole duration elapsed.
+func SleepContext(ctx context.Context, timeSvc TimeSvc, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	timer := timeSvc.NewTimer(d)
+	defer timer.Stop()
+
+	wait := func() error {
+		select {
+		case <-timer.C():
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	// Parked in the mock for its auto-advance mode.
+	if mock, ok := timeSvc.(*TimeSvcMockImpl); ok {
+		var err error
+		mock.Parked(func() { err = wait() })
+		return err
+	}
+	return wait()
+}
+
+// WithTimeout is context.WithTimeout() with the timeout measured by timeSvc.
+//
+// See WithDeadline() for details.
+func WithTimeout(parent context.Context, timeSvc TimeSvc, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return WithDeadline(parent, timeSvc, timeSvc.Now().Add(timeout))
+}
+
+// WithDeadline is context.WithDeadline() with the deadline measured by timeSvc.
+//
+// With the real TimeSvc it simply calls context.WithDeadline(). Otherwise (e.g. TimeSvcMockImpl)
+// the returned context is cancelled by a timeSvc timer, i.e. once the mock time passes the deadline.
+// Either way, Err() of the context (and of contexts derived from it) returns
+// context.DeadlineExceeded once the deadline passed.
+func WithDeadline(parent context.Context, timeSvc TimeSvc, deadline time.Time) (context.Context, context.CancelFunc) {
+	if _, ok := timeSvc.(timeSvcImpl); ok {
+		return context.WithDeadline(parent, deadline)
+	}
+
+	if cur, ok := parent.Deadline(); ok && cur.Before(deadline) {
+		// The current deadline is already sooner than the new one.
+		return context.WithCancel(parent)
+	}
+
+	inner, cancel := context.WithCancelCause(parent)
+	ctx := &deadlineCtx{
+		Context:  inner,
+		deadline: deadline,
+		done:     make(chan struct{}),
+	}
+	context.AfterFunc(inner, func() { close(ctx.done) })
+
+	timer := timeSvc.AfterFunc(deadline.Sub(timeSvc.Now()), func() {
+		cancel(context.DeadlineExceeded)
+	})
+
+	return ctx, func() {
+		timer.Stop()
+		cancel(context.Canceled)
+	}
+}
+
+// deadlineCtx is a context with a deadline enforced by a TimeSvc timer.
+//
+// The embedded context is cancelled with context.DeadlineExceeded as the cause once the deadline
+// passes. It can't be used as is, since its Err() would return context.Canceled. And since contexts
+// derived from a standard context.Context share its done channel (and its Err()), deadlineCtx
+// uses its own done channel, which makes derived contexts ask its own Err() instead.
+type deadlineCtx struct {
+	context.Context
+	deadline time.Time
+	done     chan struct{}
+}
+
+func (c *deadlineCtx) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+func (c *deadlineCtx) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *deadlineCtx) Err() error {
+	select {
+	case <-c.done:
+	default:
+		return nil
+	}
+
+	if context.Cause(c.Context) == context.DeadlineExceeded {
+		return context.DeadlineExceeded
+	}
+	return c.Context.Err()
+}
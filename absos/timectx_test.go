@@ -0,0 +1,158 @@
+package absos
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSleepContext(t *testing.T) {
+	svc := NewTimeSvcMock()
+
+	// Completes normally once mock time is advanced.
+	done := make(chan error)
+	go func() {
+		done <- SleepContext(context.Background(), svc, time.Second)
+	}()
+
+	svc.WaitForSleepers(1)
+	svc.AdvanceToNextSleepEvent()
+	assert.Nil(t, <-done)
+
+	// Returns early on cancellation, does not leave a sleeper behind.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		done <- SleepContext(ctx, svc, time.Second)
+	}()
+
+	svc.WaitForSleepers(1)
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	assert.Equal(t, 0, svc.SleeperCount())
+
+	// Does not sleep at all with a done context.
+	assert.Equal(t, context.Canceled, SleepContext(ctx, svc, time.Second))
+
+	// Real time.
+	assert.Nil(t, SleepContext(context.Background(), NewTimeSvc(), time.Millisecond))
+}
+
+func TestWithTimeoutMock(t *testing.T) {
+	svc := NewTimeSvcMock()
+	svc.Add(time.Hour)
+
+	ctx, cancel := WithTimeout(context.Background(), svc, time.Second)
+	defer cancel()
+
+	child, childCancel := context.WithCancel(ctx)
+	defer childCancel()
+
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.Equal(t, time.Time{}.Add(time.Hour+time.Second), deadline)
+
+	deadline, ok = child.Deadline()
+	assert.True(t, ok)
+	assert.Equal(t, time.Time{}.Add(time.Hour+time.Second), deadline)
+
+	svc.Add(999 * time.Millisecond)
+	assert.Nil(t, ctx.Err())
+	assert.Nil(t, child.Err())
+
+	svc.Add(time.Millisecond)
+	<-ctx.Done()
+	<-child.Done()
+
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+	assert.Equal(t, context.DeadlineExceeded, context.Cause(ctx))
+	assert.Equal(t, context.DeadlineExceeded, child.Err())
+	assert.Equal(t, context.DeadlineExceeded, context.Cause(child))
+}
+
+func TestWithDeadlineMockCancel(t *testing.T) {
+	svc := NewTimeSvcMock()
+
+	ctx, cancel := WithDeadline(context.Background(), svc, time.Time{}.Add(time.Second))
+	assert.Equal(t, 1, svc.SleeperCount())
+
+	cancel()
+	<-ctx.Done()
+
+	assert.Equal(t, context.Canceled, ctx.Err())
+	assert.Equal(t, context.Canceled, context.Cause(ctx))
+	assert.Equal(t, 0, svc.SleeperCount())
+
+	// Deadline passing afterwards changes nothing.
+	svc.Add(time.Hour)
+	assert.Equal(t, context.Canceled, ctx.Err())
+}
+
+func TestWithDeadlineMockParent(t *testing.T) {
+	svc := NewTimeSvcMock()
+
+	// Parent cancellation propagates.
+	parent, parentCancel := context.WithCancel(context.Background())
+
+	ctx, cancel := WithTimeout(parent, svc, time.Second)
+	defer cancel()
+
+	parentCancel()
+	<-ctx.Done()
+	assert.Equal(t, context.Canceled, ctx.Err())
+
+	// Sooner parent deadline wins.
+	parent, parentCancel = WithTimeout(context.Background(), svc, time.Second)
+	defer parentCancel()
+
+	ctx, cancel = WithTimeout(parent, svc, time.Minute)
+	defer cancel()
+
+	deadline, _ := ctx.Deadline()
+	assert.Equal(t, time.Time{}.Add(time.Second), deadline)
+
+	svc.Add(time.Second)
+	<-ctx.Done()
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+
+	// Later parent deadline does not.
+	parent, parentCancel = WithTimeout(context.Background(), svc, time.Minute)
+	defer parentCancel()
+
+	ctx, cancel = WithTimeout(parent, svc, time.Second)
+	defer cancel()
+
+	svc.Add(time.Second)
+	<-ctx.Done()
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+	assert.Nil(t, parent.Err())
+}
+
+func TestWithDeadlineMockPast(t *testing.T) {
+	svc := NewTimeSvcMock()
+	svc.Add(time.Hour)
+
+	ctx, cancel := WithDeadline(context.Background(), svc, time.Time{})
+	defer cancel()
+
+	<-ctx.Done()
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+	assert.Equal(t, 0, svc.SleeperCount())
+}
+
+func TestWithTimeoutReal(t *testing.T) {
+	svc := NewTimeSvc()
+
+	ctx, cancel := WithTimeout(context.Background(), svc, time.Millisecond)
+	defer cancel()
+
+	<-ctx.Done()
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+
+	ctx, cancel = WithDeadline(context.Background(), svc, time.Now().Add(time.Hour))
+	cancel()
+
+	<-ctx.Done()
+	assert.Equal(t, context.Canceled, ctx.Err())
+}
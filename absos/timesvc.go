@@ -5,6 +5,43 @@ import "time"
 type TimeSvc interface {
 	Now() time.Time
 	Sleep(d time.Duration)
+
+	// NewTimer is time.NewTimer().
+	NewTimer(d time.Duration) Timer
+
+	// NewTicker is time.NewTicker(). Panics if d <= 0.
+	NewTicker(d time.Duration) Ticker
+
+	// After is time.After().
+	After(d time.Duration) <-chan time.Time
+
+	// AfterFunc is time.AfterFunc(), f is called in its own goroutine. The returned Timer has no channel.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer abstracts time.Timer. Stop/Reset semantics are those of Go 1.23+ timers,
+// i.e. no stale values are received from C() after Stop() or Reset() returns.
+type Timer interface {
+	// C returns the channel the current time is sent on when the timer fires (nil for AfterFunc timers).
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing. Returns false if the timer already fired or was stopped.
+	Stop() bool
+
+	// Reset changes the timer to fire after d. Returns true if the timer had been active.
+	Reset(d time.Duration) bool
+}
+
+// Ticker abstracts time.Ticker.
+type Ticker interface {
+	// C returns the channel the ticks are sent on.
+	C() <-chan time.Time
+
+	// Stop turns off the ticker.
+	Stop()
+
+	// Reset stops the ticker and resets its period to d. Panics if d <= 0.
+	Reset(d time.Duration)
 }
 
 type timeSvcImpl struct{}
@@ -22,3 +59,51 @@ func (timeSvcImpl) Now() time.Time {
 func (timeSvcImpl) Sleep(d time.Duration) {
 	time.Sleep(d)
 }
+
+func (timeSvcImpl) NewTimer(d time.Duration) Timer {
+	return timerImpl{time.NewTimer(d)}
+}
+
+func (timeSvcImpl) NewTicker(d time.Duration) Ticker {
+	return tickerImpl{time.NewTicker(d)}
+}
+
+func (timeSvcImpl) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (timeSvcImpl) AfterFunc(d time.Duration, f func()) Timer {
+	return timerImpl{time.AfterFunc(d, f)}
+}
+
+type timerImpl struct {
+	t *time.Timer
+}
+
+func (t timerImpl) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t timerImpl) Stop() bool {
+	return t.t.Stop()
+}
+
+func (t timerImpl) Reset(d time.Duration) bool {
+	return t.t.Reset(d)
+}
+
+type tickerImpl struct {
+	t *time.Ticker
+}
+
+func (t tickerImpl) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t tickerImpl) Stop() {
+	t.t.Stop()
+}
+
+func (t tickerImpl) Reset(d time.Duration) {
+	t.t.Reset(d)
+}
@@ -28,3 +28,27 @@ func TestTimeSvcSleep(t *testing.T) {
 
 	assert.Greater(t, t2.Sub(t1), 9*time.Microsecond)
 }
+
+func TestTimeSvcTimers(t *testing.T) {
+	svc := NewTimeSvc()
+
+	timer := svc.NewTimer(time.Millisecond)
+	<-timer.C()
+	assert.False(t, timer.Stop())
+	assert.False(t, timer.Reset(time.Hour))
+	assert.True(t, timer.Stop())
+
+	<-svc.After(time.Millisecond)
+
+	ticker := svc.NewTicker(time.Millisecond)
+	<-ticker.C()
+	ticker.Reset(2 * time.Millisecond)
+	<-ticker.C()
+	ticker.Stop()
+
+	called := make(chan any)
+	timer = svc.AfterFunc(time.Millisecond, func() { close(called) })
+	<-called
+	assert.Nil(t, timer.C())
+	assert.False(t, timer.Stop())
+}
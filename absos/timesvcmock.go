@@ -9,16 +9,17 @@ import (
 // sleepRequest represents a single Sleep() call with its due time and synchronization channels.
 type sleepRequest struct {
 	dueTime     time.Time
-	releaseChan chan any // Used to signal the sleeper to wake up.
-	doneChan    chan any // Used by sleeper to signal completion.
+	releaseChan chan any  // Used to signal the sleeper to wake up.
+	doneChan    chan any  // Used by sleeper to signal completion.
+	callers     []uintptr // Stack of the Sleep() caller, for diagnostics.
 }
 
 // TimeSvcMockImpl provides a mock implementation of TimeSvc for testing purposes.
 // It allows controlled time advancement and synchronization with sleeping goroutines.
 //
-// The mock works by intercepting Sleep() calls and coordinating them with test code
-// via AdvanceToNextSleepEvent() or Add(). This enables deterministic testing of time-dependent
-// code without relying on real time delays.
+// The mock works by intercepting Sleep() calls and timers (NewTimer(), NewTicker(), After(),
+// AfterFunc()) and coordinating them with test code via AdvanceToNextSleepEvent() or Add().
+// This enables deterministic testing of time-dependent code without relying on real time delays.
 //
 // Thread Safety: All methods are thread-safe and can be called from multiple goroutines.
 //
@@ -26,6 +27,9 @@ type sleepRequest struct {
 //  1. Goroutines call Sleep() which blocks until their due time is reached via Add() or AdvanceToNextSleepEvent().
 //  2. Test calls Add() to advance mock time and automatically release sleepers whose due time has passed.
 //  3. Test calls AdvanceToNextSleepEvent() to advance to the next sleep event and release those sleepers.
+//
+// Timers and tickers fire the same way sleepers are released: in due-time order, when the mock
+// time reaches their due time. Active timers and tickers count as sleepers (see SleeperCount()).
 type TimeSvcMockImpl struct {
 	// mu protects all fields below from concurrent access.
 	mu sync.Mutex
@@ -35,6 +39,22 @@ type TimeSvcMockImpl struct {
 
 	// sleepers contains all currently sleeping goroutines waiting to be awakened.
 	sleepers []*sleepRequest
+
+	// timers contains all active (not yet fired or stopped) timers and tickers.
+	timers []*mockTimer
+
+	// cond is signalled on every change of the mock state, see changedLocked().
+	cond *sync.Cond
+
+	// generation is incremented on every change of the mock state, see changedLocked().
+	generation uint64
+
+	// Goroutine tracking and auto-advance state, see timesvcmockauto.go.
+	tracked       map[uint64]struct{}
+	parked        map[uint64]int // Nesting depth of Sleep()/Parked() calls by goroutine id.
+	pendingStarts int
+	autoAdvance   *autoAdvancer
+	deadlockErr   error
 }
 
 // NewTimeSvcMock creates a new TimeSvcMockImpl instance.
@@ -48,31 +68,16 @@ func NewTimeSvcMock() *TimeSvcMockImpl {
 
 // SleeperCount returns the current number of registered sleepers.
 //
+// Active timers and tickers are counted as sleepers as well, since goroutines waiting for them
+// are, in fact, sleeping.
+//
 // This method is useful for testing to ensure all expected sleepers
 // have registered before proceeding with time advancement.
 // Thread-safe for concurrent access.
 func (svc *TimeSvcMockImpl) SleeperCount() int {
 	svc.mu.Lock()
 	defer svc.mu.Unlock()
-	return len(svc.sleepers)
-}
-
-// WaitForSleepers waits until the specified number of sleepers are registered.
-//
-// This method provides deterministic synchronization for tests, ensuring
-// all expected Sleep() calls have registered before advancing time.
-// Thread-safe for concurrent access.
-func (svc *TimeSvcMockImpl) WaitForSleepers(count int) {
-	for {
-		svc.mu.Lock()
-		currentCount := len(svc.sleepers)
-		svc.mu.Unlock()
-
-		if currentCount >= count {
-			return
-		}
-		time.Sleep(1 * time.Millisecond)
-	}
+	return len(svc.sleepers) + len(svc.timers)
 }
 
 // Now returns the current mock time.
@@ -89,49 +94,109 @@ func (svc *TimeSvcMockImpl) Now() time.Time {
 
 // Add advances the mock time by the specified duration.
 //
-// This method automatically releases all sleepers whose due time has been reached
-// or passed after the time advancement.
+// This method automatically releases all sleepers and fires all timers whose due time has been
+// reached or passed, in due-time order. The mock time is set to the due time of each event
+// while it's released, and to the final time afterwards.
 // Thread-safe for concurrent access.
 func (svc *TimeSvcMockImpl) Add(d time.Duration) {
-	func() {
-		svc.mu.Lock()
-		defer svc.mu.Unlock()
-		svc.Time = svc.Time.Add(d)
-	}()
-
-	svc.releaseReadySleepers()
+	svc.advanceTo(svc.Now().Add(d))
 }
 
-// releaseReadySleepers finds and releases all sleepers whose due time has been reached.
+// advanceTo advances the mock time to target, releasing due sleepers and firing due timers
+// in due-time order on the way.
 // This method must be called without holding svc.mu as it will acquire and release the lock itself.
-func (svc *TimeSvcMockImpl) releaseReadySleepers() {
-	var readySleepers []*sleepRequest
+func (svc *TimeSvcMockImpl) advanceTo(target time.Time) {
+	for {
+		var readySleepers []*sleepRequest
+		fired := false
 
-	func() {
-		svc.mu.Lock()
-		defer svc.mu.Unlock()
+		func() {
+			svc.mu.Lock()
+			defer svc.mu.Unlock()
 
-		// Find sleepers whose due time has been reached.
-		var remaining []*sleepRequest
-		for _, sleeper := range svc.sleepers {
-			if svc.Time.Before(sleeper.dueTime) {
-				// This sleeper's due time has not been reached yet.
-				remaining = append(remaining, sleeper)
-			} else {
-				// This sleeper's due time has been reached.
-				readySleepers = append(readySleepers, sleeper)
+			dueTime, found := svc.nextDueTimeLocked()
+			if !found || dueTime.After(target) {
+				if svc.Time.Before(target) {
+					svc.Time = target
+					svc.changedLocked()
+				}
+				return
 			}
+
+			defer svc.changedLocked()
+
+			if dueTime.After(svc.Time) {
+				svc.Time = dueTime
+			}
+
+			fired = svc.fireReadyTimersLocked()
+
+			// Find sleepers whose due time has been reached.
+			var remaining []*sleepRequest
+			for _, sleeper := range svc.sleepers {
+				if svc.Time.Before(sleeper.dueTime) {
+					// This sleeper's due time has not been reached yet.
+					remaining = append(remaining, sleeper)
+				} else {
+					// This sleeper's due time has been reached.
+					readySleepers = append(readySleepers, sleeper)
+				}
+			}
+			svc.sleepers = remaining
+		}()
+
+		if !fired && len(readySleepers) == 0 {
+			return
 		}
-		svc.sleepers = remaining
-	}()
 
-	// Release sleepers without holding the lock.
-	for _, sleeper := range readySleepers {
-		sleeper.releaseChan <- nil
+		// Release sleepers without holding the lock.
+		for _, sleeper := range readySleepers {
+			sleeper.releaseChan <- nil
+
+			// Wait for sleeper to actually wake up and complete.
+			<-sleeper.doneChan
+		}
+	}
+}
+
+// changedLocked records a change of the mock state (time, sleepers, timers, tracked goroutines)
+// and wakes up everyone waiting for one. Must be called with svc.mu held.
+func (svc *TimeSvcMockImpl) changedLocked() {
+	svc.generation++
+	if svc.cond != nil {
+		svc.cond.Broadcast()
+	}
+}
+
+// waitLocked waits for the next change of the mock state. Must be called with svc.mu held.
+func (svc *TimeSvcMockImpl) waitLocked() {
+	svc.condLocked().Wait()
+}
+
+// condLocked returns svc.cond, creates it on first use. Must be called with svc.mu held.
+func (svc *TimeSvcMockImpl) condLocked() *sync.Cond {
+	if svc.cond == nil {
+		svc.cond = sync.NewCond(&svc.mu)
+	}
+	return svc.cond
+}
 
-		// Wait for sleeper to actually wake up and complete.
-		<-sleeper.doneChan
+// nextDueTimeLocked returns the minimum due time among all sleepers and timers.
+// Must be called with svc.mu held.
+func (svc *TimeSvcMockImpl) nextDueTimeLocked() (minDueTime time.Time, found bool) {
+	for _, sleeper := range svc.sleepers {
+		if !found || sleeper.dueTime.Before(minDueTime) {
+			minDueTime = sleeper.dueTime
+			found = true
+		}
 	}
+	for _, timer := range svc.timers {
+		if !found || timer.dueTime.Before(minDueTime) {
+			minDueTime = timer.dueTime
+			found = true
+		}
+	}
+	return
 }
 
 // Sleep simulates sleeping for the specified duration.
@@ -142,6 +207,7 @@ func (svc *TimeSvcMockImpl) releaseReadySleepers() {
 func (svc *TimeSvcMockImpl) Sleep(d time.Duration) {
 	releaseChan := make(chan any, 1)
 	doneChan := make(chan any, 1)
+	id := currentGoroutineId()
 
 	func() {
 		svc.mu.Lock()
@@ -152,13 +218,19 @@ func (svc *TimeSvcMockImpl) Sleep(d time.Duration) {
 			dueTime:     dueTime,
 			releaseChan: releaseChan,
 			doneChan:    doneChan,
+			callers:     captureCallers(),
 		}
 		svc.sleepers = append(svc.sleepers, request)
+		svc.parkLocked(id)
 	}()
 
 	// Block until released by Add() or AdvanceToNextSleepEvent().
 	<-releaseChan
 
+	svc.mu.Lock()
+	svc.unparkLocked(id)
+	svc.mu.Unlock()
+
 	// Signal completion before yielding.
 	doneChan <- nil
 	runtime.Gosched()
@@ -166,11 +238,11 @@ func (svc *TimeSvcMockImpl) Sleep(d time.Duration) {
 
 // AdvanceToNextSleepEvent advances mock time to the next sleep event and releases those sleepers.
 //
-// This method finds the minimum due time among all current sleepers, advances
-// the mock time to that point, and releases all sleepers whose due time has
-// been reached.
+// This method finds the minimum due time among all current sleepers and timers, advances
+// the mock time to that point, and releases all sleepers and fires all timers whose due time
+// has been reached.
 //
-// Returns 0 if no sleepers are present, otherwise returns the duration advanced.
+// Returns 0 if no sleepers or timers are present, otherwise returns the duration advanced.
 // Thread-safe for concurrent access.
 func (svc *TimeSvcMockImpl) AdvanceToNextSleepEvent() time.Duration {
 	var currentTime time.Time
@@ -182,24 +254,17 @@ func (svc *TimeSvcMockImpl) AdvanceToNextSleepEvent() time.Duration {
 		defer svc.mu.Unlock()
 
 		currentTime = svc.Time
+		minDueTime, found = svc.nextDueTimeLocked()
+	}()
 
-		// Find the minimum due time among all sleepers.
-		for _, sleeper := range svc.sleepers {
-			if !found || sleeper.dueTime.Before(minDueTime) {
-				minDueTime = sleeper.dueTime
-				found = true
-			}
-		}
+	if !found {
+		return 0
+	}
 
-		if found {
-			// Advance time to the minimum due time.
-			svc.Time = minDueTime
-		}
-	}()
+	svc.advanceTo(minDueTime)
 
-	if found {
-		svc.releaseReadySleepers()
-		return minDueTime.Sub(currentTime)
+	if minDueTime.Before(currentTime) {
+		return 0
 	}
-	return 0
+	return minDueTime.Sub(currentTime)
 }
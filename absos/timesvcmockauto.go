@@ -0,0 +1,320 @@
+package absos
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kattecon/akgoli/utils"
+)
+
+// ErrTimeMockDeadlock is returned by TimeSvcMockImpl.WaitGoroutines() if the auto-advance mode
+// detected that all tracked goroutines are parked and there is nothing to advance the time to.
+const ErrTimeMockDeadlock = utils.ConstError("time mock deadlock: all tracked goroutines are parked and no sleepers are pending")
+
+// AutoAdvanceConfig configures the auto-advance mode, see TimeSvcMockImpl.EnableAutoAdvance().
+type AutoAdvanceConfig struct {
+	// PollInterval is the (real time) interval between checks of the tracked goroutines.
+	// Defaults to 1ms.
+	PollInterval time.Duration
+
+	// DeadlockTimeout is how long (in real time) all tracked goroutines may stay parked with
+	// nothing to advance the time to, before it's reported as a deadlock. Defaults to 100ms.
+	DeadlockTimeout time.Duration
+
+	// OnDeadlock is called (from the auto-advance goroutine) when a deadlock is detected. Optional.
+	// The error wraps ErrTimeMockDeadlock and contains stacks of the tracked goroutines.
+	OnDeadlock func(err error)
+}
+
+// autoAdvancer is the state of an enabled auto-advance mode.
+type autoAdvancer struct {
+	cfg     AutoAdvanceConfig
+	stop    chan any
+	stopped chan any
+}
+
+// Go runs f in a new goroutine tracked by the mock.
+//
+// Tracked goroutines are the ones the auto-advance mode watches (see EnableAutoAdvance()) and
+// WaitGoroutines() waits for. Callbacks of AfterFunc() timers are tracked automatically.
+// Goroutines started by tracked goroutines via the plain go statement are not tracked.
+func (svc *TimeSvcMockImpl) Go(f func()) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.goLocked(f)
+}
+
+// goLocked is Go(), must be called with svc.mu held.
+func (svc *TimeSvcMockImpl) goLocked(f func()) {
+	// Counted as running until the goroutine registers its id.
+	svc.pendingStarts++
+
+	go func() {
+		id := currentGoroutineId()
+
+		func() {
+			svc.mu.Lock()
+			defer svc.mu.Unlock()
+			if svc.tracked == nil {
+				svc.tracked = make(map[uint64]struct{})
+			}
+			svc.tracked[id] = struct{}{}
+			svc.pendingStarts--
+			svc.changedLocked()
+		}()
+
+		defer func() {
+			svc.mu.Lock()
+			defer svc.mu.Unlock()
+			delete(svc.tracked, id)
+			svc.changedLocked()
+		}()
+
+		f()
+	}()
+}
+
+// Parked calls f, counting the calling goroutine as parked in the mock meanwhile, like while it's
+// in Sleep(). The auto-advance mode advances the time only once all tracked goroutines are parked,
+// so f is meant to wait for timers of the mock only, e.g. receive from a ticker channel, or select
+// on a timer channel and the context of WithTimeout(). SleepContext() parks on its own.
+func (svc *TimeSvcMockImpl) Parked(f func()) {
+	id := currentGoroutineId()
+
+	svc.mu.Lock()
+	svc.parkLocked(id)
+	svc.mu.Unlock()
+
+	defer func() {
+		svc.mu.Lock()
+		defer svc.mu.Unlock()
+		svc.unparkLocked(id)
+	}()
+
+	f()
+}
+
+// parkLocked counts the goroutine id as parked (see Parked()). Must be called with svc.mu held.
+func (svc *TimeSvcMockImpl) parkLocked(id uint64) {
+	if svc.parked == nil {
+		svc.parked = make(map[uint64]int)
+	}
+	svc.parked[id]++
+	svc.changedLocked()
+}
+
+// unparkLocked reverts parkLocked(). Must be called with svc.mu held.
+func (svc *TimeSvcMockImpl) unparkLocked(id uint64) {
+	svc.parked[id]--
+	if svc.parked[id] == 0 {
+		delete(svc.parked, id)
+	}
+	svc.changedLocked()
+}
+
+// allTrackedParkedLocked tells whether there are tracked goroutines and all of them are parked.
+// Must be called with svc.mu held.
+func (svc *TimeSvcMockImpl) allTrackedParkedLocked() bool {
+	if svc.pendingStarts > 0 || len(svc.tracked) == 0 {
+		return false
+	}
+	for id := range svc.tracked {
+		if svc.parked[id] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// TrackedGoroutineCount returns the number of running goroutines started by Go() or AfterFunc().
+func (svc *TimeSvcMockImpl) TrackedGoroutineCount() int {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	return len(svc.tracked) + svc.pendingStarts
+}
+
+// WaitGoroutines waits until all tracked goroutines (see Go()) have finished.
+//
+// Returns an error wrapping ErrTimeMockDeadlock (and does not wait any longer) if the auto-advance
+// mode detects a deadlock.
+func (svc *TimeSvcMockImpl) WaitGoroutines() error {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	for len(svc.tracked)+svc.pendingStarts > 0 {
+		if svc.deadlockErr != nil {
+			return svc.deadlockErr
+		}
+		svc.waitLocked()
+	}
+
+	return nil
+}
+
+// EnableAutoAdvance turns on the auto-advance mode.
+//
+// In this mode a background goroutine watches goroutines tracked by the mock (see Go()). When all
+// of them are parked in the mock (in Sleep(), SleepContext() or Parked()) and the mock state did
+// not change for two consecutive checks, it advances the time to the next sleep event on its own,
+// exactly like AdvanceToNextSleepEvent() does. If there is no sleep event to advance to for
+// cfg.DeadlockTimeout, it reports a deadlock (see AutoAdvanceConfig.OnDeadlock, WaitGoroutines()).
+//
+// Goroutines blocked on anything else (channels fed by other goroutines, locks, I/O) aren't
+// parked, so the time stands still until they get going again.
+// Calling EnableAutoAdvance() again replaces the config.
+func (svc *TimeSvcMockImpl) EnableAutoAdvance(cfg AutoAdvanceConfig) {
+	svc.DisableAutoAdvance()
+
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Millisecond
+	}
+	if cfg.DeadlockTimeout <= 0 {
+		cfg.DeadlockTimeout = 100 * time.Millisecond
+	}
+
+	aa := &autoAdvancer{
+		cfg:     cfg,
+		stop:    make(chan any),
+		stopped: make(chan any),
+	}
+
+	svc.mu.Lock()
+	svc.autoAdvance = aa
+	svc.deadlockErr = nil
+	svc.mu.Unlock()
+
+	go svc.autoAdvanceLoop(aa)
+}
+
+// DisableAutoAdvance turns off the auto-advance mode (if enabled), waits for it to stop.
+func (svc *TimeSvcMockImpl) DisableAutoAdvance() {
+	svc.mu.Lock()
+	aa := svc.autoAdvance
+	svc.autoAdvance = nil
+	svc.mu.Unlock()
+
+	if aa != nil {
+		close(aa.stop)
+		<-aa.stopped
+	}
+}
+
+func (svc *TimeSvcMockImpl) autoAdvanceLoop(aa *autoAdvancer) {
+	defer close(aa.stopped)
+
+	ticker := time.NewTicker(aa.cfg.PollInterval)
+	defer ticker.Stop()
+
+	// State of the previous check.
+	var blocked, reported bool
+	var blockedGeneration uint64
+	var blockedSince time.Time
+
+	for {
+		select {
+		case <-aa.stop:
+			return
+		case <-ticker.C:
+		}
+
+		svc.mu.Lock()
+		generation := svc.generation
+		parked := svc.allTrackedParkedLocked()
+		ids := make([]uint64, 0, len(svc.tracked))
+		for id := range svc.tracked {
+			ids = append(ids, id)
+		}
+		_, hasEvents := svc.nextDueTimeLocked()
+		svc.mu.Unlock()
+
+		if !parked {
+			blocked = false
+			continue
+		}
+
+		if !blocked || generation != blockedGeneration {
+			// Give it one more check to make sure nothing is going on.
+			blocked, reported = true, false
+			blockedGeneration = generation
+			blockedSince = time.Now()
+			continue
+		}
+
+		if hasEvents {
+			svc.AdvanceToNextSleepEvent()
+			blocked = false
+			continue
+		}
+
+		if !reported && time.Since(blockedSince) >= aa.cfg.DeadlockTimeout {
+			reported = true
+
+			err := fmt.Errorf("%w; tracked goroutines:\n\n%s", ErrTimeMockDeadlock, goroutineStacks(ids))
+
+			svc.mu.Lock()
+			svc.deadlockErr = err
+			svc.changedLocked()
+			svc.mu.Unlock()
+
+			if aa.cfg.OnDeadlock != nil {
+				aa.cfg.OnDeadlock(err)
+			}
+		}
+	}
+}
+
+// currentGoroutineId returns id of the calling goroutine (parsed from its stack trace header).
+func currentGoroutineId() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	id, err := strconv.ParseUint(string(buf[:bytes.IndexByte(buf, ' ')]), 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// dumpGoroutines returns stack traces of all goroutines by their ids.
+func dumpGoroutines() map[uint64]string {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	stacks := make(map[uint64]string)
+	for _, stack := range strings.Split(string(buf), "\n\n") {
+		// Header looks like "goroutine 18 [chan receive, 2 minutes]:".
+		idStr, _, ok := strings.Cut(strings.TrimPrefix(stack, "goroutine "), " [")
+		if !ok {
+			continue
+		}
+		id, err := strconv.ParseUint(idStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		stacks[id] = stack
+	}
+	return stacks
+}
+
+// goroutineStacks returns stack traces of the given goroutines for diagnostics.
+func goroutineStacks(ids []uint64) string {
+	dumps := dumpGoroutines()
+	stacks := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if stack, ok := dumps[id]; ok {
+			stacks = append(stacks, stack)
+		}
+	}
+	return strings.Join(stacks, "\n\n")
+}
@@ -0,0 +1,192 @@
+package absos
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeSvcMockAutoAdvance(t *testing.T) {
+	svc := NewTimeSvcMock()
+	svc.EnableAutoAdvance(AutoAdvanceConfig{})
+	defer svc.DisableAutoAdvance()
+
+	var mu sync.Mutex
+	var woken []time.Duration
+
+	// Variable number of goroutines, some of them sleeping more than once.
+	for i := range 5 {
+		svc.Go(func() {
+			for range i % 2 {
+				svc.Sleep(time.Second)
+			}
+
+			svc.Sleep(time.Duration(i) * time.Minute)
+
+			mu.Lock()
+			defer mu.Unlock()
+			woken = append(woken, svc.Now().Sub(time.Time{}))
+		})
+	}
+
+	assert.Nil(t, svc.WaitGoroutines())
+	assert.Equal(t, 0, svc.TrackedGoroutineCount())
+
+	assert.ElementsMatch(t, []time.Duration{
+		0,
+		time.Second + time.Minute,
+		2 * time.Minute,
+		time.Second + 3*time.Minute,
+		4 * time.Minute,
+	}, woken)
+}
+
+func TestTimeSvcMockAutoAdvanceTimers(t *testing.T) {
+	svc := NewTimeSvcMock()
+	svc.EnableAutoAdvance(AutoAdvanceConfig{})
+	defer svc.DisableAutoAdvance()
+
+	var ticks int
+	var timeoutErr error
+
+	svc.Go(func() {
+		ticker := svc.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for range 3 {
+			svc.Parked(func() { <-ticker.C() })
+			ticks++
+		}
+	})
+
+	svc.Go(func() {
+		ctx, cancel := WithTimeout(context.Background(), svc, time.Minute)
+		defer cancel()
+
+		// Nothing but the timeout is going to happen.
+		svc.Parked(func() {
+			select {
+			case <-ctx.Done():
+				timeoutErr = ctx.Err()
+			case <-svc.After(time.Hour):
+			}
+		})
+	})
+
+	assert.Nil(t, svc.WaitGoroutines())
+	assert.Equal(t, 3, ticks)
+	assert.Equal(t, context.DeadlineExceeded, timeoutErr)
+	assert.Equal(t, time.Time{}.Add(time.Minute), svc.Now())
+}
+
+func TestTimeSvcMockAutoAdvanceDeadlock(t *testing.T) {
+	svc := NewTimeSvcMock()
+
+	reported := make(chan error, 1)
+	svc.EnableAutoAdvance(AutoAdvanceConfig{
+		DeadlockTimeout: 10 * time.Millisecond,
+		OnDeadlock:      func(err error) { reported <- err },
+	})
+	defer svc.DisableAutoAdvance()
+
+	// Waiting for a stopped timer.
+	timer := svc.NewTimer(time.Minute)
+	timer.Stop()
+	svc.Go(func() {
+		svc.Sleep(time.Second)
+		svc.Parked(func() { <-timer.C() })
+	})
+
+	err := svc.WaitGoroutines()
+	assert.ErrorIs(t, err, ErrTimeMockDeadlock)
+	assert.Contains(t, err.Error(), "TestTimeSvcMockAutoAdvanceDeadlock")
+	assert.Contains(t, err.Error(), "[chan receive")
+	assert.Equal(t, err, <-reported)
+
+	// The sleep was advanced before.
+	assert.Equal(t, time.Time{}.Add(time.Second), svc.Now())
+
+	// Once the timer is reset, the goroutine finishes.
+	timer.Reset(time.Minute)
+	svc.EnableAutoAdvance(AutoAdvanceConfig{})
+	assert.Nil(t, svc.WaitGoroutines())
+	assert.Equal(t, time.Time{}.Add(time.Second+time.Minute), svc.Now())
+}
+
+func TestTimeSvcMockAutoAdvanceNotParked(t *testing.T) {
+	svc := NewTimeSvcMock()
+	svc.EnableAutoAdvance(AutoAdvanceConfig{})
+	defer svc.DisableAutoAdvance()
+
+	// Waiting for an untracked worker, with a timeout pending.
+	results := make(chan int)
+	var result int
+	svc.Go(func() {
+		timeout := svc.NewTimer(time.Second)
+		defer timeout.Stop()
+		result = <-results
+	})
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, time.Time{}, svc.Now())
+	assert.Equal(t, 1, svc.TrackedGoroutineCount())
+
+	go func() { results <- 1 }()
+	assert.Nil(t, svc.WaitGoroutines())
+	assert.Equal(t, 1, result)
+	assert.Equal(t, time.Time{}, svc.Now())
+}
+
+func TestTimeSvcMockGoWithoutAutoAdvance(t *testing.T) {
+	svc := NewTimeSvcMock()
+
+	release := make(chan any)
+	svc.Go(func() { <-release })
+	assert.Equal(t, 1, svc.TrackedGoroutineCount())
+
+	// AfterFunc callbacks are tracked, too.
+	called := make(chan any)
+	svc.AfterFunc(time.Second, func() {
+		close(called)
+		<-release
+	})
+	svc.Add(time.Second)
+	<-called
+	assert.Equal(t, 2, svc.TrackedGoroutineCount())
+
+	close(release)
+	assert.Nil(t, svc.WaitGoroutines())
+	assert.Equal(t, 0, svc.TrackedGoroutineCount())
+}
+
+func TestCurrentGoroutineId(t *testing.T) {
+	id := currentGoroutineId()
+	assert.Equal(t, id, currentGoroutineId())
+
+	other := make(chan uint64)
+	go func() { other <- currentGoroutineId() }()
+	assert.NotEqual(t, id, <-other)
+}
+
+func TestGoroutineStacks(t *testing.T) {
+	blocked := make(chan any)
+	ids := make(chan uint64)
+	go func() {
+		ids <- currentGoroutineId()
+		<-blocked
+	}()
+	id := <-ids
+
+	assert.Eventually(t, func() bool {
+		return strings.HasPrefix(dumpGoroutines()[id], fmt.Sprintf("goroutine %d [chan receive", id))
+	}, time.Second, time.Millisecond)
+	assert.Contains(t, dumpGoroutines()[currentGoroutineId()], "TestGoroutineStacks")
+	assert.Contains(t, goroutineStacks([]uint64{id}), "TestGoroutineStacks")
+
+	close(blocked)
+}
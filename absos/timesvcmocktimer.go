@@ -0,0 +1,197 @@
+package absos
+
+import (
+	"slices"
+	"time"
+)
+
+// mockTimer is a timer or ticker of TimeSvcMockImpl.
+//
+// All fields but svc, c and f are protected by svc.mu.
+// Implements Timer, mockTicker adapts it to Ticker.
+type mockTimer struct {
+	svc *TimeSvcMockImpl
+
+	// c is the channel the time is sent on when firing, nil for AfterFunc timers.
+	c chan time.Time
+
+	// f is the function called (in a new goroutine) when firing, nil for channel timers.
+	f func()
+
+	// period is the ticker period, 0 for timers.
+	period time.Duration
+
+	// dueTime is the next time the timer fires at.
+	dueTime time.Time
+
+	// active tells whether the timer is in svc.timers.
+	active bool
+
+	// callers is the stack of the timer creator, for diagnostics.
+	callers []uintptr
+}
+
+// NewTimer creates a timer firing once the mock time reaches now+d.
+// A timer with d <= 0 fires immediately.
+func (svc *TimeSvcMockImpl) NewTimer(d time.Duration) Timer {
+	return svc.startTimer(&mockTimer{svc: svc, c: make(chan time.Time, 1)}, d)
+}
+
+// NewTicker creates a ticker firing every d of mock time. Panics if d <= 0.
+//
+// Like with real tickers, ticks are dropped if the receiver doesn't keep up,
+// e.g. Add(10*d) delivers a single tick if nobody reads the channel meanwhile.
+func (svc *TimeSvcMockImpl) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return mockTicker{svc.startTimer(&mockTimer{svc: svc, c: make(chan time.Time, 1), period: d}, d)}
+}
+
+// After returns a channel receiving the mock time once it reaches now+d.
+func (svc *TimeSvcMockImpl) After(d time.Duration) <-chan time.Time {
+	return svc.NewTimer(d).C()
+}
+
+// AfterFunc calls f in its own goroutine once the mock time reaches now+d.
+// The goroutine is tracked like the ones started by Go().
+//
+// Note that Add() and AdvanceToNextSleepEvent() don't wait for f to complete.
+func (svc *TimeSvcMockImpl) AfterFunc(d time.Duration, f func()) Timer {
+	return svc.startTimer(&mockTimer{svc: svc, f: f}, d)
+}
+
+func (svc *TimeSvcMockImpl) startTimer(t *mockTimer, d time.Duration) *mockTimer {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	defer svc.changedLocked()
+	t.callers = captureCallers()
+	t.scheduleLocked(d)
+	return t
+}
+
+// fireReadyTimersLocked fires all timers whose due time has been reached.
+// Tickers are rescheduled, timers deactivated.
+// Returns whether any timer fired. Must be called with svc.mu held.
+func (svc *TimeSvcMockImpl) fireReadyTimersLocked() bool {
+	fired := false
+
+	// Firing might modify svc.timers, iterate over a copy.
+	for _, t := range slices.Clone(svc.timers) {
+		if svc.Time.Before(t.dueTime) {
+			continue
+		}
+
+		fired = true
+
+		if t.period > 0 {
+			t.dueTime = t.dueTime.Add(t.period)
+		} else {
+			t.removeLocked()
+		}
+
+		t.fireLocked()
+	}
+
+	return fired
+}
+
+// scheduleLocked (re)schedules the timer to fire after d, or fires it right away if d <= 0.
+// Must be called with svc.mu held.
+func (t *mockTimer) scheduleLocked(d time.Duration) {
+	if d <= 0 && t.period == 0 {
+		t.fireLocked()
+		return
+	}
+
+	t.dueTime = t.svc.Time.Add(d)
+	if !t.active {
+		t.active = true
+		t.svc.timers = append(t.svc.timers, t)
+	}
+}
+
+// fireLocked delivers the current mock time to the channel (dropping it if the channel is full),
+// or calls f in a new goroutine. Must be called with svc.mu held.
+func (t *mockTimer) fireLocked() {
+	if t.f != nil {
+		t.svc.goLocked(t.f)
+		return
+	}
+
+	select {
+	case t.c <- t.svc.Time:
+	default:
+	}
+}
+
+// removeLocked removes the timer from the list of active timers.
+// Returns whether the timer was active. Must be called with svc.mu held.
+func (t *mockTimer) removeLocked() bool {
+	if !t.active {
+		return false
+	}
+
+	t.active = false
+	t.svc.timers = slices.DeleteFunc(t.svc.timers, func(other *mockTimer) bool {
+		return other == t
+	})
+	return true
+}
+
+// drainLocked removes a pending value from the channel, so it's not received after Stop/Reset.
+// Must be called with svc.mu held.
+func (t *mockTimer) drainLocked() {
+	select {
+	case <-t.c:
+	default:
+	}
+}
+
+func (t *mockTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *mockTimer) Stop() bool {
+	t.svc.mu.Lock()
+	defer t.svc.mu.Unlock()
+	defer t.svc.changedLocked()
+	t.drainLocked()
+	return t.removeLocked()
+}
+
+// Reset implements both Timer.Reset and Ticker.Reset (the latter doesn't return anything).
+func (t *mockTimer) Reset(d time.Duration) bool {
+	t.svc.mu.Lock()
+	defer t.svc.mu.Unlock()
+	defer t.svc.changedLocked()
+
+	if t.period > 0 {
+		if d <= 0 {
+			panic("non-positive interval for Ticker.Reset")
+		}
+		t.period = d
+	}
+
+	t.drainLocked()
+	wasActive := t.active
+	if d <= 0 {
+		// Fires right away, not active anymore.
+		t.removeLocked()
+	}
+	t.scheduleLocked(d)
+	return wasActive
+}
+
+// mockTicker adapts mockTimer to the Ticker interface.
+type mockTicker struct {
+	*mockTimer
+}
+
+func (t mockTicker) Stop() {
+	t.mockTimer.Stop()
+}
+
+func (t mockTicker) Reset(d time.Duration) {
+	t.mockTimer.Reset(d)
+}
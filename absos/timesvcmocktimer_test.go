@@ -0,0 +1,151 @@
+package absos
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kattecon/akgoli/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeSvcMockTimer(t *testing.T) {
+	svc := NewTimeSvcMock()
+
+	timer := svc.NewTimer(100 * time.Nanosecond)
+	assert.Equal(t, 1, svc.SleeperCount())
+
+	svc.Add(99 * time.Nanosecond)
+	assert.Len(t, timer.C(), 0)
+
+	svc.Add(10 * time.Nanosecond)
+	assert.Equal(t, time.Time{}.Add(100*time.Nanosecond), <-timer.C())
+	assert.Equal(t, 0, svc.SleeperCount())
+
+	// Already fired.
+	assert.False(t, timer.Stop())
+
+	// Reset of a fired timer.
+	assert.False(t, timer.Reset(50*time.Nanosecond))
+	assert.Equal(t, time.Duration(50), svc.AdvanceToNextSleepEvent())
+	assert.Equal(t, time.Time{}.Add(159*time.Nanosecond), <-timer.C())
+
+	// Stopped timers never fire.
+	timer.Reset(10 * time.Nanosecond)
+	assert.True(t, timer.Stop())
+	assert.False(t, timer.Stop())
+	assert.Equal(t, time.Duration(0), svc.AdvanceToNextSleepEvent())
+	svc.Add(time.Second)
+	assert.Len(t, timer.C(), 0)
+
+	// Reset of an active timer, no stale value is received.
+	timer.Reset(0)
+	assert.False(t, timer.Reset(10*time.Nanosecond))
+	assert.Len(t, timer.C(), 0)
+	assert.True(t, timer.Reset(20*time.Nanosecond))
+	assert.Equal(t, time.Duration(20), svc.AdvanceToNextSleepEvent())
+	<-timer.C()
+
+	// Zero duration fires right away.
+	timer = svc.NewTimer(0)
+	<-timer.C()
+	assert.Equal(t, 0, svc.SleeperCount())
+}
+
+func TestTimeSvcMockAfter(t *testing.T) {
+	svc := NewTimeSvcMock()
+
+	c := svc.After(time.Second)
+	svc.Add(time.Hour)
+	assert.Equal(t, time.Time{}.Add(time.Second), <-c)
+	assert.Equal(t, time.Time{}.Add(time.Hour), svc.Now())
+}
+
+func TestTimeSvcMockTicker(t *testing.T) {
+	svc := NewTimeSvcMock()
+
+	ticker := svc.NewTicker(10 * time.Nanosecond)
+
+	for i := 1; i <= 3; i++ {
+		assert.Equal(t, time.Duration(10), svc.AdvanceToNextSleepEvent())
+		assert.Equal(t, time.Time{}.Add(time.Duration(i*10)), <-ticker.C())
+	}
+
+	// Ticks are dropped if nobody receives them.
+	svc.Add(100 * time.Nanosecond)
+	assert.Equal(t, time.Time{}.Add(40*time.Nanosecond), <-ticker.C())
+	assert.Len(t, ticker.C(), 0)
+	assert.Equal(t, 1, svc.SleeperCount())
+
+	ticker.Reset(100 * time.Nanosecond)
+	assert.Equal(t, time.Duration(100), svc.AdvanceToNextSleepEvent())
+	assert.Equal(t, time.Time{}.Add(230*time.Nanosecond), <-ticker.C())
+
+	ticker.Stop()
+	assert.Equal(t, 0, svc.SleeperCount())
+	svc.Add(time.Second)
+	assert.Len(t, ticker.C(), 0)
+
+	assert.Equal(t, "non-positive interval for NewTicker", testutils.CapturePanicValue(func() { svc.NewTicker(0) }))
+	assert.Equal(t, "non-positive interval for Ticker.Reset", testutils.CapturePanicValue(func() { ticker.Reset(-1) }))
+}
+
+func TestTimeSvcMockAfterFunc(t *testing.T) {
+	svc := NewTimeSvcMock()
+
+	var mu sync.Mutex
+	var calls []time.Time
+	var wg sync.WaitGroup
+
+	record := func() {
+		defer wg.Done()
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, svc.Now())
+	}
+
+	wg.Add(1)
+	timer := svc.AfterFunc(time.Second, record)
+	assert.Nil(t, timer.C())
+
+	stopped := svc.AfterFunc(time.Second, func() { t.Error("must not be called") })
+	assert.True(t, stopped.Stop())
+
+	assert.Equal(t, time.Second, svc.AdvanceToNextSleepEvent())
+	wg.Wait()
+
+	wg.Add(1)
+	assert.False(t, timer.Reset(time.Second))
+	svc.Add(time.Minute)
+	wg.Wait()
+
+	assert.Len(t, calls, 2)
+	assert.Equal(t, time.Time{}.Add(time.Second), calls[0])
+}
+
+func TestTimeSvcMockEventOrder(t *testing.T) {
+	svc := NewTimeSvcMock()
+
+	done := make(chan any)
+	go func() {
+		svc.Sleep(30 * time.Nanosecond)
+		close(done)
+	}()
+
+	timer20 := svc.NewTimer(20 * time.Nanosecond)
+	timer40 := svc.NewTimer(40 * time.Nanosecond)
+	ticker := svc.NewTicker(25 * time.Nanosecond)
+
+	svc.WaitForSleepers(4)
+
+	// Each event fires at its own due time.
+	svc.Add(45 * time.Nanosecond)
+	<-done
+
+	assert.Equal(t, time.Time{}.Add(20*time.Nanosecond), <-timer20.C())
+	assert.Equal(t, time.Time{}.Add(40*time.Nanosecond), <-timer40.C())
+	assert.Equal(t, time.Time{}.Add(25*time.Nanosecond), <-ticker.C())
+	assert.Equal(t, time.Time{}.Add(45*time.Nanosecond), svc.Now())
+
+	ticker.Stop()
+}
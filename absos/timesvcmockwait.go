@@ -0,0 +1,167 @@
+package absos
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kattecon/akgoli/utils"
+)
+
+// ErrWaitForSleepers is returned when waiting for sleepers (see TimeSvcMockImpl.WaitForSleepersContext())
+// gives up. The returned error wraps it and lists the current sleepers.
+const ErrWaitForSleepers = utils.ConstError("gave up waiting for sleepers")
+
+// DefaultWaitForSleepersTimeout is the (real time) timeout of TimeSvcMockImpl.WaitForSleepers().
+// Shorter than usual test timeouts, so failing tests tell what's going on instead of just being killed.
+const DefaultWaitForSleepersTimeout = 2 * time.Second
+
+// SleeperInfo describes a pending sleep event of TimeSvcMockImpl.
+type SleeperInfo struct {
+	// Kind is one of "Sleep", "Timer", "Ticker" or "AfterFunc".
+	Kind string
+
+	// DueTime is the mock time the sleeper is released (or the timer fires) at.
+	DueTime time.Time
+
+	// Stack is the stack of the goroutine which called Sleep() or created the timer,
+	// captured at that moment. Frames of the mock itself are omitted.
+	Stack string
+}
+
+func (si SleeperInfo) String() string {
+	return fmt.Sprintf("%s due at %s, created at:\n%s", si.Kind, si.DueTime.Format(time.RFC3339Nano), si.Stack)
+}
+
+// SleepersDue returns all pending sleep events (sleepers and active timers) sorted by due time.
+// Thread-safe for concurrent access.
+func (svc *TimeSvcMockImpl) SleepersDue() []SleeperInfo {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	return svc.sleepersDueLocked()
+}
+
+func (svc *TimeSvcMockImpl) sleepersDueLocked() []SleeperInfo {
+	infos := make([]SleeperInfo, 0, len(svc.sleepers)+len(svc.timers))
+
+	for _, sleeper := range svc.sleepers {
+		infos = append(infos, SleeperInfo{Kind: "Sleep", DueTime: sleeper.dueTime, Stack: formatCallers(sleeper.callers)})
+	}
+
+	for _, timer := range svc.timers {
+		kind := "Timer"
+		if timer.period > 0 {
+			kind = "Ticker"
+		} else if timer.f != nil {
+			kind = "AfterFunc"
+		}
+		infos = append(infos, SleeperInfo{Kind: kind, DueTime: timer.dueTime, Stack: formatCallers(timer.callers)})
+	}
+
+	slices.SortStableFunc(infos, func(a, b SleeperInfo) int {
+		return a.DueTime.Compare(b.DueTime)
+	})
+
+	return infos
+}
+
+// WaitForSleepers waits until the specified number of sleepers are registered.
+//
+// This method provides deterministic synchronization for tests, ensuring
+// all expected Sleep() calls have registered before advancing time.
+// Thread-safe for concurrent access.
+//
+// Panics with the error of WaitForSleepersTimeout() (listing the current sleepers) if the sleepers
+// don't show up within DefaultWaitForSleepersTimeout.
+func (svc *TimeSvcMockImpl) WaitForSleepers(count int) {
+	if err := svc.WaitForSleepersTimeout(count, DefaultWaitForSleepersTimeout); err != nil {
+		panic(err)
+	}
+}
+
+// WaitForSleepersTimeout is WaitForSleepersContext() with a (real time) timeout.
+func (svc *TimeSvcMockImpl) WaitForSleepersTimeout(count int, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return svc.WaitForSleepersContext(ctx, count)
+}
+
+// WaitForSleepersContext waits until the specified number of sleepers (see SleeperCount()) are registered.
+//
+// Returns an error wrapping ErrWaitForSleepers, listing the current sleepers and where they came from,
+// if ctx gets done first.
+// Thread-safe for concurrent access.
+func (svc *TimeSvcMockImpl) WaitForSleepersContext(ctx context.Context, count int) error {
+	// Wake up the waiting below once ctx is done.
+	stop := context.AfterFunc(ctx, func() {
+		svc.mu.Lock()
+		defer svc.mu.Unlock()
+		svc.condLocked().Broadcast()
+	})
+	defer stop()
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	for {
+		current := len(svc.sleepers) + len(svc.timers)
+		if current >= count {
+			return nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return svc.waitForSleepersErrorLocked(count, current, err)
+		}
+
+		svc.waitLocked()
+	}
+}
+
+func (svc *TimeSvcMockImpl) waitForSleepersErrorLocked(count, current int, cause error) error {
+	var b strings.Builder
+	for i, info := range svc.sleepersDueLocked() {
+		fmt.Fprintf(&b, "\n\n#%d %s", i+1, info)
+	}
+
+	return fmt.Errorf("%w (%v): expected %d, got %d; mock time is %s%s",
+		ErrWaitForSleepers, cause, count, current, svc.Time.Format(time.RFC3339Nano), b.String())
+}
+
+// captureCallers captures the stack of the current goroutine for diagnostics.
+func captureCallers() []uintptr {
+	pcs := make([]uintptr, 32)
+	return pcs[:runtime.Callers(2, pcs)]
+}
+
+// mockFramePrefixes are the function name prefixes of frames formatCallers() omits.
+var mockFramePrefixes = []string{
+	"github.com/kattecon/akgoli/absos.(*TimeSvcMockImpl).",
+	"github.com/kattecon/akgoli/absos.(*mockTimer).",
+	"github.com/kattecon/akgoli/absos.mockTicker.",
+	"github.com/kattecon/akgoli/absos.captureCallers",
+}
+
+// formatCallers formats a captured stack similar to runtime/debug.Stack(), omitting frames of the mock.
+func formatCallers(pcs []uintptr) string {
+	var b strings.Builder
+
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+
+		if !slices.ContainsFunc(mockFramePrefixes, func(prefix string) bool {
+			return strings.HasPrefix(frame.Function, prefix)
+		}) {
+			fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	return b.String()
+}
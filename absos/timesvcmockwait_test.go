@@ -0,0 +1,86 @@
+package absos
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kattecon/akgoli/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeSvcMockWaitForSleepersContext(t *testing.T) {
+	svc := NewTimeSvcMock()
+
+	go svc.Sleep(time.Second)
+	go svc.NewTimer(time.Minute)
+
+	assert.Nil(t, svc.WaitForSleepersContext(context.Background(), 2))
+	assert.Nil(t, svc.WaitForSleepersTimeout(2, time.Millisecond))
+
+	// Cancelled context.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := svc.WaitForSleepersContext(ctx, 3)
+	assert.ErrorIs(t, err, ErrWaitForSleepers)
+	assert.Contains(t, err.Error(), "(context canceled): expected 3, got 2")
+
+	svc.Add(time.Minute)
+}
+
+func TestTimeSvcMockWaitForSleepersTimeout(t *testing.T) {
+	svc := NewTimeSvcMock()
+
+	svc.AfterFunc(time.Minute, func() {})
+	svc.NewTicker(time.Hour)
+	sleepForTest(svc)
+
+	err := svc.WaitForSleepersTimeout(4, 10*time.Millisecond)
+	assert.ErrorIs(t, err, ErrWaitForSleepers)
+
+	msg := err.Error()
+	assert.Contains(t, msg, "(context deadline exceeded): expected 4, got 3; mock time is 0001-01-01T00:00:00Z")
+	assert.Contains(t, msg, "#1 Sleep due at 0001-01-01T00:00:01Z, created at:\n")
+	assert.Contains(t, msg, "#2 AfterFunc due at 0001-01-01T00:01:00Z, created at:\n")
+	assert.Contains(t, msg, "#3 Ticker due at 0001-01-01T01:00:00Z, created at:\n")
+	assert.Contains(t, msg, "absos.sleepForTest")
+	assert.Contains(t, msg, "absos.TestTimeSvcMockWaitForSleepersTimeout")
+	assert.NotContains(t, msg, "TimeSvcMockImpl")
+
+	svc.NewTimer(time.Second)
+	assert.Nil(t, testutils.CapturePanicValue(func() { svc.WaitForSleepers(4) }))
+}
+
+func TestTimeSvcMockSleepersDue(t *testing.T) {
+	svc := NewTimeSvcMock()
+	assert.Empty(t, svc.SleepersDue())
+
+	timer := svc.NewTimer(time.Hour)
+	svc.AfterFunc(time.Minute, func() {})
+	sleepForTest(svc)
+
+	due := svc.SleepersDue()
+	assert.Len(t, due, 3)
+
+	assert.Equal(t, "Sleep", due[0].Kind)
+	assert.Equal(t, time.Time{}.Add(time.Second), due[0].DueTime)
+	assert.Contains(t, due[0].Stack, "absos.sleepForTest")
+	assert.NotContains(t, due[0].Stack, "TimeSvcMockImpl")
+
+	assert.Equal(t, "AfterFunc", due[1].Kind)
+	assert.Equal(t, time.Time{}.Add(time.Minute), due[1].DueTime)
+
+	assert.Equal(t, "Timer", due[2].Kind)
+	assert.Equal(t, time.Time{}.Add(time.Hour), due[2].DueTime)
+	assert.Contains(t, due[2].Stack, "absos.TestTimeSvcMockSleepersDue")
+
+	timer.Stop()
+	svc.Add(time.Minute)
+	assert.Empty(t, svc.SleepersDue())
+}
+
+// sleepForTest starts a goroutine sleeping for a second and waits for it to register.
+func sleepForTest(svc *TimeSvcMockImpl) {
+	go func() { svc.Sleep(time.Second) }()
+	svc.WaitForSleepers(svc.SleeperCount() + 1)
+}
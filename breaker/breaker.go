@@ -0,0 +1,328 @@
+// Package breaker provides a circuit breaker for calls to flaky downstream services: once calls
+// fail too much, further ones are rejected right away for a cooldown, then a few trial calls
+// tell whether the service recovered.
+package breaker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/kattecon/akgoli/utils"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// ErrOpen is returned (wrapped, with the breaker name) for calls rejected by an open breaker.
+const ErrOpen = utils.ConstError("circuit breaker open")
+
+// State is the state of Breaker. Its value is the one of the state gauge.
+type State int
+
+const (
+	// StateClosed lets calls through, counting failures.
+	StateClosed State = iota
+
+	// StateOpen rejects calls until the cooldown passes.
+	StateOpen
+
+	// StateHalfOpen lets a few trial calls through: the breaker closes once they all succeed,
+	// and opens again on a failure.
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// windowBuckets is the number of buckets of the failure rate window.
+const windowBuckets = 10
+
+// Config configures Breaker.
+type Config struct {
+	// ConsecutiveFailures opens the breaker after that many failures in a row; 0 disables the
+	// threshold. Defaults to 5 if FailureRate is 0 as well.
+	ConsecutiveFailures int
+
+	// FailureRate (0-1) opens the breaker once the failed part of the calls of the last Window
+	// reaches it; 0 disables the threshold.
+	FailureRate float64
+
+	// MinCalls is the min number of calls of the last Window for FailureRate to apply. Defaults to 10.
+	MinCalls int
+
+	// Window is the period FailureRate is measured over. Defaults to 1m.
+	Window time.Duration
+
+	// Cooldown is the time the breaker stays open before letting trial calls through. Defaults to 30s.
+	Cooldown time.Duration
+
+	// HalfOpenCalls is the number of trial calls, which all must succeed to close the breaker.
+	// Defaults to 1.
+	HalfOpenCalls int
+
+	// IsFailure tells whether an error returned by a call is a failure of the service. Defaults
+	// to all errors but context.Canceled (given up by the caller, not failed).
+	IsFailure func(err error) bool
+}
+
+// DefaultIsFailure is the default Config.IsFailure.
+func DefaultIsFailure(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled)
+}
+
+// bucket counts calls of a part of the failure rate window.
+type bucket struct {
+	index    int64 // Index of the bucket since the breaker was created.
+	calls    int
+	failures int
+}
+
+// Breaker is a circuit breaker. Safe for concurrent use.
+//
+// State changes are logged, the current state is exposed as a gauge (see State for values) and
+// rejected calls as a counter, both with a "breaker" const label of the name. The open breaker
+// turns half-open on the first call (or State()) once the cooldown passed.
+type Breaker struct {
+	name     string
+	cfg      Config
+	timeSvc  absos.TimeSvc
+	logger   *zap.Logger
+	stateG   prometheus.Gauge
+	rejected prometheus.Counter
+
+	// created is the origin of window buckets.
+	created    time.Time
+	bucketSize time.Duration
+
+	mu          sync.Mutex
+	state       State
+	generation  uint64 // Incremented on state changes, results of calls of former ones are ignored.
+	openedAt    time.Time
+	consecutive int
+	buckets     [windowBuckets]bucket
+	trials      int       // Trial calls started in the half-open state.
+	trialAt     time.Time // Start of the last trial call.
+	successes   int       // Trial calls succeeded in the half-open state.
+}
+
+// NewBreaker returns a closed Breaker named name (used in logs & metrics), measuring time using
+// timeSvc, and registering its metrics in m.
+func NewBreaker(name string, cfg Config, timeSvc absos.TimeSvc, logger *zap.Logger, m *metrics.Metrics) *Breaker {
+	if cfg.ConsecutiveFailures <= 0 && cfg.FailureRate <= 0 {
+		cfg.ConsecutiveFailures = 5
+	}
+	if cfg.MinCalls <= 0 {
+		cfg.MinCalls = 10
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 30 * time.Second
+	}
+	if cfg.HalfOpenCalls <= 0 {
+		cfg.HalfOpenCalls = 1
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = DefaultIsFailure
+	}
+
+	constLabels := prometheus.Labels{"breaker": name}
+	b := &Breaker{
+		name:    name,
+		cfg:     cfg,
+		timeSvc: timeSvc,
+		logger:  logger.With(zap.String("breaker", name)),
+		stateG: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name:        m.Prefixed("circuit_breaker_state"),
+				Help:        "State of the circuit breaker (0 closed, 1 open, 2 half-open).",
+				ConstLabels: constLabels,
+			},
+		),
+		rejected: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name:        m.Prefixed("circuit_breaker_rejected_calls"),
+				Help:        "Total number of calls rejected by the circuit breaker.",
+				ConstLabels: constLabels,
+			},
+		),
+		created:    timeSvc.Now(),
+		bucketSize: max(cfg.Window/windowBuckets, 1),
+	}
+	m.MustRegister(b.stateG, b.rejected)
+	return b
+}
+
+// State returns the current state.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.checkCooldownLocked(b.timeSvc.Now())
+	return b.state
+}
+
+// Allow reserves a call: returns an error wrapping ErrOpen if it's rejected, otherwise the func
+// to report the result of the call with (the error it returned, nil on success). done must be
+// called for every allowed call: trial calls not all reported within Cooldown are started over.
+func (b *Breaker) Allow() (done func(err error), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.timeSvc.Now()
+	b.checkCooldownLocked(now)
+
+	switch {
+	case b.state == StateOpen,
+		b.state == StateHalfOpen && b.trials >= b.cfg.HalfOpenCalls:
+		b.rejected.Inc()
+		return nil, errors.Wrap(ErrOpen, b.name)
+	case b.state == StateHalfOpen:
+		b.trials++
+		b.trialAt = now
+	}
+
+	generation := b.generation
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { b.report(generation, b.cfg.IsFailure(err)) })
+	}, nil
+}
+
+// Do calls fn unless the breaker rejects the call (returning an error wrapping ErrOpen), reports
+// its result, and returns its error. A panic of fn is a failure (and goes on).
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+
+	panicked := true
+	defer func() {
+		if panicked {
+			done(errors.New("panicked"))
+		}
+	}()
+	err = fn(ctx)
+	panicked = false
+	done(err)
+	return err
+}
+
+// report records the result of a call allowed in generation.
+func (b *Breaker) report(generation uint64, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		// Allowed in a former state.
+		return
+	}
+	now := b.timeSvc.Now()
+
+	switch b.state {
+	case StateClosed:
+		b.recordLocked(now, failed)
+		if reason := b.tripReasonLocked(now); reason != "" {
+			b.setStateLocked(now, StateOpen, reason)
+		}
+	case StateHalfOpen:
+		if failed {
+			b.setStateLocked(now, StateOpen, "trial call failed")
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenCalls {
+			b.setStateLocked(now, StateClosed, "trial calls succeeded")
+		}
+	}
+}
+
+// recordLocked counts the call in the consecutive failures & the failure rate window.
+func (b *Breaker) recordLocked(now time.Time, failed bool) {
+	if failed {
+		b.consecutive++
+	} else {
+		b.consecutive = 0
+	}
+
+	index := int64(now.Sub(b.created) / b.bucketSize)
+	bkt := &b.buckets[index%windowBuckets]
+	if bkt.index != index {
+		*bkt = bucket{index: index}
+	}
+	bkt.calls++
+	if failed {
+		bkt.failures++
+	}
+}
+
+// tripReasonLocked returns why the breaker opens, "" if it doesn't.
+func (b *Breaker) tripReasonLocked(now time.Time) string {
+	if b.cfg.ConsecutiveFailures > 0 && b.consecutive >= b.cfg.ConsecutiveFailures {
+		return fmt.Sprintf("%d consecutive failures", b.consecutive)
+	}
+
+	if b.cfg.FailureRate > 0 {
+		index := int64(now.Sub(b.created) / b.bucketSize)
+		calls, failures := 0, 0
+		for _, bkt := range b.buckets {
+			if bkt.index > index-windowBuckets {
+				calls += bkt.calls
+				failures += bkt.failures
+			}
+		}
+		if calls >= b.cfg.MinCalls && float64(failures) >= b.cfg.FailureRate*float64(calls) {
+			return fmt.Sprintf("%d of %d calls failed", failures, calls)
+		}
+	}
+	return ""
+}
+
+// checkCooldownLocked turns the open breaker half-open once the cooldown passed, and starts trial
+// calls over if they weren't all reported within the cooldown (e.g. done was never called).
+func (b *Breaker) checkCooldownLocked(now time.Time) {
+	switch {
+	case b.state == StateOpen && !now.Before(b.openedAt.Add(b.cfg.Cooldown)):
+		b.setStateLocked(now, StateHalfOpen, "cooldown passed")
+	case b.state == StateHalfOpen && b.trials >= b.cfg.HalfOpenCalls && !now.Before(b.trialAt.Add(b.cfg.Cooldown)):
+		b.setStateLocked(now, StateHalfOpen, "trial calls expired")
+	}
+}
+
+// setStateLocked changes the state, resetting the counters.
+func (b *Breaker) setStateLocked(now time.Time, state State, reason string) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.consecutive = 0
+	b.buckets = [windowBuckets]bucket{}
+	b.trials = 0
+	b.successes = 0
+	if state == StateOpen {
+		b.openedAt = now
+	}
+	b.stateG.Set(float64(state))
+
+	level := zap.InfoLevel
+	if state == StateOpen {
+		level = zap.WarnLevel
+	}
+	b.logger.Log(level, "Circuit breaker state changed",
+		zap.Stringer("from", from), zap.Stringer("to", state), zap.String("reason", reason))
+}
@@ -0,0 +1,213 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/appinfo"
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/kattecon/akgoli/testutils"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var errBoom = errors.New("boom")
+
+// call makes a call returning err through b.
+func call(b *Breaker, err error) error {
+	return b.Do(context.Background(), func(ctx context.Context) error { return err })
+}
+
+func TestBreakerConsecutiveFailures(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	log := testutils.NewBufferingLogger(zap.DebugLevel)
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	b := NewBreaker("payments", Config{ConsecutiveFailures: 3, Cooldown: 10 * time.Second}, timeSvc, log.Logger, m)
+	assert.Equal(t, StateClosed, b.State())
+
+	// Reset by a success.
+	for _, err := range []error{errBoom, errBoom, nil, errBoom, errBoom} {
+		assert.Equal(t, err, call(b, err))
+	}
+	assert.Equal(t, StateClosed, b.State())
+
+	assert.Equal(t, errBoom, call(b, errBoom))
+	assert.Equal(t, StateOpen, b.State())
+
+	// Rejected without calling.
+	err := b.Do(context.Background(), func(ctx context.Context) error {
+		t.Fatal("called")
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrOpen)
+	assert.EqualError(t, err, "payments: circuit breaker open")
+
+	dump := m.DumpAsTextForTest()
+	assert.Contains(t, dump, `mock_circuit_breaker_state{breaker="payments"} 1`)
+	assert.Contains(t, dump, `mock_circuit_breaker_rejected_calls{breaker="payments"} 1`)
+	assert.Contains(t, log.JsonNoDoubleQuotes(),
+		`'level':'warn','msg':'Circuit breaker state changed','breaker':'payments','from':'closed','to':'open','reason':'3 consecutive failures'`)
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	log := testutils.NewBufferingLogger(zap.DebugLevel)
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	b := NewBreaker("payments", Config{ConsecutiveFailures: 1, Cooldown: 10 * time.Second, HalfOpenCalls: 2}, timeSvc, log.Logger, m)
+	call(b, errBoom)
+
+	timeSvc.Add(9 * time.Second)
+	assert.ErrorIs(t, call(b, nil), ErrOpen)
+
+	timeSvc.Add(time.Second)
+	assert.Equal(t, StateHalfOpen, b.State())
+	assert.Contains(t, m.DumpAsTextForTest(), `mock_circuit_breaker_state{breaker="payments"} 2`)
+
+	// Trial calls only.
+	done1, err := b.Allow()
+	assert.Nil(t, err)
+	done2, err := b.Allow()
+	assert.Nil(t, err)
+	_, err = b.Allow()
+	assert.ErrorIs(t, err, ErrOpen)
+
+	done1(nil)
+	assert.Equal(t, StateHalfOpen, b.State())
+	done1(errBoom) // Reported once only.
+	done2(nil)
+	assert.Equal(t, StateClosed, b.State())
+
+	logs := log.JsonNoDoubleQuotes()
+	assert.Contains(t, logs, `'level':'info','msg':'Circuit breaker state changed','breaker':'payments','from':'open','to':'half-open','reason':'cooldown passed'`)
+	assert.Contains(t, logs, `'level':'info','msg':'Circuit breaker state changed','breaker':'payments','from':'half-open','to':'closed','reason':'trial calls succeeded'`)
+	dump := m.DumpAsTextForTest()
+	assert.Contains(t, dump, `mock_circuit_breaker_state{breaker="payments"} 0`)
+	assert.Contains(t, dump, `mock_circuit_breaker_rejected_calls{breaker="payments"} 2`)
+}
+
+func TestBreakerHalfOpenFailure(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	log := testutils.NewBufferingLogger(zap.DebugLevel)
+	b := NewBreaker("payments", Config{ConsecutiveFailures: 1, Cooldown: 10 * time.Second}, timeSvc, log.Logger, metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	call(b, errBoom)
+	timeSvc.Add(10 * time.Second)
+
+	assert.Equal(t, errBoom, call(b, errBoom))
+	assert.Equal(t, StateOpen, b.State())
+	assert.Contains(t, log.JsonNoDoubleQuotes(), `'from':'half-open','to':'open','reason':'trial call failed'`)
+
+	// A new cooldown.
+	timeSvc.Add(9 * time.Second)
+	assert.Equal(t, StateOpen, b.State())
+	timeSvc.Add(time.Second)
+	assert.Nil(t, call(b, nil))
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreakerFailureRate(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	log := testutils.NewBufferingLogger(zap.DebugLevel)
+	b := NewBreaker("payments", Config{FailureRate: 0.5, MinCalls: 4, Window: 10 * time.Second}, timeSvc, log.Logger, metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+
+	// Below MinCalls.
+	call(b, errBoom)
+	call(b, errBoom)
+	call(b, errBoom)
+	assert.Equal(t, StateClosed, b.State())
+
+	// Out of the window.
+	timeSvc.Add(10 * time.Second)
+	call(b, nil)
+	call(b, nil)
+	call(b, errBoom)
+	assert.Equal(t, StateClosed, b.State())
+
+	timeSvc.Add(time.Second)
+	call(b, errBoom)
+	assert.Equal(t, StateOpen, b.State())
+	assert.Contains(t, log.JsonNoDoubleQuotes(), `'reason':'2 of 4 calls failed'`)
+}
+
+func TestBreakerIsFailure(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	b := NewBreaker("payments", Config{}, timeSvc, zap.NewNop(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+
+	// Cancelled by the caller.
+	for range 10 {
+		call(b, context.Canceled)
+	}
+	assert.Equal(t, StateClosed, b.State())
+
+	// Defaults to 5 consecutive failures.
+	for range 5 {
+		call(b, context.DeadlineExceeded)
+	}
+	assert.Equal(t, StateOpen, b.State())
+
+	cfg := Config{ConsecutiveFailures: 1, IsFailure: func(err error) bool { return errors.Is(err, errBoom) }}
+	b = NewBreaker("payments", cfg, timeSvc, zap.NewNop(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	call(b, errors.New("not found"))
+	assert.Equal(t, StateClosed, b.State())
+	call(b, errBoom)
+	assert.Equal(t, StateOpen, b.State())
+}
+
+func TestBreakerStaleResults(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	b := NewBreaker("payments", Config{ConsecutiveFailures: 1, Cooldown: 10 * time.Second}, timeSvc, zap.NewNop(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+
+	// Started while closed, finished once open & half-open.
+	slowDone, err := b.Allow()
+	assert.Nil(t, err)
+	call(b, errBoom)
+	timeSvc.Add(10 * time.Second)
+	assert.Equal(t, StateHalfOpen, b.State())
+
+	slowDone(errBoom)
+	assert.Equal(t, StateHalfOpen, b.State())
+}
+
+func TestBreakerTrialExpiry(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	log := testutils.NewBufferingLogger(zap.DebugLevel)
+	b := NewBreaker("payments", Config{ConsecutiveFailures: 1, Cooldown: 10 * time.Second}, timeSvc, log.Logger, metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	call(b, errBoom)
+	timeSvc.Add(10 * time.Second)
+
+	// Never reported.
+	lostDone, err := b.Allow()
+	assert.Nil(t, err)
+	timeSvc.Add(9 * time.Second)
+	_, err = b.Allow()
+	assert.ErrorIs(t, err, ErrOpen)
+
+	timeSvc.Add(time.Second)
+	done, err := b.Allow()
+	assert.Nil(t, err)
+	assert.Contains(t, log.JsonNoDoubleQuotes(), `'from':'half-open','to':'half-open','reason':'trial calls expired'`)
+
+	// Results of expired trials are ignored.
+	lostDone(errBoom)
+	assert.Equal(t, StateHalfOpen, b.State())
+	done(nil)
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreakerPanic(t *testing.T) {
+	b := NewBreaker("payments", Config{ConsecutiveFailures: 1}, absos.NewTimeSvcMock(), zap.NewNop(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+
+	assert.PanicsWithValue(t, "oops", func() {
+		_ = b.Do(context.Background(), func(ctx context.Context) error { panic("oops") })
+	})
+	assert.Equal(t, StateOpen, b.State())
+}
+
+func TestStateString(t *testing.T) {
+	assert.Equal(t, "closed", StateClosed.String())
+	assert.Equal(t, "open", StateOpen.String())
+	assert.Equal(t, "half-open", StateHalfOpen.String())
+	assert.Equal(t, "State(7)", State(7).String())
+}
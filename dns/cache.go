@@ -0,0 +1,307 @@
+// Package dns provides DnsSvc (see absos.DnsSvc) implementations and decorators.
+//
+// All of them report lookup latency and errors via metrics.Metrics under the same
+// metric names, told apart by the "resolver" label.
+package dns
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CacheConfig configures the DnsSvc returned by NewCachingDnsSvc().
+//
+// A zero TTL disables caching of the respective answers.
+type CacheConfig struct {
+	// PositiveTtl is how long successful answers are served from the cache.
+	PositiveTtl time.Duration
+
+	// NegativeTtl is how long "not found" answers are served from the cache.
+	// Other errors (timeouts, server failures, ...) are never cached.
+	NegativeTtl time.Duration
+
+	// StaleTtl is how long successful answers are still served after PositiveTtl has passed
+	// (stale-while-revalidate). The first such lookup triggers a refresh in background.
+	StaleTtl time.Duration
+
+	// ResolverName is the "resolver" label value of the metrics. Defaults to "cache".
+	ResolverName string
+}
+
+// DefaultCacheConfig returns a config with reasonable defaults.
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		PositiveTtl: time.Minute,
+		NegativeTtl: 10 * time.Second,
+		StaleTtl:    time.Minute,
+	}
+}
+
+// cacheKey identifies a cached answer.
+type cacheKey struct {
+	recordType absos.DnsRecordType
+	name       string
+}
+
+// cacheEntry is a cached answer, either a value or a "not found" error.
+type cacheEntry struct {
+	value any
+	err   error
+
+	// expires is the time the entry is fresh until.
+	expires time.Time
+
+	// staleUntil is the time the entry may be served (while being refreshed) until.
+	staleUntil time.Time
+}
+
+// cacheCall is an in-flight lookup other callers of the same key wait for.
+type cacheCall struct {
+	done  chan any
+	value any
+	err   error
+}
+
+// srvResult bundles the two LookupSRV() results into a single cacheable value.
+type srvResult struct {
+	cname string
+	srvs  []*net.SRV
+}
+
+type cachingDnsSvc struct {
+	cfg           CacheConfig
+	inner         absos.DnsSvc
+	timeSvc       absos.TimeSvc
+	lookupMetrics *lookupMetrics
+	hits          *prometheus.CounterVec
+	misses        *prometheus.CounterVec
+
+	// mu protects all fields below.
+	mu      sync.Mutex
+	entries map[cacheKey]*cacheEntry
+	calls   map[cacheKey]*cacheCall
+
+	// nextPurge is the number of entries at which expired entries are purged next time.
+	nextPurge int
+}
+
+// minPurgeSize is the minimal number of entries at which expired entries get purged.
+const minPurgeSize = 1024
+
+// NewCachingDnsSvc returns DnsSvc that caches answers of the inner one.
+//
+// Expiration is based on timeSvc. Concurrent lookups of the same name and record type are
+// collapsed into a single lookup of the inner DnsSvc. The lookup itself is not cancelled when
+// its callers give up, so its answer still makes it into the cache.
+//
+// Cached slices are shared between callers and must not be modified.
+//
+// Registers lookup latency/errors metrics (see package doc) and cache hit/miss counters in m.
+func NewCachingDnsSvc(cfg CacheConfig, inner absos.DnsSvc, timeSvc absos.TimeSvc, m *metrics.Metrics) absos.DnsSvc {
+	if cfg.ResolverName == "" {
+		cfg.ResolverName = "cache"
+	}
+
+	constLabels := prometheus.Labels{"resolver": cfg.ResolverName}
+
+	svc := &cachingDnsSvc{
+		cfg:           cfg,
+		inner:         inner,
+		timeSvc:       timeSvc,
+		lookupMetrics: newLookupMetrics(m, cfg.ResolverName),
+		hits: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        m.Prefixed("dns_cache_hits"),
+				Help:        "Total number of DNS lookups answered from the cache (including stale answers).",
+				ConstLabels: constLabels,
+			},
+			[]string{"type"},
+		),
+		misses: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        m.Prefixed("dns_cache_misses"),
+				Help:        "Total number of DNS lookups not answered from the cache.",
+				ConstLabels: constLabels,
+			},
+			[]string{"type"},
+		),
+		entries:   make(map[cacheKey]*cacheEntry),
+		calls:     make(map[cacheKey]*cacheCall),
+		nextPurge: minPurgeSize,
+	}
+	m.MustRegister(svc.hits, svc.misses)
+
+	// Set initial counters to zero (see logging.NewLogger() for reasons).
+	for _, recordType := range allRecordTypes {
+		svc.hits.WithLabelValues(string(recordType)).Add(0)
+		svc.misses.WithLabelValues(string(recordType)).Add(0)
+	}
+
+	return svc
+}
+
+// lookup answers from the cache or from the inner DnsSvc (via fetch), records metrics.
+func (svc *cachingDnsSvc) lookup(ctx context.Context, key cacheKey, fetch func(ctx context.Context) (any, error)) (any, error) {
+	start := svc.timeSvc.Now()
+	value, err := svc.lookupCached(ctx, key, fetch)
+	svc.lookupMetrics.observe(key.recordType, start, svc.timeSvc.Now(), err)
+	return value, err
+}
+
+func (svc *cachingDnsSvc) lookupCached(ctx context.Context, key cacheKey, fetch func(ctx context.Context) (any, error)) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, newContextError(key.name, err)
+	}
+
+	now := svc.timeSvc.Now()
+
+	svc.mu.Lock()
+
+	if entry, ok := svc.entries[key]; ok && now.Before(entry.staleUntil) {
+		if !now.Before(entry.expires) && svc.calls[key] == nil {
+			// Stale, refresh in background.
+			svc.startCallLocked(context.WithoutCancel(ctx), key, fetch)
+		}
+		svc.mu.Unlock()
+
+		svc.hits.WithLabelValues(string(key.recordType)).Inc()
+		return entry.value, entry.err
+	}
+
+	call := svc.calls[key]
+	if call == nil {
+		call = svc.startCallLocked(context.WithoutCancel(ctx), key, fetch)
+	}
+	svc.mu.Unlock()
+
+	svc.misses.WithLabelValues(string(key.recordType)).Inc()
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return nil, newContextError(key.name, ctx.Err())
+	}
+}
+
+// startCallLocked starts a lookup via fetch, which stores its answer in the cache once done.
+// Must be called with svc.mu held.
+func (svc *cachingDnsSvc) startCallLocked(ctx context.Context, key cacheKey, fetch func(ctx context.Context) (any, error)) *cacheCall {
+	call := &cacheCall{done: make(chan any)}
+	svc.calls[key] = call
+
+	go func() {
+		value, err := fetch(ctx)
+		call.value, call.err = value, err
+
+		func() {
+			svc.mu.Lock()
+			defer svc.mu.Unlock()
+			delete(svc.calls, key)
+			svc.storeLocked(key, value, err)
+		}()
+
+		close(call.done)
+	}()
+
+	return call
+}
+
+// storeLocked caches the answer if it's cacheable. Must be called with svc.mu held.
+func (svc *cachingDnsSvc) storeLocked(key cacheKey, value any, err error) {
+	now := svc.timeSvc.Now()
+
+	var entry *cacheEntry
+	switch {
+	case err == nil && svc.cfg.PositiveTtl > 0:
+		expires := now.Add(svc.cfg.PositiveTtl)
+		entry = &cacheEntry{value: value, expires: expires, staleUntil: expires.Add(svc.cfg.StaleTtl)}
+	case isNotFound(err) && svc.cfg.NegativeTtl > 0:
+		expires := now.Add(svc.cfg.NegativeTtl)
+		entry = &cacheEntry{value: value, err: err, expires: expires, staleUntil: expires}
+	default:
+		// Not cacheable, keep whatever (possibly stale) entry there is.
+		return
+	}
+
+	svc.entries[key] = entry
+
+	if len(svc.entries) >= svc.nextPurge {
+		for k, e := range svc.entries {
+			if !now.Before(e.staleUntil) {
+				delete(svc.entries, k)
+			}
+		}
+		svc.nextPurge = max(2*len(svc.entries), minPurgeSize)
+	}
+}
+
+// cachedLookup is a typed wrapper around lookup().
+func cachedLookup[T any](
+	ctx context.Context,
+	svc *cachingDnsSvc,
+	recordType absos.DnsRecordType,
+	name string,
+	fetch func(ctx context.Context) (T, error),
+) (T, error) {
+	value, err := svc.lookup(ctx, cacheKey{recordType, name}, func(ctx context.Context) (any, error) {
+		v, err := fetch(ctx)
+		return v, err
+	})
+	t, _ := value.(T)
+	return t, err
+}
+
+func (svc *cachingDnsSvc) LookupIP(host string) ([]net.IP, error) {
+	return svc.LookupIPContext(context.Background(), host)
+}
+
+func (svc *cachingDnsSvc) LookupIPContext(ctx context.Context, host string) ([]net.IP, error) {
+	return cachedLookup(ctx, svc, absos.DnsRecordIP, host, func(ctx context.Context) ([]net.IP, error) {
+		return svc.inner.LookupIPContext(ctx, host)
+	})
+}
+
+func (svc *cachingDnsSvc) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return cachedLookup(ctx, svc, absos.DnsRecordHost, host, func(ctx context.Context) ([]string, error) {
+		return svc.inner.LookupHost(ctx, host)
+	})
+}
+
+func (svc *cachingDnsSvc) LookupCNAME(ctx context.Context, host string) (string, error) {
+	return cachedLookup(ctx, svc, absos.DnsRecordCNAME, host, func(ctx context.Context) (string, error) {
+		return svc.inner.LookupCNAME(ctx, host)
+	})
+}
+
+func (svc *cachingDnsSvc) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	return cachedLookup(ctx, svc, absos.DnsRecordMX, name, func(ctx context.Context) ([]*net.MX, error) {
+		return svc.inner.LookupMX(ctx, name)
+	})
+}
+
+func (svc *cachingDnsSvc) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return cachedLookup(ctx, svc, absos.DnsRecordTXT, name, func(ctx context.Context) ([]string, error) {
+		return svc.inner.LookupTXT(ctx, name)
+	})
+}
+
+func (svc *cachingDnsSvc) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	result, err := cachedLookup(ctx, svc, absos.DnsRecordSRV, absos.DnsSrvName(service, proto, name), func(ctx context.Context) (srvResult, error) {
+		cname, srvs, err := svc.inner.LookupSRV(ctx, service, proto, name)
+		return srvResult{cname, srvs}, err
+	})
+	return result.cname, result.srvs, err
+}
+
+func (svc *cachingDnsSvc) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	return cachedLookup(ctx, svc, absos.DnsRecordAddr, addr, func(ctx context.Context) ([]string, error) {
+		return svc.inner.LookupAddr(ctx, addr)
+	})
+}
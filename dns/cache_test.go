@@ -0,0 +1,315 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/appinfo"
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+var testCacheConfig = CacheConfig{
+	PositiveTtl: 60 * time.Second,
+	NegativeTtl: 10 * time.Second,
+	StaleTtl:    30 * time.Second,
+}
+
+var (
+	ip1 = net.ParseIP("10.0.0.1")
+	ip2 = net.ParseIP("10.0.0.2")
+)
+
+func TestCachingDnsSvcPositive(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	dnsMock := absos.NewDnsSvcMock(timeSvc)
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	svc := NewCachingDnsSvc(testCacheConfig, dnsMock, timeSvc, m)
+
+	dnsMock.SetLookupIpResult("example.com", []net.IP{ip1}, nil)
+
+	ips, err := svc.LookupIP("example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []net.IP{ip1}, ips)
+
+	// Answered from the cache while fresh.
+	dnsMock.SetLookupIpResult("example.com", []net.IP{ip2}, nil)
+	timeSvc.Add(59 * time.Second)
+
+	ips, err = svc.LookupIPContext(context.Background(), "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []net.IP{ip1}, ips)
+
+	// Stale, still answered from the cache, refreshed in background.
+	timeSvc.Add(time.Second)
+
+	ips, err = svc.LookupIP("example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []net.IP{ip1}, ips)
+
+	assert.Eventually(t, func() bool {
+		ips, _ := svc.LookupIP("example.com")
+		return ips[0].Equal(ip2)
+	}, time.Second, time.Millisecond)
+
+	// Refreshed entry is fresh again.
+	dnsMock.SetLookupIpResult("example.com", []net.IP{ip1}, nil)
+	timeSvc.Add(59 * time.Second)
+
+	ips, err = svc.LookupIP("example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []net.IP{ip2}, ips)
+
+	// After the stale window, it's a miss.
+	timeSvc.Add(31 * time.Second)
+
+	ips, err = svc.LookupIP("example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []net.IP{ip1}, ips)
+
+	dump := m.DumpAsTextForTest()
+	assert.Contains(t, dump, `mock_dns_cache_misses{resolver="cache",type="IP"} 2`)
+	assert.Contains(t, dump, `mock_dns_cache_misses{resolver="cache",type="MX"} 0`)
+	assert.Contains(t, dump, `mock_dns_cache_hits{resolver="cache",type="MX"} 0`)
+	assert.Contains(t, dump, `mock_dns_lookup_errors{reason="not_found",resolver="cache",type="IP"} 0`)
+}
+
+func TestCachingDnsSvcNegative(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	dnsMock := absos.NewDnsSvcMock(timeSvc)
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	svc := NewCachingDnsSvc(testCacheConfig, dnsMock, timeSvc, m)
+	ctx := context.Background()
+
+	_, err := svc.LookupTXT(ctx, "example.com")
+	assert.True(t, isNotFound(err))
+
+	// "Not found" is cached.
+	dnsMock.SetLookupTXTResult("example.com", []string{"hello"}, nil)
+	timeSvc.Add(9 * time.Second)
+
+	_, err = svc.LookupTXT(ctx, "example.com")
+	assert.True(t, isNotFound(err))
+
+	// No stale window for negative answers.
+	timeSvc.Add(time.Second)
+
+	txts, err := svc.LookupTXT(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hello"}, txts)
+
+	// Other errors are not cached.
+	tempErr := &net.DNSError{Err: "server misbehaving", Name: "temp.com", IsTemporary: true}
+	dnsMock.SetLookupTXTResult("temp.com", nil, tempErr)
+
+	_, err = svc.LookupTXT(ctx, "temp.com")
+	assert.Equal(t, tempErr, err)
+
+	dnsMock.SetLookupTXTResult("temp.com", []string{"ok"}, nil)
+
+	txts, err = svc.LookupTXT(ctx, "temp.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ok"}, txts)
+
+	dump := m.DumpAsTextForTest()
+	assert.Contains(t, dump, `mock_dns_cache_hits{resolver="cache",type="TXT"} 1`)
+	assert.Contains(t, dump, `mock_dns_cache_misses{resolver="cache",type="TXT"} 4`)
+	assert.Contains(t, dump, `mock_dns_lookup_errors{reason="not_found",resolver="cache",type="TXT"} 2`)
+	assert.Contains(t, dump, `mock_dns_lookup_errors{reason="other",resolver="cache",type="TXT"} 1`)
+}
+
+func TestCachingDnsSvcStaleKeptOnError(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	dnsMock := absos.NewDnsSvcMock(timeSvc)
+	svc := NewCachingDnsSvc(testCacheConfig, dnsMock, timeSvc, metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+
+	dnsMock.SetLookupIpResult("example.com", []net.IP{ip1}, nil)
+
+	_, err := svc.LookupIP("example.com")
+	assert.Nil(t, err)
+
+	// Refresh fails with a temporary error, stale answer is kept.
+	dnsMock.SetLookupIpResult("example.com", nil, &net.DNSError{Err: "timeout", IsTimeout: true})
+	timeSvc.Add(70 * time.Second)
+
+	for range 10 {
+		ips, err := svc.LookupIP("example.com")
+		assert.Nil(t, err)
+		assert.Equal(t, []net.IP{ip1}, ips)
+	}
+
+	// Until the stale window is over.
+	timeSvc.Add(20 * time.Second)
+
+	_, err = svc.LookupIP("example.com")
+	assert.NotNil(t, err)
+}
+
+func TestCachingDnsSvcDisabled(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	dnsMock := absos.NewDnsSvcMock(timeSvc)
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	svc := NewCachingDnsSvc(CacheConfig{ResolverName: "nocache"}, dnsMock, timeSvc, m)
+
+	dnsMock.SetLookupIpResult("example.com", []net.IP{ip1}, nil)
+
+	_, err := svc.LookupIP("example.com")
+	assert.Nil(t, err)
+
+	dnsMock.SetLookupIpResult("example.com", []net.IP{ip2}, nil)
+
+	ips, err := svc.LookupIP("example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []net.IP{ip2}, ips)
+
+	_, err = svc.LookupIP("unknown.com")
+	assert.NotNil(t, err)
+
+	assert.Contains(t, m.DumpAsTextForTest(), `mock_dns_cache_misses{resolver="nocache",type="IP"} 3`)
+}
+
+func TestCachingDnsSvcCollapsesConcurrentLookups(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	dnsMock := absos.NewDnsSvcMock(timeSvc)
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	svc := NewCachingDnsSvc(testCacheConfig, dnsMock, timeSvc, m)
+
+	dnsMock.SetLookupIpResultWithDuration("slow.com", []net.IP{ip1}, nil, time.Second)
+
+	const n = 5
+
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ips, err := svc.LookupIP("slow.com")
+			assert.Nil(t, err)
+			assert.Equal(t, []net.IP{ip1}, ips)
+		}()
+	}
+
+	// Wait for all of them to miss, then release the single lookup.
+	assert.Eventually(t, func() bool {
+		return strings.Contains(m.DumpAsTextForTest(), `mock_dns_cache_misses{resolver="cache",type="IP"} 5`)
+	}, time.Second, time.Millisecond)
+
+	assert.Equal(t, 1, timeSvc.SleeperCount())
+	timeSvc.AdvanceToNextSleepEvent()
+
+	wg.Wait()
+
+	dump := m.DumpAsTextForTest()
+	assert.Contains(t, dump, `mock_dns_lookup_duration_seconds_count{resolver="cache",type="IP"} 5`)
+	assert.Contains(t, dump, `mock_dns_lookup_duration_seconds_sum{resolver="cache",type="IP"} 5`)
+}
+
+func TestCachingDnsSvcCallerCancel(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	dnsMock := absos.NewDnsSvcMock(timeSvc)
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	svc := NewCachingDnsSvc(testCacheConfig, dnsMock, timeSvc, m)
+
+	dnsMock.SetLookupIpResultWithDuration("slow.com", []net.IP{ip1}, nil, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+	go func() {
+		_, err := svc.LookupIPContext(ctx, "slow.com")
+		done <- err
+	}()
+
+	timeSvc.WaitForSleepers(1)
+	cancel()
+
+	err := <-done
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// The lookup itself goes on and gets cached.
+	timeSvc.AdvanceToNextSleepEvent()
+
+	assert.Eventually(t, func() bool {
+		ips, err := svc.LookupIPContext(context.Background(), "slow.com")
+		return err == nil && ips[0].Equal(ip1)
+	}, time.Second, time.Millisecond)
+
+	// Done contexts fail right away.
+	_, err = svc.LookupIPContext(ctx, "slow.com")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	assert.Contains(t, m.DumpAsTextForTest(), `mock_dns_lookup_errors{reason="cancelled",resolver="cache",type="IP"} 2`)
+}
+
+func TestCachingDnsSvcRecordTypes(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	dnsMock := absos.NewDnsSvcMock(timeSvc)
+	svc := NewCachingDnsSvc(testCacheConfig, dnsMock, timeSvc, metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	ctx := context.Background()
+
+	mxs := []*net.MX{{Host: "mx.example.com.", Pref: 10}}
+	srvs := []*net.SRV{{Target: "sip.example.com.", Port: 5060}}
+
+	dnsMock.SetLookupHostResult("example.com", []string{"10.0.0.1"}, nil)
+	dnsMock.SetLookupCNAMEResult("www.example.com", "example.com.", nil)
+	dnsMock.SetLookupMXResult("example.com", mxs, nil)
+	dnsMock.SetLookupSRVResult("sip", "udp", "example.com", "example.com.", srvs, nil)
+	dnsMock.SetLookupAddrResult("10.0.0.1", []string{"example.com."}, nil)
+
+	for range 2 {
+		addrs, err := svc.LookupHost(ctx, "example.com")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"10.0.0.1"}, addrs)
+
+		cname, err := svc.LookupCNAME(ctx, "www.example.com")
+		assert.Nil(t, err)
+		assert.Equal(t, "example.com.", cname)
+
+		resMXs, err := svc.LookupMX(ctx, "example.com")
+		assert.Nil(t, err)
+		assert.Equal(t, mxs, resMXs)
+
+		cname, resSRVs, err := svc.LookupSRV(ctx, "sip", "udp", "example.com")
+		assert.Nil(t, err)
+		assert.Equal(t, "example.com.", cname)
+		assert.Equal(t, srvs, resSRVs)
+
+		names, err := svc.LookupAddr(ctx, "10.0.0.1")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"example.com."}, names)
+
+		// Served from the cache in the second iteration.
+		dnsMock.ClearAllResults()
+	}
+}
+
+func TestCachingDnsSvcPurge(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	dnsMock := absos.NewDnsSvcMock(timeSvc)
+	svc := NewCachingDnsSvc(testCacheConfig, dnsMock, timeSvc, metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	impl := svc.(*cachingDnsSvc)
+
+	for i := range minPurgeSize - 1 {
+		name := strings.Repeat("x", i+1) + ".com"
+		dnsMock.SetLookupIpResult(name, []net.IP{ip1}, nil)
+		_, err := svc.LookupIP(name)
+		assert.Nil(t, err)
+	}
+
+	// All of them expire, the next store purges them.
+	timeSvc.Add(90 * time.Second)
+
+	dnsMock.SetLookupIpResult("last.com", []net.IP{ip1}, nil)
+	_, err := svc.LookupIP("last.com")
+	assert.Nil(t, err)
+
+	impl.mu.Lock()
+	defer impl.mu.Unlock()
+	assert.Len(t, impl.entries, 1)
+	assert.Equal(t, minPurgeSize, impl.nextPurge)
+}
@@ -0,0 +1,353 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/pkg/errors"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DohFormat is the message format of DNS-over-HTTPS requests & responses.
+type DohFormat string
+
+const (
+	// DohFormatWire is the DNS wire format of RFC 8484 ("application/dns-message").
+	DohFormatWire DohFormat = "wire"
+
+	// DohFormatJSON is the JSON format of Google/Cloudflare ("application/dns-json").
+	DohFormatJSON DohFormat = "json"
+)
+
+const (
+	dohWireContentType = "application/dns-message"
+	dohJSONContentType = "application/dns-json"
+
+	// dohMaxResponseSize limits the size of read responses (the max DNS message size).
+	dohMaxResponseSize = 65535
+)
+
+// DohConfig configures the DnsSvc returned by NewDohDnsSvc().
+type DohConfig struct {
+	// URL is the DoH endpoint, e.g. "https://cloudflare-dns.com/dns-query".
+	URL string
+
+	// Format is the message format, DohFormatWire by default.
+	Format DohFormat
+
+	// UseGET makes wire format queries GET requests (with a "dns" param), which are cacheable by
+	// HTTP caches, instead of POST ones. JSON format queries are always GET ones.
+	UseGET bool
+
+	// Timeout is the timeout of a single query. Defaults to 5s.
+	Timeout time.Duration
+
+	// ResolverName is the "resolver" label value of the metrics. Defaults to "doh".
+	ResolverName string
+}
+
+// DefaultDohConfig returns a config with reasonable defaults, querying the URL in the wire format.
+func DefaultDohConfig(url string) DohConfig {
+	return DohConfig{
+		URL:     url,
+		Format:  DohFormatWire,
+		Timeout: 5 * time.Second,
+	}
+}
+
+// normalized returns cfg with defaults applied.
+func (cfg DohConfig) normalized() (DohConfig, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return cfg, errors.Wrap(err, "invalid DoH URL")
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return cfg, errors.Errorf("invalid DoH URL %q: not an HTTP(S) one", cfg.URL)
+	}
+
+	switch cfg.Format {
+	case "":
+		cfg.Format = DohFormatWire
+	case DohFormatWire, DohFormatJSON:
+	default:
+		return cfg, errors.Errorf("invalid DoH format %q", cfg.Format)
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.ResolverName == "" {
+		cfg.ResolverName = "doh"
+	}
+
+	return cfg, nil
+}
+
+type dohClient struct {
+	cfg     DohConfig
+	client  *http.Client
+	timeSvc absos.TimeSvc
+}
+
+// NewDohDnsSvc returns DnsSvc querying a DNS-over-HTTPS server (RFC 8484) using client
+// (http.DefaultClient if nil), in the wire or JSON format (see DohConfig).
+//
+// Errors returned by lookups are *net.DNSError, like the ones of net.Resolver; Server is the URL.
+// Timeouts are measured by timeSvc.
+//
+// Registers lookup latency/errors metrics (see package doc) in m.
+func NewDohDnsSvc(cfg DohConfig, client *http.Client, timeSvc absos.TimeSvc, m *metrics.Metrics) (absos.DnsSvc, error) {
+	cfg, err := cfg.normalized()
+	if err != nil {
+		return nil, err
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	c := &dohClient{cfg: cfg, client: client, timeSvc: timeSvc}
+	return &wireDnsSvc{
+		exchange:      c.exchange,
+		timeSvc:       timeSvc,
+		lookupMetrics: newLookupMetrics(m, cfg.ResolverName),
+	}, nil
+}
+
+func (c *dohClient) exchange(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, string, error) {
+	reqCtx, cancel := absos.WithTimeout(ctx, c.timeSvc, c.cfg.Timeout)
+	defer cancel()
+
+	var msg *dnsmessage.Message
+	var err error
+	if c.cfg.Format == DohFormatJSON {
+		msg, err = c.exchangeJSON(reqCtx, q)
+	} else {
+		msg, err = c.exchangeWire(reqCtx, q)
+	}
+
+	if err != nil {
+		switch {
+		case ctx.Err() != nil:
+			err = ctx.Err()
+		case reqCtx.Err() != nil:
+			// The request timed out.
+			err = os.ErrDeadlineExceeded
+		}
+	}
+	return msg, c.cfg.URL, err
+}
+
+// do sends the request, and returns the body of a successful response.
+func (c *dohClient) do(req *http.Request, contentType string) ([]byte, error) {
+	req.Header.Set("Accept", contentType)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("DoH server responded with status %q", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dohMaxResponseSize))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read DoH response")
+	}
+	return body, nil
+}
+
+func (c *dohClient) exchangeWire(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+	// ID 0 for cache friendliness (RFC 8484, section 4.1).
+	query, err := packQuery(0, q, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var req *http.Request
+	if c.cfg.UseGET {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.URL, nil)
+		if err == nil {
+			params := req.URL.Query()
+			params.Set("dns", base64.RawURLEncoding.EncodeToString(query))
+			req.URL.RawQuery = params.Encode()
+		}
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL, bytes.NewReader(query))
+		if err == nil {
+			req.Header.Set("Content-Type", dohWireContentType)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.do(req, dohWireContentType)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, ok := unpackResponse(body, 0, q)
+	if !ok {
+		return nil, errInvalidResponse
+	}
+	return msg, nil
+}
+
+// dohJSONResponse is the JSON format response, see https://developers.google.com/speed/public-dns/docs/doh/json.
+type dohJSONResponse struct {
+	Status int
+	TC     bool
+	Answer []dohJSONRecord
+}
+
+type dohJSONRecord struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+	TTL  uint32 `json:"TTL"`
+	Data string `json:"data"`
+}
+
+func (c *dohClient) exchangeJSON(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	params := req.URL.Query()
+	params.Set("name", q.Name.String())
+	params.Set("type", strconv.Itoa(int(q.Type)))
+	req.URL.RawQuery = params.Encode()
+
+	body, err := c.do(req, dohJSONContentType)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp dohJSONResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, errors.Wrap(errInvalidResponse, err.Error())
+	}
+
+	msg := &dnsmessage.Message{
+		Header: dnsmessage.Header{
+			Response:  true,
+			Truncated: resp.TC,
+			RCode:     dnsmessage.RCode(resp.Status),
+		},
+		Questions: []dnsmessage.Question{q},
+	}
+	for _, record := range resp.Answer {
+		rr, err := record.resource()
+		if err != nil {
+			return nil, errors.Wrapf(errInvalidResponse, "%s record of %s: %v", strings.TrimPrefix(dnsmessage.Type(record.Type).String(), "Type"), record.Name, err)
+		}
+		if rr.Body != nil {
+			msg.Answers = append(msg.Answers, rr)
+		}
+	}
+	return msg, nil
+}
+
+// resource converts the record, returns a resource with nil Body for unsupported types (to be skipped).
+func (r dohJSONRecord) resource() (dnsmessage.Resource, error) {
+	name, err := dnsmessage.NewName(absoluteName(r.Name))
+	if err != nil {
+		return dnsmessage.Resource{}, err
+	}
+	rtype := dnsmessage.Type(r.Type)
+	rr := dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: name, Type: rtype, Class: dnsmessage.ClassINET, TTL: r.TTL},
+	}
+
+	switch rtype {
+	case dnsmessage.TypeA, dnsmessage.TypeAAAA:
+		addr, err := netip.ParseAddr(r.Data)
+		switch {
+		case err != nil:
+			return rr, err
+		case rtype == dnsmessage.TypeA && addr.Is4():
+			rr.Body = &dnsmessage.AResource{A: addr.As4()}
+		case rtype == dnsmessage.TypeAAAA && addr.Is6():
+			rr.Body = &dnsmessage.AAAAResource{AAAA: addr.As16()}
+		default:
+			return rr, errors.Errorf("unexpected address %s", addr)
+		}
+
+	case dnsmessage.TypeCNAME, dnsmessage.TypePTR:
+		target, err := dnsmessage.NewName(absoluteName(r.Data))
+		if err != nil {
+			return rr, err
+		}
+		if rtype == dnsmessage.TypeCNAME {
+			rr.Body = &dnsmessage.CNAMEResource{CNAME: target}
+		} else {
+			rr.Body = &dnsmessage.PTRResource{PTR: target}
+		}
+
+	case dnsmessage.TypeMX:
+		var pref uint16
+		var host string
+		if _, err := fmt.Sscan(r.Data, &pref, &host); err != nil {
+			return rr, err
+		}
+		mx, err := dnsmessage.NewName(absoluteName(host))
+		if err != nil {
+			return rr, err
+		}
+		rr.Body = &dnsmessage.MXResource{Pref: pref, MX: mx}
+
+	case dnsmessage.TypeSRV:
+		var priority, weight, port uint16
+		var host string
+		if _, err := fmt.Sscan(r.Data, &priority, &weight, &port, &host); err != nil {
+			return rr, err
+		}
+		target, err := dnsmessage.NewName(absoluteName(host))
+		if err != nil {
+			return rr, err
+		}
+		rr.Body = &dnsmessage.SRVResource{Priority: priority, Weight: weight, Port: port, Target: target}
+
+	case dnsmessage.TypeTXT:
+		rr.Body = &dnsmessage.TXTResource{TXT: parseJSONTXT(r.Data)}
+	}
+
+	return rr, nil
+}
+
+// parseJSONTXT returns the strings of TXT record data, which is either a sequence of quoted
+// strings (e.g. `"v=spf1 " "-all"`), or a single unquoted one (servers differ).
+func parseJSONTXT(data string) []string {
+	var txts []string
+	for rest := strings.TrimSpace(data); rest != ""; rest = strings.TrimSpace(rest) {
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return []string{data}
+		}
+		txt, err := strconv.Unquote(quoted)
+		if err != nil {
+			return []string{data}
+		}
+		txts = append(txts, txt)
+		rest = rest[len(quoted):]
+	}
+	if len(txts) == 0 {
+		return []string{data}
+	}
+	return txts
+}
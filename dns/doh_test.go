@@ -0,0 +1,255 @@
+package dns
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/appinfo"
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/kattecon/akgoli/testutils"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestDohDnsSvcWire(t *testing.T) {
+	dnsServer, err := testutils.NewDnsServer()
+	assert.Nil(t, err)
+	defer dnsServer.Close()
+	dnsServer.Add("example.com", &dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}})
+	dnsServer.Add("www.example.com", &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("example.com.")})
+	dnsServer.Add("example.com", &dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mx.example.com.")})
+	httpServer := httptest.NewServer(dnsServer)
+	defer httpServer.Close()
+
+	for _, useGET := range []bool{false, true} {
+		dnsServer.ClearQueries()
+
+		cfg := DefaultDohConfig(httpServer.URL)
+		cfg.UseGET = useGET
+		svc, err := NewDohDnsSvc(cfg, httpServer.Client(), absos.NewTimeSvc(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+		assert.Nil(t, err)
+		ctx := context.Background()
+
+		ips, err := svc.LookupIP("www.example.com")
+		assert.Nil(t, err)
+		assert.Equal(t, []net.IP{net.IPv4(10, 0, 0, 1).To4()}, ips)
+
+		mxs, err := svc.LookupMX(ctx, "example.com")
+		assert.Nil(t, err)
+		assert.Equal(t, []*net.MX{{Host: "mx.example.com.", Pref: 10}}, mxs)
+
+		_, err = svc.LookupTXT(ctx, "unknown.example.com")
+		assert.Equal(t, &net.DNSError{Err: "no such host", Name: "unknown.example.com", Server: httpServer.URL, IsNotFound: true}, err)
+
+		assert.Contains(t, dnsServer.Queries(), testutils.DnsServerQuery{Name: "example.com.", Type: dnsmessage.TypeMX, HTTP: true})
+	}
+}
+
+func TestDohDnsSvcWireErrors(t *testing.T) {
+	status, body := http.StatusServiceUnavailable, ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/dns-message", r.Header.Get("Content-Type"))
+		assert.Equal(t, "application/dns-message", r.Header.Get("Accept"))
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	svc, err := NewDohDnsSvc(DefaultDohConfig(server.URL), server.Client(), absos.NewTimeSvc(), m)
+	assert.Nil(t, err)
+
+	_, err = svc.LookupTXT(context.Background(), "example.com")
+	assert.Equal(t, &net.DNSError{Err: `DoH server responded with status "503 Service Unavailable"`, Name: "example.com", Server: server.URL, IsTemporary: true}, err)
+
+	status, body = http.StatusOK, "garbage"
+	_, err = svc.LookupTXT(context.Background(), "example.com")
+	assert.Equal(t, &net.DNSError{Err: "invalid DNS response", Name: "example.com", Server: server.URL, IsTemporary: true}, err)
+
+	assert.Contains(t, m.DumpAsTextForTest(), `mock_dns_lookup_errors{reason="other",resolver="doh",type="TXT"} 2`)
+}
+
+func TestDohDnsSvcJSON(t *testing.T) {
+	body := `{
+		"Status": 0, "TC": false,
+		"Question": [{"name": "www.example.com.", "type": 1}],
+		"Answer": [
+			{"name": "www.example.com.", "type": 5, "TTL": 60, "data": "example.com."},
+			{"name": "example.com.", "type": 1, "TTL": 60, "data": "10.0.0.1"},
+			{"name": "example.com.", "type": 28, "TTL": 60, "data": "::1"},
+			{"name": "example.com.", "type": 15, "TTL": 60, "data": "20 mx2.example.com."},
+			{"name": "example.com.", "type": 15, "TTL": 60, "data": "10 mx1.example.com"},
+			{"name": "example.com.", "type": 16, "TTL": 60, "data": "\"v=spf1 \" \"-all\""},
+			{"name": "example.com.", "type": 16, "TTL": 60, "data": "unquoted"},
+			{"name": "example.com.", "type": 33, "TTL": 60, "data": "1 0 80 web.example.com."},
+			{"name": "example.com.", "type": 12, "TTL": 60, "data": "ptr.example.com."},
+			{"name": "example.com.", "type": 46, "TTL": 60, "data": "A 13 2 ..."}
+		]
+	}`
+	var mu sync.Mutex
+	var requests []*http.Request
+	client := &http.Client{Transport: testutils.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Status:     http.StatusText(http.StatusOK),
+			Header:     http.Header{"Content-Type": {dohJSONContentType}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}, nil
+	})}
+
+	cfg := DefaultDohConfig("https://dns.example.net/resolve")
+	cfg.Format = DohFormatJSON
+	svc, err := NewDohDnsSvc(cfg, client, absos.NewTimeSvc(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	ips, err := svc.LookupIPContext(ctx, "www.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []net.IP{net.IPv4(10, 0, 0, 1).To4(), net.IPv6loopback}, ips)
+
+	// The same answer for all the queries, records of the queried type are picked.
+	mxs, err := svc.LookupMX(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []*net.MX{{Host: "mx1.example.com.", Pref: 10}, {Host: "mx2.example.com.", Pref: 20}}, mxs)
+
+	txts, err := svc.LookupTXT(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"v=spf1 -all", "unquoted"}, txts)
+
+	_, srvs, err := svc.LookupSRV(ctx, "", "", "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []*net.SRV{{Target: "web.example.com.", Port: 80, Priority: 1}}, srvs)
+
+	cname, err := svc.LookupCNAME(ctx, "www.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com.", cname)
+
+	req := requests[len(requests)-1]
+	assert.Equal(t, http.MethodGet, req.Method)
+	assert.Equal(t, "https://dns.example.net/resolve?name=www.example.com.&type=1", req.URL.String())
+	assert.Equal(t, "application/dns-json", req.Header.Get("Accept"))
+}
+
+func TestDohDnsSvcJSONErrors(t *testing.T) {
+	cfg := DefaultDohConfig("https://dns.example.net/resolve")
+	cfg.Format = DohFormatJSON
+	server := cfg.URL
+
+	lookup := func(body string) error {
+		client := &http.Client{Transport: testutils.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Status:     http.StatusText(http.StatusOK),
+				Header:     http.Header{"Content-Type": {dohJSONContentType}},
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		})}
+		svc, err := NewDohDnsSvc(cfg, client, absos.NewTimeSvc(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+		assert.Nil(t, err)
+		_, err = svc.LookupHost(context.Background(), "example.com")
+		return err
+	}
+
+	assert.Equal(t,
+		&net.DNSError{Err: "no such host", Name: "example.com", Server: server, IsNotFound: true},
+		lookup(`{"Status": 3}`))
+	assert.Equal(t,
+		&net.DNSError{Err: "server misbehaving", Name: "example.com", Server: server, IsTemporary: true},
+		lookup(`{"Status": 2}`))
+	assert.Equal(t,
+		&net.DNSError{Err: "invalid character 'x' looking for beginning of value: invalid DNS response", Name: "example.com", Server: server, IsTemporary: true},
+		lookup(`x`))
+	assert.Equal(t,
+		&net.DNSError{Err: "A record of example.com.: unexpected address ::1: invalid DNS response", Name: "example.com", Server: server, IsTemporary: true},
+		lookup(`{"Status": 0, "Answer": [{"name": "example.com.", "type": 1, "data": "::1"}]}`))
+}
+
+func TestDohDnsSvcTimeout(t *testing.T) {
+	client := &http.Client{Transport: testutils.RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	})}
+
+	timeSvc := absos.NewTimeSvcMock()
+	cfg := DefaultDohConfig("https://dns.example.net/dns-query")
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	svc, err := NewDohDnsSvc(cfg, client, timeSvc, m)
+	assert.Nil(t, err)
+
+	errCh := make(chan error)
+	go func() {
+		_, err := svc.LookupTXT(context.Background(), "example.com")
+		errCh <- err
+	}()
+
+	timeSvc.WaitForSleepers(1)
+	timeSvc.Add(cfg.Timeout)
+
+	assert.Equal(t, &net.DNSError{Err: "i/o timeout", Name: "example.com", Server: cfg.URL, IsTimeout: true, IsTemporary: true}, <-errCh)
+	assert.Contains(t, m.DumpAsTextForTest(), `mock_dns_lookup_errors{reason="timeout",resolver="doh",type="TXT"} 1`)
+	assert.Contains(t, m.DumpAsTextForTest(), `mock_dns_lookup_duration_seconds_sum{resolver="doh",type="TXT"} 5`)
+
+	// Cancelled by the caller.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, err := svc.LookupTXT(ctx, "example.com")
+		errCh <- err
+	}()
+
+	timeSvc.WaitForSleepers(1)
+	cancel()
+
+	err = <-errCh
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, cfg.URL, err.(*net.DNSError).Server)
+}
+
+func TestDohDnsSvcDefaultClient(t *testing.T) {
+	dnsServer, err := testutils.NewDnsServer()
+	assert.Nil(t, err)
+	defer dnsServer.Close()
+	dnsServer.Add("example.com", &dnsmessage.TXTResource{TXT: []string{"hello"}})
+	httpServer := httptest.NewServer(dnsServer)
+	defer httpServer.Close()
+
+	svc, err := NewDohDnsSvc(DefaultDohConfig(httpServer.URL), nil, absos.NewTimeSvc(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	assert.Nil(t, err)
+	txts, err := svc.LookupTXT(context.Background(), "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hello"}, txts)
+}
+
+func TestDohConfigNormalized(t *testing.T) {
+	_, err := NewDohDnsSvc(DohConfig{URL: "dns.example.net"}, http.DefaultClient, absos.NewTimeSvc(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	assert.EqualError(t, err, `invalid DoH URL "dns.example.net": not an HTTP(S) one`)
+
+	_, err = DohConfig{URL: "https://dns.example.net/dns-query", Format: "xml"}.normalized()
+	assert.EqualError(t, err, `invalid DoH format "xml"`)
+
+	_, err = DohConfig{URL: "https://dns example"}.normalized()
+	assert.ErrorContains(t, err, "invalid DoH URL: ")
+
+	cfg, err := DohConfig{URL: "https://dns.example.net/dns-query"}.normalized()
+	assert.Nil(t, err)
+	assert.Equal(t, DohConfig{URL: "https://dns.example.net/dns-query", Format: DohFormatWire, Timeout: 5 * time.Second, ResolverName: "doh"}, cfg)
+}
+
+func TestParseJSONTXT(t *testing.T) {
+	assert.Equal(t, []string{"a b"}, parseJSONTXT(`"a b"`))
+	assert.Equal(t, []string{"a", `b"c`}, parseJSONTXT(`"a" "b\"c"`))
+	assert.Equal(t, []string{"a b"}, parseJSONTXT(`a b`))
+	assert.Equal(t, []string{`"a" b`}, parseJSONTXT(`"a" b`))
+	assert.Equal(t, []string{""}, parseJSONTXT(``))
+}
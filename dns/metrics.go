@@ -0,0 +1,113 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// allRecordTypes lists every record type, used to init metrics to zero.
+var allRecordTypes = []absos.DnsRecordType{
+	absos.DnsRecordIP,
+	absos.DnsRecordHost,
+	absos.DnsRecordCNAME,
+	absos.DnsRecordMX,
+	absos.DnsRecordTXT,
+	absos.DnsRecordSRV,
+	absos.DnsRecordAddr,
+}
+
+// lookupMetrics are the metrics every DnsSvc implementation of this package exposes.
+//
+// All implementations share metric names, a "resolver" const label tells them apart,
+// so several of them can be registered in the same metrics.Metrics (given distinct resolver names).
+type lookupMetrics struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+func newLookupMetrics(m *metrics.Metrics, resolver string) *lookupMetrics {
+	constLabels := prometheus.Labels{"resolver": resolver}
+
+	lm := &lookupMetrics{
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:        m.Prefixed("dns_lookup_duration_seconds"),
+				Help:        "DNS lookup latency.",
+				ConstLabels: constLabels,
+			},
+			[]string{"type"},
+		),
+		errors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        m.Prefixed("dns_lookup_errors"),
+				Help:        "Total number of failed DNS lookups.",
+				ConstLabels: constLabels,
+			},
+			[]string{"type", "reason"},
+		),
+	}
+	m.MustRegister(lm.duration, lm.errors)
+
+	// Set initial counters to zero (see logging.NewLogger() for reasons).
+	for _, recordType := range allRecordTypes {
+		for _, reason := range allErrorReasons {
+			lm.errors.WithLabelValues(string(recordType), reason).Add(0)
+		}
+	}
+
+	return lm
+}
+
+// observe records a finished lookup.
+func (lm *lookupMetrics) observe(recordType absos.DnsRecordType, start, end time.Time, err error) {
+	lm.duration.WithLabelValues(string(recordType)).Observe(end.Sub(start).Seconds())
+	if err != nil {
+		lm.errors.WithLabelValues(string(recordType), errorReason(err)).Inc()
+	}
+}
+
+const (
+	errorReasonNotFound  = "not_found"
+	errorReasonTimeout   = "timeout"
+	errorReasonCancelled = "cancelled"
+	errorReasonOther     = "other"
+)
+
+var allErrorReasons = []string{errorReasonNotFound, errorReasonTimeout, errorReasonCancelled, errorReasonOther}
+
+// errorReason classifies lookup errors for the errors counter.
+func errorReason(err error) string {
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return errorReasonCancelled
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		return errorReasonNotFound
+	case errors.Is(err, context.DeadlineExceeded) || (dnsErr != nil && dnsErr.IsTimeout):
+		return errorReasonTimeout
+	default:
+		return errorReasonOther
+	}
+}
+
+// isNotFound tells whether err is a definitive "no such host/record" answer.
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// newContextError wraps a context error the same way net.Resolver does.
+func newContextError(name string, err error) *net.DNSError {
+	return &net.DNSError{
+		Err:       err.Error(),
+		Name:      name,
+		IsTimeout: err == context.DeadlineExceeded,
+		UnwrapErr: err,
+	}
+}
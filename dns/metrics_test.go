@@ -0,0 +1,63 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/appinfo"
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupMetrics(t *testing.T) {
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+
+	// Several resolvers may share metrics.
+	lm1 := newLookupMetrics(m, "one")
+	lm2 := newLookupMetrics(m, "two")
+
+	start := time.Time{}
+	lm1.observe(absos.DnsRecordMX, start, start.Add(2*time.Second), nil)
+	lm1.observe(absos.DnsRecordMX, start, start.Add(time.Second), &net.DNSError{IsNotFound: true})
+	lm2.observe(absos.DnsRecordIP, start, start.Add(time.Second), errors.New("x"))
+
+	dump := m.DumpAsTextForTest()
+	assert.Contains(t, dump, `mock_dns_lookup_duration_seconds_sum{resolver="one",type="MX"} 3`)
+	assert.Contains(t, dump, `mock_dns_lookup_duration_seconds_count{resolver="one",type="MX"} 2`)
+	assert.Contains(t, dump, `mock_dns_lookup_errors{reason="not_found",resolver="one",type="MX"} 1`)
+	assert.Contains(t, dump, `mock_dns_lookup_errors{reason="timeout",resolver="one",type="MX"} 0`)
+	assert.Contains(t, dump, `mock_dns_lookup_errors{reason="other",resolver="two",type="IP"} 1`)
+	assert.Contains(t, dump, `mock_dns_lookup_errors{reason="other",resolver="two",type="PTR"} 0`)
+}
+
+func TestErrorReason(t *testing.T) {
+	assert.Equal(t, "not_found", errorReason(&net.DNSError{IsNotFound: true}))
+	assert.Equal(t, "timeout", errorReason(&net.DNSError{IsTimeout: true}))
+	assert.Equal(t, "timeout", errorReason(newContextError("x", context.DeadlineExceeded)))
+	assert.Equal(t, "timeout", errorReason(context.DeadlineExceeded))
+	assert.Equal(t, "cancelled", errorReason(newContextError("x", context.Canceled)))
+	assert.Equal(t, "other", errorReason(&net.DNSError{IsTemporary: true}))
+	assert.Equal(t, "other", errorReason(errors.New("x")))
+}
+
+func TestIsNotFound(t *testing.T) {
+	assert.True(t, isNotFound(&net.DNSError{IsNotFound: true}))
+	assert.False(t, isNotFound(&net.DNSError{IsTimeout: true}))
+	assert.False(t, isNotFound(errors.New("x")))
+	assert.False(t, isNotFound(nil))
+}
+
+func TestNewContextError(t *testing.T) {
+	err := newContextError("example.com", context.DeadlineExceeded)
+	assert.Equal(t, "example.com", err.Name)
+	assert.True(t, err.IsTimeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	err = newContextError("example.com", context.Canceled)
+	assert.False(t, err.IsTimeout)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,267 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/kattecon/akgoli/utils"
+	"github.com/pkg/errors"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// ErrNoUpstreamServers is returned by NewUpstreamDnsSvc() if no servers are configured.
+	ErrNoUpstreamServers = utils.ConstError("no upstream DNS servers configured")
+
+	// errInvalidResponse is returned for TCP responses not matching the query.
+	errInvalidResponse = utils.ConstError("invalid DNS response")
+)
+
+// minUDPSize is the UDP payload size every DNS server and client supports (without EDNS0).
+const minUDPSize = 512
+
+// UpstreamConfig configures the DnsSvc returned by NewUpstreamDnsSvc().
+type UpstreamConfig struct {
+	// Servers are addresses of the recursive resolvers to query, "ip" or "ip:port" (port 53 by default).
+	Servers []string
+
+	// Timeout is the timeout of a single query of a single server. Defaults to 2s.
+	Timeout time.Duration
+
+	// Attempts is the number of rounds over all servers before giving up. Defaults to 2.
+	Attempts int
+
+	// Rotate spreads the load over the servers: each query starts with the next server (round-robin).
+	// Otherwise servers are queried in order, later ones only when the former ones fail.
+	Rotate bool
+
+	// UDPSize is the UDP payload size advertised via EDNS0. Defaults to 1232 (see dnsflagday.net).
+	// Larger answers are truncated by the servers, and re-queried over TCP.
+	UDPSize int
+
+	// DisableEDNS0 makes queries without the EDNS0 OPT record, limiting UDP answers to 512 bytes.
+	DisableEDNS0 bool
+
+	// ResolverName is the "resolver" label value of the metrics. Defaults to "upstream".
+	ResolverName string
+}
+
+// DefaultUpstreamConfig returns a config with reasonable defaults, querying the servers.
+func DefaultUpstreamConfig(servers ...string) UpstreamConfig {
+	return UpstreamConfig{
+		Servers:  servers,
+		Timeout:  2 * time.Second,
+		Attempts: 2,
+		UDPSize:  1232,
+	}
+}
+
+// normalized returns cfg with defaults applied and ports added to servers.
+func (cfg UpstreamConfig) normalized() (UpstreamConfig, error) {
+	if len(cfg.Servers) == 0 {
+		return cfg, ErrNoUpstreamServers
+	}
+
+	servers := make([]string, len(cfg.Servers))
+	for i, server := range cfg.Servers {
+		host, port, err := net.SplitHostPort(server)
+		if err != nil {
+			host, port = server, "53"
+		}
+		if net.ParseIP(host) == nil {
+			return cfg, errors.Errorf("invalid upstream DNS server %q: not an IP address", server)
+		}
+		servers[i] = net.JoinHostPort(host, port)
+	}
+	cfg.Servers = servers
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+	if cfg.Attempts <= 0 {
+		cfg.Attempts = 2
+	}
+	if cfg.UDPSize < minUDPSize {
+		cfg.UDPSize = 1232
+	}
+	if cfg.ResolverName == "" {
+		cfg.ResolverName = "upstream"
+	}
+
+	return cfg, nil
+}
+
+type upstreamClient struct {
+	cfg     UpstreamConfig
+	netSvc  absos.NetSvc
+	timeSvc absos.TimeSvc
+
+	// next is the index of the server the next query starts with (if cfg.Rotate).
+	next atomic.Uint32
+}
+
+// NewUpstreamDnsSvc returns DnsSvc querying the configured upstream servers directly (without the
+// system resolver), over UDP with fallback to TCP for truncated answers.
+//
+// Servers failing (timeouts, network errors, SERVFAIL/REFUSED answers) are failed over to
+// the next ones. Errors returned by lookups are *net.DNSError, like the ones of net.Resolver.
+// Connections are made using netSvc, timeouts are measured by timeSvc.
+//
+// Registers lookup latency/errors metrics (see package doc) in m.
+func NewUpstreamDnsSvc(cfg UpstreamConfig, netSvc absos.NetSvc, timeSvc absos.TimeSvc, m *metrics.Metrics) (absos.DnsSvc, error) {
+	cfg, err := cfg.normalized()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &upstreamClient{cfg: cfg, netSvc: netSvc, timeSvc: timeSvc}
+	return &wireDnsSvc{
+		exchange:      client.exchange,
+		timeSvc:       timeSvc,
+		lookupMetrics: newLookupMetrics(m, cfg.ResolverName),
+	}, nil
+}
+
+// exchange queries the servers in turn until one answers.
+func (c *upstreamClient) exchange(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, string, error) {
+	servers := c.cfg.Servers
+
+	first := 0
+	if c.cfg.Rotate {
+		first = int((c.next.Add(1) - 1) % uint32(len(servers)))
+	}
+
+	var (
+		msg    *dnsmessage.Message
+		server string
+		err    error
+	)
+	for range c.cfg.Attempts {
+		for i := range servers {
+			server = servers[(first+i)%len(servers)]
+			msg, err = c.exchangeServer(ctx, server, q)
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, server, ctxErr
+			}
+			if err == nil && msg.RCode != dnsmessage.RCodeServerFailure && msg.RCode != dnsmessage.RCodeRefused {
+				return msg, server, nil
+			}
+		}
+	}
+
+	// The last failure.
+	return msg, server, err
+}
+
+// exchangeServer queries the server over UDP, and over TCP if the answer is truncated.
+func (c *upstreamClient) exchangeServer(ctx context.Context, server string, q dnsmessage.Question) (*dnsmessage.Message, error) {
+	attemptCtx, cancel := absos.WithTimeout(ctx, c.timeSvc, c.cfg.Timeout)
+	defer cancel()
+
+	udpSize := c.cfg.UDPSize
+	if c.cfg.DisableEDNS0 {
+		udpSize = 0
+	}
+
+	id := uint16(rand.Uint32())
+	query, err := packQuery(id, q, udpSize)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := c.exchangeUDP(attemptCtx, server, id, q, query)
+	if err == nil && msg.Truncated {
+		msg, err = c.exchangeTCP(attemptCtx, server, id, q, query)
+	}
+
+	if err != nil && ctx.Err() == nil && attemptCtx.Err() != nil {
+		// The attempt timed out.
+		return nil, os.ErrDeadlineExceeded
+	}
+	return msg, err
+}
+
+// withConn runs fn doing I/O on conn, interrupted once ctx is done.
+func (c *upstreamClient) withConn(ctx context.Context, conn net.Conn, fn func() error) error {
+	stop := context.AfterFunc(ctx, func() {
+		// Just passed, but not zero (i.e. no deadline) even if the mock time is.
+		_ = conn.SetDeadline(c.timeSvc.Now().Add(-time.Nanosecond))
+	})
+	defer stop()
+
+	err := fn()
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+func (c *upstreamClient) exchangeUDP(ctx context.Context, server string, id uint16, q dnsmessage.Question, query []byte) (*dnsmessage.Message, error) {
+	conn, err := c.netSvc.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var msg *dnsmessage.Message
+	err = c.withConn(ctx, conn, func() error {
+		if _, err := conn.Write(query); err != nil {
+			return err
+		}
+
+		buf := make([]byte, max(c.cfg.UDPSize, minUDPSize))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return err
+			}
+
+			// Ignore anything else than the response (e.g. late responses to former queries, spoofing attempts).
+			var ok bool
+			if msg, ok = unpackResponse(buf[:n], id, q); ok {
+				return nil
+			}
+		}
+	})
+	return msg, err
+}
+
+func (c *upstreamClient) exchangeTCP(ctx context.Context, server string, id uint16, q dnsmessage.Question, query []byte) (*dnsmessage.Message, error) {
+	conn, err := c.netSvc.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var msg *dnsmessage.Message
+	err = c.withConn(ctx, conn, func() error {
+		// Messages are prefixed by their length over TCP.
+		if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(query))), query...)); err != nil {
+			return err
+		}
+
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return err
+		}
+		buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return err
+		}
+
+		var ok bool
+		if msg, ok = unpackResponse(buf, id, q); !ok {
+			return errInvalidResponse
+		}
+		return nil
+	})
+	return msg, err
+}
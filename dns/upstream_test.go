@@ -0,0 +1,369 @@
+package dns
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/appinfo"
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/kattecon/akgoli/testutils"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestUpstreamDnsSvcLookups(t *testing.T) {
+	server, err := testutils.NewDnsServer()
+	assert.Nil(t, err)
+	defer server.Close()
+	server.Add("example.com", &dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}})
+	server.Add("example.com", &dnsmessage.AAAAResource{AAAA: [16]byte{15: 1}})
+	server.Add("example.com", &dnsmessage.AResource{A: [4]byte{10, 0, 0, 2}})
+	server.Add("www.example.com", &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("web.example.com.")})
+	server.Add("web.example.com", &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("example.com.")})
+	server.Add("example.com", &dnsmessage.MXResource{Pref: 20, MX: dnsmessage.MustNewName("mx2.example.com.")})
+	server.Add("example.com", &dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mx1.example.com.")})
+	server.Add("example.com", &dnsmessage.TXTResource{TXT: []string{"v=spf1 ", "-all"}})
+	server.Add("_http._tcp.example.com", &dnsmessage.SRVResource{Priority: 1, Port: 80, Target: dnsmessage.MustNewName("web.example.com.")})
+	server.Add("1.0.0.10.in-addr.arpa", &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("example.com.")})
+
+	svc, err := NewUpstreamDnsSvc(DefaultUpstreamConfig(server.Addr()), absos.NewNetSvc(), absos.NewTimeSvc(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	ips, err := svc.LookupIP("www.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []net.IP{net.IPv4(10, 0, 0, 1).To4(), net.IPv4(10, 0, 0, 2).To4(), net.IPv6loopback}, ips)
+
+	ips, err = svc.LookupIPContext(ctx, "10.0.0.3")
+	assert.Nil(t, err)
+	assert.Equal(t, []net.IP{net.ParseIP("10.0.0.3")}, ips)
+
+	hosts, err := svc.LookupHost(ctx, "example.com.")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2", "::1"}, hosts)
+
+	cname, err := svc.LookupCNAME(ctx, "www.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com.", cname)
+
+	cname, err = svc.LookupCNAME(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com.", cname)
+
+	mxs, err := svc.LookupMX(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []*net.MX{{Host: "mx1.example.com.", Pref: 10}, {Host: "mx2.example.com.", Pref: 20}}, mxs)
+
+	txts, err := svc.LookupTXT(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"v=spf1 -all"}, txts)
+
+	cname, srvs, err := svc.LookupSRV(ctx, "http", "tcp", "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "_http._tcp.example.com.", cname)
+	assert.Equal(t, []*net.SRV{{Target: "web.example.com.", Port: 80, Priority: 1}}, srvs)
+
+	names, err := svc.LookupAddr(ctx, "10.0.0.1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"example.com."}, names)
+
+	// A & AAAA queried concurrently, with EDNS0.
+	queries := server.Queries()
+	assert.ElementsMatch(t, []testutils.DnsServerQuery{
+		{Name: "www.example.com.", Type: dnsmessage.TypeA, UDPSize: 1232},
+		{Name: "www.example.com.", Type: dnsmessage.TypeAAAA, UDPSize: 1232},
+	}, queries[:2])
+}
+
+func TestUpstreamDnsSvcNotFound(t *testing.T) {
+	server, err := testutils.NewDnsServer()
+	assert.Nil(t, err)
+	defer server.Close()
+	server.Add("example.com", &dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}})
+
+	svc, err := NewUpstreamDnsSvc(DefaultUpstreamConfig(server.Addr()), absos.NewNetSvc(), absos.NewTimeSvc(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	// NXDOMAIN.
+	_, err = svc.LookupIP("unknown.example.com")
+	assert.Equal(t, &net.DNSError{Err: "no such host", Name: "unknown.example.com", Server: server.Addr(), IsNotFound: true}, err)
+
+	// NODATA.
+	_, err = svc.LookupMX(ctx, "example.com")
+	assert.Equal(t, &net.DNSError{Err: "no such host", Name: "example.com", Server: server.Addr(), IsNotFound: true}, err)
+
+	_, err = svc.LookupAddr(ctx, "10.0.0.9")
+	assert.Equal(t, &net.DNSError{Err: "no such host", Name: "10.0.0.9", Server: server.Addr(), IsNotFound: true}, err)
+
+	_, err = svc.LookupAddr(ctx, "not-an-ip")
+	assert.Equal(t, &net.DNSError{Err: "unrecognized address", Name: "not-an-ip"}, err)
+
+	_, err = svc.LookupHost(ctx, "")
+	assert.Equal(t, &net.DNSError{Err: "no such host", Name: "", IsNotFound: true}, err)
+}
+
+func TestUpstreamDnsSvcServerFailureFailover(t *testing.T) {
+	failing, err := testutils.NewDnsServer()
+	assert.Nil(t, err)
+	defer failing.Close()
+	failing.SetRCode("example.com", dnsmessage.RCodeServerFailure)
+	failing.SetRCode("refused.example.com", dnsmessage.RCodeRefused)
+	working, err := testutils.NewDnsServer()
+	assert.Nil(t, err)
+	defer working.Close()
+	working.Add("example.com", &dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mx.example.com.")})
+	working.Add("refused.example.com", &dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mx.example.com.")})
+
+	svc, err := NewUpstreamDnsSvc(DefaultUpstreamConfig(failing.Addr(), working.Addr()), absos.NewNetSvc(), absos.NewTimeSvc(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	mxs, err := svc.LookupMX(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.Len(t, mxs, 1)
+
+	mxs, err = svc.LookupMX(ctx, "refused.example.com")
+	assert.Nil(t, err)
+	assert.Len(t, mxs, 1)
+
+	// All servers failing, each queried Attempts times.
+	working.SetRCode("example.com", dnsmessage.RCodeServerFailure)
+	failing.ClearQueries()
+	working.ClearQueries()
+
+	_, err = svc.LookupMX(ctx, "example.com")
+	assert.Equal(t, &net.DNSError{Err: "server misbehaving", Name: "example.com", Server: working.Addr(), IsTemporary: true}, err)
+	assert.Len(t, failing.Queries(), 2)
+	assert.Len(t, working.Queries(), 2)
+}
+
+func TestUpstreamDnsSvcTimeoutFailover(t *testing.T) {
+	unresponsive, err := testutils.NewDnsServer()
+	assert.Nil(t, err)
+	defer unresponsive.Close()
+	unresponsive.SetDropUDP(true)
+	working, err := testutils.NewDnsServer()
+	assert.Nil(t, err)
+	defer working.Close()
+	working.Add("example.com", &dnsmessage.TXTResource{TXT: []string{"txt"}})
+
+	cfg := DefaultUpstreamConfig(unresponsive.Addr(), working.Addr())
+	cfg.Timeout = 50 * time.Millisecond
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	svc, err := NewUpstreamDnsSvc(cfg, absos.NewNetSvc(), absos.NewTimeSvc(), m)
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	txts, err := svc.LookupTXT(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"txt"}, txts)
+	assert.Len(t, unresponsive.Queries(), 1)
+
+	// All servers timing out.
+	working.SetDropUDP(true)
+	unresponsive.ClearQueries()
+
+	start := time.Now()
+	_, err = svc.LookupTXT(ctx, "example.com")
+	assert.Equal(t, &net.DNSError{Err: "i/o timeout", Name: "example.com", Server: working.Addr(), IsTimeout: true, IsTemporary: true}, err)
+	assert.GreaterOrEqual(t, time.Since(start), 4*cfg.Timeout)
+	assert.Len(t, unresponsive.Queries(), 2)
+
+	assert.Contains(t, m.DumpAsTextForTest(), `mock_dns_lookup_errors{reason="timeout",resolver="upstream",type="TXT"} 1`)
+}
+
+func TestUpstreamDnsSvcRotate(t *testing.T) {
+	server1, err := testutils.NewDnsServer()
+	assert.Nil(t, err)
+	defer server1.Close()
+	server2, err := testutils.NewDnsServer()
+	assert.Nil(t, err)
+	defer server2.Close()
+	for _, server := range []*testutils.DnsServer{server1, server2} {
+		server.Add("example.com", &dnsmessage.TXTResource{TXT: []string{"txt"}})
+	}
+
+	cfg := DefaultUpstreamConfig(server1.Addr(), server2.Addr())
+	svc, err := NewUpstreamDnsSvc(cfg, absos.NewNetSvc(), absos.NewTimeSvc(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	assert.Nil(t, err)
+	for range 4 {
+		_, err := svc.LookupTXT(context.Background(), "example.com")
+		assert.Nil(t, err)
+	}
+	assert.Len(t, server1.Queries(), 4)
+	assert.Len(t, server2.Queries(), 0)
+
+	server1.ClearQueries()
+	cfg.Rotate = true
+	svc, err = NewUpstreamDnsSvc(cfg, absos.NewNetSvc(), absos.NewTimeSvc(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	assert.Nil(t, err)
+	for range 4 {
+		_, err := svc.LookupTXT(context.Background(), "example.com")
+		assert.Nil(t, err)
+	}
+	assert.Len(t, server1.Queries(), 2)
+	assert.Len(t, server2.Queries(), 2)
+}
+
+func TestUpstreamDnsSvcTCPFallback(t *testing.T) {
+	server, err := testutils.NewDnsServer()
+	assert.Nil(t, err)
+	defer server.Close()
+	// ~1KB, fits the EDNS0 UDP size, but not 512 bytes.
+	for range 5 {
+		server.Add("example.com", &dnsmessage.TXTResource{TXT: []string{strings.Repeat("x", 200)}})
+	}
+
+	cfg := DefaultUpstreamConfig(server.Addr())
+	svc, err := NewUpstreamDnsSvc(cfg, absos.NewNetSvc(), absos.NewTimeSvc(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	assert.Nil(t, err)
+
+	txts, err := svc.LookupTXT(context.Background(), "example.com")
+	assert.Nil(t, err)
+	assert.Len(t, txts, 5)
+	assert.Equal(t, []testutils.DnsServerQuery{{Name: "example.com.", Type: dnsmessage.TypeTXT, UDPSize: 1232}}, server.Queries())
+
+	// W/o EDNS0 truncated, re-queried over TCP.
+	server.ClearQueries()
+	cfg.DisableEDNS0 = true
+	svc, err = NewUpstreamDnsSvc(cfg, absos.NewNetSvc(), absos.NewTimeSvc(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	assert.Nil(t, err)
+
+	txts, err = svc.LookupTXT(context.Background(), "example.com")
+	assert.Nil(t, err)
+	assert.Len(t, txts, 5)
+	assert.Equal(t, []testutils.DnsServerQuery{
+		{Name: "example.com.", Type: dnsmessage.TypeTXT},
+		{Name: "example.com.", Type: dnsmessage.TypeTXT, TCP: true},
+	}, server.Queries())
+
+	// Truncated regardless of the size.
+	server.ClearQueries()
+	server.SetTruncateUDP(true)
+
+	txts, err = svc.LookupTXT(context.Background(), "example.com")
+	assert.Nil(t, err)
+	assert.Len(t, txts, 5)
+	assert.Len(t, server.Queries(), 2)
+}
+
+func TestUpstreamDnsSvcCancel(t *testing.T) {
+	server, err := testutils.NewDnsServer()
+	assert.Nil(t, err)
+	defer server.Close()
+	server.SetDropUDP(true)
+
+	cfg := DefaultUpstreamConfig(server.Addr())
+	cfg.Timeout = time.Minute
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	svc, err := NewUpstreamDnsSvc(cfg, absos.NewNetSvc(), absos.NewTimeSvc(), m)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		assert.Eventually(t, func() bool { return len(server.Queries()) == 1 }, time.Second, time.Millisecond)
+		cancel()
+	}()
+
+	_, err = svc.LookupTXT(ctx, "example.com")
+	assert.ErrorIs(t, err, context.Canceled)
+	var dnsErr *net.DNSError
+	assert.ErrorAs(t, err, &dnsErr)
+	assert.Equal(t, server.Addr(), dnsErr.Server)
+
+	// Already cancelled.
+	_, err = svc.LookupTXT(ctx, "example.com")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, server.Queries(), 1)
+
+	assert.Contains(t, m.DumpAsTextForTest(), `mock_dns_lookup_errors{reason="cancelled",resolver="upstream",type="TXT"} 2`)
+}
+
+func TestUpstreamClientCancelRead(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	netSvc := absos.NewNetSvcMock(timeSvc, absos.NewDnsSvcMock(timeSvc))
+	l, err := netSvc.Listen("tcp", ":53")
+	assert.Nil(t, err)
+	defer l.Close()
+
+	// Reads the query, never answers.
+	received := make(chan struct{})
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Read(make([]byte, minUDPSize))
+		close(received)
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	cfg, err := DefaultUpstreamConfig("10.0.0.1").normalized()
+	assert.Nil(t, err)
+	c := &upstreamClient{cfg: cfg, netSvc: netSvc, timeSvc: timeSvc}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-received
+		cancel()
+	}()
+
+	// The mock time is zero, the read is interrupted nevertheless.
+	q := dnsmessage.Question{Name: dnsmessage.MustNewName("example.com."), Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET}
+	query, err := packQuery(1, q, 0)
+	assert.Nil(t, err)
+	_, err = c.exchangeTCP(ctx, cfg.Servers[0], 1, q, query)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestUpstreamDnsSvcMetrics(t *testing.T) {
+	server, err := testutils.NewDnsServer()
+	assert.Nil(t, err)
+	defer server.Close()
+	server.Add("example.com", &dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}})
+
+	cfg := DefaultUpstreamConfig(server.Addr())
+	cfg.ResolverName = "custom"
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	svc, err := NewUpstreamDnsSvc(cfg, absos.NewNetSvc(), absos.NewTimeSvc(), m)
+	assert.Nil(t, err)
+
+	_, err = svc.LookupIP("example.com")
+	assert.Nil(t, err)
+	_, err = svc.LookupIP("unknown.example.com")
+	assert.NotNil(t, err)
+
+	dump := m.DumpAsTextForTest()
+	assert.Contains(t, dump, `mock_dns_lookup_duration_seconds_count{resolver="custom",type="IP"} 2`)
+	assert.Contains(t, dump, `mock_dns_lookup_errors{reason="not_found",resolver="custom",type="IP"} 1`)
+	assert.Contains(t, dump, `mock_dns_lookup_errors{reason="other",resolver="custom",type="MX"} 0`)
+}
+
+func TestUpstreamConfigNormalized(t *testing.T) {
+	_, err := NewUpstreamDnsSvc(UpstreamConfig{}, absos.NewNetSvc(), absos.NewTimeSvc(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	assert.Equal(t, ErrNoUpstreamServers, err)
+
+	_, err = DefaultUpstreamConfig("10.0.0.1", "dns.example.com:53").normalized()
+	assert.EqualError(t, err, `invalid upstream DNS server "dns.example.com:53": not an IP address`)
+
+	cfg, err := UpstreamConfig{Servers: []string{"10.0.0.1", "[::1]:5353", "::2"}, UDPSize: 100}.normalized()
+	assert.Nil(t, err)
+	assert.Equal(t, UpstreamConfig{
+		Servers:      []string{"10.0.0.1:53", "[::1]:5353", "[::2]:53"},
+		Timeout:      2 * time.Second,
+		Attempts:     2,
+		UDPSize:      1232,
+		ResolverName: "upstream",
+	}, cfg)
+
+	cfg, err = UpstreamConfig{Servers: []string{"10.0.0.1:5353"}, Timeout: time.Second, Attempts: 3, UDPSize: 4096, ResolverName: "x"}.normalized()
+	assert.Nil(t, err)
+	assert.Equal(t, UpstreamConfig{Servers: []string{"10.0.0.1:5353"}, Timeout: time.Second, Attempts: 3, UDPSize: 4096, ResolverName: "x"}, cfg)
+}
@@ -0,0 +1,408 @@
+package dns
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kattecon/akgoli/absos"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Error messages of net.DNSError, the same as the ones of net.Resolver.
+const (
+	errMsgNoSuchHost        = "no such host"
+	errMsgServerMisbehaving = "server misbehaving"
+	errMsgTimeout           = "i/o timeout"
+)
+
+// maxCnameChain is the max number of CNAMEs followed within an answer.
+const maxCnameChain = 16
+
+// exchangeFunc sends a query for the question and returns the response, along with the address
+// of the server that answered (or failed last). Implemented by the upstream and DoH clients.
+type exchangeFunc func(ctx context.Context, q dnsmessage.Question) (*dnsmessage.Message, string, error)
+
+// wireDnsSvc implements DnsSvc on top of DNS queries (see exchangeFunc), the way net.Resolver does:
+// IP lookups query A and AAAA records, CNAME chains in answers are followed, error values match.
+type wireDnsSvc struct {
+	exchange      exchangeFunc
+	timeSvc       absos.TimeSvc
+	lookupMetrics *lookupMetrics
+}
+
+// wireAnswer are records of the requested type at the end of the CNAME chain.
+type wireAnswer struct {
+	// cname is the canonical name (the end of the CNAME chain), set also for NODATA answers.
+	cname   string
+	records []dnsmessage.Resource
+}
+
+// absoluteName returns name with a trailing dot.
+func absoluteName(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// newQuestion returns the question for name & type; name may be relative (no trailing dot).
+func newQuestion(name string, qtype dnsmessage.Type) (dnsmessage.Question, error) {
+	qname, err := dnsmessage.NewName(absoluteName(name))
+	if err != nil || name == "" {
+		return dnsmessage.Question{}, errors.New("invalid name")
+	}
+	return dnsmessage.Question{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}, nil
+}
+
+// packQuery returns the wire format of a recursive query. udpSize > 0 adds an EDNS0 OPT record
+// advertising that UDP payload size.
+func packQuery(id uint16, q dnsmessage.Question, udpSize int) ([]byte, error) {
+	b := dnsmessage.NewBuilder(make([]byte, 0, 512), dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.EnableCompression()
+
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+
+	if udpSize > 0 {
+		if err := b.StartAdditionals(); err != nil {
+			return nil, err
+		}
+		var rh dnsmessage.ResourceHeader
+		if err := rh.SetEDNS0(udpSize, dnsmessage.RCodeSuccess, false); err != nil {
+			return nil, err
+		}
+		if err := b.OPTResource(rh, dnsmessage.OPTResource{}); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.Finish()
+}
+
+// unpackResponse parses b, and checks it's a response to the query with the id & question.
+func unpackResponse(b []byte, id uint16, q dnsmessage.Question) (*dnsmessage.Message, bool) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(b); err != nil {
+		return nil, false
+	}
+	if !msg.Response || msg.ID != id || len(msg.Questions) != 1 {
+		return nil, false
+	}
+	rq := msg.Questions[0]
+	if rq.Type != q.Type || rq.Class != q.Class || !strings.EqualFold(rq.Name.String(), q.Name.String()) {
+		return nil, false
+	}
+	return &msg, true
+}
+
+// newDNSError returns net.DNSError the way net.Resolver would for the failed exchange.
+func newDNSError(name, server string, err error) *net.DNSError {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		dnsErr := newContextError(name, err)
+		dnsErr.Server = server
+		return dnsErr
+	case errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		return &net.DNSError{Err: errMsgTimeout, Name: name, Server: server, IsTimeout: true, IsTemporary: true}
+	default:
+		return &net.DNSError{Err: err.Error(), Name: name, Server: server, IsTemporary: true}
+	}
+}
+
+// query looks up records of the type.
+//
+// The returned error is *net.DNSError. For NODATA answers (the name exists, but has no records
+// of the type) the returned answer has cname set.
+func (svc *wireDnsSvc) query(ctx context.Context, name string, qtype dnsmessage.Type) (wireAnswer, error) {
+	if err := ctx.Err(); err != nil {
+		return wireAnswer{}, newContextError(name, err)
+	}
+
+	q, err := newQuestion(name, qtype)
+	if err != nil {
+		return wireAnswer{}, &net.DNSError{Err: errMsgNoSuchHost, Name: name, IsNotFound: true}
+	}
+
+	msg, server, err := svc.exchange(ctx, q)
+	if err != nil {
+		return wireAnswer{}, newDNSError(name, server, err)
+	}
+
+	switch msg.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return wireAnswer{}, &net.DNSError{Err: errMsgNoSuchHost, Name: name, Server: server, IsNotFound: true}
+	default:
+		return wireAnswer{}, &net.DNSError{Err: errMsgServerMisbehaving, Name: name, Server: server, IsTemporary: true}
+	}
+
+	// Follow the CNAME chain.
+	cname := q.Name.String()
+	if qtype != dnsmessage.TypeCNAME {
+	chain:
+		for range maxCnameChain {
+			for _, rr := range msg.Answers {
+				if body, ok := rr.Body.(*dnsmessage.CNAMEResource); ok && strings.EqualFold(rr.Header.Name.String(), cname) {
+					cname = body.CNAME.String()
+					continue chain
+				}
+			}
+			break
+		}
+	}
+
+	answer := wireAnswer{cname: cname}
+	for _, rr := range msg.Answers {
+		if rr.Header.Type == qtype && strings.EqualFold(rr.Header.Name.String(), cname) {
+			answer.records = append(answer.records, rr)
+		}
+	}
+	if len(answer.records) == 0 {
+		return answer, &net.DNSError{Err: errMsgNoSuchHost, Name: name, Server: server, IsNotFound: true}
+	}
+	return answer, nil
+}
+
+// lookupIPs queries A and AAAA records concurrently, IPv4 addresses go first.
+func (svc *wireDnsSvc) lookupIPs(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+
+	var wg sync.WaitGroup
+	var answers [2]wireAnswer
+	var errs [2]error
+	for i, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		wg.Go(func() {
+			answers[i], errs[i] = svc.query(ctx, host, qtype)
+		})
+	}
+	wg.Wait()
+
+	var ips []net.IP
+	for _, answer := range answers {
+		for _, rr := range answer.records {
+			switch body := rr.Body.(type) {
+			case *dnsmessage.AResource:
+				ips = append(ips, net.IP(body.A[:]))
+			case *dnsmessage.AAAAResource:
+				ips = append(ips, net.IP(body.AAAA[:]))
+			}
+		}
+	}
+	if len(ips) > 0 {
+		return ips, nil
+	}
+
+	// Prefer errors telling more than "not found".
+	if !isNotFound(errs[0]) {
+		return nil, errs[0]
+	}
+	return nil, errs[1]
+}
+
+// wireLookup records metrics of the lookup done by fn.
+func wireLookup[T any](svc *wireDnsSvc, recordType absos.DnsRecordType, fn func() (T, error)) (T, error) {
+	start := svc.timeSvc.Now()
+	value, err := fn()
+	svc.lookupMetrics.observe(recordType, start, svc.timeSvc.Now(), err)
+	return value, err
+}
+
+func (svc *wireDnsSvc) LookupIP(host string) ([]net.IP, error) {
+	return svc.LookupIPContext(context.Background(), host)
+}
+
+func (svc *wireDnsSvc) LookupIPContext(ctx context.Context, host string) ([]net.IP, error) {
+	return wireLookup(svc, absos.DnsRecordIP, func() ([]net.IP, error) {
+		return svc.lookupIPs(ctx, host)
+	})
+}
+
+func (svc *wireDnsSvc) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return wireLookup(svc, absos.DnsRecordHost, func() ([]string, error) {
+		ips, err := svc.lookupIPs(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if net.ParseIP(host) != nil {
+			return []string{host}, nil
+		}
+
+		addrs := make([]string, len(ips))
+		for i, ip := range ips {
+			addrs[i] = ip.String()
+		}
+		return addrs, nil
+	})
+}
+
+func (svc *wireDnsSvc) LookupCNAME(ctx context.Context, host string) (string, error) {
+	return wireLookup(svc, absos.DnsRecordCNAME, func() (string, error) {
+		answer, err := svc.query(ctx, host, dnsmessage.TypeA)
+		if err != nil && (!isNotFound(err) || answer.cname == "") {
+			return "", err
+		}
+		return answer.cname, nil
+	})
+}
+
+func (svc *wireDnsSvc) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	return wireLookup(svc, absos.DnsRecordMX, func() ([]*net.MX, error) {
+		answer, err := svc.query(ctx, name, dnsmessage.TypeMX)
+		if err != nil {
+			return nil, err
+		}
+
+		mxs := make([]*net.MX, 0, len(answer.records))
+		for _, rr := range answer.records {
+			body := rr.Body.(*dnsmessage.MXResource)
+			mxs = append(mxs, &net.MX{Host: body.MX.String(), Pref: body.Pref})
+		}
+		slices.SortStableFunc(mxs, func(a, b *net.MX) int {
+			return cmp.Compare(a.Pref, b.Pref)
+		})
+		return mxs, nil
+	})
+}
+
+func (svc *wireDnsSvc) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return wireLookup(svc, absos.DnsRecordTXT, func() ([]string, error) {
+		answer, err := svc.query(ctx, name, dnsmessage.TypeTXT)
+		if err != nil {
+			return nil, err
+		}
+
+		txts := make([]string, 0, len(answer.records))
+		for _, rr := range answer.records {
+			// Like net.Resolver, strings of a record are joined.
+			txts = append(txts, strings.Join(rr.Body.(*dnsmessage.TXTResource).TXT, ""))
+		}
+		return txts, nil
+	})
+}
+
+func (svc *wireDnsSvc) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	type srvAnswer struct {
+		cname string
+		srvs  []*net.SRV
+	}
+
+	result, err := wireLookup(svc, absos.DnsRecordSRV, func() (srvAnswer, error) {
+		answer, err := svc.query(ctx, absos.DnsSrvName(service, proto, name), dnsmessage.TypeSRV)
+		if err != nil {
+			return srvAnswer{}, err
+		}
+
+		srvs := make([]*net.SRV, 0, len(answer.records))
+		for _, rr := range answer.records {
+			body := rr.Body.(*dnsmessage.SRVResource)
+			srvs = append(srvs, &net.SRV{Target: body.Target.String(), Port: body.Port, Priority: body.Priority, Weight: body.Weight})
+		}
+		sortSRVs(srvs)
+		return srvAnswer{answer.cname, srvs}, nil
+	})
+	return result.cname, result.srvs, err
+}
+
+func (svc *wireDnsSvc) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	return wireLookup(svc, absos.DnsRecordAddr, func() ([]string, error) {
+		name, ok := reverseName(addr)
+		if !ok {
+			return nil, &net.DNSError{Err: "unrecognized address", Name: addr}
+		}
+
+		answer, err := svc.query(ctx, name, dnsmessage.TypePTR)
+		if err != nil {
+			// Report the address, not the reverse name.
+			err.(*net.DNSError).Name = addr
+			return nil, err
+		}
+
+		names := make([]string, 0, len(answer.records))
+		for _, rr := range answer.records {
+			names = append(names, rr.Body.(*dnsmessage.PTRResource).PTR.String())
+		}
+		return names, nil
+	})
+}
+
+// reverseName returns the in-addr.arpa./ip6.arpa. name of the IP address.
+func reverseName(addr string) (string, bool) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return "", false
+	}
+
+	var sb strings.Builder
+	if ip4 := ip.To4(); ip4 != nil {
+		for i := len(ip4) - 1; i >= 0; i-- {
+			sb.WriteString(strconv.Itoa(int(ip4[i])))
+			sb.WriteByte('.')
+		}
+		sb.WriteString("in-addr.arpa.")
+		return sb.String(), true
+	}
+
+	const hexDigits = "0123456789abcdef"
+	for i := len(ip) - 1; i >= 0; i-- {
+		sb.WriteByte(hexDigits[ip[i]&0xf])
+		sb.WriteByte('.')
+		sb.WriteByte(hexDigits[ip[i]>>4])
+		sb.WriteByte('.')
+	}
+	sb.WriteString("ip6.arpa.")
+	return sb.String(), true
+}
+
+// sortSRVs sorts the records by priority, and randomizes them by weight within a priority (RFC 2782).
+func sortSRVs(srvs []*net.SRV) {
+	slices.SortStableFunc(srvs, func(a, b *net.SRV) int {
+		return cmp.Compare(a.Priority, b.Priority)
+	})
+
+	for start := 0; start < len(srvs); {
+		end := start + 1
+		for end < len(srvs) && srvs[end].Priority == srvs[start].Priority {
+			end++
+		}
+		shuffleByWeight(srvs[start:end])
+		start = end
+	}
+}
+
+// shuffleByWeight orders the records randomly, records with a greater weight more likely go first.
+func shuffleByWeight(srvs []*net.SRV) {
+	total := 0
+	for _, srv := range srvs {
+		total += int(srv.Weight)
+	}
+
+	for i := range srvs {
+		if total == 0 {
+			return
+		}
+		pick := rand.IntN(total)
+		for j := i; j < len(srvs); j++ {
+			pick -= int(srvs[j].Weight)
+			if pick < 0 {
+				total -= int(srvs[j].Weight)
+				srvs[i], srvs[j] = srvs[j], srvs[i]
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestNewQuestion(t *testing.T) {
+	q, err := newQuestion("example.com", dnsmessage.TypeMX)
+	assert.Nil(t, err)
+	assert.Equal(t, dnsmessage.Question{Name: dnsmessage.MustNewName("example.com."), Type: dnsmessage.TypeMX, Class: dnsmessage.ClassINET}, q)
+
+	q2, err := newQuestion("example.com.", dnsmessage.TypeMX)
+	assert.Nil(t, err)
+	assert.Equal(t, q, q2)
+
+	_, err = newQuestion("", dnsmessage.TypeA)
+	assert.NotNil(t, err)
+}
+
+func TestPackQueryUnpackResponse(t *testing.T) {
+	q, _ := newQuestion("example.com", dnsmessage.TypeA)
+
+	b, err := packQuery(42, q, 1232)
+	assert.Nil(t, err)
+
+	var query dnsmessage.Message
+	assert.Nil(t, query.Unpack(b))
+	assert.Equal(t, uint16(42), query.ID)
+	assert.True(t, query.RecursionDesired)
+	assert.Equal(t, []dnsmessage.Question{q}, query.Questions)
+	assert.Len(t, query.Additionals, 1)
+	assert.Equal(t, dnsmessage.TypeOPT, query.Additionals[0].Header.Type)
+	assert.Equal(t, dnsmessage.Class(1232), query.Additionals[0].Header.Class)
+
+	b, err = packQuery(42, q, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, query.Unpack(b))
+	assert.Empty(t, query.Additionals)
+
+	// Not a response.
+	_, ok := unpackResponse(b, 42, q)
+	assert.False(t, ok)
+
+	query.Response = true
+	b, _ = query.Pack()
+	msg, ok := unpackResponse(b, 42, q)
+	assert.True(t, ok)
+	assert.Equal(t, uint16(42), msg.ID)
+
+	// Mismatching ID/question.
+	_, ok = unpackResponse(b, 43, q)
+	assert.False(t, ok)
+	q2, _ := newQuestion("example.org", dnsmessage.TypeA)
+	_, ok = unpackResponse(b, 42, q2)
+	assert.False(t, ok)
+	q2, _ = newQuestion("EXAMPLE.com", dnsmessage.TypeA)
+	_, ok = unpackResponse(b, 42, q2)
+	assert.True(t, ok)
+
+	_, ok = unpackResponse(b[:5], 42, q)
+	assert.False(t, ok)
+}
+
+func TestNewDNSError(t *testing.T) {
+	assert.Equal(t,
+		&net.DNSError{Err: "i/o timeout", Name: "example.com", Server: "10.0.0.1:53", IsTimeout: true, IsTemporary: true},
+		newDNSError("example.com", "10.0.0.1:53", os.ErrDeadlineExceeded))
+
+	assert.Equal(t,
+		&net.DNSError{Err: "x", Name: "example.com", Server: "10.0.0.1:53", IsTemporary: true},
+		newDNSError("example.com", "10.0.0.1:53", errors.New("x")))
+
+	err := newDNSError("example.com", "10.0.0.1:53", context.DeadlineExceeded)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, err.IsTimeout)
+	assert.Equal(t, "10.0.0.1:53", err.Server)
+}
+
+func TestReverseName(t *testing.T) {
+	name, ok := reverseName("10.0.0.1")
+	assert.True(t, ok)
+	assert.Equal(t, "1.0.0.10.in-addr.arpa.", name)
+
+	name, ok = reverseName("2001:db8::1")
+	assert.True(t, ok)
+	assert.Equal(t, "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", name)
+
+	_, ok = reverseName("example.com")
+	assert.False(t, ok)
+}
+
+func TestSortSRVs(t *testing.T) {
+	srvs := []*net.SRV{
+		{Target: "c.", Priority: 20, Weight: 0},
+		{Target: "a.", Priority: 10, Weight: 0},
+		{Target: "b.", Priority: 10, Weight: 0},
+	}
+	sortSRVs(srvs)
+	assert.Equal(t, []string{"a.", "b.", "c."}, []string{srvs[0].Target, srvs[1].Target, srvs[2].Target})
+
+	// Greater weights go first more likely; zero weights last.
+	first := map[string]int{}
+	for range 1000 {
+		srvs := []*net.SRV{
+			{Target: "zero.", Priority: 10, Weight: 0},
+			{Target: "light.", Priority: 10, Weight: 1},
+			{Target: "heavy.", Priority: 10, Weight: 9},
+		}
+		sortSRVs(srvs)
+		first[srvs[0].Target]++
+		assert.Equal(t, "zero.", srvs[2].Target)
+	}
+	assert.Greater(t, first["heavy."], first["light."])
+	assert.Zero(t, first["zero."])
+}
@@ -0,0 +1,194 @@
+// Package happyeyeballs provides a dialer racing connection attempts to the addresses of a host,
+// IPv6 and IPv4 ones interleaved, as RFC 8305 ("Happy Eyeballs Version 2") describes.
+package happyeyeballs
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+)
+
+// Config configures Dialer.
+type Config struct {
+	// AttemptDelay is the delay before starting the next connection attempt while the former ones
+	// are still pending; a failing attempt starts the next one right away. Defaults to 250ms.
+	AttemptDelay time.Duration
+
+	// PreferIPv4 makes IPv4 addresses go first, otherwise the family of the best address goes
+	// first (usually IPv6), see SortIPs().
+	PreferIPv4 bool
+
+	// FirstFamilyCount is the number of addresses of the first family attempted before the ones of
+	// the other family are interleaved. Defaults to 1.
+	FirstFamilyCount int
+
+	// Timeout limits the whole dial (resolving included); 0 means no limit besides the ctx one.
+	Timeout time.Duration
+}
+
+// DefaultConfig returns the config with values recommended by RFC 8305.
+func DefaultConfig() Config {
+	return Config{
+		AttemptDelay:     250 * time.Millisecond,
+		FirstFamilyCount: 1,
+	}
+}
+
+// Dialer connects to hosts resolved by DnsSvc, racing staggered attempts to their addresses.
+// Once an attempt succeeds, the pending ones are cancelled (and their late connections closed).
+type Dialer struct {
+	cfg     Config
+	dnsSvc  absos.DnsSvc
+	netSvc  absos.NetSvc
+	timeSvc absos.TimeSvc
+}
+
+// NewDialer returns Dialer resolving hosts using dnsSvc, connecting to their addresses using netSvc,
+// and timing the attempts using timeSvc.
+func NewDialer(cfg Config, dnsSvc absos.DnsSvc, netSvc absos.NetSvc, timeSvc absos.TimeSvc) *Dialer {
+	if cfg.AttemptDelay <= 0 {
+		cfg.AttemptDelay = 250 * time.Millisecond
+	}
+	if cfg.FirstFamilyCount <= 0 {
+		cfg.FirstFamilyCount = 1
+	}
+	return &Dialer{cfg: cfg, dnsSvc: dnsSvc, netSvc: netSvc, timeSvc: timeSvc}
+}
+
+// dialResult is the outcome of a connection attempt.
+type dialResult struct {
+	index int
+	conn  net.Conn
+	err   error
+}
+
+// DialContext connects to the address ("host:port") on the network ("tcp", "tcp4", "tcp6",
+// or the "udp" ones). Has the signature of http.Transport.DialContext.
+//
+// Returns the error of the first attempt if all of them fail, like net.Dialer.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
+	default:
+		return nil, &net.OpError{Op: "dial", Net: network, Err: net.UnknownNetworkError(network)}
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+
+	if d.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = absos.WithTimeout(ctx, d.timeSvc, d.cfg.Timeout)
+		defer cancel()
+	}
+
+	ips, err := d.resolve(ctx, network, host)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+
+	return d.race(ctx, network, ips, port)
+}
+
+// resolve returns the IPs of host usable with network, in the order to attempt them.
+func (d *Dialer) resolve(ctx context.Context, network, host string) ([]net.IP, error) {
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		var err error
+		if ips, err = d.dnsSvc.LookupIPContext(ctx, host); err != nil {
+			return nil, err
+		}
+	}
+
+	suitable := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		switch network[len(network)-1] {
+		case '4':
+			if ip.To4() == nil {
+				continue
+			}
+		case '6':
+			if ip.To4() != nil {
+				continue
+			}
+		}
+		suitable = append(suitable, ip)
+	}
+	if len(suitable) == 0 {
+		return nil, &net.AddrError{Err: "no suitable address found", Addr: host}
+	}
+
+	return SortIPs(suitable, d.cfg.PreferIPv4, d.cfg.FirstFamilyCount), nil
+}
+
+// race attempts connections to the ips, staggered, and returns the first established one.
+func (d *Dialer) race(ctx context.Context, network string, ips []net.IP, port string) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Buffered, so attempts never block on reporting results.
+	results := make(chan dialResult, len(ips))
+	errs := make([]error, len(ips))
+	next, pending := 0, 0
+
+	timer := d.timeSvc.NewTimer(d.cfg.AttemptDelay)
+	defer timer.Stop()
+
+	startNext := func() {
+		index, address := next, net.JoinHostPort(ips[next].String(), port)
+		next++
+		pending++
+		go func() {
+			conn, err := d.netSvc.DialContext(ctx, network, address)
+			results <- dialResult{index, conn, err}
+		}()
+		if next < len(ips) {
+			timer.Reset(d.cfg.AttemptDelay)
+		} else {
+			timer.Stop()
+		}
+	}
+
+	// closeLate closes connections of the attempts still pending, once they're established.
+	closeLate := func() {
+		go func(pending int) {
+			for range pending {
+				if result := <-results; result.conn != nil {
+					_ = result.conn.Close()
+				}
+			}
+		}(pending)
+	}
+
+	startNext()
+	for pending > 0 {
+		select {
+		case <-timer.C():
+			startNext()
+
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				cancel()
+				closeLate()
+				return result.conn, nil
+			}
+			errs[result.index] = result.err
+			if next < len(ips) {
+				startNext()
+			}
+
+		case <-ctx.Done():
+			closeLate()
+			return nil, &net.OpError{Op: "dial", Net: network, Err: ctx.Err()}
+		}
+	}
+
+	return nil, errs[0]
+}
@@ -0,0 +1,293 @@
+package happyeyeballs
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testIPv4 = net.ParseIP("10.0.0.1")
+	testIPv6 = net.ParseIP("2001:db8::1")
+)
+
+// dialedConns returns connections successfully dialed by netSvc.
+func dialedConns(netSvc *absos.NetSvcMockImpl) []net.Conn {
+	var conns []net.Conn
+	for _, dial := range netSvc.Dials() {
+		if dial.Conn != nil {
+			conns = append(conns, dial.Conn)
+		}
+	}
+	return conns
+}
+
+type testDialResult struct {
+	conn net.Conn
+	err  error
+}
+
+func dialAsync(dialer *Dialer, ctx context.Context, network, address string) <-chan testDialResult {
+	resultCh := make(chan testDialResult, 1)
+	go func() {
+		conn, err := dialer.DialContext(ctx, network, address)
+		resultCh <- testDialResult{conn, err}
+	}()
+	return resultCh
+}
+
+func remoteIP(conn net.Conn) net.IP {
+	return conn.RemoteAddr().(*net.TCPAddr).IP
+}
+
+func TestDialerIPv6First(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	dnsSvc := absos.NewDnsSvcMock(timeSvc)
+	dnsSvc.SetLookupIpResult("example.com", []net.IP{testIPv4, testIPv6}, nil)
+	netSvc := absos.NewNetSvcMock(timeSvc, dnsSvc)
+	l, err := netSvc.Listen("tcp", ":80")
+	assert.Nil(t, err)
+	defer l.Close()
+	dialer := NewDialer(DefaultConfig(), dnsSvc, netSvc, timeSvc)
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", "example.com:80")
+	assert.Nil(t, err)
+	assert.Equal(t, testIPv6, remoteIP(conn))
+	assert.Len(t, dialedConns(netSvc), 1)
+
+	// IP literals aren't resolved.
+	conn, err = dialer.DialContext(context.Background(), "tcp", "10.0.0.2:80")
+	assert.Nil(t, err)
+	assert.Equal(t, net.ParseIP("10.0.0.2"), remoteIP(conn))
+}
+
+func TestDialerPreferIPv4(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PreferIPv4 = true
+	timeSvc := absos.NewTimeSvcMock()
+	dnsSvc := absos.NewDnsSvcMock(timeSvc)
+	dnsSvc.SetLookupIpResult("example.com", []net.IP{testIPv4, testIPv6}, nil)
+	netSvc := absos.NewNetSvcMock(timeSvc, dnsSvc)
+	l, err := netSvc.Listen("tcp", ":80")
+	assert.Nil(t, err)
+	defer l.Close()
+	dialer := NewDialer(cfg, dnsSvc, netSvc, timeSvc)
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", "example.com:80")
+	assert.Nil(t, err)
+	assert.Equal(t, testIPv4, remoteIP(conn))
+}
+
+func TestDialerStaggered(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	dnsSvc := absos.NewDnsSvcMock(timeSvc)
+	dnsSvc.SetLookupIpResult("example.com", []net.IP{testIPv4, testIPv6}, nil)
+	netSvc := absos.NewNetSvcMock(timeSvc, dnsSvc)
+	l, err := netSvc.Listen("tcp", ":80")
+	assert.Nil(t, err)
+	defer l.Close()
+	dialer := NewDialer(DefaultConfig(), dnsSvc, netSvc, timeSvc)
+	netSvc.SetLink("[2001:db8::1]:80", absos.NetMockLink{Latency: 5 * time.Second}) // Black-holed.
+	netSvc.SetLink("10.0.0.1:80", absos.NetMockLink{Latency: 10 * time.Millisecond})
+	start := timeSvc.Now()
+
+	resultCh := dialAsync(dialer, context.Background(), "tcp", "example.com:80")
+
+	// The IPv6 attempt & the attempt delay timer.
+	timeSvc.WaitForSleepers(2)
+	timeSvc.Add(250 * time.Millisecond)
+
+	// The IPv6 & IPv4 attempts.
+	timeSvc.WaitForSleepers(2)
+	timeSvc.Add(20 * time.Millisecond)
+
+	result := <-resultCh
+	assert.Nil(t, result.err)
+	assert.Equal(t, testIPv4, remoteIP(result.conn))
+	assert.Equal(t, 270*time.Millisecond, timeSvc.Now().Sub(start))
+
+	// The IPv6 attempt is cancelled.
+	assert.Eventually(t, func() bool { return timeSvc.SleeperCount() == 0 }, time.Second, time.Millisecond)
+	assert.Len(t, dialedConns(netSvc), 1)
+}
+
+func TestDialerFailingAttemptStartsNext(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	dnsSvc := absos.NewDnsSvcMock(timeSvc)
+	dnsSvc.SetLookupIpResult("example.com", []net.IP{testIPv4, testIPv6}, nil)
+	netSvc := absos.NewNetSvcMock(timeSvc, dnsSvc)
+	l, err := netSvc.Listen("tcp", ":80")
+	assert.Nil(t, err)
+	defer l.Close()
+	dialer := NewDialer(DefaultConfig(), dnsSvc, netSvc, timeSvc)
+	netSvc.SetLink("[2001:db8::1]:80", absos.NetMockLink{Refuse: true})
+	start := timeSvc.Now()
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", "example.com:80")
+	assert.Nil(t, err)
+	assert.Equal(t, testIPv4, remoteIP(conn))
+	assert.Equal(t, start, timeSvc.Now())
+}
+
+func TestDialerLateConnectionsClosed(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	dnsSvc := absos.NewDnsSvcMock(timeSvc)
+	dnsSvc.SetLookupIpResult("example.com", []net.IP{testIPv4, testIPv6}, nil)
+	netSvc := absos.NewNetSvcMock(timeSvc, dnsSvc)
+	l, err := netSvc.Listen("tcp", ":80")
+	assert.Nil(t, err)
+	defer l.Close()
+	dialer := NewDialer(DefaultConfig(), dnsSvc, netSvc, timeSvc)
+	// Both established at 300ms.
+	netSvc.SetLink("[2001:db8::1]:80", absos.NetMockLink{Latency: 150 * time.Millisecond})
+	netSvc.SetLink("10.0.0.1:80", absos.NetMockLink{Latency: 25 * time.Millisecond})
+
+	resultCh := dialAsync(dialer, context.Background(), "tcp", "example.com:80")
+
+	timeSvc.WaitForSleepers(2)
+	timeSvc.Add(250 * time.Millisecond)
+	timeSvc.WaitForSleepers(2)
+	timeSvc.Add(50 * time.Millisecond)
+
+	result := <-resultCh
+	assert.Nil(t, result.err)
+
+	assert.Eventually(t, func() bool { return len(dialedConns(netSvc)) == 2 }, time.Second, time.Millisecond)
+	for _, conn := range dialedConns(netSvc) {
+		_, err := conn.Write([]byte("x"))
+		if conn == result.conn {
+			assert.Nil(t, err)
+		} else {
+			assert.Eventually(t, func() bool {
+				_, err := conn.Write([]byte("x"))
+				return errors.Is(err, net.ErrClosed)
+			}, time.Second, time.Millisecond)
+		}
+	}
+}
+
+func TestDialerAllFail(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	dnsSvc := absos.NewDnsSvcMock(timeSvc)
+	dnsSvc.SetLookupIpResult("example.com", []net.IP{testIPv4, testIPv6}, nil)
+	netSvc := absos.NewNetSvcMock(timeSvc, dnsSvc)
+	l, err := netSvc.Listen("tcp", ":80")
+	assert.Nil(t, err)
+	defer l.Close()
+	dialer := NewDialer(DefaultConfig(), dnsSvc, netSvc, timeSvc)
+	netSvc.SetDefaultLink(absos.NetMockLink{Refuse: true})
+
+	_, err = dialer.DialContext(context.Background(), "tcp", "example.com:80")
+	assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+
+	// The error of the first attempt.
+	var opErr *net.OpError
+	assert.ErrorAs(t, err, &opErr)
+	assert.Equal(t, testIPv6, opErr.Addr.(*net.TCPAddr).IP)
+}
+
+func TestDialerNetworks(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	dnsSvc := absos.NewDnsSvcMock(timeSvc)
+	dnsSvc.SetLookupIpResult("example.com", []net.IP{testIPv4, testIPv6}, nil)
+	netSvc := absos.NewNetSvcMock(timeSvc, dnsSvc)
+	l, err := netSvc.Listen("tcp", ":80")
+	assert.Nil(t, err)
+	defer l.Close()
+	dialer := NewDialer(DefaultConfig(), dnsSvc, netSvc, timeSvc)
+
+	conn, err := dialer.DialContext(context.Background(), "tcp4", "example.com:80")
+	assert.Nil(t, err)
+	assert.Equal(t, testIPv4, remoteIP(conn))
+
+	conn, err = dialer.DialContext(context.Background(), "tcp6", "example.com:80")
+	assert.Nil(t, err)
+	assert.Equal(t, testIPv6, remoteIP(conn))
+
+	dnsSvc.SetLookupIpResult("v4.example.com", []net.IP{testIPv4}, nil)
+	_, err = dialer.DialContext(context.Background(), "tcp6", "v4.example.com:80")
+	assert.EqualError(t, err, "dial tcp6: address v4.example.com: no suitable address found")
+
+	_, err = dialer.DialContext(context.Background(), "unix", "/tmp/socket")
+	assert.EqualError(t, err, "dial unix: unknown network unix")
+
+	_, err = dialer.DialContext(context.Background(), "tcp", "example.com")
+	assert.EqualError(t, err, "dial tcp: address example.com: missing port in address")
+}
+
+func TestDialerDnsError(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	dnsSvc := absos.NewDnsSvcMock(timeSvc)
+	dnsSvc.SetLookupIpResult("example.com", []net.IP{testIPv4, testIPv6}, nil)
+	netSvc := absos.NewNetSvcMock(timeSvc, dnsSvc)
+	l, err := netSvc.Listen("tcp", ":80")
+	assert.Nil(t, err)
+	defer l.Close()
+	dialer := NewDialer(DefaultConfig(), dnsSvc, netSvc, timeSvc)
+	dnsErr := &net.DNSError{Err: "no such host", Name: "unknown.example.com", IsNotFound: true}
+	dnsSvc.SetLookupIpResult("unknown.example.com", nil, dnsErr)
+
+	_, err = dialer.DialContext(context.Background(), "tcp", "unknown.example.com:80")
+	assert.ErrorIs(t, err, dnsErr)
+	assert.EqualError(t, err, "dial tcp: lookup unknown.example.com: no such host")
+}
+
+func TestDialerTimeout(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Timeout = time.Second
+	timeSvc := absos.NewTimeSvcMock()
+	dnsSvc := absos.NewDnsSvcMock(timeSvc)
+	dnsSvc.SetLookupIpResult("example.com", []net.IP{testIPv4, testIPv6}, nil)
+	netSvc := absos.NewNetSvcMock(timeSvc, dnsSvc)
+	l, err := netSvc.Listen("tcp", ":80")
+	assert.Nil(t, err)
+	defer l.Close()
+	dialer := NewDialer(cfg, dnsSvc, netSvc, timeSvc)
+	netSvc.SetDefaultLink(absos.NetMockLink{Latency: 5 * time.Second})
+
+	resultCh := dialAsync(dialer, context.Background(), "tcp", "example.com:80")
+
+	// The timeout, the IPv6 attempt & the attempt delay timer.
+	timeSvc.WaitForSleepers(3)
+	timeSvc.Add(250 * time.Millisecond)
+	// The timeout & the 2 attempts.
+	timeSvc.WaitForSleepers(3)
+	timeSvc.Add(750 * time.Millisecond)
+
+	result := <-resultCh
+	assert.ErrorIs(t, result.err, context.DeadlineExceeded)
+	assert.EqualError(t, result.err, "dial tcp: context deadline exceeded")
+}
+
+func TestDialerCancel(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	dnsSvc := absos.NewDnsSvcMock(timeSvc)
+	dnsSvc.SetLookupIpResult("example.com", []net.IP{testIPv4, testIPv6}, nil)
+	netSvc := absos.NewNetSvcMock(timeSvc, dnsSvc)
+	l, err := netSvc.Listen("tcp", ":80")
+	assert.Nil(t, err)
+	defer l.Close()
+	dialer := NewDialer(DefaultConfig(), dnsSvc, netSvc, timeSvc)
+	netSvc.SetDefaultLink(absos.NetMockLink{Latency: 5 * time.Second})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	resultCh := dialAsync(dialer, ctx, "tcp", "example.com:80")
+
+	timeSvc.WaitForSleepers(2)
+	cancel()
+
+	result := <-resultCh
+	assert.ErrorIs(t, result.err, context.Canceled)
+	assert.Eventually(t, func() bool { return timeSvc.SleeperCount() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestNewDialerDefaults(t *testing.T) {
+	d := NewDialer(Config{}, nil, nil, nil)
+	assert.Equal(t, DefaultConfig(), d.cfg)
+}
@@ -0,0 +1,102 @@
+package happyeyeballs
+
+import (
+	"net"
+	"slices"
+)
+
+// precedenceEntry is an entry of the RFC 6724 default policy table.
+type precedenceEntry struct {
+	prefix     *net.IPNet
+	precedence int
+}
+
+// precedenceTable is the RFC 6724 default policy table (section 2.1), longest prefixes first.
+var precedenceTable = func() []precedenceEntry {
+	entries := []struct {
+		cidr       string
+		precedence int
+	}{
+		{"::1/128", 50},
+		{"::ffff:0:0/96", 35},
+		{"::/96", 1},
+		{"2001::/32", 5},
+		{"2002::/16", 30},
+		{"3ffe::/16", 1},
+		{"fec0::/10", 1},
+		{"fc00::/7", 3},
+		{"::/0", 40},
+	}
+
+	table := make([]precedenceEntry, len(entries))
+	for i, entry := range entries {
+		_, prefix, err := net.ParseCIDR(entry.cidr)
+		if err != nil {
+			panic(err)
+		}
+		table[i] = precedenceEntry{prefix, entry.precedence}
+	}
+	return table
+}()
+
+// precedence returns the RFC 6724 precedence of ip, IPv4 addresses match as IPv4-mapped ones.
+func precedence(ip net.IP) int {
+	ip16 := ip.To16()
+	for _, entry := range precedenceTable {
+		if entry.prefix.Contains(ip16) {
+			return entry.precedence
+		}
+	}
+	return 0
+}
+
+// SortIPs returns ips ordered for connection attempts as RFC 8305 (section 4) suggests.
+//
+// IPs are sorted by RFC 6724 precedence (without the rules needing source addresses, i.e. native IPv6
+// first, then IPv4, then transition/ULA/deprecated IPv6 ranges), keeping the DNS order otherwise.
+// Then address families are interleaved: firstFamilyCount (at least 1) addresses of the first
+// family, then alternately one of the other family and one of the first one. The first family is
+// the one of the first address, or IPv4 if preferIPv4 (and there are any). Duplicates are removed.
+func SortIPs(ips []net.IP, preferIPv4 bool, firstFamilyCount int) []net.IP {
+	sorted := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		if !slices.ContainsFunc(sorted, ip.Equal) {
+			sorted = append(sorted, ip)
+		}
+	}
+	slices.SortStableFunc(sorted, func(a, b net.IP) int {
+		return precedence(b) - precedence(a)
+	})
+
+	var v6, v4 []net.IP
+	for _, ip := range sorted {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	if len(v4) == 0 || len(v6) == 0 {
+		return sorted
+	}
+
+	first, second := v6, v4
+	if preferIPv4 || sorted[0].To4() != nil {
+		first, second = v4, v6
+	}
+
+	n := min(max(firstFamilyCount, 1), len(first))
+	result := append(make([]net.IP, 0, len(sorted)), first[:n]...)
+	first = first[n:]
+	for len(first) > 0 || len(second) > 0 {
+		if len(second) > 0 {
+			result = append(result, second[0])
+			second = second[1:]
+		}
+		if len(first) > 0 {
+			result = append(result, first[0])
+			first = first[1:]
+		}
+	}
+	return result
+}
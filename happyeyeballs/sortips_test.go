@@ -0,0 +1,45 @@
+package happyeyeballs
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseIPs(addrs ...string) []net.IP {
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = net.ParseIP(addr)
+	}
+	return ips
+}
+
+func TestSortIPs(t *testing.T) {
+	ips := parseIPs("10.0.0.1", "10.0.0.2", "10.0.0.3", "2001:db8::1", "2001:db8::2")
+
+	// Interleaved, IPv6 first.
+	assert.Equal(t, parseIPs("2001:db8::1", "10.0.0.1", "2001:db8::2", "10.0.0.2", "10.0.0.3"), SortIPs(ips, false, 1))
+	assert.Equal(t, parseIPs("10.0.0.1", "2001:db8::1", "10.0.0.2", "2001:db8::2", "10.0.0.3"), SortIPs(ips, true, 1))
+	assert.Equal(t, parseIPs("10.0.0.1", "10.0.0.2", "2001:db8::1", "10.0.0.3", "2001:db8::2"), SortIPs(ips, true, 2))
+	assert.Equal(t, parseIPs("2001:db8::1", "2001:db8::2", "10.0.0.1", "10.0.0.2", "10.0.0.3"), SortIPs(ips, false, 5))
+	assert.Equal(t, parseIPs("2001:db8::1", "10.0.0.1", "2001:db8::2", "10.0.0.2", "10.0.0.3"), SortIPs(ips, false, 0))
+
+	// Single family, duplicates.
+	assert.Equal(t, parseIPs("10.0.0.2", "10.0.0.1"), SortIPs(parseIPs("10.0.0.2", "10.0.0.1", "10.0.0.2"), false, 1))
+	assert.Empty(t, SortIPs(nil, false, 1))
+}
+
+func TestSortIPsPrecedence(t *testing.T) {
+	// ULA & 6to4 go after IPv4, so IPv4 goes first.
+	ips := parseIPs("fd00::1", "2002:a00:1::1", "10.0.0.1", "2001:db8::1", "::1")
+	assert.Equal(t, parseIPs("::1", "10.0.0.1", "2001:db8::1", "2002:a00:1::1", "fd00::1"), SortIPs(ips, false, 1))
+
+	assert.Equal(t, 50, precedence(net.ParseIP("::1")))
+	assert.Equal(t, 40, precedence(net.ParseIP("2a00::1")))
+	assert.Equal(t, 35, precedence(net.ParseIP("192.168.0.1")))
+	assert.Equal(t, 30, precedence(net.ParseIP("2002::1")))
+	assert.Equal(t, 5, precedence(net.ParseIP("2001::1")))
+	assert.Equal(t, 3, precedence(net.ParseIP("fc00::1")))
+	assert.Equal(t, 1, precedence(net.ParseIP("fec0::1")))
+}
@@ -0,0 +1,144 @@
+// Package ratelimit provides in-process rate limiters keyed per client (IP, API key, user, ...),
+// with token bucket & sliding window algorithms, and net/http middleware enforcing them.
+//
+// Time is measured by absos.TimeSvc, so limits are testable with TimeSvcMockImpl. State of keys
+// idle long enough to be back to the initial one is evicted, so memory is bounded by the number
+// of active clients.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/typesafe"
+)
+
+// DefaultEvictionInterval is the default min interval between looks for idle keys.
+const DefaultEvictionInterval = time.Minute
+
+// Limiter decides whether requests of clients are allowed. Safe for concurrent use.
+type Limiter interface {
+	// Allow takes a request of the client identified by key, and tells whether it's allowed.
+	Allow(key string) Result
+}
+
+// Result is the decision about a request.
+type Result struct {
+	// Allowed tells whether the request is allowed.
+	Allowed bool
+
+	// Limit is the max number of requests allowed at once.
+	Limit int
+
+	// Remaining is the number of requests allowed right after this one.
+	Remaining int
+
+	// RetryAfter is the time until a request is allowed again, 0 if this one is allowed.
+	RetryAfter time.Duration
+
+	// Reset is the time until the limit is fully available again.
+	Reset time.Duration
+}
+
+// state is the state of a key.
+type state interface {
+	// allow takes a request at now.
+	allow(now time.Time) Result
+
+	// idle tells whether the state at now is the initial one, so can be evicted.
+	idle(now time.Time) bool
+}
+
+// entry holds the state of a key in keyedStates.
+type entry struct {
+	mu      sync.Mutex
+	evicted bool
+	state   state
+}
+
+// keyedStates holds states of keys, evicting idle ones (on requests, at most every evictionInterval).
+type keyedStates struct {
+	timeSvc          absos.TimeSvc
+	newState         func(now time.Time) state
+	evictionInterval time.Duration
+
+	entries typesafe.SyncMap[string, *entry]
+
+	evictionMu   sync.Mutex
+	nextEviction time.Time
+}
+
+func newKeyedStates(timeSvc absos.TimeSvc, evictionInterval time.Duration, newState func(now time.Time) state) *keyedStates {
+	if evictionInterval <= 0 {
+		evictionInterval = DefaultEvictionInterval
+	}
+	return &keyedStates{
+		timeSvc:          timeSvc,
+		newState:         newState,
+		evictionInterval: evictionInterval,
+		nextEviction:     timeSvc.Now().Add(evictionInterval),
+	}
+}
+
+func (ks *keyedStates) allow(key string) Result {
+	now := ks.timeSvc.Now()
+	ks.maybeEvict(now)
+
+	for {
+		e, _ := ks.entries.LoadOrCompute(key, func() *entry {
+			return &entry{state: ks.newState(now)}
+		})
+
+		e.mu.Lock()
+		if !e.evicted {
+			result := e.state.allow(now)
+			e.mu.Unlock()
+			return result
+		}
+		// Evicted concurrently (& already deleted), retry with a new one.
+		e.mu.Unlock()
+	}
+}
+
+// maybeEvict evicts idle states if the eviction interval passed since the last time, unless
+// another request is already at it.
+func (ks *keyedStates) maybeEvict(now time.Time) {
+	if !ks.evictionMu.TryLock() {
+		return
+	}
+	defer ks.evictionMu.Unlock()
+
+	if now.Before(ks.nextEviction) {
+		return
+	}
+	ks.nextEviction = now.Add(ks.evictionInterval)
+	ks.evict(now)
+}
+
+// evict deletes idle states, returns their number.
+func (ks *keyedStates) evict(now time.Time) int {
+	evicted := 0
+	ks.entries.Range(func(key string, e *entry) bool {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		if e.state.idle(now) {
+			e.evicted = true
+			ks.entries.Delete(key)
+			evicted++
+		}
+		return true
+	})
+	return evicted
+}
+
+// len returns the number of keys with state.
+func (ks *keyedStates) len() int {
+	n := 0
+	ks.entries.Range(func(string, *entry) bool {
+		n++
+		return true
+	})
+	return n
+}
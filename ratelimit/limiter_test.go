@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterEviction(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	tb, err := NewTokenBucket(TokenBucketConfig{Rate: 1, EvictionInterval: 10 * time.Second}, timeSvc)
+	assert.Nil(t, err)
+
+	for i := range 5 {
+		tb.Allow(strconv.Itoa(i))
+	}
+	assert.Equal(t, 5, tb.states.len())
+
+	// Idle, but not looked for yet.
+	timeSvc.Add(9 * time.Second)
+	tb.Allow("x")
+	assert.Equal(t, 6, tb.states.len())
+
+	// Evicted on the next request after the interval.
+	timeSvc.Add(time.Second)
+	tb.Allow("x")
+	assert.Equal(t, 1, tb.states.len())
+
+	// Not again before the interval.
+	timeSvc.Add(9 * time.Second)
+	tb.Allow("y")
+	assert.Equal(t, 2, tb.states.len())
+}
+
+func TestLimiterConcurrent(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	tb, err := NewTokenBucket(TokenBucketConfig{Rate: 100, EvictionInterval: time.Nanosecond}, timeSvc)
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := map[string]int{}
+	for i := range 8 {
+		wg.Go(func() {
+			for j := range 200 {
+				key := strconv.Itoa((i + j) % 4)
+				if tb.Allow(key).Allowed {
+					mu.Lock()
+					allowed[key]++
+					mu.Unlock()
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	// Concurrent evictions (of no idle keys) don't lose requests.
+	assert.Equal(t, map[string]int{"0": 100, "1": 100, "2": 100, "3": 100}, allowed)
+}
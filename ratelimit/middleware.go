@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// KeyFunc returns the key identifying the client of a request.
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP is KeyFunc returning the IP of the peer (the proxy one if behind a reverse proxy;
+// forwarding headers are not trusted, they're easy to forge).
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByHeader returns KeyFunc returning the value of the header (e.g. an API key). Requests without
+// the header share the "" key.
+func KeyByHeader(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// Middleware rejects requests over the limit of their client with 429 Too Many Requests, and sets
+// the rate limit headers (RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and Retry-After
+// for rejected requests, all in seconds where applicable).
+type Middleware struct {
+	limiter  Limiter
+	keyFunc  KeyFunc
+	rejected prometheus.Counter
+}
+
+// NewMiddleware returns Middleware limiting requests using limiter, per client identified by
+// keyFunc. Registers a rejected requests counter in m, with a "limiter" const label of name
+// (so several middlewares can be registered in the same metrics.Metrics).
+func NewMiddleware(limiter Limiter, keyFunc KeyFunc, name string, m *metrics.Metrics) *Middleware {
+	rejected := prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name:        m.Prefixed("ratelimit_rejected_requests"),
+			Help:        "Total number of requests rejected by rate limiting.",
+			ConstLabels: prometheus.Labels{"limiter": name},
+		},
+	)
+	m.MustRegister(rejected)
+
+	return &Middleware{limiter: limiter, keyFunc: keyFunc, rejected: rejected}
+}
+
+// Handler wraps next, calling it for allowed requests only.
+func (mw *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result := mw.limiter.Allow(mw.keyFunc(r))
+
+		h := w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			mw.rejected.Inc()
+			h.Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(result.RetryAfter))))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ceilSeconds returns d in whole seconds, rounded up.
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
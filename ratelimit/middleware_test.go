@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/appinfo"
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	tb, err := NewTokenBucket(TokenBucketConfig{Rate: 1, Period: 10 * time.Second, Burst: 2}, timeSvc)
+	assert.Nil(t, err)
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+
+	handler := NewMiddleware(tb, KeyByIP, "api", m).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	serve := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("192.0.2.1:1234")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok", rec.Body.String())
+	assert.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "10", rec.Header().Get("RateLimit-Reset"))
+	assert.Empty(t, rec.Header().Get("Retry-After"))
+
+	// Same IP, other port.
+	assert.Equal(t, http.StatusOK, serve("192.0.2.1:5678").Code)
+
+	timeSvc.Add(500 * time.Millisecond)
+	rec = serve("192.0.2.1:1234")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "Too Many Requests\n", rec.Body.String())
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "20", rec.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "10", rec.Header().Get("Retry-After"))
+
+	// Other IP.
+	assert.Equal(t, http.StatusOK, serve("[2001:db8::1]:1234").Code)
+
+	assert.Contains(t, m.DumpAsTextForTest(), `mock_ratelimit_rejected_requests{limiter="api"} 1`)
+}
+
+func TestMiddlewareRetryAfterAtLeastOneSecond(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	tb, err := NewTokenBucket(TokenBucketConfig{Rate: 100}, timeSvc)
+	assert.Nil(t, err)
+	handler := NewMiddleware(tb, KeyByHeader("X-Api-Key"), "api", metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())).
+		Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var rec *httptest.ResponseRecorder
+	for range 101 {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Api-Key", "key1")
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	// Another key.
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestKeyFuncs(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.1")
+	req.Header.Set("X-Api-Key", "secret")
+
+	assert.Equal(t, "192.0.2.1", KeyByIP(req))
+	assert.Equal(t, "secret", KeyByHeader("X-Api-Key")(req))
+	assert.Equal(t, "", KeyByHeader("Authorization")(req))
+
+	req.RemoteAddr = "@"
+	assert.Equal(t, "@", KeyByIP(req))
+}
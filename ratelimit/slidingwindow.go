@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/pkg/errors"
+)
+
+// SlidingWindowConfig configures SlidingWindow.
+type SlidingWindowConfig struct {
+	// Limit is the max number of requests per Window. Required.
+	Limit int
+
+	// Window is the duration of windows. Required.
+	Window time.Duration
+
+	// EvictionInterval is the min interval between looks for idle keys (done on requests).
+	// Defaults to DefaultEvictionInterval.
+	EvictionInterval time.Duration
+}
+
+// SlidingWindow is Limiter allowing up to a number of requests per window sliding with time:
+// requests are counted per fixed window, and the ones of the previous window are weighted by
+// the part of it still covered by the sliding window (assuming they were spread evenly).
+// Unlike fixed windows, twice the limit can't pass around a window boundary.
+//
+// Counters are idle once the previous & current windows of a key have no requests.
+type SlidingWindow struct {
+	limit  int
+	window time.Duration
+	states *keyedStates
+}
+
+var _ Limiter = (*SlidingWindow)(nil)
+
+// NewSlidingWindow returns SlidingWindow with the config, measuring time using timeSvc.
+func NewSlidingWindow(cfg SlidingWindowConfig, timeSvc absos.TimeSvc) (*SlidingWindow, error) {
+	if cfg.Limit <= 0 {
+		return nil, errors.Errorf("invalid sliding window limit %d", cfg.Limit)
+	}
+	if cfg.Window <= 0 {
+		return nil, errors.Errorf("invalid sliding window duration %v", cfg.Window)
+	}
+
+	sw := &SlidingWindow{limit: cfg.Limit, window: cfg.Window}
+	sw.states = newKeyedStates(timeSvc, cfg.EvictionInterval, func(now time.Time) state {
+		return &slidingWindowState{sw: sw, start: now}
+	})
+	return sw, nil
+}
+
+func (sw *SlidingWindow) Allow(key string) Result {
+	return sw.states.allow(key)
+}
+
+// slidingWindowState is the counters of a key.
+type slidingWindowState struct {
+	sw *SlidingWindow
+
+	// start is the start of the current window, windows of keys are aligned to their first request.
+	start     time.Time
+	prevCount int
+	count     int
+}
+
+// advance moves the current window to the one of now.
+func (s *slidingWindowState) advance(now time.Time) {
+	passed := now.Sub(s.start) / s.sw.window
+	if passed <= 0 {
+		return
+	}
+	if passed == 1 {
+		s.prevCount = s.count
+	} else {
+		s.prevCount = 0
+	}
+	s.count = 0
+	s.start = s.start.Add(passed * s.sw.window)
+}
+
+// weightAt returns the weight of the previous window at elapsed time into the current one.
+func (s *slidingWindowState) weightAt(elapsed time.Duration) float64 {
+	return 1 - float64(elapsed)/float64(s.sw.window)
+}
+
+func (s *slidingWindowState) allow(now time.Time) Result {
+	s.advance(now)
+	limit, window := s.sw.limit, s.sw.window
+	elapsed := now.Sub(s.start)
+
+	estimate := float64(s.prevCount)*s.weightAt(elapsed) + float64(s.count)
+	result := Result{Limit: limit}
+	if estimate+1 <= float64(limit) {
+		result.Allowed = true
+		s.count++
+		estimate++
+	} else {
+		result.RetryAfter = s.retryAfter(elapsed)
+	}
+	result.Remaining = max(0, int(math.Floor(float64(limit)-estimate)))
+
+	switch {
+	case s.count > 0:
+		result.Reset = 2*window - elapsed
+	case s.prevCount > 0:
+		result.Reset = window - elapsed
+	}
+	return result
+}
+
+// retryAfter returns the time until the estimated count drops enough for a request to be allowed.
+func (s *slidingWindowState) retryAfter(elapsed time.Duration) time.Duration {
+	// Allowed once prevWeight * weightAt(t) + count <= limit - 1.
+	free := float64(s.sw.limit - 1)
+	window := float64(s.sw.window)
+
+	if s.count <= s.sw.limit-1 {
+		// Within the current window, as the previous one slides out.
+		at := window * (1 - (free-float64(s.count))/float64(s.prevCount))
+		return time.Duration(math.Ceil(at)) - elapsed
+	}
+	// Within the next window, as the current one slides out.
+	at := window + window*(1-free/float64(s.count))
+	return time.Duration(math.Ceil(at)) - elapsed
+}
+
+func (s *slidingWindowState) idle(now time.Time) bool {
+	s.advance(now)
+	return s.count == 0 && s.prevCount == 0
+}
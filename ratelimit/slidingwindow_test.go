@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlidingWindow(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	sw, err := NewSlidingWindow(SlidingWindowConfig{Limit: 4, Window: time.Minute}, timeSvc)
+	assert.Nil(t, err)
+
+	for i := range 4 {
+		assert.Equal(t, Result{Allowed: true, Limit: 4, Remaining: 3 - i, Reset: 2 * time.Minute}, sw.Allow("a"))
+	}
+	assert.Equal(t, Result{Limit: 4, RetryAfter: 75 * time.Second, Reset: 2 * time.Minute}, sw.Allow("a"))
+
+	// Keys are independent.
+	assert.True(t, sw.Allow("b").Allowed)
+
+	// The previous window counts 3/4 then, only 1 slot.
+	timeSvc.Add(75 * time.Second)
+	assert.Equal(t, Result{Allowed: true, Limit: 4, Remaining: 0, Reset: 105 * time.Second}, sw.Allow("a"))
+	// Until another quarter of the previous window slides out.
+	assert.Equal(t, Result{Limit: 4, RetryAfter: 15 * time.Second, Reset: 105 * time.Second}, sw.Allow("a"))
+
+	timeSvc.Add(15 * time.Second)
+	assert.True(t, sw.Allow("a").Allowed)
+	assert.False(t, sw.Allow("a").Allowed)
+
+	// Both windows passed.
+	timeSvc.Add(2 * time.Minute)
+	for range 4 {
+		assert.True(t, sw.Allow("a").Allowed)
+	}
+	assert.False(t, sw.Allow("a").Allowed)
+}
+
+func TestSlidingWindowBoundary(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	sw, err := NewSlidingWindow(SlidingWindowConfig{Limit: 10, Window: time.Minute}, timeSvc)
+	assert.Nil(t, err)
+
+	// Unlike fixed windows, no 2x burst around the boundary.
+	sw.Allow("a")
+	timeSvc.Add(59 * time.Second)
+	allowed := 0
+	for range 9 + 10 {
+		if sw.Allow("a").Allowed {
+			allowed++
+		}
+	}
+	timeSvc.Add(2 * time.Second)
+	for range 10 {
+		if sw.Allow("a").Allowed {
+			allowed++
+		}
+	}
+	assert.Equal(t, 9, allowed)
+}
+
+func TestSlidingWindowLimitOne(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	sw, err := NewSlidingWindow(SlidingWindowConfig{Limit: 1, Window: time.Second}, timeSvc)
+	assert.Nil(t, err)
+
+	assert.True(t, sw.Allow("a").Allowed)
+	timeSvc.Add(300 * time.Millisecond)
+	result := sw.Allow("a")
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 1700*time.Millisecond, result.RetryAfter)
+
+	timeSvc.Add(result.RetryAfter - time.Millisecond)
+	assert.False(t, sw.Allow("a").Allowed)
+	timeSvc.Add(time.Millisecond)
+	assert.True(t, sw.Allow("a").Allowed)
+}
+
+func TestNewSlidingWindowErrors(t *testing.T) {
+	_, err := NewSlidingWindow(SlidingWindowConfig{Window: time.Second}, absos.NewTimeSvcMock())
+	assert.EqualError(t, err, "invalid sliding window limit 0")
+
+	_, err = NewSlidingWindow(SlidingWindowConfig{Limit: 1}, absos.NewTimeSvcMock())
+	assert.EqualError(t, err, "invalid sliding window duration 0s")
+}
+
+func TestSlidingWindowIdle(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	sw, err := NewSlidingWindow(SlidingWindowConfig{Limit: 2, Window: time.Minute}, timeSvc)
+	assert.Nil(t, err)
+
+	sw.Allow("a")
+	timeSvc.Add(90 * time.Second)
+	sw.Allow("b")
+
+	// The requests of a are in the previous window.
+	assert.Equal(t, 0, sw.states.evict(timeSvc.Now()))
+	timeSvc.Add(30 * time.Second)
+	assert.Equal(t, 1, sw.states.evict(timeSvc.Now()))
+	assert.Equal(t, 1, sw.states.len())
+}
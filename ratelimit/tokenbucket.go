@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/pkg/errors"
+)
+
+// TokenBucketConfig configures TokenBucket.
+type TokenBucketConfig struct {
+	// Rate is the number of tokens added to buckets per Period (a request takes one). Required.
+	Rate int
+
+	// Period is the period of Rate. Defaults to 1s.
+	Period time.Duration
+
+	// Burst is the capacity of buckets, i.e. the max number of requests allowed at once.
+	// Defaults to Rate.
+	Burst int
+
+	// EvictionInterval is the min interval between looks for idle keys (done on requests).
+	// Defaults to DefaultEvictionInterval.
+	EvictionInterval time.Duration
+}
+
+// TokenBucket is Limiter with a bucket of tokens per key: buckets start full, requests take
+// a token each, and are refused if there is none; tokens are added at a constant rate, up to
+// the capacity. Allows bursts, while limiting the long-term rate.
+//
+// Implemented as GCRA (buckets are a single time value, without rounding errors). Buckets are idle
+// once full again.
+type TokenBucket struct {
+	// interval is the time to add a token.
+	interval time.Duration
+	burst    int
+	states   *keyedStates
+}
+
+var _ Limiter = (*TokenBucket)(nil)
+
+// NewTokenBucket returns TokenBucket with the config, measuring time using timeSvc.
+func NewTokenBucket(cfg TokenBucketConfig, timeSvc absos.TimeSvc) (*TokenBucket, error) {
+	if cfg.Rate <= 0 {
+		return nil, errors.Errorf("invalid token bucket rate %d", cfg.Rate)
+	}
+	if cfg.Period <= 0 {
+		cfg.Period = time.Second
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = cfg.Rate
+	}
+
+	tb := &TokenBucket{
+		interval: cfg.Period / time.Duration(cfg.Rate),
+		burst:    cfg.Burst,
+	}
+	if tb.interval <= 0 {
+		return nil, errors.Errorf("token bucket rate %d per %v is too high", cfg.Rate, cfg.Period)
+	}
+	tb.states = newKeyedStates(timeSvc, cfg.EvictionInterval, func(now time.Time) state {
+		return &tokenBucketState{tb: tb, tat: now}
+	})
+	return tb, nil
+}
+
+func (tb *TokenBucket) Allow(key string) Result {
+	return tb.states.allow(key)
+}
+
+// tokenBucketState is the bucket of a key.
+type tokenBucketState struct {
+	tb *TokenBucket
+
+	// tat is the "theoretical arrival time", when the bucket is full again.
+	tat time.Time
+}
+
+func (s *tokenBucketState) allow(now time.Time) Result {
+	capacity := time.Duration(s.tb.burst) * s.tb.interval
+
+	tat := s.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(s.tb.interval)
+
+	result := Result{Limit: s.tb.burst}
+	if allowAt := newTat.Add(-capacity); now.Before(allowAt) {
+		result.RetryAfter = allowAt.Sub(now)
+	} else {
+		result.Allowed = true
+		tat = newTat
+		s.tat = newTat
+	}
+	result.Remaining = int((capacity - tat.Sub(now)) / s.tb.interval)
+	result.Reset = tat.Sub(now)
+	return result
+}
+
+func (s *tokenBucketState) idle(now time.Time) bool {
+	return !s.tat.After(now)
+}
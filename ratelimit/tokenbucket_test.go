@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	tb, err := NewTokenBucket(TokenBucketConfig{Rate: 1, Burst: 3}, timeSvc)
+	assert.Nil(t, err)
+
+	// The burst.
+	assert.Equal(t, Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}, tb.Allow("a"))
+	assert.Equal(t, Result{Allowed: true, Limit: 3, Remaining: 1, Reset: 2 * time.Second}, tb.Allow("a"))
+	assert.Equal(t, Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}, tb.Allow("a"))
+	assert.Equal(t, Result{Limit: 3, RetryAfter: time.Second, Reset: 3 * time.Second}, tb.Allow("a"))
+
+	// Keys are independent.
+	assert.True(t, tb.Allow("b").Allowed)
+
+	// Refilled at the rate.
+	timeSvc.Add(400 * time.Millisecond)
+	assert.Equal(t, Result{Limit: 3, RetryAfter: 600 * time.Millisecond, Reset: 2600 * time.Millisecond}, tb.Allow("a"))
+	timeSvc.Add(600 * time.Millisecond)
+	assert.Equal(t, Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}, tb.Allow("a"))
+	assert.False(t, tb.Allow("a").Allowed)
+
+	// Up to the capacity.
+	timeSvc.Add(time.Hour)
+	for range 3 {
+		assert.True(t, tb.Allow("a").Allowed)
+	}
+	assert.False(t, tb.Allow("a").Allowed)
+}
+
+func TestTokenBucketRate(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	tb, err := NewTokenBucket(TokenBucketConfig{Rate: 10, Period: time.Minute}, timeSvc)
+	assert.Nil(t, err)
+
+	// Every second of 10 minutes, both ends included.
+	allowed := 0
+	for range 10*60 + 1 {
+		if tb.Allow("a").Allowed {
+			allowed++
+		}
+		timeSvc.Add(time.Second)
+	}
+	// The burst (10) + 10 per minute.
+	assert.Equal(t, 10+100, allowed)
+}
+
+func TestNewTokenBucketErrors(t *testing.T) {
+	_, err := NewTokenBucket(TokenBucketConfig{}, absos.NewTimeSvcMock())
+	assert.EqualError(t, err, "invalid token bucket rate 0")
+
+	_, err = NewTokenBucket(TokenBucketConfig{Rate: 10, Period: 5 * time.Nanosecond}, absos.NewTimeSvcMock())
+	assert.EqualError(t, err, "token bucket rate 10 per 5ns is too high")
+}
+
+func TestTokenBucketIdle(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	tb, err := NewTokenBucket(TokenBucketConfig{Rate: 2, Period: time.Second}, timeSvc)
+	assert.Nil(t, err)
+
+	tb.Allow("a")
+	tb.Allow("a")
+	tb.Allow("b")
+
+	timeSvc.Add(500 * time.Millisecond)
+	assert.Equal(t, 1, tb.states.evict(timeSvc.Now()))
+	assert.Equal(t, 1, tb.states.len())
+
+	// Full again, so evicting changes nothing.
+	timeSvc.Add(500 * time.Millisecond)
+	assert.Equal(t, 1, tb.states.evict(timeSvc.Now()))
+	assert.Equal(t, 0, tb.states.len())
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, Reset: 500 * time.Millisecond}, tb.Allow("a"))
+}
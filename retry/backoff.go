@@ -0,0 +1,97 @@
+package retry
+
+import (
+	"math"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+)
+
+// Backoff gives delays between attempts.
+type Backoff interface {
+	// Next returns the delay before the retry-th retry (from 1), prev is the delay before
+	// the former retry (0 for the first one).
+	Next(retry int, prev time.Duration) time.Duration
+}
+
+// ConstantBackoff is Backoff with the same delay before each retry.
+type ConstantBackoff time.Duration
+
+func (b ConstantBackoff) Next(int, time.Duration) time.Duration {
+	return time.Duration(b)
+}
+
+// ExponentialBackoff is Backoff with delays growing exponentially: Initial, Initial * Multiplier,
+// Initial * Multiplier^2, ... up to Max, optionally randomized.
+type ExponentialBackoff struct {
+	// Initial is the delay before the first retry. Defaults to 100ms.
+	Initial time.Duration
+
+	// Multiplier is the growth factor of delays. Defaults to 2.
+	Multiplier float64
+
+	// Max caps delays (before randomization); 0 means no cap.
+	Max time.Duration
+
+	// Jitter randomizes delays by up to ±Jitter of them (e.g. 0.2 for ±20%), spreading retries
+	// of clients failing at the same time. 0 means no randomization, Rand is required otherwise.
+	Jitter float64
+
+	// Rand is the source of randomization.
+	Rand absos.RandSvc
+}
+
+func (b ExponentialBackoff) Next(retry int, _ time.Duration) time.Duration {
+	initial, multiplier := b.Initial, b.Multiplier
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	delay := float64(initial) * math.Pow(multiplier, float64(retry-1))
+	if b.Max > 0 {
+		delay = min(delay, float64(b.Max))
+	}
+	if b.Jitter > 0 {
+		delay *= 1 + b.Jitter*(2*b.Rand.Float64()-1)
+	}
+	return durationOf(delay)
+}
+
+// DecorrelatedJitterBackoff is Backoff with random delays between Base and 3 times the previous
+// delay, up to Max ("decorrelated jitter", as described by the AWS Architecture Blog). Grows
+// like exponential backoff, but spreads retries of clients failing at the same time better.
+type DecorrelatedJitterBackoff struct {
+	// Base is the min delay. Defaults to 100ms.
+	Base time.Duration
+
+	// Max caps delays; 0 means no cap.
+	Max time.Duration
+
+	// Rand is the source of randomization. Required.
+	Rand absos.RandSvc
+}
+
+func (b DecorrelatedJitterBackoff) Next(_ int, prev time.Duration) time.Duration {
+	base := b.Base
+	if base <= 0 {
+		base = 100 * time.Millisecond
+	}
+	prev = max(prev, base)
+
+	delay := float64(base) + b.Rand.Float64()*float64(3*prev-base)
+	if b.Max > 0 {
+		delay = min(delay, float64(b.Max))
+	}
+	return durationOf(delay)
+}
+
+// durationOf converts ns to time.Duration, saturating instead of overflowing.
+func durationOf(ns float64) time.Duration {
+	if ns >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(ns)
+}
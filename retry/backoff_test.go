@@ -0,0 +1,73 @@
+package retry
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/stretchr/testify/assert"
+)
+
+// delays returns the first n delays of b.
+func delays(b Backoff, n int) []time.Duration {
+	var result []time.Duration
+	var prev time.Duration
+	for retry := 1; retry <= n; retry++ {
+		prev = b.Next(retry, prev)
+		result = append(result, prev)
+	}
+	return result
+}
+
+func TestConstantBackoff(t *testing.T) {
+	assert.Equal(t, []time.Duration{time.Second, time.Second, time.Second}, delays(ConstantBackoff(time.Second), 3))
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	ms := time.Millisecond
+	assert.Equal(t, []time.Duration{100 * ms, 200 * ms, 400 * ms, 800 * ms}, delays(ExponentialBackoff{}, 4))
+
+	b := ExponentialBackoff{Initial: time.Second, Multiplier: 1.5, Max: 3 * time.Second}
+	assert.Equal(t, []time.Duration{time.Second, 1500 * ms, 2250 * ms, 3 * time.Second, 3 * time.Second}, delays(b, 5))
+
+	// Saturates.
+	assert.Equal(t, time.Duration(math.MaxInt64), ExponentialBackoff{}.Next(1000, 0))
+}
+
+func TestExponentialBackoffJitter(t *testing.T) {
+	b := ExponentialBackoff{Initial: time.Second, Max: 8 * time.Second, Jitter: 0.5, Rand: absos.NewRandSvcMock(1)}
+
+	distinct := map[time.Duration]bool{}
+	for retry := 1; retry <= 6; retry++ {
+		expected := min(time.Second<<(retry-1), 8*time.Second)
+		for range 20 {
+			delay := b.Next(retry, 0)
+			assert.GreaterOrEqual(t, delay, expected/2)
+			assert.LessOrEqual(t, delay, expected*3/2)
+			distinct[delay] = true
+		}
+	}
+	assert.Greater(t, len(distinct), 100)
+}
+
+func TestDecorrelatedJitterBackoff(t *testing.T) {
+	b := DecorrelatedJitterBackoff{Base: time.Second, Max: time.Minute, Rand: absos.NewRandSvcMock(1)}
+
+	var prev time.Duration
+	grown := false
+	for retry := 1; retry <= 50; retry++ {
+		delay := b.Next(retry, prev)
+		assert.GreaterOrEqual(t, delay, time.Second)
+		assert.LessOrEqual(t, delay, min(3*max(prev, time.Second), time.Minute))
+		grown = grown || delay > 10*time.Second
+		prev = delay
+	}
+	assert.True(t, grown)
+
+	// Reproducible with the same seed.
+	b1 := DecorrelatedJitterBackoff{Rand: absos.NewRandSvcMock(2)}
+	b2 := DecorrelatedJitterBackoff{Rand: absos.NewRandSvcMock(2)}
+	assert.Equal(t, delays(b1, 10), delays(b2, 10))
+	assert.GreaterOrEqual(t, delays(b1, 1)[0], 100*time.Millisecond)
+}
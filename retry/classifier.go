@@ -0,0 +1,68 @@
+package retry
+
+import "github.com/pkg/errors"
+
+// Classifier tells whether err is retryable, false means it's permanent.
+type Classifier func(err error) bool
+
+// permanentError marks an error as permanent, see Permanent().
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as permanent (so it's never retried, whatever the classifier says).
+// Retrier.Do() returns err without the mark. Returns nil for nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// IsPermanent tells whether err (or an error it wraps) is marked as permanent by Permanent().
+func IsPermanent(err error) bool {
+	var permanentErr *permanentError
+	return errors.As(err, &permanentErr)
+}
+
+// unwrapPermanent returns err without the Permanent() mark, if it's marked at the top.
+func unwrapPermanent(err error) error {
+	if permanentErr, ok := err.(*permanentError); ok {
+		return permanentErr.err
+	}
+	return err
+}
+
+// RetryAll is Classifier retrying all errors (but the ones marked by Permanent()), the default one.
+func RetryAll(error) bool {
+	return true
+}
+
+// PermanentErrors returns Classifier retrying all errors but the ones matching (see errors.Is())
+// any of targets, e.g. utils.ConstError values.
+func PermanentErrors(targets ...error) Classifier {
+	return func(err error) bool {
+		return !isAny(err, targets)
+	}
+}
+
+// RetryableErrors returns Classifier retrying only errors matching (see errors.Is()) any of
+// targets, e.g. utils.ConstError values.
+func RetryableErrors(targets ...error) Classifier {
+	return func(err error) bool {
+		return isAny(err, targets)
+	}
+}
+
+func isAny(err error, targets []error) bool {
+	for _, target := range targets {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kattecon/akgoli/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	errTemporary = utils.ConstError("temporary")
+	errInvalid   = utils.ConstError("invalid")
+)
+
+func TestPermanent(t *testing.T) {
+	assert.Nil(t, Permanent(nil))
+
+	err := Permanent(errInvalid)
+	assert.EqualError(t, err, "invalid")
+	assert.ErrorIs(t, err, errInvalid)
+	assert.True(t, IsPermanent(err))
+	assert.True(t, IsPermanent(fmt.Errorf("wrapped: %w", err)))
+	assert.False(t, IsPermanent(errInvalid))
+
+	assert.Equal(t, errInvalid, unwrapPermanent(err))
+	assert.Equal(t, errInvalid, unwrapPermanent(errInvalid))
+}
+
+func TestClassifiers(t *testing.T) {
+	wrapped := fmt.Errorf("fetch: %w", errInvalid)
+	other := errors.New("other")
+
+	assert.True(t, RetryAll(other))
+
+	permanent := PermanentErrors(errInvalid, context.Canceled)
+	assert.False(t, permanent(wrapped))
+	assert.False(t, permanent(context.Canceled))
+	assert.True(t, permanent(errTemporary))
+	assert.True(t, permanent(other))
+
+	retryable := RetryableErrors(errTemporary)
+	assert.True(t, retryable(fmt.Errorf("fetch: %w", errTemporary)))
+	assert.False(t, retryable(wrapped))
+	assert.False(t, retryable(other))
+}
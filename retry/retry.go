@@ -0,0 +1,188 @@
+// Package retry retries failing operations with backoff (exponential, decorrelated jitter or
+// constant), up to a max number of attempts and/or a max elapsed time, retrying only errors
+// classified as retryable. Waiting is done via absos.TimeSvc, so retries are testable
+// with TimeSvcMockImpl.
+package retry
+
+import (
+	"context"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Config configures Retrier.
+type Config struct {
+	// Backoff gives the delays between attempts. Defaults to ExponentialBackoff{}.
+	Backoff Backoff
+
+	// MaxAttempts limits the number of attempts (the first one included); 0 means no limit.
+	MaxAttempts int
+
+	// MaxElapsedTime limits the time since the first attempt: no retry is made if it would start
+	// past it. 0 means no limit.
+	MaxElapsedTime time.Duration
+
+	// Classifier tells whether errors are retryable. Defaults to RetryAll.
+	Classifier Classifier
+
+	// OnRetry is called before waiting for a retry, with the number of the failed attempt (from 1),
+	// its error and the delay. Optional, e.g. for logging.
+	OnRetry func(attempt int, err error, delay time.Duration)
+
+	// Name is the "operation" label value of the metrics.
+	Name string
+
+	// Metrics records attempts & give-ups if not nil.
+	Metrics *Metrics
+}
+
+// Give-up reasons, the "reason" label values of the give-ups counter.
+const (
+	GiveUpMaxAttempts    = "max_attempts"
+	GiveUpMaxElapsedTime = "max_elapsed_time"
+	GiveUpPermanent      = "permanent"
+	GiveUpCancelled      = "cancelled"
+)
+
+var allGiveUpReasons = []string{GiveUpMaxAttempts, GiveUpMaxElapsedTime, GiveUpPermanent, GiveUpCancelled}
+
+// Metrics are the attempt & give-up counters of Retriers, labeled by operation name.
+// Register them once, and share them by Retriers of distinct names (see Config).
+type Metrics struct {
+	attempts *prometheus.CounterVec
+	giveUps  *prometheus.CounterVec
+}
+
+// NewMetrics returns Metrics registered in m.
+func NewMetrics(m *metrics.Metrics) *Metrics {
+	rm := &Metrics{
+		attempts: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: m.Prefixed("retry_attempts"),
+				Help: "Total number of attempts of retried operations.",
+			},
+			[]string{"operation"},
+		),
+		giveUps: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: m.Prefixed("retry_give_ups"),
+				Help: "Total number of retried operations failed for good.",
+			},
+			[]string{"operation", "reason"},
+		),
+	}
+	m.MustRegister(rm.attempts, rm.giveUps)
+	return rm
+}
+
+// init sets the counters of the operation to zero (see logging.NewLogger() for reasons).
+func (rm *Metrics) init(operation string) {
+	rm.attempts.WithLabelValues(operation).Add(0)
+	for _, reason := range allGiveUpReasons {
+		rm.giveUps.WithLabelValues(operation, reason).Add(0)
+	}
+}
+
+// Retrier runs operations, retrying them on failures. Safe for concurrent use.
+type Retrier struct {
+	cfg     Config
+	timeSvc absos.TimeSvc
+}
+
+// NewRetrier returns Retrier with the config, waiting using timeSvc.
+func NewRetrier(cfg Config, timeSvc absos.TimeSvc) *Retrier {
+	if cfg.Backoff == nil {
+		cfg.Backoff = ExponentialBackoff{}
+	}
+	if cfg.Classifier == nil {
+		cfg.Classifier = RetryAll
+	}
+	if cfg.Metrics != nil {
+		cfg.Metrics.init(cfg.Name)
+	}
+	return &Retrier{cfg: cfg, timeSvc: timeSvc}
+}
+
+// Do runs op until it succeeds, or the retrier gives up:
+//   - on a permanent error (see Classifier and Permanent()), returned as is (without the Permanent() mark);
+//   - once the max attempts or elapsed time is reached, returning the last error wrapped
+//     (with the number of attempts);
+//   - once ctx is done, returning ctx.Err() wrapped (with the number of attempts and the last error,
+//     "after 0 attempts" if ctx is done already).
+func (r *Retrier) Do(ctx context.Context, op func(ctx context.Context) error) error {
+	if err := ctx.Err(); err != nil {
+		r.giveUp(GiveUpCancelled)
+		return errors.Wrap(err, "after 0 attempts")
+	}
+
+	start := r.timeSvc.Now()
+	var delay time.Duration
+
+	// Later attempts follow a SleepContext(), which checks ctx.
+	for attempt := 1; ; attempt++ {
+		r.countAttempt()
+		err := op(ctx)
+		if err == nil {
+			return nil
+		}
+
+		if IsPermanent(err) || !r.cfg.Classifier(err) {
+			r.giveUp(GiveUpPermanent)
+			return unwrapPermanent(err)
+		}
+		if ctx.Err() != nil {
+			r.giveUp(GiveUpCancelled)
+			return errors.Wrapf(ctx.Err(), "after %d attempts (last error: %v)", attempt, err)
+		}
+		if r.cfg.MaxAttempts > 0 && attempt >= r.cfg.MaxAttempts {
+			r.giveUp(GiveUpMaxAttempts)
+			return errors.Wrapf(err, "gave up after %d attempts", attempt)
+		}
+
+		delay = r.cfg.Backoff.Next(attempt, delay)
+		if r.cfg.MaxElapsedTime > 0 && r.timeSvc.Now().Add(delay).Sub(start) > r.cfg.MaxElapsedTime {
+			r.giveUp(GiveUpMaxElapsedTime)
+			return errors.Wrapf(err, "gave up after %d attempts", attempt)
+		}
+
+		if r.cfg.OnRetry != nil {
+			r.cfg.OnRetry(attempt, err, delay)
+		}
+		if sleepErr := absos.SleepContext(ctx, r.timeSvc, delay); sleepErr != nil {
+			r.giveUp(GiveUpCancelled)
+			return errors.Wrapf(sleepErr, "after %d attempts (last error: %v)", attempt, err)
+		}
+	}
+}
+
+// DoValue is Retrier.Do() for operations returning a value, returns the one of the successful
+// attempt (the zero value on failure).
+func DoValue[T any](ctx context.Context, r *Retrier, op func(ctx context.Context) (T, error)) (T, error) {
+	var value T
+	err := r.Do(ctx, func(ctx context.Context) error {
+		var err error
+		value, err = op(ctx)
+		return err
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return value, nil
+}
+
+func (r *Retrier) countAttempt() {
+	if r.cfg.Metrics != nil {
+		r.cfg.Metrics.attempts.WithLabelValues(r.cfg.Name).Inc()
+	}
+}
+
+func (r *Retrier) giveUp(reason string) {
+	if r.cfg.Metrics != nil {
+		r.cfg.Metrics.giveUps.WithLabelValues(r.cfg.Name, reason).Inc()
+	}
+}
@@ -0,0 +1,198 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/appinfo"
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingOp returns an op failing with errs in turn (then succeeding), recording the mock times
+// of its attempts.
+func failingOp(timeSvc absos.TimeSvc, attempts *[]time.Duration, errs ...error) func(ctx context.Context) error {
+	start := timeSvc.Now()
+	return func(ctx context.Context) error {
+		*attempts = append(*attempts, timeSvc.Now().Sub(start))
+		if len(*attempts) <= len(errs) {
+			return errs[len(*attempts)-1]
+		}
+		return nil
+	}
+}
+
+func TestRetrierDo(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	timeSvc.EnableAutoAdvance(absos.AutoAdvanceConfig{})
+	defer timeSvc.DisableAutoAdvance()
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	var retries []string
+	r := NewRetrier(Config{
+		Backoff: ExponentialBackoff{Initial: time.Second},
+		OnRetry: func(attempt int, err error, delay time.Duration) {
+			retries = append(retries, err.Error()+" "+delay.String())
+		},
+		Name:    "fetch",
+		Metrics: NewMetrics(m),
+	}, timeSvc)
+
+	var attempts []time.Duration
+	var err error
+	timeSvc.Go(func() {
+		err = r.Do(context.Background(), failingOp(timeSvc, &attempts, errTemporary, errTemporary))
+	})
+	assert.Nil(t, timeSvc.WaitGoroutines())
+
+	assert.Nil(t, err)
+	assert.Equal(t, []time.Duration{0, time.Second, 3 * time.Second}, attempts)
+	assert.Equal(t, []string{"temporary 1s", "temporary 2s"}, retries)
+
+	dump := m.DumpAsTextForTest()
+	assert.Contains(t, dump, `mock_retry_attempts{operation="fetch"} 3`)
+	assert.Contains(t, dump, `mock_retry_give_ups{operation="fetch",reason="max_attempts"} 0`)
+}
+
+func TestRetrierMaxAttempts(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	timeSvc.EnableAutoAdvance(absos.AutoAdvanceConfig{})
+	defer timeSvc.DisableAutoAdvance()
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	r := NewRetrier(Config{Backoff: ConstantBackoff(time.Second), MaxAttempts: 3, Name: "fetch", Metrics: NewMetrics(m)}, timeSvc)
+
+	var attempts []time.Duration
+	var err error
+	timeSvc.Go(func() {
+		err = r.Do(context.Background(), failingOp(timeSvc, &attempts, errTemporary, errTemporary, errTemporary, errTemporary))
+	})
+	assert.Nil(t, timeSvc.WaitGoroutines())
+
+	assert.ErrorIs(t, err, errTemporary)
+	assert.EqualError(t, err, "gave up after 3 attempts: temporary")
+	assert.Equal(t, []time.Duration{0, time.Second, 2 * time.Second}, attempts)
+
+	dump := m.DumpAsTextForTest()
+	assert.Contains(t, dump, `mock_retry_attempts{operation="fetch"} 3`)
+	assert.Contains(t, dump, `mock_retry_give_ups{operation="fetch",reason="max_attempts"} 1`)
+}
+
+func TestRetrierMaxElapsedTime(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	timeSvc.EnableAutoAdvance(absos.AutoAdvanceConfig{})
+	defer timeSvc.DisableAutoAdvance()
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	r := NewRetrier(Config{
+		Backoff:        ExponentialBackoff{Initial: time.Second},
+		MaxElapsedTime: 10 * time.Second,
+		Name:           "fetch",
+		Metrics:        NewMetrics(m),
+	}, timeSvc)
+
+	var attempts []time.Duration
+	var err error
+	timeSvc.Go(func() {
+		err = r.Do(context.Background(), failingOp(timeSvc, &attempts, errTemporary, errTemporary, errTemporary, errTemporary, errTemporary))
+	})
+	assert.Nil(t, timeSvc.WaitGoroutines())
+
+	// The next retry would start at 15s.
+	assert.EqualError(t, err, "gave up after 4 attempts: temporary")
+	assert.Equal(t, []time.Duration{0, time.Second, 3 * time.Second, 7 * time.Second}, attempts)
+	assert.Contains(t, m.DumpAsTextForTest(), `mock_retry_give_ups{operation="fetch",reason="max_elapsed_time"} 1`)
+}
+
+func TestRetrierPermanent(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	timeSvc.EnableAutoAdvance(absos.AutoAdvanceConfig{})
+	defer timeSvc.DisableAutoAdvance()
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	rm := NewMetrics(m)
+
+	// Classified as permanent.
+	r := NewRetrier(Config{Classifier: PermanentErrors(errInvalid), Name: "a", Metrics: rm}, timeSvc)
+	var attempts []time.Duration
+	err := r.Do(context.Background(), failingOp(timeSvc, &attempts, errInvalid))
+	assert.Equal(t, errInvalid, err)
+	assert.Len(t, attempts, 1)
+
+	// Marked as permanent.
+	r = NewRetrier(Config{Name: "b", Metrics: rm}, timeSvc)
+	attempts = nil
+	err = r.Do(context.Background(), failingOp(timeSvc, &attempts, Permanent(errTemporary)))
+	assert.Equal(t, errTemporary, err)
+	assert.Len(t, attempts, 1)
+
+	dump := m.DumpAsTextForTest()
+	assert.Contains(t, dump, `mock_retry_give_ups{operation="a",reason="permanent"} 1`)
+	assert.Contains(t, dump, `mock_retry_give_ups{operation="b",reason="permanent"} 1`)
+}
+
+func TestRetrierCancel(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	r := NewRetrier(Config{Backoff: ConstantBackoff(time.Minute), Metrics: NewMetrics(m)}, timeSvc)
+
+	// While waiting.
+	ctx, cancel := context.WithCancel(context.Background())
+	var attempts []time.Duration
+	errCh := make(chan error)
+	go func() {
+		errCh <- r.Do(ctx, failingOp(timeSvc, &attempts, errTemporary, errTemporary))
+	}()
+	timeSvc.WaitForSleepers(1)
+	cancel()
+	err := <-errCh
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.EqualError(t, err, "after 1 attempts (last error: temporary): context canceled")
+	assert.Len(t, attempts, 1)
+
+	// During an attempt.
+	ctx, cancel = context.WithCancel(context.Background())
+	err = r.Do(ctx, func(ctx context.Context) error {
+		cancel()
+		return ctx.Err()
+	})
+	assert.EqualError(t, err, "after 1 attempts (last error: context canceled): context canceled")
+
+	// Before the first attempt.
+	err = r.Do(ctx, func(ctx context.Context) error {
+		t.Fatal("attempted")
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.EqualError(t, err, "after 0 attempts: context canceled")
+
+	assert.Contains(t, m.DumpAsTextForTest(), `mock_retry_give_ups{operation="",reason="cancelled"} 3`)
+}
+
+func TestDoValue(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	timeSvc.EnableAutoAdvance(absos.AutoAdvanceConfig{})
+	defer timeSvc.DisableAutoAdvance()
+	r := NewRetrier(Config{MaxAttempts: 2}, timeSvc)
+
+	calls := 0
+	var value int
+	var err error
+	timeSvc.Go(func() {
+		value, err = DoValue(context.Background(), r, func(ctx context.Context) (int, error) {
+			calls++
+			if calls == 1 {
+				return -1, errTemporary
+			}
+			return 42, nil
+		})
+	})
+	assert.Nil(t, timeSvc.WaitGoroutines())
+	assert.Nil(t, err)
+	assert.Equal(t, 42, value)
+
+	value, err = DoValue(context.Background(), r, func(ctx context.Context) (int, error) {
+		return -1, Permanent(errors.New("nope"))
+	})
+	assert.EqualError(t, err, "nope")
+	assert.Equal(t, 0, value)
+}
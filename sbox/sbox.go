@@ -53,10 +53,10 @@
 package sbox
 
 import (
-	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 
+	"github.com/kattecon/akgoli/absos"
 	"github.com/kattecon/akgoli/utils"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/nacl/secretbox"
@@ -130,6 +130,9 @@ type sboxSvcImpl struct {
 	// secretKey is the 32-byte key used for encryption/decryption.
 	// This key is generated once during construction and never changes.
 	secretKey [secretKeySize]byte
+
+	// rnd is the source of the secret key and nonces.
+	rnd absos.RandSvc
 }
 
 // NewSBoxSvc creates a new SBoxSvc instance with a randomly generated encryption key.
@@ -142,9 +145,21 @@ type sboxSvcImpl struct {
 //
 // Returns a new SBoxSvc ready for immediate use.
 func NewSBoxSvc() SBoxSvc {
-	var sb sboxSvcImpl
+	return NewSBoxSvcWithRand(absos.NewRandSvc())
+}
+
+// NewSBoxSvcWithRand creates a new SBoxSvc instance taking the encryption key and
+// nonces from rnd.
+//
+// Use absos.RandSvcMockImpl for reproducible results in tests (e.g. golden ciphertexts):
+// instances created with equally seeded mocks share the key, and produce the same
+// results for the same sequence of calls. Production code should use NewSBoxSvc().
+//
+// The function panics if rnd fails.
+func NewSBoxSvcWithRand(rnd absos.RandSvc) SBoxSvc {
+	sb := sboxSvcImpl{rnd: rnd}
 
-	nr, err := rand.Read(sb.secretKey[:])
+	nr, err := rnd.Read(sb.secretKey[:])
 	if nr != secretKeySize || err != nil {
 		panic(err)
 	}
@@ -181,7 +196,7 @@ func (sb *sboxSvcImpl) Encode(value any) (string, error) {
 	// Generate a cryptographically secure random nonce.
 	// Each encryption operation must use a unique nonce for security.
 	var nonce [nonceSize]byte
-	nr, err := rand.Read(nonce[:])
+	nr, err := sb.rnd.Read(nonce[:])
 	if nr != nonceSize || err != nil {
 		panic(err)
 	}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/agnivade/levenshtein"
+	"github.com/kattecon/akgoli/absos"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -432,3 +433,29 @@ func TestDataIntegrity(t *testing.T) {
 		}
 	})
 }
+
+// TestWithRand tests reproducibility with a deterministic RandSvc.
+func TestWithRand(t *testing.T) {
+	sb1 := NewSBoxSvcWithRand(absos.NewRandSvcMock(42))
+	sb2 := NewSBoxSvcWithRand(absos.NewRandSvcMock(42))
+	sb3 := NewSBoxSvcWithRand(absos.NewRandSvcMock(43))
+
+	msg := testStruct{A: "hello-world", B: 32}
+
+	enc1a, err := sb1.Encode(msg)
+	assert.NoError(t, err)
+	enc1b, err := sb1.Encode(msg)
+	assert.NoError(t, err)
+	assert.NotEqual(t, enc1a, enc1b)
+
+	// Same seed, same key and nonces.
+	enc2a, err := sb2.Encode(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, enc1a, enc2a)
+
+	var decoded testStruct
+	assert.NoError(t, sb2.Decode(enc1b, &decoded))
+	assert.Equal(t, msg, decoded)
+
+	assert.Equal(t, ErrFailedToDecrypt, sb3.Decode(enc1a, &decoded))
+}
@@ -0,0 +1,230 @@
+package scheduler
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Schedule tells when a job runs.
+type Schedule interface {
+	// Next returns the first run time strictly after after, in the location of after.
+	// The zero time means no more runs.
+	Next(after time.Time) time.Time
+}
+
+// every is Schedule with a fixed interval.
+type every time.Duration
+
+// Every returns Schedule running every d, the first run d after the job is scheduled.
+// Panics if d <= 0.
+func Every(d time.Duration) Schedule {
+	if d <= 0 {
+		panic("non-positive interval for Every")
+	}
+	return every(d)
+}
+
+func (e every) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(e))
+}
+
+// cronField is the bitset of the values matched by a field of a cron expression.
+type cronField uint64
+
+func (f cronField) has(v int) bool {
+	return f&(1<<uint(v)) != 0
+}
+
+// cronSchedule is Schedule of a cron expression.
+type cronSchedule struct {
+	minute, hour, dom, month, dow cronField
+
+	// Whether dom/dow are "*" (or "?"): if both are restricted, days matching either of them match.
+	domAny, dowAny bool
+}
+
+// cronFieldSpec describes a field of cron expressions.
+type cronFieldSpec struct {
+	name     string
+	min, max int
+	names    []string // Names of the values from min, if any.
+}
+
+var (
+	minuteSpec = cronFieldSpec{name: "minute", min: 0, max: 59}
+	hourSpec   = cronFieldSpec{name: "hour", min: 0, max: 23}
+	domSpec    = cronFieldSpec{name: "day of month", min: 1, max: 31}
+	monthSpec  = cronFieldSpec{name: "month", min: 1, max: 12, names: []string{
+		"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec",
+	}}
+	// 7 is Sunday as well.
+	dowSpec = cronFieldSpec{name: "day of week", min: 0, max: 7, names: []string{
+		"sun", "mon", "tue", "wed", "thu", "fri", "sat",
+	}}
+)
+
+// cronDescriptors are the predefined expressions.
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a standard cron expression: 5 fields (minute, hour, day of month, month,
+// day of week) of "*", values, ranges ("1-5"), steps ("*/15", "0-30/10") and lists of them
+// ("1,15"). Months & days of week may be given by names ("jan", "mon", case-insensitive),
+// 0 & 7 are Sunday. If both days of month & of week are restricted, days matching either run,
+// like Vixie cron does. The descriptors @yearly (@annually), @monthly, @weekly, @daily (@midnight)
+// and @hourly are recognized as well.
+//
+// The expression is evaluated in the location of the times passed to Next(), and wall clock
+// times skipped by DST transitions are skipped, repeated ones run once.
+func ParseCron(expr string) (Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) == 1 && strings.HasPrefix(fields[0], "@") {
+		descriptor, ok := cronDescriptors[strings.ToLower(fields[0])]
+		if !ok {
+			return nil, errors.Errorf("invalid cron expression %q: unknown descriptor", expr)
+		}
+		fields = strings.Fields(descriptor)
+	}
+	if len(fields) != 5 {
+		return nil, errors.Errorf("invalid cron expression %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	var s cronSchedule
+	for i, spec := range []cronFieldSpec{minuteSpec, hourSpec, domSpec, monthSpec, dowSpec} {
+		field, err := parseCronField(fields[i], spec)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid cron expression %q", expr)
+		}
+		switch i {
+		case 0:
+			s.minute = field
+		case 1:
+			s.hour = field
+		case 2:
+			s.dom, s.domAny = field, isCronWildcard(fields[i])
+		case 3:
+			s.month = field
+		case 4:
+			// Sunday is 0.
+			if field.has(7) {
+				field = field&^(1<<7) | 1
+			}
+			s.dow, s.dowAny = field, isCronWildcard(fields[i])
+		}
+	}
+	return &s, nil
+}
+
+func isCronWildcard(field string) bool {
+	return field == "*" || field == "?"
+}
+
+// parseCronField parses a comma separated list of ranges of a field.
+func parseCronField(field string, spec cronFieldSpec) (cronField, error) {
+	var result cronField
+	for part := range strings.SplitSeq(field, ",") {
+		lo, hi, step := spec.min, spec.max, 1
+
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, errors.Errorf("invalid step %q of %s", stepStr, spec.name)
+			}
+		}
+
+		if !isCronWildcard(rng) {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = spec.parseValue(loStr); err != nil {
+				return 0, err
+			}
+			switch {
+			case isRange:
+				if hi, err = spec.parseValue(hiStr); err != nil {
+					return 0, err
+				}
+				if hi < lo {
+					return 0, errors.Errorf("invalid range %q of %s", rng, spec.name)
+				}
+			case hasStep:
+				// "5/10" is "5-max/10".
+			default:
+				hi = lo
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			result |= 1 << uint(v)
+		}
+	}
+	return result, nil
+}
+
+// parseValue parses a number or a name of a value of the field.
+func (spec cronFieldSpec) parseValue(s string) (int, error) {
+	for i, name := range spec.names {
+		if strings.EqualFold(s, name) {
+			return spec.min + i, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < spec.min || v > spec.max {
+		return 0, errors.Errorf("invalid value %q of %s (expected %d-%d)", s, spec.name, spec.min, spec.max)
+	}
+	return v, nil
+}
+
+// cronSearchYears limits the search for the next run time, so impossible dates (e.g. Feb 30) end it.
+const cronSearchYears = 5
+
+func (s *cronSchedule) Next(after time.Time) time.Time {
+	// The next whole minute.
+	t := dateAfter(after, after.Year(), after.Month(), after.Day(), after.Hour(), after.Minute()+1)
+	yearLimit := t.Year() + cronSearchYears
+
+	for t.Year() <= yearLimit {
+		switch {
+		case !s.month.has(int(t.Month())):
+			t = dateAfter(t, t.Year(), t.Month()+1, 1, 0, 0)
+		case !s.dayMatches(t):
+			t = dateAfter(t, t.Year(), t.Month(), t.Day()+1, 0, 0)
+		case !s.hour.has(t.Hour()):
+			t = dateAfter(t, t.Year(), t.Month(), t.Day(), t.Hour()+1, 0)
+		case !s.minute.has(t.Minute()):
+			t = dateAfter(t, t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dateAfter returns time.Date() of the wall clock time in the location of t, or t plus a minute if
+// that's not after t (time.Date() may go back for wall clock times skipped by DST transitions).
+func dateAfter(t time.Time, year int, month time.Month, day, hour, minute int) time.Time {
+	if next := time.Date(year, month, day, hour, minute, 0, 0, t.Location()); next.After(t) {
+		return next
+	}
+	return t.Truncate(time.Minute).Add(time.Minute)
+}
+
+// dayMatches tells whether the day of t matches the day of month & day of week fields.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch, dowMatch := s.dom.has(t.Day()), s.dow.has(int(t.Weekday()))
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // America/New_York regardless of the system tz database.
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCron(t *testing.T) {
+	// Saturday.
+	after := time.Date(2026, 10, 17, 12, 34, 56, 0, time.UTC)
+
+	for _, tc := range []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 17, 12, 35, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 17, 12, 45, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2026, 10, 17, 12, 45, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2026, 10, 17, 13, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2026, 10, 18, 2, 30, 0, 0, time.UTC)},
+		{"0,30 8-10/2 * * *", time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * JAN,jul *", time.Date(2027, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"59 23 31 12 ?", time.Date(2026, 12, 31, 23, 59, 0, 0, time.UTC)},
+		// The 13th or Fridays.
+		{"0 0 13 * 5", time.Date(2026, 10, 23, 0, 0, 0, 0, time.UTC)},
+		// Never.
+		{"0 0 31 2 *", time.Time{}},
+		{"@hourly", time.Date(2026, 10, 17, 13, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"@Weekly", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		s, err := ParseCron(tc.expr)
+		if assert.Nil(t, err, tc.expr) {
+			assert.Equal(t, tc.next, s.Next(after), tc.expr)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for expr, msg := range map[string]string{
+		"* * * *":       `invalid cron expression "* * * *": expected 5 fields, got 4`,
+		"@reboot":       `invalid cron expression "@reboot": unknown descriptor`,
+		"60 * * * *":    `invalid cron expression "60 * * * *": invalid value "60" of minute (expected 0-59)`,
+		"* * 0 * *":     `invalid cron expression "* * 0 * *": invalid value "0" of day of month (expected 1-31)`,
+		"* * * foo *":   `invalid cron expression "* * * foo *": invalid value "foo" of month (expected 1-12)`,
+		"* * * * 1-x":   `invalid cron expression "* * * * 1-x": invalid value "x" of day of week (expected 0-7)`,
+		"*/0 * * * *":   `invalid cron expression "*/0 * * * *": invalid step "0" of minute`,
+		"* 5-1 * * *":   `invalid cron expression "* 5-1 * * *": invalid range "5-1" of hour`,
+		"1,,2 * * * *":  `invalid cron expression "1,,2 * * * *": invalid value "" of minute (expected 0-59)`,
+		"* * * * * * *": `invalid cron expression "* * * * * * *": expected 5 fields, got 7`,
+	} {
+		_, err := ParseCron(expr)
+		assert.EqualError(t, err, msg)
+	}
+}
+
+func TestCronScheduleNextSequence(t *testing.T) {
+	s, err := ParseCron("0 9 * * 1,3")
+	assert.Nil(t, err)
+
+	var runs []string
+	next := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	for range 4 {
+		next = s.Next(next)
+		runs = append(runs, next.Format("Mon 2006-01-02 15:04"))
+	}
+	assert.Equal(t, []string{"Mon 2026-10-19 09:00", "Wed 2026-10-21 09:00", "Mon 2026-10-26 09:00", "Wed 2026-10-28 09:00"}, runs)
+}
+
+func TestCronScheduleLocation(t *testing.T) {
+	s, err := ParseCron("0 9 * * *")
+	assert.Nil(t, err)
+
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	next := s.Next(time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC).In(loc))
+	assert.Equal(t, time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC), next.UTC())
+	assert.Equal(t, loc, next.Location())
+}
+
+func TestCronScheduleDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.Nil(t, err)
+
+	// 2:30 doesn't exist on Mar 8, 2026 (2:00 EST -> 3:00 EDT): skipped.
+	s, err := ParseCron("30 2 * * *")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2026, 3, 9, 2, 30, 0, 0, loc), s.Next(time.Date(2026, 3, 7, 12, 0, 0, 0, loc)))
+
+	// 1:30 happens twice on Nov 1, 2026 (2:00 EDT -> 1:00 EST): run once.
+	s, err = ParseCron("30 1 * * *")
+	assert.Nil(t, err)
+	next := s.Next(time.Date(2026, 10, 31, 12, 0, 0, 0, loc))
+	assert.Equal(t, "2026-11-01 01:30 EDT", next.Format("2006-01-02 15:04 MST"))
+	assert.Equal(t, "2026-11-02 01:30 EST", s.Next(next).Format("2006-01-02 15:04 MST"))
+
+	// Hourly: the repeated hour is skipped.
+	s, err = ParseCron("0 * * * *")
+	assert.Nil(t, err)
+	next = s.Next(time.Date(2026, 11, 1, 0, 30, 0, 0, loc))
+	assert.Equal(t, "2026-11-01 01:00 EDT", next.Format("2006-01-02 15:04 MST"))
+	next = s.Next(next)
+	assert.Equal(t, "2026-11-01 02:00 EST", next.Format("2006-01-02 15:04 MST"))
+	assert.Equal(t, 2*time.Hour, next.Sub(time.Date(2026, 11, 1, 0, 0, 0, 0, loc).Add(time.Hour)))
+}
+
+func TestEvery(t *testing.T) {
+	after := time.Date(2026, 10, 17, 12, 34, 56, 0, time.UTC)
+	assert.Equal(t, after.Add(90*time.Second), Every(90*time.Second).Next(after))
+
+	assert.PanicsWithValue(t, "non-positive interval for Every", func() { Every(0) })
+}
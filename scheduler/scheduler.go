@@ -0,0 +1,373 @@
+// Package scheduler runs periodic jobs (cleanups, reports, ...) on cron expressions or fixed
+// intervals. Time is measured by absos.TimeSvc, so schedules are testable with TimeSvcMockImpl.
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/kattecon/akgoli/utils"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	// ErrDuplicateJob is returned when adding a job under the name of an existing one.
+	ErrDuplicateJob = utils.ConstError("job already exists")
+
+	// ErrStopped is returned when adding a job to a stopped scheduler.
+	ErrStopped = utils.ConstError("scheduler stopped")
+)
+
+// Job is a job run. ctx is done once the run timeout passes, or the scheduler stops (see Scheduler.Stop()).
+type Job func(ctx context.Context) error
+
+// OverlapPolicy tells what happens to runs due while the former run of the job is still running.
+type OverlapPolicy int
+
+const (
+	// OverlapSkip skips the run (the default).
+	OverlapSkip OverlapPolicy = iota
+
+	// OverlapQueue delays the run until the former one finishes; queued runs run one after another.
+	OverlapQueue
+
+	// OverlapAllow starts the run right away, concurrently with the former one.
+	OverlapAllow
+)
+
+// JobConfig configures a job.
+type JobConfig struct {
+	// Schedule tells when the job runs, see ParseCron() and Every(). Required.
+	Schedule Schedule
+
+	// Location is the time zone the schedule is evaluated in. Defaults to UTC.
+	Location *time.Location
+
+	// Jitter is the max random delay added to each run (spreading runs of jobs with the same schedule).
+	Jitter time.Duration
+
+	// Overlap is the overlap policy of runs.
+	Overlap OverlapPolicy
+
+	// Timeout limits each run (its ctx is done once passed); 0 means no limit.
+	Timeout time.Duration
+}
+
+type job struct {
+	name   string
+	cfg    JobConfig
+	fn     Job
+	logger *zap.Logger
+	stop   chan struct{}
+
+	mu      sync.Mutex
+	running int // Number of goroutines running runs of the job.
+	queued  int
+}
+
+// Scheduler runs jobs on their schedules.
+//
+// Runs are recovered from panics (logged and counted as failures like errors). Missed runs (e.g.
+// of a process suspended for a while) are skipped, not caught up. Runs, failures, runs skipped by
+// OverlapSkip and run durations are exposed as metrics labeled by job name.
+type Scheduler struct {
+	timeSvc absos.TimeSvc
+	randSvc absos.RandSvc
+	logger  *zap.Logger
+
+	runs     *prometheus.CounterVec
+	failures *prometheus.CounterVec
+	skipped  *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+
+	// ctx is the parent of run ctxs, cancelled once stopped.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// wg tracks job loops & runs.
+	wg sync.WaitGroup
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	started bool
+	stopped bool
+}
+
+// NewScheduler creates a new Scheduler without jobs, registering its metrics in m.
+// Jitter is taken from randSvc.
+func NewScheduler(timeSvc absos.TimeSvc, randSvc absos.RandSvc, logger *zap.Logger, m *metrics.Metrics) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{
+		timeSvc: timeSvc,
+		randSvc: randSvc,
+		logger:  logger,
+		runs: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: m.Prefixed("scheduler_job_runs"),
+				Help: "Total number of finished job runs.",
+			},
+			[]string{"job"},
+		),
+		failures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: m.Prefixed("scheduler_job_failures"),
+				Help: "Total number of job runs failed (with an error or a panic).",
+			},
+			[]string{"job"},
+		),
+		skipped: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: m.Prefixed("scheduler_job_skipped_runs"),
+				Help: "Total number of job runs skipped since the former run was still running.",
+			},
+			[]string{"job"},
+		),
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name: m.Prefixed("scheduler_job_duration_seconds"),
+				Help: "Duration of job runs.",
+			},
+			[]string{"job"},
+		),
+		ctx:    ctx,
+		cancel: cancel,
+		jobs:   make(map[string]*job),
+	}
+	m.MustRegister(s.runs, s.failures, s.skipped, s.duration)
+	return s
+}
+
+// Add adds a job named name (used in logs & metrics) running fn on the schedule of cfg. Jobs added
+// to a started scheduler are scheduled right away, others once it starts.
+func (s *Scheduler) Add(name string, cfg JobConfig, fn Job) error {
+	if cfg.Schedule == nil {
+		return errors.Errorf("no schedule for job %s", name)
+	}
+	if cfg.Location == nil {
+		cfg.Location = time.UTC
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return ErrStopped
+	}
+	if _, exists := s.jobs[name]; exists {
+		return errors.Wrap(ErrDuplicateJob, name)
+	}
+
+	j := &job{
+		name:   name,
+		cfg:    cfg,
+		fn:     fn,
+		logger: s.logger.With(zap.String("job", name)),
+		stop:   make(chan struct{}),
+	}
+	s.jobs[name] = j
+
+	// Set initial counters to zero (see logging.NewLogger() for reasons).
+	s.runs.WithLabelValues(name).Add(0)
+	s.failures.WithLabelValues(name).Add(0)
+	s.skipped.WithLabelValues(name).Add(0)
+
+	if s.started {
+		s.startLocked(j)
+	}
+	return nil
+}
+
+// Remove removes the job named name, returns false if there is none. A running run goes on,
+// queued ones are dropped.
+func (s *Scheduler) Remove(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, exists := s.jobs[name]
+	if exists {
+		delete(s.jobs, name)
+		close(j.stop)
+	}
+	return exists
+}
+
+// Start schedules the jobs. Does nothing if already started (or stopped).
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started || s.stopped {
+		return
+	}
+	s.started = true
+	for _, j := range s.jobs {
+		s.startLocked(j)
+	}
+}
+
+func (s *Scheduler) startLocked(j *job) {
+	s.wg.Add(1)
+	go s.loop(j)
+}
+
+// Stop stops scheduling runs, and waits for the running ones to finish. Queued runs are dropped.
+// Once ctx is done, the ctx of the running runs is cancelled, and ctx.Err() is returned without
+// waiting further.
+//
+// Has the signature of shutdown.Hook.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.stopped {
+		s.stopped = true
+		for _, j := range s.jobs {
+			close(j.stop)
+		}
+		s.jobs = nil
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	defer s.cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// loop triggers runs of the job on its schedule, until the job stops.
+func (s *Scheduler) loop(j *job) {
+	defer s.wg.Done()
+
+	var timer absos.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	prev := s.timeSvc.Now()
+	for {
+		due := s.next(j, prev)
+		if due.IsZero() {
+			j.logger.Warn("Job schedule has no more runs")
+			return
+		}
+
+		delay := due.Sub(s.timeSvc.Now())
+		if j.cfg.Jitter > 0 {
+			delay += time.Duration(s.randSvc.IntN(int(j.cfg.Jitter)))
+		}
+		if timer == nil {
+			timer = s.timeSvc.NewTimer(delay)
+		} else {
+			timer.Reset(delay)
+		}
+
+		select {
+		case <-timer.C():
+			s.trigger(j)
+		case <-j.stop:
+			return
+		}
+		prev = due
+	}
+}
+
+// next returns the run time of the job following prev, skipping the ones already missed.
+func (s *Scheduler) next(j *job, prev time.Time) time.Time {
+	due := j.cfg.Schedule.Next(prev.In(j.cfg.Location))
+	if now := s.timeSvc.Now(); !due.IsZero() && due.Before(now) {
+		due = j.cfg.Schedule.Next(now.In(j.cfg.Location))
+	}
+	return due
+}
+
+// trigger starts a run of the job, unless the overlap policy says otherwise.
+func (s *Scheduler) trigger(j *job) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.running > 0 {
+		switch j.cfg.Overlap {
+		case OverlapSkip:
+			s.skipped.WithLabelValues(j.name).Inc()
+			j.logger.Warn("Job still running, run skipped")
+			return
+		case OverlapQueue:
+			j.queued++
+			return
+		}
+	}
+
+	j.running++
+	s.wg.Add(1)
+	go s.runQueued(j)
+}
+
+// runQueued runs the job, then its queued runs, if any.
+func (s *Scheduler) runQueued(j *job) {
+	defer s.wg.Done()
+
+	for {
+		s.run(j)
+
+		j.mu.Lock()
+		select {
+		case <-j.stop:
+			j.queued = 0
+		default:
+		}
+		if j.queued == 0 {
+			j.running--
+			j.mu.Unlock()
+			return
+		}
+		j.queued--
+		j.mu.Unlock()
+	}
+}
+
+// run runs the job once, records metrics.
+func (s *Scheduler) run(j *job) {
+	ctx := s.ctx
+	if j.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = absos.WithTimeout(ctx, s.timeSvc, j.cfg.Timeout)
+		defer cancel()
+	}
+
+	start := s.timeSvc.Now()
+	err := s.call(ctx, j)
+	duration := s.timeSvc.Now().Sub(start)
+
+	s.runs.WithLabelValues(j.name).Inc()
+	s.duration.WithLabelValues(j.name).Observe(duration.Seconds())
+
+	if err != nil {
+		s.failures.WithLabelValues(j.name).Inc()
+		j.logger.Error("Job failed", zap.Duration("duration", duration), zap.Error(err))
+	} else {
+		j.logger.Debug("Job finished", zap.Duration("duration", duration))
+	}
+}
+
+// call calls the job func, turning panics into errors.
+func (s *Scheduler) call(ctx context.Context, j *job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("job %s panicked: %v", j.name, r)
+		}
+	}()
+	return j.fn(ctx)
+}
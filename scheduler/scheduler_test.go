@@ -0,0 +1,423 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/appinfo"
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// testJob returns a job counting its runs in runs (if not nil), sending their start times to started
+// (if not nil), then waiting for release (if not nil) or ctx.
+func testJob(timeSvc absos.TimeSvc, runs *atomic.Int32, started chan<- time.Time, release <-chan any, err error) Job {
+	return func(ctx context.Context) error {
+		now := timeSvc.Now()
+		if runs != nil {
+			runs.Add(1)
+		}
+		if started != nil {
+			started <- now
+		}
+
+		if release != nil {
+			select {
+			case <-release:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return err
+	}
+}
+
+// waitIdle waits for all runs of s to finish (runs report to started before they finish, so a run
+// due right after could otherwise be skipped).
+func waitIdle(t *testing.T, s *Scheduler) {
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, j := range s.jobs {
+			j.mu.Lock()
+			running := j.running
+			j.mu.Unlock()
+			if running > 0 {
+				return false
+			}
+		}
+		return true
+	}, time.Second, time.Millisecond)
+}
+
+// advance waits for runs to finish & for n sleepers (the job timers), then advances the mock time by d.
+func advance(t *testing.T, s *Scheduler, timeSvc *absos.TimeSvcMockImpl, n int, d time.Duration) {
+	waitIdle(t, s)
+	timeSvc.WaitForSleepers(n)
+	timeSvc.Add(d)
+}
+
+// failedCount returns the number of "Job failed" logs with the error errMsg.
+func failedCount(logs *observer.ObservedLogs, errMsg string) int {
+	return len(logs.Filter(func(entry observer.LoggedEntry) bool {
+		return entry.Message == "Job failed" && entry.ContextMap()["error"] == errMsg
+	}).All())
+}
+
+func TestSchedulerEvery(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	// Jobs run concurrently, so a thread-safe log.
+	core, logs := observer.New(zap.DebugLevel)
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	s := NewScheduler(timeSvc, absos.NewRandSvcMock(1), zap.New(core), m)
+	defer s.Stop(context.Background())
+	start := timeSvc.Now()
+	started := make(chan time.Time)
+	assert.Nil(t, s.Add("tick", JobConfig{Schedule: Every(time.Minute)}, testJob(timeSvc, nil, started, nil, nil)))
+
+	// Not started yet.
+	assert.Equal(t, 0, timeSvc.SleeperCount())
+	s.Start()
+	s.Start()
+
+	for i := 1; i <= 3; i++ {
+		advance(t, s, timeSvc, 1, time.Minute)
+		assert.Equal(t, start.Add(time.Duration(i)*time.Minute), <-started)
+	}
+
+	assert.Nil(t, s.Stop(context.Background()))
+	dump := m.DumpAsTextForTest()
+	assert.Contains(t, dump, `mock_scheduler_job_runs{job="tick"} 3`)
+	assert.Contains(t, dump, `mock_scheduler_job_failures{job="tick"} 0`)
+	assert.Contains(t, dump, `mock_scheduler_job_skipped_runs{job="tick"} 0`)
+	assert.Contains(t, dump, `mock_scheduler_job_duration_seconds_count{job="tick"} 3`)
+	assert.Equal(t, 3, logs.FilterMessage("Job finished").FilterField(zap.String("job", "tick")).Len())
+}
+
+func TestSchedulerCron(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	s := NewScheduler(timeSvc, absos.NewRandSvcMock(1), zap.NewNop(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	defer s.Stop(context.Background())
+	start := timeSvc.Now()
+	started := make(chan time.Time)
+	hourly, err := ParseCron("15 * * * *")
+	assert.Nil(t, err)
+	s.Start()
+
+	// Scheduled right away once started.
+	assert.Nil(t, s.Add("hourly", JobConfig{Schedule: hourly}, testJob(timeSvc, nil, started, nil, nil)))
+
+	advance(t, s, timeSvc, 1, 10*time.Minute)
+	advance(t, s, timeSvc, 1, 5*time.Minute)
+	assert.Equal(t, start.Add(15*time.Minute), <-started)
+	advance(t, s, timeSvc, 1, time.Hour)
+	assert.Equal(t, start.Add(75*time.Minute), <-started)
+
+	// Missed runs are skipped (the timer fires late, as if the process was suspended).
+	advance(t, s, timeSvc, 1, 3*time.Hour+5*time.Minute)
+	assert.Equal(t, start.Add(4*time.Hour+20*time.Minute), <-started)
+	advance(t, s, timeSvc, 1, 55*time.Minute)
+	assert.Equal(t, start.Add(5*time.Hour+15*time.Minute), <-started)
+}
+
+func TestSchedulerLocation(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	s := NewScheduler(timeSvc, absos.NewRandSvcMock(1), zap.NewNop(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	defer s.Stop(context.Background())
+	start := timeSvc.Now()
+	started := make(chan time.Time)
+	daily, err := ParseCron("0 9 * * *")
+	assert.Nil(t, err)
+	assert.Nil(t, s.Add("daily", JobConfig{
+		Schedule: daily,
+		Location: time.FixedZone("UTC+2", 2*60*60),
+	}, testJob(timeSvc, nil, started, nil, nil)))
+	s.Start()
+
+	timeSvc.WaitForSleepers(1)
+	assert.Equal(t, 7*time.Hour, timeSvc.AdvanceToNextSleepEvent())
+	assert.Equal(t, start.Add(7*time.Hour), <-started)
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	s := NewScheduler(timeSvc, absos.NewRandSvcMock(1), zap.NewNop(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	defer s.Stop(context.Background())
+	start := timeSvc.Now()
+	started := make(chan time.Time)
+	assert.Nil(t, s.Add("jittery", JobConfig{Schedule: Every(time.Hour), Jitter: time.Minute}, testJob(timeSvc, nil, started, nil, nil)))
+	s.Start()
+
+	var delays []time.Duration
+	for i := 1; i <= 3; i++ {
+		waitIdle(t, s)
+		timeSvc.WaitForSleepers(1)
+		timeSvc.AdvanceToNextSleepEvent()
+		delay := (<-started).Sub(start.Add(time.Duration(i) * time.Hour))
+		assert.True(t, delay >= 0 && delay < time.Minute, delay)
+		delays = append(delays, delay)
+	}
+	// Random, not accumulated.
+	assert.NotEqual(t, delays[0], delays[1])
+	assert.NotEqual(t, delays[1], delays[2])
+}
+
+func TestSchedulerOverlapSkip(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	// Jobs run concurrently, so a thread-safe log.
+	core, logs := observer.New(zap.DebugLevel)
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	s := NewScheduler(timeSvc, absos.NewRandSvcMock(1), zap.New(core), m)
+	defer s.Stop(context.Background())
+	var runs atomic.Int32
+	started := make(chan time.Time)
+	release := make(chan any)
+	assert.Nil(t, s.Add("slow", JobConfig{Schedule: Every(time.Minute)}, testJob(timeSvc, &runs, started, release, nil)))
+	s.Start()
+
+	advance(t, s, timeSvc, 1, time.Minute)
+	<-started
+	// Due while running.
+	timeSvc.WaitForSleepers(1)
+	timeSvc.Add(time.Minute)
+	timeSvc.WaitForSleepers(1)
+	timeSvc.Add(time.Minute)
+	timeSvc.WaitForSleepers(1)
+	release <- nil
+
+	advance(t, s, timeSvc, 1, time.Minute)
+	<-started
+	release <- nil
+
+	assert.Nil(t, s.Stop(context.Background()))
+	assert.Equal(t, 2, int(runs.Load()))
+	dump := m.DumpAsTextForTest()
+	assert.Contains(t, dump, `mock_scheduler_job_runs{job="slow"} 2`)
+	assert.Contains(t, dump, `mock_scheduler_job_skipped_runs{job="slow"} 2`)
+	assert.Equal(t, 2, logs.FilterMessage("Job still running, run skipped").Len())
+}
+
+func TestSchedulerOverlapQueue(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	s := NewScheduler(timeSvc, absos.NewRandSvcMock(1), zap.NewNop(), m)
+	defer s.Stop(context.Background())
+	var runs atomic.Int32
+	start := timeSvc.Now()
+	started := make(chan time.Time)
+	release := make(chan any)
+	assert.Nil(t, s.Add("slow", JobConfig{Schedule: Every(time.Minute), Overlap: OverlapQueue}, testJob(timeSvc, &runs, started, release, nil)))
+	s.Start()
+
+	advance(t, s, timeSvc, 1, time.Minute)
+	<-started
+	// Due while running, queued.
+	timeSvc.WaitForSleepers(1)
+	timeSvc.Add(time.Minute)
+	timeSvc.WaitForSleepers(1)
+	timeSvc.Add(time.Minute)
+	timeSvc.WaitForSleepers(1)
+
+	// Queued runs run one after another.
+	release <- nil
+	assert.Equal(t, start.Add(3*time.Minute), <-started)
+	release <- nil
+	assert.Equal(t, start.Add(3*time.Minute), <-started)
+	release <- nil
+
+	assert.Nil(t, s.Stop(context.Background()))
+	assert.Equal(t, 3, int(runs.Load()))
+	assert.Contains(t, m.DumpAsTextForTest(), `mock_scheduler_job_skipped_runs{job="slow"} 0`)
+}
+
+func TestSchedulerOverlapAllow(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	s := NewScheduler(timeSvc, absos.NewRandSvcMock(1), zap.NewNop(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	defer s.Stop(context.Background())
+	var runs atomic.Int32
+	started := make(chan time.Time)
+	release := make(chan any)
+	assert.Nil(t, s.Add("slow", JobConfig{Schedule: Every(time.Minute), Overlap: OverlapAllow}, testJob(timeSvc, &runs, started, release, nil)))
+	s.Start()
+
+	advance(t, s, timeSvc, 1, time.Minute)
+	<-started
+	timeSvc.WaitForSleepers(1)
+	timeSvc.Add(time.Minute)
+	<-started
+
+	// Both running.
+	release <- nil
+	release <- nil
+	assert.Nil(t, s.Stop(context.Background()))
+	assert.Equal(t, 2, int(runs.Load()))
+}
+
+func TestSchedulerFailures(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	// Jobs run concurrently, so a thread-safe log.
+	core, logs := observer.New(zap.DebugLevel)
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	s := NewScheduler(timeSvc, absos.NewRandSvcMock(1), zap.New(core), m)
+	defer s.Stop(context.Background())
+	started := make(chan time.Time)
+	assert.Nil(t, s.Add("failing", JobConfig{Schedule: Every(time.Minute)}, testJob(timeSvc, nil, started, nil, errors.New("boom"))))
+	assert.Nil(t, s.Add("panicking", JobConfig{Schedule: Every(time.Minute)}, func(ctx context.Context) error {
+		started <- timeSvc.Now()
+		panic("oops")
+	}))
+	s.Start()
+
+	advance(t, s, timeSvc, 2, time.Minute)
+	<-started
+	<-started
+	advance(t, s, timeSvc, 2, time.Minute)
+	<-started
+	<-started
+
+	assert.Nil(t, s.Stop(context.Background()))
+	dump := m.DumpAsTextForTest()
+	assert.Contains(t, dump, `mock_scheduler_job_runs{job="failing"} 2`)
+	assert.Contains(t, dump, `mock_scheduler_job_failures{job="failing"} 2`)
+	assert.Contains(t, dump, `mock_scheduler_job_runs{job="panicking"} 2`)
+	assert.Contains(t, dump, `mock_scheduler_job_failures{job="panicking"} 2`)
+
+	assert.Equal(t, 2, failedCount(logs, "boom"))
+	assert.Equal(t, 2, failedCount(logs, "job panicking panicked: oops"))
+}
+
+func TestSchedulerTimeout(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	// Jobs run concurrently, so a thread-safe log.
+	core, logs := observer.New(zap.DebugLevel)
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	s := NewScheduler(timeSvc, absos.NewRandSvcMock(1), zap.New(core), m)
+	defer s.Stop(context.Background())
+	started := make(chan time.Time)
+	assert.Nil(t, s.Add("stuck", JobConfig{Schedule: Every(time.Hour), Timeout: 10 * time.Second}, testJob(timeSvc, nil, started, make(chan any), nil)))
+	s.Start()
+
+	advance(t, s, timeSvc, 1, time.Hour)
+	<-started
+	// The job timer & the timeout.
+	timeSvc.WaitForSleepers(2)
+	timeSvc.Add(10 * time.Second)
+
+	assert.Eventually(t, func() bool {
+		return failedCount(logs, "context deadline exceeded") == 1
+	}, time.Second, time.Millisecond)
+	assert.Contains(t, m.DumpAsTextForTest(), `mock_scheduler_job_duration_seconds_sum{job="stuck"} 10`)
+}
+
+func TestSchedulerStop(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	s := NewScheduler(timeSvc, absos.NewRandSvcMock(1), zap.NewNop(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	defer s.Stop(context.Background())
+	var runs atomic.Int32
+	started := make(chan time.Time)
+	release := make(chan any)
+	assert.Nil(t, s.Add("slow", JobConfig{Schedule: Every(time.Minute), Overlap: OverlapQueue}, testJob(timeSvc, &runs, started, release, nil)))
+	s.Start()
+
+	advance(t, s, timeSvc, 1, time.Minute)
+	<-started
+	timeSvc.WaitForSleepers(1)
+	timeSvc.Add(time.Minute)
+	timeSvc.WaitForSleepers(1)
+
+	stopped := make(chan error)
+	go func() { stopped <- s.Stop(context.Background()) }()
+
+	// Waits for the running run, the queued one is dropped.
+	select {
+	case <-stopped:
+		t.Fatal("stopped while running")
+	case <-time.After(10 * time.Millisecond):
+	}
+	release <- nil
+	assert.Nil(t, <-stopped)
+	assert.Equal(t, 1, int(runs.Load()))
+	assert.Equal(t, 0, timeSvc.SleeperCount())
+
+	assert.ErrorIs(t, s.Add("late", JobConfig{Schedule: Every(time.Minute)}, testJob(timeSvc, &runs, nil, nil, nil)), ErrStopped)
+	assert.Nil(t, s.Stop(context.Background()))
+}
+
+func TestSchedulerStopTimeout(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	s := NewScheduler(timeSvc, absos.NewRandSvcMock(1), zap.NewNop(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	defer s.Stop(context.Background())
+	started := make(chan time.Time)
+	var runErr error
+	runDone := make(chan any)
+	assert.Nil(t, s.Add("stuck", JobConfig{Schedule: Every(time.Minute)}, func(ctx context.Context) error {
+		started <- timeSvc.Now()
+		<-ctx.Done()
+		runErr = ctx.Err()
+		close(runDone)
+		return runErr
+	}))
+	s.Start()
+
+	advance(t, s, timeSvc, 1, time.Minute)
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, s.Stop(ctx), context.Canceled)
+
+	// The run is cancelled.
+	<-runDone
+	assert.ErrorIs(t, runErr, context.Canceled)
+}
+
+func TestSchedulerAddRemove(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	s := NewScheduler(timeSvc, absos.NewRandSvcMock(1), zap.NewNop(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	defer s.Stop(context.Background())
+	job := testJob(timeSvc, nil, nil, nil, nil)
+
+	assert.EqualError(t, s.Add("nil", JobConfig{}, job), "no schedule for job nil")
+	assert.Nil(t, s.Add("a", JobConfig{Schedule: Every(time.Minute)}, job))
+	assert.Nil(t, s.Add("b", JobConfig{Schedule: Every(time.Minute)}, job))
+	err := s.Add("a", JobConfig{Schedule: Every(time.Hour)}, job)
+	assert.ErrorIs(t, err, ErrDuplicateJob)
+	assert.EqualError(t, err, "a: job already exists")
+
+	s.Start()
+	timeSvc.WaitForSleepers(2)
+
+	assert.True(t, s.Remove("a"))
+	assert.False(t, s.Remove("a"))
+	assert.Eventually(t, func() bool { return timeSvc.SleeperCount() == 1 }, time.Second, time.Millisecond)
+
+	// Removed before started.
+	assert.Nil(t, s.Add("c", JobConfig{Schedule: Every(time.Minute)}, job))
+	assert.True(t, s.Remove("c"))
+	assert.Eventually(t, func() bool { return timeSvc.SleeperCount() == 1 }, time.Second, time.Millisecond)
+
+	// Can be added again.
+	assert.Nil(t, s.Add("a", JobConfig{Schedule: Every(time.Minute)}, job))
+}
+
+func TestSchedulerNoMoreRuns(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	// Jobs run concurrently, so a thread-safe log.
+	core, logs := observer.New(zap.DebugLevel)
+	s := NewScheduler(timeSvc, absos.NewRandSvcMock(1), zap.New(core), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	defer s.Stop(context.Background())
+	never, err := ParseCron("0 0 30 2 *")
+	assert.Nil(t, err)
+	assert.Nil(t, s.Add("never", JobConfig{Schedule: never}, testJob(timeSvc, nil, nil, nil, nil)))
+	s.Start()
+
+	assert.Nil(t, s.Stop(context.Background()))
+	assert.Equal(t, 1, logs.FilterMessage("Job schedule has no more runs").Len())
+	assert.Equal(t, 0, timeSvc.SleeperCount())
+}
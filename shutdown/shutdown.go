@@ -0,0 +1,228 @@
+// Package shutdown coordinates graceful shutdown of a process: on SIGTERM/SIGINT (or on demand)
+// registered stop hooks of its components are run in order, each with its own timeout.
+package shutdown
+
+import (
+	"context"
+	stderrors "errors"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/kattecon/akgoli/utils"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultHookTimeout is the timeout of hooks registered without one.
+	DefaultHookTimeout = 10 * time.Second
+
+	// ErrHookTimeout is returned (wrapped, with the hook name) when a stop hook doesn't return within its timeout.
+	ErrHookTimeout = utils.ConstError("stop hook timed out")
+)
+
+// Hook stops a component. ctx is done once the timeout of the hook passes.
+type Hook func(ctx context.Context) error
+
+type hook struct {
+	name    string
+	timeout time.Duration
+	fn      Hook
+}
+
+// Coordinator runs stop hooks of components on shutdown.
+//
+// Hooks run one by one in reverse registration order, like defers: components usually register
+// after their dependencies, and must stop before them (e.g. an HTTP server before the DB pool
+// its handlers use). A hook not returning within its timeout (measured by TimeSvc) is abandoned,
+// the shutdown goes on with the next one. Progress is logged, durations are exposed as metrics.
+type Coordinator struct {
+	timeSvc      absos.TimeSvc
+	logger       *zap.Logger
+	duration     prometheus.Gauge
+	hookDuration *prometheus.GaugeVec
+
+	mu      sync.Mutex
+	hooks   []hook
+	started bool
+	done    chan struct{}
+	err     error
+}
+
+// NewCoordinator creates a new Coordinator without hooks, registering its metrics in m.
+func NewCoordinator(timeSvc absos.TimeSvc, logger *zap.Logger, m *metrics.Metrics) *Coordinator {
+	c := &Coordinator{
+		timeSvc: timeSvc,
+		logger:  logger,
+		duration: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: m.Prefixed("shutdown_duration_seconds"),
+				Help: "Duration of the graceful shutdown.",
+			},
+		),
+		hookDuration: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: m.Prefixed("shutdown_hook_duration_seconds"),
+				Help: "Duration of stop hooks run during the graceful shutdown.",
+			},
+			[]string{"hook"},
+		),
+		done: make(chan struct{}),
+	}
+	m.MustRegister(c.duration, c.hookDuration)
+	return c
+}
+
+// Register adds a stop hook named name (used in logs & metrics). A timeout <= 0 means DefaultHookTimeout.
+//
+// Hooks registered once the shutdown started are not run (a warning is logged).
+func (c *Coordinator) Register(name string, timeout time.Duration, fn Hook) {
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.started {
+		c.logger.Warn("Stop hook registered during shutdown, not run", zap.String("hook", name))
+		return
+	}
+	c.hooks = append(c.hooks, hook{name: name, timeout: timeout, fn: fn})
+}
+
+// HandleSignals makes the coordinator shut down once one of sigs arrives via signalSvc
+// (SIGINT or SIGTERM if no sigs given). Signals arriving during the shutdown are logged and
+// otherwise ignored. The signals are subscribed to before returning.
+func (c *Coordinator) HandleSignals(signalSvc absos.SignalSvc, sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+
+	signaled := make(chan os.Signal, 1)
+	signalSvc.Notify(signaled, sigs...)
+
+	go func() {
+		defer signalSvc.Stop(signaled)
+
+		for {
+			select {
+			case sig := <-signaled:
+				c.mu.Lock()
+				started := c.started
+				c.mu.Unlock()
+
+				if started {
+					c.logger.Warn("Signal received during shutdown, ignored", zap.Stringer("signal", sig))
+					continue
+				}
+				go func() {
+					_ = c.Shutdown("signal " + sig.String())
+				}()
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown runs the stop hooks, and returns their errors joined (see errors.Join()).
+//
+// Only the first call runs them, others wait for it to finish and return the same.
+func (c *Coordinator) Shutdown(reason string) error {
+	c.mu.Lock()
+	if c.started {
+		c.mu.Unlock()
+		return c.Wait()
+	}
+	c.started = true
+	hooks := c.hooks
+	c.mu.Unlock()
+
+	start := c.timeSvc.Now()
+	c.logger.Info("Shutting down", zap.String("reason", reason), zap.Int("hooks", len(hooks)))
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := c.runHook(hooks[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	duration := c.timeSvc.Now().Sub(start)
+	c.duration.Set(duration.Seconds())
+
+	err := stderrors.Join(errs...)
+	if err != nil {
+		c.logger.Warn("Shutdown finished with errors", zap.Duration("duration", duration), zap.Error(err))
+	} else {
+		c.logger.Info("Shutdown finished", zap.Duration("duration", duration))
+	}
+
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+	close(c.done)
+
+	return err
+}
+
+// runHook runs the hook, waiting for it at most its timeout.
+func (c *Coordinator) runHook(h hook) error {
+	start := c.timeSvc.Now()
+	logger := c.logger.With(zap.String("hook", h.name))
+	logger.Info("Stopping")
+
+	ctx, cancel := absos.WithTimeout(context.Background(), c.timeSvc, h.timeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				result <- errors.Errorf("stop hook %s panicked: %v", h.name, r)
+			}
+		}()
+		if err := h.fn(ctx); err != nil {
+			result <- errors.Wrapf(err, "stop hook %s failed", h.name)
+		} else {
+			result <- nil
+		}
+	}()
+
+	var err error
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = errors.Wrapf(ErrHookTimeout, "%s (%v)", h.name, h.timeout)
+	}
+
+	duration := c.timeSvc.Now().Sub(start)
+	c.hookDuration.WithLabelValues(h.name).Set(duration.Seconds())
+
+	if err != nil {
+		logger.Error("Stop hook failed", zap.Duration("duration", duration), zap.Error(err))
+	} else {
+		logger.Info("Stopped", zap.Duration("duration", duration))
+	}
+	return err
+}
+
+// Done returns a channel closed once the shutdown finished.
+func (c *Coordinator) Done() <-chan struct{} {
+	return c.done
+}
+
+// Wait waits for the shutdown to finish (see Done()), and returns the result of Shutdown().
+func (c *Coordinator) Wait() error {
+	<-c.done
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
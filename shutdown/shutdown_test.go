@@ -0,0 +1,183 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/appinfo"
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/kattecon/akgoli/testutils"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestShutdown(t *testing.T) {
+	log := testutils.NewBufferingLogger(zap.DebugLevel)
+	c := NewCoordinator(absos.NewTimeSvcMock(), log.Logger, metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+
+	var order []string
+	hook := func(name string) Hook {
+		return func(ctx context.Context) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+	c.Register("db", time.Second, hook("db"))
+	c.Register("cache", 0, hook("cache"))
+	c.Register("http", 5*time.Second, hook("http"))
+
+	select {
+	case <-c.Done():
+		t.Fatal("done before shutdown")
+	default:
+	}
+
+	assert.Nil(t, c.Shutdown("test"))
+	assert.Equal(t, []string{"http", "cache", "db"}, order)
+	<-c.Done()
+	assert.Nil(t, c.Wait())
+
+	// Runs once.
+	assert.Nil(t, c.Shutdown("again"))
+	assert.Len(t, order, 3)
+
+	// Too late.
+	c.Register("late", 0, hook("late"))
+
+	logs := log.JsonNoDoubleQuotes()
+	assert.Contains(t, logs, `'msg':'Shutting down','reason':'test','hooks':3`)
+	assert.Contains(t, logs, `'msg':'Stopping','hook':'http'`)
+	assert.Contains(t, logs, `'msg':'Stopped','hook':'db','duration':0`)
+	assert.Contains(t, logs, `'msg':'Shutdown finished','duration':0`)
+	assert.Contains(t, logs, `'level':'warn','msg':'Stop hook registered during shutdown, not run','hook':'late'`)
+	assert.NotContains(t, logs, "again")
+}
+
+func TestShutdownErrors(t *testing.T) {
+	log := testutils.NewBufferingLogger(zap.DebugLevel)
+	c := NewCoordinator(absos.NewTimeSvcMock(), log.Logger, metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+
+	errBoom := errors.New("boom")
+	var order []string
+	c.Register("db", 0, func(ctx context.Context) error {
+		order = append(order, "db")
+		return errBoom
+	})
+	c.Register("worker", 0, func(ctx context.Context) error { panic("oops") })
+	c.Register("http", 0, func(ctx context.Context) error {
+		order = append(order, "http")
+		return nil
+	})
+
+	err := c.Shutdown("test")
+	assert.ErrorIs(t, err, errBoom)
+	assert.EqualError(t, err, "stop hook worker panicked: oops\nstop hook db failed: boom")
+	assert.Equal(t, err, c.Wait())
+	assert.Equal(t, []string{"http", "db"}, order)
+
+	logs := log.JsonNoDoubleQuotes()
+	assert.Contains(t, logs, `'level':'error','msg':'Stop hook failed','hook':'db','duration':0,'error':'stop hook db failed: boom'`)
+	assert.Contains(t, logs, `'level':'warn','msg':'Shutdown finished with errors'`)
+}
+
+func TestShutdownTimeouts(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	c := NewCoordinator(timeSvc, testutils.NewBufferingLogger(zap.DebugLevel).Logger, m)
+
+	var mu sync.Mutex
+	var order []string
+	entered := make(chan string, 10)
+	sleepingHook := func(name string, d time.Duration) Hook {
+		return func(ctx context.Context) error {
+			entered <- name
+			if err := absos.SleepContext(ctx, timeSvc, d); err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		}
+	}
+	c.Register("db", time.Second, sleepingHook("db", 500*time.Millisecond))
+	c.Register("stuck", 2*time.Second, func(ctx context.Context) error {
+		entered <- "stuck"
+		<-make(chan struct{})
+		return nil
+	})
+	c.Register("http", 5*time.Second, sleepingHook("http", time.Second))
+
+	var err error
+	shutdownDone := make(chan any)
+	go func() {
+		err = c.Shutdown("test")
+		close(shutdownDone)
+	}()
+
+	// Timeout timer & own sleep.
+	assert.Equal(t, "http", <-entered)
+	timeSvc.WaitForSleepers(2)
+	timeSvc.Add(time.Second)
+
+	// Timeout timer only.
+	assert.Equal(t, "stuck", <-entered)
+	timeSvc.WaitForSleepers(1)
+	timeSvc.Add(2 * time.Second)
+
+	assert.Equal(t, "db", <-entered)
+	timeSvc.WaitForSleepers(2)
+	timeSvc.Add(500 * time.Millisecond)
+
+	<-shutdownDone
+	assert.ErrorIs(t, err, ErrHookTimeout)
+	assert.EqualError(t, err, "stuck (2s): stop hook timed out")
+	assert.Equal(t, []string{"http", "db"}, order)
+
+	metricsText := m.DumpAsTextForTest()
+	assert.Contains(t, metricsText, "mock_shutdown_duration_seconds 3.5\n")
+	assert.Contains(t, metricsText, `mock_shutdown_hook_duration_seconds{hook="db"} 0.5`)
+	assert.Contains(t, metricsText, `mock_shutdown_hook_duration_seconds{hook="http"} 1`)
+	assert.Contains(t, metricsText, `mock_shutdown_hook_duration_seconds{hook="stuck"} 2`)
+}
+
+func TestHandleSignals(t *testing.T) {
+	// Signals are handled concurrently with the shutdown, so a thread-safe log.
+	core, logs := observer.New(zap.DebugLevel)
+	timeSvc := absos.NewTimeSvcMock()
+	c := NewCoordinator(timeSvc, zap.New(core), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	signalSvc := absos.NewSignalSvcMock()
+
+	release := make(chan any)
+	c.Register("http", 0, func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	c.HandleSignals(signalSvc)
+
+	assert.Equal(t, 0, signalSvc.Send(syscall.SIGHUP))
+	assert.Equal(t, 1, signalSvc.Send(syscall.SIGTERM))
+
+	// Ignored, the hook is still running.
+	timeSvc.WaitForSleepers(1)
+	assert.Equal(t, 1, signalSvc.Send(syscall.SIGINT))
+	for logs.FilterMessage("Signal received during shutdown, ignored").Len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	assert.Nil(t, c.Wait())
+	assert.Equal(t, "signal terminated", logs.FilterMessage("Shutting down").All()[0].ContextMap()["reason"])
+	assert.Equal(t, 1, logs.FilterMessage("Shutting down").Len())
+
+	// Unsubscribed once done.
+	for signalSvc.ListenerCount(syscall.SIGINT) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
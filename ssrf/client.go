@@ -0,0 +1,47 @@
+package ssrf
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NewTransport returns http.Transport connecting through the guard (see Guard.DialContext()).
+//
+// Proxies are never used (a proxy would connect to the destination unchecked); the other settings
+// are the ones of http.DefaultTransport.
+func (g *Guard) NewTransport() *http.Transport {
+	return &http.Transport{
+		Proxy:                 nil,
+		DialContext:           g.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// NewClient returns http.Client with the transport of NewTransport(), re-validating redirects
+// (see CheckRedirect()).
+func (g *Guard) NewClient() *http.Client {
+	return &http.Client{
+		Transport:     g.NewTransport(),
+		CheckRedirect: g.CheckRedirect,
+	}
+}
+
+// CheckRedirect is http.Client.CheckRedirect refusing redirects to non-HTTP(S) URLs (with an error
+// wrapping ErrBlockedDestination), and stopping after the max number of redirects (see Config).
+//
+// Redirect destinations are checked by Guard.DialContext() like any other, this fails early only.
+func (g *Guard) CheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= g.maxRedirects {
+		return errors.Errorf("stopped after %d redirects", g.maxRedirects)
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return errors.Wrap(ErrBlockedDestination, "redirect to "+req.URL.Redacted())
+	}
+	return nil
+}
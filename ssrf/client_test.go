@@ -0,0 +1,79 @@
+package ssrf
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	dnsSvc := absos.NewDnsSvcMock(timeSvc)
+	dnsSvc.SetLookupIpResult("public.example.com", []net.IP{publicIP}, nil)
+	dnsSvc.SetLookupIpResult("internal.example.com", []net.IP{net.ParseIP("10.0.0.1")}, nil)
+	netSvc := absos.NewNetSvcMock(timeSvc, dnsSvc)
+	l, err := netSvc.Listen("tcp", ":80")
+	assert.Nil(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello")
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	server := &http.Server{Handler: mux}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.MaxRedirects = 3
+	guard, err := NewGuard(cfg, dnsSvc, netSvc)
+	assert.Nil(t, err)
+	client := guard.NewClient()
+
+	resp, err := client.Get("http://public.example.com/")
+	assert.Nil(t, err)
+	body, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Nil(t, resp.Body.Close())
+	assert.Equal(t, "hello", string(body))
+
+	resp, err = client.Get("http://public.example.com/redirect?to=/")
+	assert.Nil(t, err)
+	assert.Nil(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = client.Get("http://internal.example.com/")
+	assert.ErrorIs(t, err, ErrBlockedDestination)
+	assert.EqualError(t, err, `Get "http://internal.example.com/": dial tcp: internal.example.com (10.0.0.1) is in 10.0.0.0/8: blocked destination`)
+
+	// Redirect destinations are checked as well.
+	_, err = client.Get("http://public.example.com/redirect?to=http://internal.example.com/")
+	assert.ErrorIs(t, err, ErrBlockedDestination)
+
+	_, err = client.Get("http://public.example.com/redirect?to=http://169.254.169.254/latest/meta-data/")
+	assert.EqualError(t, err, `Get "http://169.254.169.254/latest/meta-data/": dial tcp: 169.254.169.254 is in 169.254.0.0/16: blocked destination`)
+
+	_, err = client.Get("http://public.example.com/redirect?to=ftp://public.example.com/file")
+	assert.EqualError(t, err, `Get "ftp://public.example.com/file": redirect to ftp://public.example.com/file: blocked destination`)
+
+	_, err = client.Get("http://public.example.com/loop")
+	assert.EqualError(t, err, `Get "/loop": stopped after 3 redirects`)
+}
+
+func TestNewTransport(t *testing.T) {
+	guard, err := NewGuard(DefaultConfig(), nil, nil)
+	assert.Nil(t, err)
+
+	transport := guard.NewTransport()
+	assert.Nil(t, transport.Proxy)
+	assert.NotNil(t, transport.DialContext)
+}
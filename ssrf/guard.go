@@ -0,0 +1,233 @@
+// Package ssrf protects outgoing connections to user-supplied destinations (webhooks, URL
+// previews, ...) against server-side request forgery: connections to internal addresses
+// (loopback, private, link-local, metadata services, ...) are refused.
+//
+// Host names are resolved once, and connections are made to the validated IPs, so DNS rebinding
+// (answering with a public IP for the check, then with an internal one for the connection) is defeated.
+package ssrf
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/utils"
+	"github.com/pkg/errors"
+)
+
+// ErrBlockedDestination is wrapped by errors for refused destinations.
+const ErrBlockedDestination = utils.ConstError("blocked destination")
+
+// DefaultBlockedCIDRs are ranges not reachable from the public internet, or reserved (RFC 6890).
+var DefaultBlockedCIDRs = []string{
+	"0.0.0.0/8",       // "This network".
+	"10.0.0.0/8",      // Private.
+	"100.64.0.0/10",   // CGNAT.
+	"127.0.0.0/8",     // Loopback.
+	"169.254.0.0/16",  // Link-local, incl. cloud metadata services (169.254.169.254).
+	"172.16.0.0/12",   // Private.
+	"192.0.0.0/24",    // IETF protocol assignments.
+	"192.0.2.0/24",    // Documentation.
+	"192.88.99.0/24",  // 6to4 relay anycast.
+	"192.168.0.0/16",  // Private.
+	"198.18.0.0/15",   // Benchmarking.
+	"198.51.100.0/24", // Documentation.
+	"203.0.113.0/24",  // Documentation.
+	"224.0.0.0/4",     // Multicast.
+	"240.0.0.0/4",     // Reserved, incl. broadcast.
+	"::/128",          // Unspecified.
+	"::1/128",         // Loopback.
+	"64:ff9b::/96",    // NAT64, may reach internal IPv4 addresses.
+	"64:ff9b:1::/48",  // Local-use NAT64.
+	"100::/64",        // Discard-only.
+	"2001::/23",       // IETF protocol assignments, incl. Teredo.
+	"2001:db8::/32",   // Documentation.
+	"2002::/16",       // 6to4, may embed internal IPv4 addresses.
+	"fc00::/7",        // Unique local, incl. AWS metadata service (fd00:ec2::254).
+	"fe80::/10",       // Link-local.
+	"fec0::/10",       // Site-local (deprecated).
+	"ff00::/8",        // Multicast.
+}
+
+// Config configures Guard.
+type Config struct {
+	// AllowCIDRs are ranges allowed regardless of the blocked ones (e.g. an internal service
+	// meant to be reachable).
+	AllowCIDRs []string
+
+	// DenyCIDRs are ranges blocked in addition to DefaultBlockedCIDRs.
+	DenyCIDRs []string
+
+	// AllowedPorts restricts the destination ports; empty means any port.
+	AllowedPorts []int
+
+	// MaxRedirects is the max number of redirects followed by clients of NewClient(). Defaults to 10.
+	MaxRedirects int
+}
+
+// DefaultConfig returns the config blocking DefaultBlockedCIDRs, with any port allowed.
+func DefaultConfig() Config {
+	return Config{MaxRedirects: 10}
+}
+
+// Guard checks destinations, and connects to allowed ones only.
+type Guard struct {
+	allow        []netip.Prefix
+	deny         []netip.Prefix
+	ports        []int
+	maxRedirects int
+
+	dnsSvc absos.DnsSvc
+	netSvc absos.NetSvc
+}
+
+func parsePrefixes(cidrs ...[]string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, list := range cidrs {
+		for _, cidr := range list {
+			prefix, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid CIDR %q", cidr)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+		}
+	}
+	return prefixes, nil
+}
+
+// NewGuard returns Guard resolving host names using dnsSvc, and connecting using netSvc.
+func NewGuard(cfg Config, dnsSvc absos.DnsSvc, netSvc absos.NetSvc) (*Guard, error) {
+	allow, err := parsePrefixes(cfg.AllowCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := parsePrefixes(DefaultBlockedCIDRs, cfg.DenyCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxRedirects <= 0 {
+		cfg.MaxRedirects = 10
+	}
+
+	return &Guard{
+		allow:        allow,
+		deny:         deny,
+		ports:        slices.Clone(cfg.AllowedPorts),
+		maxRedirects: cfg.MaxRedirects,
+		dnsSvc:       dnsSvc,
+		netSvc:       netSvc,
+	}, nil
+}
+
+// blockingPrefix returns the prefix ip is blocked by, false if ip is allowed.
+func (g *Guard) blockingPrefix(ip net.IP) (netip.Prefix, bool) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		// Not an IP at all.
+		return netip.Prefix{}, true
+	}
+	addr = addr.Unmap()
+
+	containsAddr := func(prefix netip.Prefix) bool { return prefix.Contains(addr) }
+	if slices.ContainsFunc(g.allow, containsAddr) {
+		return netip.Prefix{}, false
+	}
+	if i := slices.IndexFunc(g.deny, containsAddr); i >= 0 {
+		return g.deny[i], true
+	}
+	return netip.Prefix{}, false
+}
+
+// blockedIPError returns the error for the blocked ip of host.
+func blockedIPError(host string, ip net.IP, prefix netip.Prefix) error {
+	dest := ip.String()
+	if host != dest {
+		dest = host + " (" + dest + ")"
+	}
+	if !prefix.IsValid() {
+		return errors.Wrapf(ErrBlockedDestination, "%s is not a valid IP", dest)
+	}
+	return errors.Wrapf(ErrBlockedDestination, "%s is in %s", dest, prefix)
+}
+
+// CheckIP returns an error wrapping ErrBlockedDestination if ip is blocked.
+// IPv4-mapped IPv6 addresses are checked as IPv4 ones.
+func (g *Guard) CheckIP(ip net.IP) error {
+	if prefix, blocked := g.blockingPrefix(ip); blocked {
+		return blockedIPError(ip.String(), ip, prefix)
+	}
+	return nil
+}
+
+// CheckPort returns an error wrapping ErrBlockedDestination if the port is not allowed.
+func (g *Guard) CheckPort(port int) error {
+	if len(g.ports) > 0 && !slices.Contains(g.ports, port) {
+		return errors.Wrapf(ErrBlockedDestination, "port %d is not allowed", port)
+	}
+	return nil
+}
+
+// DialContext connects to the address ("host:port") if allowed: the host is resolved using DnsSvc,
+// and the connection is made to the first allowed IP (the next allowed ones are tried if it fails),
+// never resolving the host again. Returns an error wrapping ErrBlockedDestination if all IPs are
+// blocked (or the port is), otherwise the error of the first failed connection.
+//
+// Has the signature of http.Transport.DialContext.
+func (g *Guard) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	opErr := func(err error) error {
+		return &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, opErr(err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, opErr(errors.Errorf("invalid port %q", portStr))
+	}
+	if err := g.CheckPort(port); err != nil {
+		return nil, opErr(err)
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else if ips, err = g.dnsSvc.LookupIPContext(ctx, host); err != nil {
+		return nil, opErr(err)
+	}
+
+	var blockedErr, dialErr error
+	for _, ip := range ips {
+		if prefix, blocked := g.blockingPrefix(ip); blocked {
+			if blockedErr == nil {
+				blockedErr = opErr(blockedIPError(host, ip, prefix))
+			}
+			continue
+		}
+
+		conn, err := g.netSvc.DialContext(ctx, network, net.JoinHostPort(ip.String(), portStr))
+		if err == nil {
+			return conn, nil
+		}
+		if dialErr == nil {
+			dialErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	switch {
+	case dialErr != nil:
+		return nil, dialErr
+	case blockedErr != nil:
+		return nil, blockedErr
+	default:
+		return nil, opErr(&net.AddrError{Err: "no suitable address found", Addr: host})
+	}
+}
@@ -0,0 +1,155 @@
+package ssrf
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/stretchr/testify/assert"
+)
+
+var publicIP = net.ParseIP("93.184.216.34")
+
+// dialedAddresses returns addresses dialed by netSvc.
+func dialedAddresses(netSvc *absos.NetSvcMockImpl) []string {
+	var addresses []string
+	for _, dial := range netSvc.Dials() {
+		addresses = append(addresses, dial.Address)
+	}
+	return addresses
+}
+
+func TestGuardCheckIP(t *testing.T) {
+	guard, err := NewGuard(DefaultConfig(), nil, nil)
+	assert.Nil(t, err)
+
+	for _, addr := range []string{
+		"0.0.0.0", "10.1.2.3", "100.64.0.1", "127.0.0.1", "169.254.169.254", "172.16.0.1", "192.168.1.1",
+		"198.18.0.1", "224.0.0.1", "255.255.255.255",
+		"::", "::1", "fe80::1", "fd00:ec2::254", "ff02::1", "::ffff:127.0.0.1", "64:ff9b::a00:1", "2002:a00:1::1",
+	} {
+		assert.ErrorIs(t, guard.CheckIP(net.ParseIP(addr)), ErrBlockedDestination, addr)
+	}
+
+	for _, addr := range []string{"93.184.216.34", "8.8.8.8", "2606:4700::1111", "::ffff:8.8.8.8"} {
+		assert.Nil(t, guard.CheckIP(net.ParseIP(addr)), addr)
+	}
+
+	assert.EqualError(t, guard.CheckIP(net.ParseIP("::ffff:169.254.169.254")), "169.254.169.254 is in 169.254.0.0/16: blocked destination")
+	assert.EqualError(t, guard.CheckIP(net.IP{1, 2}), "?0102 is not a valid IP: blocked destination")
+}
+
+func TestGuardConfig(t *testing.T) {
+	guard, err := NewGuard(Config{
+		AllowCIDRs:   []string{"10.0.0.0/24", "fd00::1/128"},
+		DenyCIDRs:    []string{"8.8.8.8/24"},
+		AllowedPorts: []int{443},
+	}, nil, nil)
+	assert.Nil(t, err)
+
+	assert.Nil(t, guard.CheckIP(net.ParseIP("10.0.0.5")))
+	assert.Nil(t, guard.CheckIP(net.ParseIP("fd00::1")))
+	assert.ErrorIs(t, guard.CheckIP(net.ParseIP("10.0.1.5")), ErrBlockedDestination)
+	assert.EqualError(t, guard.CheckIP(net.ParseIP("8.8.8.9")), "8.8.8.9 is in 8.8.8.0/24: blocked destination")
+
+	assert.Nil(t, guard.CheckPort(443))
+	assert.EqualError(t, guard.CheckPort(80), "port 80 is not allowed: blocked destination")
+	assert.Equal(t, 10, guard.maxRedirects)
+
+	_, err = NewGuard(Config{DenyCIDRs: []string{"10.0.0.0"}}, nil, nil)
+	assert.EqualError(t, err, `invalid CIDR "10.0.0.0": netip.ParsePrefix("10.0.0.0"): no '/'`)
+}
+
+func TestGuardDialContext(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	dnsSvc := absos.NewDnsSvcMock(timeSvc)
+	dnsSvc.SetLookupIpResult("public.example.com", []net.IP{publicIP}, nil)
+	dnsSvc.SetLookupIpResult("internal.example.com", []net.IP{net.ParseIP("10.0.0.1")}, nil)
+	netSvc := absos.NewNetSvcMock(timeSvc, dnsSvc)
+	l, err := netSvc.Listen("tcp", ":80")
+	assert.Nil(t, err)
+	defer l.Close()
+	guard, err := NewGuard(DefaultConfig(), dnsSvc, netSvc)
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	conn, err := guard.DialContext(ctx, "tcp", "public.example.com:80")
+	assert.Nil(t, err)
+	assert.Equal(t, publicIP, conn.RemoteAddr().(*net.TCPAddr).IP)
+
+	_, err = guard.DialContext(ctx, "tcp", "internal.example.com:80")
+	assert.ErrorIs(t, err, ErrBlockedDestination)
+	assert.EqualError(t, err, "dial tcp: internal.example.com (10.0.0.1) is in 10.0.0.0/8: blocked destination")
+
+	_, err = guard.DialContext(ctx, "tcp", "127.0.0.1:80")
+	assert.EqualError(t, err, "dial tcp: 127.0.0.1 is in 127.0.0.0/8: blocked destination")
+
+	_, err = guard.DialContext(ctx, "tcp", "[::ffff:127.0.0.1]:80")
+	assert.ErrorIs(t, err, ErrBlockedDestination)
+
+	// Connected to the validated IP, never resolved again.
+	assert.Equal(t, []string{"93.184.216.34:80"}, dialedAddresses(netSvc))
+}
+
+func TestGuardDialContextMixedIPs(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	dnsSvc := absos.NewDnsSvcMock(timeSvc)
+	dnsSvc.SetLookupIpResult("public.example.com", []net.IP{publicIP}, nil)
+	dnsSvc.SetLookupIpResult("internal.example.com", []net.IP{net.ParseIP("10.0.0.1")}, nil)
+	netSvc := absos.NewNetSvcMock(timeSvc, dnsSvc)
+	l, err := netSvc.Listen("tcp", ":80")
+	assert.Nil(t, err)
+	defer l.Close()
+	guard, err := NewGuard(DefaultConfig(), dnsSvc, netSvc)
+	assert.Nil(t, err)
+	dnsSvc.SetLookupIpResult("mixed.example.com", []net.IP{net.ParseIP("127.0.0.1"), publicIP}, nil)
+
+	conn, err := guard.DialContext(context.Background(), "tcp", "mixed.example.com:80")
+	assert.Nil(t, err)
+	assert.Equal(t, publicIP, conn.RemoteAddr().(*net.TCPAddr).IP)
+	assert.Equal(t, []string{"93.184.216.34:80"}, dialedAddresses(netSvc))
+
+	// Connection errors win over blocked IPs.
+	netSvc.SetLink("93.184.216.34:80", absos.NetMockLink{Refuse: true})
+	_, err = guard.DialContext(context.Background(), "tcp", "mixed.example.com:80")
+	assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+	assert.NotErrorIs(t, err, ErrBlockedDestination)
+}
+
+func TestGuardDialContextErrors(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AllowedPorts = []int{80}
+	timeSvc := absos.NewTimeSvcMock()
+	dnsSvc := absos.NewDnsSvcMock(timeSvc)
+	dnsSvc.SetLookupIpResult("public.example.com", []net.IP{publicIP}, nil)
+	dnsSvc.SetLookupIpResult("internal.example.com", []net.IP{net.ParseIP("10.0.0.1")}, nil)
+	netSvc := absos.NewNetSvcMock(timeSvc, dnsSvc)
+	l, err := netSvc.Listen("tcp", ":80")
+	assert.Nil(t, err)
+	defer l.Close()
+	guard, err := NewGuard(cfg, dnsSvc, netSvc)
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	_, err = guard.DialContext(ctx, "tcp", "public.example.com:8080")
+	assert.EqualError(t, err, "dial tcp: port 8080 is not allowed: blocked destination")
+
+	dnsErr := &net.DNSError{Err: "no such host", Name: "unknown.example.com", IsNotFound: true}
+	dnsSvc.SetLookupIpResult("unknown.example.com", nil, dnsErr)
+	_, err = guard.DialContext(ctx, "tcp", "unknown.example.com:80")
+	assert.ErrorIs(t, err, dnsErr)
+
+	dnsSvc.SetLookupIpResult("empty.example.com", []net.IP{}, nil)
+	_, err = guard.DialContext(ctx, "tcp", "empty.example.com:80")
+	assert.EqualError(t, err, "dial tcp: address empty.example.com: no suitable address found")
+
+	_, err = guard.DialContext(ctx, "tcp", "public.example.com")
+	assert.EqualError(t, err, "dial tcp: address public.example.com: missing port in address")
+
+	_, err = guard.DialContext(ctx, "tcp", "public.example.com:http")
+	assert.EqualError(t, err, `dial tcp: invalid port "http"`)
+
+	assert.Empty(t, dialedAddresses(netSvc))
+}
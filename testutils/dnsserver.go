@@ -0,0 +1,404 @@
+package testutils
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DnsServerQuery is a query received by DnsServer.
+type DnsServerQuery struct {
+	Name string // Absolute (with a trailing dot).
+	Type dnsmessage.Type
+	TCP  bool
+	HTTP bool // Via ServeHTTP().
+	// UDPSize is the payload size advertised via EDNS0, 0 if the query had no OPT record.
+	UDPSize int
+}
+
+// DnsServer is an in-process DNS server answering queries over UDP & TCP (on the same port of
+// 127.0.0.1) from records added by Add(). Serves as a stand-in for real servers in tests of DNS clients.
+//
+// CNAME chains are followed within answers, unknown names are answered with NXDOMAIN. UDP answers
+// larger than 512 bytes (or the EDNS0 advertised size) are truncated.
+//
+// It's also http.Handler answering DNS-over-HTTPS queries, to be served by httptest.NewServer().
+type DnsServer struct {
+	udp net.PacketConn
+	tcp net.Listener
+	wg  sync.WaitGroup
+
+	mu          sync.Mutex
+	records     map[string][]dnsmessage.Resource
+	rcodes      map[string]dnsmessage.RCode
+	truncateUDP bool
+	dropUDP     bool
+	queries     []DnsServerQuery
+	conns       map[net.Conn]struct{}
+	closed      bool
+}
+
+// dnsServerTransport is the transport a query was received over.
+type dnsServerTransport int
+
+const (
+	dnsServerUDP dnsServerTransport = iota
+	dnsServerTCP
+	dnsServerHTTP
+)
+
+// dnsMessageContentType is the media type of DNS messages over HTTP (RFC 8484).
+const dnsMessageContentType = "application/dns-message"
+
+// dnsServerUDPSize is the UDP payload size DnsServer advertises via EDNS0.
+const dnsServerUDPSize = 4096
+
+// NewDnsServer starts a new DnsServer; stop it with Close().
+func NewDnsServer() (*DnsServer, error) {
+	var (
+		udp net.PacketConn
+		tcp net.Listener
+		err error
+	)
+
+	// The TCP port may be taken, retry with another UDP one.
+	for range 10 {
+		if udp, err = net.ListenPacket("udp", "127.0.0.1:0"); err != nil {
+			return nil, err
+		}
+		if tcp, err = net.Listen("tcp", udp.LocalAddr().String()); err == nil {
+			break
+		}
+		_ = udp.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &DnsServer{
+		udp:     udp,
+		tcp:     tcp,
+		records: make(map[string][]dnsmessage.Resource),
+		rcodes:  make(map[string]dnsmessage.RCode),
+		conns:   make(map[net.Conn]struct{}),
+	}
+	s.wg.Go(s.serveUDP)
+	s.wg.Go(s.serveTCP)
+	return s, nil
+}
+
+// Addr returns the "ip:port" address the server listens on (both UDP & TCP).
+func (s *DnsServer) Addr() string {
+	return s.udp.LocalAddr().String()
+}
+
+// Close stops the server, and waits till all its goroutines finish.
+func (s *DnsServer) Close() {
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	_ = s.udp.Close()
+	_ = s.tcp.Close()
+	s.wg.Wait()
+}
+
+// dnsServerKey normalizes name for lookups.
+func dnsServerKey(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
+
+// dnsResourceType returns the record type of body.
+func dnsResourceType(body dnsmessage.ResourceBody) dnsmessage.Type {
+	switch body.(type) {
+	case *dnsmessage.AResource:
+		return dnsmessage.TypeA
+	case *dnsmessage.AAAAResource:
+		return dnsmessage.TypeAAAA
+	case *dnsmessage.CNAMEResource:
+		return dnsmessage.TypeCNAME
+	case *dnsmessage.MXResource:
+		return dnsmessage.TypeMX
+	case *dnsmessage.NSResource:
+		return dnsmessage.TypeNS
+	case *dnsmessage.PTRResource:
+		return dnsmessage.TypePTR
+	case *dnsmessage.SOAResource:
+		return dnsmessage.TypeSOA
+	case *dnsmessage.SRVResource:
+		return dnsmessage.TypeSRV
+	case *dnsmessage.TXTResource:
+		return dnsmessage.TypeTXT
+	default:
+		panic("unsupported DNS record type")
+	}
+}
+
+// Add adds a record of name (with or without a trailing dot) with the body (e.g. &dnsmessage.AResource{...}).
+// Records are answered in the order added. Panics on an invalid name or unsupported record type.
+func (s *DnsServer) Add(name string, body dnsmessage.ResourceBody) {
+	key := dnsServerKey(name)
+	rr := dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  dnsmessage.MustNewName(key),
+			Type:  dnsResourceType(body),
+			Class: dnsmessage.ClassINET,
+			TTL:   60,
+		},
+		Body: body,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = append(s.records[key], rr)
+}
+
+// SetRCode makes queries for name answered with rcode (e.g. dnsmessage.RCodeServerFailure) and no records.
+// dnsmessage.RCodeSuccess reverts to answering from records.
+func (s *DnsServer) SetRCode(name string, rcode dnsmessage.RCode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rcode == dnsmessage.RCodeSuccess {
+		delete(s.rcodes, dnsServerKey(name))
+	} else {
+		s.rcodes[dnsServerKey(name)] = rcode
+	}
+}
+
+// SetTruncateUDP makes all UDP answers truncated (regardless of their size).
+func (s *DnsServer) SetTruncateUDP(truncate bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.truncateUDP = truncate
+}
+
+// SetDropUDP makes UDP queries unanswered (recorded still), simulating an unresponsive server.
+func (s *DnsServer) SetDropUDP(drop bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropUDP = drop
+}
+
+// Queries returns the queries received so far, in order.
+func (s *DnsServer) Queries() []DnsServerQuery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]DnsServerQuery(nil), s.queries...)
+}
+
+// ClearQueries forgets the queries received so far.
+func (s *DnsServer) ClearQueries() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries = nil
+}
+
+func (s *DnsServer) serveUDP() {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := s.respond(buf[:n], dnsServerUDP); resp != nil {
+			_, _ = s.udp.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (s *DnsServer) serveTCP() {
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Go(func() {
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				_ = conn.Close()
+			}()
+			s.serveTCPConn(conn)
+		})
+	}
+}
+
+func (s *DnsServer) serveTCPConn(conn net.Conn) {
+	for {
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+
+		resp := s.respond(query, dnsServerTCP)
+		if resp == nil {
+			return
+		}
+		if _, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...)); err != nil {
+			return
+		}
+	}
+}
+
+// respond returns the wire format of the answer to the query, nil if it should be left unanswered.
+func (s *DnsServer) respond(query []byte, transport dnsServerTransport) []byte {
+	var q dnsmessage.Message
+	if err := q.Unpack(query); err != nil || q.Response || len(q.Questions) != 1 {
+		return nil
+	}
+	question := q.Questions[0]
+
+	udpSize := 0
+	for _, rr := range q.Additionals {
+		if rr.Header.Type == dnsmessage.TypeOPT {
+			udpSize = int(rr.Header.Class)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queries = append(s.queries, DnsServerQuery{
+		Name:    question.Name.String(),
+		Type:    question.Type,
+		TCP:     transport == dnsServerTCP,
+		HTTP:    transport == dnsServerHTTP,
+		UDPSize: udpSize,
+	})
+	if s.dropUDP && transport == dnsServerUDP {
+		return nil
+	}
+
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 q.ID,
+			Response:           true,
+			RecursionDesired:   q.RecursionDesired,
+			RecursionAvailable: true,
+		},
+		Questions: q.Questions,
+	}
+	s.answer(&resp, question)
+
+	if udpSize > 0 {
+		var rh dnsmessage.ResourceHeader
+		_ = rh.SetEDNS0(dnsServerUDPSize, dnsmessage.RCodeSuccess, false)
+		resp.Additionals = append(resp.Additionals, dnsmessage.Resource{Header: rh, Body: &dnsmessage.OPTResource{}})
+	}
+
+	b, err := resp.Pack()
+	if err != nil {
+		return nil
+	}
+
+	if transport == dnsServerUDP {
+		limit := max(udpSize, 512)
+		if s.truncateUDP || len(b) > limit {
+			resp.Truncated = true
+			resp.Answers = nil
+			if b, err = resp.Pack(); err != nil {
+				return nil
+			}
+		}
+	}
+	return b
+}
+
+// ServeHTTP answers DNS-over-HTTPS (RFC 8484) queries in the wire format, GET (?dns=) & POST ones.
+func (s *DnsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var query []byte
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		query, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+	case http.MethodPost:
+		if r.Header.Get("Content-Type") != dnsMessageContentType {
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		query, err = io.ReadAll(io.LimitReader(r.Body, 65535))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := s.respond(query, dnsServerHTTP)
+	if resp == nil {
+		http.Error(w, "invalid query", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", dnsMessageContentType)
+	_, _ = w.Write(resp)
+}
+
+// answer fills in the answer records & rcode of resp.
+func (s *DnsServer) answer(resp *dnsmessage.Message, question dnsmessage.Question) {
+	name := dnsServerKey(question.Name.String())
+	if rcode, ok := s.rcodes[name]; ok {
+		resp.RCode = rcode
+		return
+	}
+
+	for range 16 {
+		records, exists := s.records[name]
+		if !exists {
+			resp.RCode = dnsmessage.RCodeNameError
+			return
+		}
+
+		found := false
+		var cname string
+		for _, rr := range records {
+			if rr.Header.Type == question.Type {
+				resp.Answers = append(resp.Answers, rr)
+				found = true
+			} else if body, ok := rr.Body.(*dnsmessage.CNAMEResource); ok {
+				cname = body.CNAME.String()
+			}
+		}
+		if found || cname == "" || question.Type == dnsmessage.TypeCNAME {
+			return
+		}
+
+		// Follow the CNAME.
+		for _, rr := range records {
+			if rr.Header.Type == dnsmessage.TypeCNAME {
+				resp.Answers = append(resp.Answers, rr)
+			}
+		}
+		name = dnsServerKey(cname)
+	}
+}
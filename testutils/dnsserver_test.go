@@ -0,0 +1,210 @@
+package testutils
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newTestResolver returns the pure Go resolver of the std lib querying only the server.
+func newTestResolver(server *DnsServer) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server.Addr())
+		},
+	}
+}
+
+func TestDnsServer(t *testing.T) {
+	server, err := NewDnsServer()
+	assert.Nil(t, err)
+	defer server.Close()
+
+	server.Add("example.com", &dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}})
+	server.Add("www.example.com.", &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("example.com.")})
+	server.Add("EXAMPLE.com", &dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mx.example.com.")})
+
+	resolver := newTestResolver(server)
+	ctx := context.Background()
+
+	ips, err := resolver.LookupIP(ctx, "ip4", "www.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []net.IP{net.IPv4(10, 0, 0, 1).To4()}, ips)
+
+	cname, err := resolver.LookupCNAME(ctx, "www.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "example.com.", cname)
+
+	mxs, err := resolver.LookupMX(ctx, "example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []*net.MX{{Host: "mx.example.com.", Pref: 10}}, mxs)
+
+	_, err = resolver.LookupIP(ctx, "ip4", "unknown.example.com")
+	var dnsErr *net.DNSError
+	assert.ErrorAs(t, err, &dnsErr)
+	assert.True(t, dnsErr.IsNotFound)
+
+	queries := server.Queries()
+	assert.Equal(t, DnsServerQuery{Name: "www.example.com.", Type: dnsmessage.TypeA, TCP: false, UDPSize: 1232}, queries[0])
+
+	server.ClearQueries()
+	assert.Empty(t, server.Queries())
+}
+
+func TestDnsServerRCode(t *testing.T) {
+	server, err := NewDnsServer()
+	assert.Nil(t, err)
+	defer server.Close()
+
+	server.Add("example.com", &dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}})
+	server.SetRCode("example.com", dnsmessage.RCodeServerFailure)
+
+	resolver := newTestResolver(server)
+
+	_, err = resolver.LookupIP(context.Background(), "ip4", "example.com")
+	var dnsErr *net.DNSError
+	assert.ErrorAs(t, err, &dnsErr)
+	assert.False(t, dnsErr.IsNotFound)
+
+	server.SetRCode("example.com", dnsmessage.RCodeSuccess)
+
+	_, err = resolver.LookupIP(context.Background(), "ip4", "example.com")
+	assert.Nil(t, err)
+}
+
+func TestDnsServerTruncation(t *testing.T) {
+	server, err := NewDnsServer()
+	assert.Nil(t, err)
+	defer server.Close()
+
+	// Too large for 1232 bytes (the UDP size advertised by the std lib resolver).
+	for range 10 {
+		server.Add("example.com", &dnsmessage.TXTResource{TXT: []string{strings.Repeat("x", 200)}})
+	}
+	server.Add("small.example.com", &dnsmessage.TXTResource{TXT: []string{"small"}})
+
+	resolver := newTestResolver(server)
+
+	txts, err := resolver.LookupTXT(context.Background(), "example.com")
+	assert.Nil(t, err)
+	assert.Len(t, txts, 10)
+
+	queries := server.Queries()
+	assert.Len(t, queries, 2)
+	assert.False(t, queries[0].TCP)
+	assert.True(t, queries[1].TCP)
+
+	// Truncated regardless of the size.
+	server.SetTruncateUDP(true)
+	server.ClearQueries()
+
+	txts, err = resolver.LookupTXT(context.Background(), "small.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"small"}, txts)
+	assert.Len(t, server.Queries(), 2)
+}
+
+func TestDnsServerDropUDP(t *testing.T) {
+	server, err := NewDnsServer()
+	assert.Nil(t, err)
+	defer server.Close()
+
+	server.Add("example.com", &dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}})
+	server.SetDropUDP(true)
+
+	conn, err := net.Dial("udp", server.Addr())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	q := dnsmessage.Message{Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName("example.com."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}}}
+	b, err := q.Pack()
+	assert.Nil(t, err)
+
+	_, err = conn.Write(b)
+	assert.Nil(t, err)
+
+	assert.Eventually(t, func() bool { return len(server.Queries()) == 1 }, time.Second, time.Millisecond)
+	// Not answered.
+	assert.Nil(t, conn.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = conn.Read(make([]byte, 512))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
+
+func TestDnsServerUnsupportedType(t *testing.T) {
+	server, err := NewDnsServer()
+	assert.Nil(t, err)
+	server.Close()
+
+	assert.Equal(t, "unsupported DNS record type", CapturePanicValue(func() {
+		server.Add("example.com", &dnsmessage.OPTResource{})
+	}))
+}
+
+func TestDnsServerHTTP(t *testing.T) {
+	server, err := NewDnsServer()
+	assert.Nil(t, err)
+	defer server.Close()
+
+	server.Add("example.com", &dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}})
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	q := dnsmessage.Message{Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName("example.com."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}}}
+	query, err := q.Pack()
+	assert.Nil(t, err)
+
+	checkAnswer := func(resp *http.Response) {
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/dns-message", resp.Header.Get("Content-Type"))
+
+		b, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		var msg dnsmessage.Message
+		assert.Nil(t, msg.Unpack(b))
+		assert.True(t, msg.Response)
+		assert.Equal(t, &dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}}, msg.Answers[0].Body)
+	}
+
+	resp, err := http.Post(httpServer.URL, "application/dns-message", bytes.NewReader(query))
+	assert.Nil(t, err)
+	checkAnswer(resp)
+
+	resp, err = http.Get(httpServer.URL + "?dns=" + base64.RawURLEncoding.EncodeToString(query))
+	assert.Nil(t, err)
+	checkAnswer(resp)
+
+	assert.Equal(t, []DnsServerQuery{
+		{Name: "example.com.", Type: dnsmessage.TypeA, HTTP: true},
+		{Name: "example.com.", Type: dnsmessage.TypeA, HTTP: true},
+	}, server.Queries())
+
+	resp, err = http.Post(httpServer.URL, "text/plain", bytes.NewReader(query))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	_ = resp.Body.Close()
+
+	resp, err = http.Get(httpServer.URL + "?dns=garbage")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	_ = resp.Body.Close()
+
+	req, _ := http.NewRequest(http.MethodDelete, httpServer.URL, nil)
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	_ = resp.Body.Close()
+}
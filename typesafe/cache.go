@@ -0,0 +1,485 @@
+package typesafe
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/kattecon/akgoli/utils"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrNoLoader is returned by Cache.GetOrLoad() of caches without CacheConfig.Loader.
+const ErrNoLoader = utils.ConstError("cache has no loader")
+
+// ErrLoaderPanicked is returned (wrapped, with the panic value) by Cache.GetOrLoad() if
+// CacheConfig.Loader panics.
+const ErrLoaderPanicked = utils.ConstError("cache loader panicked")
+
+// EvictionPolicy chooses entries Cache evicts when full.
+type EvictionPolicy int
+
+const (
+	// EvictLru evicts the least recently used entry.
+	EvictLru EvictionPolicy = iota
+
+	// EvictLfu evicts the least frequently used entry (the least recently used one of those).
+	EvictLfu
+)
+
+// EvictionReason tells why Cache evicted an entry, the "reason" label value of the evictions counter.
+type EvictionReason string
+
+const (
+	// EvictedCapacity is for entries evicted to make room (see MaxEntries & MaxCost).
+	EvictedCapacity EvictionReason = "capacity"
+
+	// EvictedExpired is for entries evicted once their TTL passed.
+	EvictedExpired EvictionReason = "expired"
+)
+
+var allEvictionReasons = []EvictionReason{EvictedCapacity, EvictedExpired}
+
+// CacheConfig configures Cache.
+type CacheConfig[K comparable, V any] struct {
+	// Name is the "cache" label value of the metrics. Defaults to "default".
+	Name string
+
+	// Policy chooses entries to evict when full. Defaults to EvictLru.
+	Policy EvictionPolicy
+
+	// MaxEntries limits the number of entries; 0 means no limit.
+	MaxEntries int
+
+	// MaxCost limits the total cost of entries (see Cost); 0 means no limit. Entries costing
+	// more than MaxCost alone aren't cached.
+	MaxCost int64
+
+	// Cost returns the cost of an entry, e.g. its size in bytes. Defaults to 1 for every entry.
+	Cost func(key K, value V) int64
+
+	// Ttl is how long entries are served after being set; 0 means they don't expire.
+	Ttl time.Duration
+
+	// TtlFunc computes the TTL of an entry (overriding Ttl), e.g. from an expiry in the value.
+	// A TTL <= 0 means the entry doesn't expire.
+	TtlFunc func(key K, value V) time.Duration
+
+	// Loader loads values missing in the cache for GetOrLoad(). Errors aren't cached.
+	Loader func(ctx context.Context, key K) (V, error)
+
+	// OnEvict is called with entries evicted by the cache (not the ones deleted or replaced), without
+	// the cache locked.
+	OnEvict func(key K, value V, reason EvictionReason)
+}
+
+// cacheEntry is an entry of Cache, an item of cacheHeap.
+type cacheEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	cost    int64
+	expires time.Time // Zero if the entry doesn't expire.
+
+	index    int    // Index in cacheHeap.
+	lastUsed uint64 // Cache.useSeq of the last use.
+	uses     uint64
+}
+
+// cacheCall is an in-flight load other callers of the same key wait for.
+type cacheCall[V any] struct {
+	done  chan any
+	value V
+	err   error
+
+	// discarded is set once the key is set or deleted during the load, so the value is stale.
+	discarded bool
+}
+
+// eviction is an entry evicted with the cache locked, reported to OnEvict once unlocked.
+type eviction[K comparable, V any] struct {
+	entry  *cacheEntry[K, V]
+	reason EvictionReason
+}
+
+// minPurgeSize is the min number of entries at which expired entries get purged.
+const minPurgeSize = 1024
+
+// Cache is a size-bounded cache with LRU or LFU eviction, TTLs measured by absos.TimeSvc, and
+// loads collapsed per key. Safe for concurrent use.
+//
+// Hits, misses and evictions (by reason) are exposed as counters with a "cache" const label of
+// the name.
+type Cache[K comparable, V any] struct {
+	cfg     CacheConfig[K, V]
+	timeSvc absos.TimeSvc
+	hits    prometheus.Counter
+	misses  prometheus.Counter
+	evicted *prometheus.CounterVec
+
+	// mu protects all fields below.
+	mu      sync.Mutex
+	entries map[K]*cacheEntry[K, V]
+	heap    cacheHeap[K, V]
+	cost    int64
+	useSeq  uint64
+	calls   map[K]*cacheCall[V]
+
+	// nextPurge is the number of entries at which expired entries are purged next time.
+	nextPurge int
+}
+
+// NewCache returns an empty Cache, measuring time using timeSvc, and registering its metrics in m.
+func NewCache[K comparable, V any](cfg CacheConfig[K, V], timeSvc absos.TimeSvc, m *metrics.Metrics) *Cache[K, V] {
+	if cfg.Name == "" {
+		cfg.Name = "default"
+	}
+	if cfg.Cost == nil {
+		cfg.Cost = func(K, V) int64 { return 1 }
+	}
+
+	constLabels := prometheus.Labels{"cache": cfg.Name}
+	c := &Cache[K, V]{
+		cfg:     cfg,
+		timeSvc: timeSvc,
+		hits: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name:        m.Prefixed("cache_hits"),
+				Help:        "Total number of cache lookups answered from the cache.",
+				ConstLabels: constLabels,
+			},
+		),
+		misses: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name:        m.Prefixed("cache_misses"),
+				Help:        "Total number of cache lookups not answered from the cache.",
+				ConstLabels: constLabels,
+			},
+		),
+		evicted: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        m.Prefixed("cache_evictions"),
+				Help:        "Total number of entries evicted from the cache.",
+				ConstLabels: constLabels,
+			},
+			[]string{"reason"},
+		),
+		entries:   make(map[K]*cacheEntry[K, V]),
+		heap:      cacheHeap[K, V]{lfu: cfg.Policy == EvictLfu},
+		calls:     make(map[K]*cacheCall[V]),
+		nextPurge: minPurgeSize,
+	}
+	m.MustRegister(c.hits, c.misses, c.evicted)
+
+	// Set initial counters to zero (see logging.NewLogger() for reasons).
+	for _, reason := range allEvictionReasons {
+		c.evicted.WithLabelValues(string(reason)).Add(0)
+	}
+
+	return c
+}
+
+// Get returns the value of key, ok is false if it's not cached (or expired).
+func (c *Cache[K, V]) Get(key K) (value V, ok bool) {
+	c.mu.Lock()
+	entry, evictions := c.getLocked(key, c.timeSvc.Now())
+	if entry != nil {
+		value = entry.value
+	}
+	c.mu.Unlock()
+
+	c.notify(evictions)
+	if entry == nil {
+		c.misses.Inc()
+		return value, false
+	}
+	c.hits.Inc()
+	return value, true
+}
+
+// GetOrLoad returns the value of key, loading it via CacheConfig.Loader if it's not cached.
+//
+// Concurrent loads of the same key are collapsed into a single call of the loader. The load
+// itself isn't cancelled when its callers give up, so its value still makes it into the cache.
+func (c *Cache[K, V]) GetOrLoad(ctx context.Context, key K) (V, error) {
+	var noValue V
+	if c.cfg.Loader == nil {
+		return noValue, ErrNoLoader
+	}
+	if err := ctx.Err(); err != nil {
+		return noValue, err
+	}
+
+	c.mu.Lock()
+	entry, evictions := c.getLocked(key, c.timeSvc.Now())
+	if entry != nil {
+		value := entry.value
+		c.mu.Unlock()
+
+		c.notify(evictions)
+		c.hits.Inc()
+		return value, nil
+	}
+
+	call := c.calls[key]
+	if call == nil {
+		call = c.startCallLocked(context.WithoutCancel(ctx), key)
+	}
+	c.mu.Unlock()
+
+	c.notify(evictions)
+	c.misses.Inc()
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return noValue, ctx.Err()
+	}
+}
+
+// Set caches value for key with the TTL of the config, replacing the former one.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.set(key, value, c.ttlOf(key, value))
+}
+
+// SetWithTtl caches value for key with ttl (<= 0 meaning no expiry), replacing the former one.
+func (c *Cache[K, V]) SetWithTtl(key K, value V, ttl time.Duration) {
+	c.set(key, value, ttl)
+}
+
+// Delete removes key, tells whether it was cached. A load of key in progress won't cache its value.
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.discardCallLocked(key)
+	entry := c.entries[key]
+	if entry == nil {
+		return false
+	}
+	c.removeLocked(entry)
+	return true
+}
+
+// Len returns the number of entries, including expired ones not evicted yet.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Cost returns the total cost of entries, including expired ones not evicted yet.
+func (c *Cache[K, V]) Cost() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cost
+}
+
+// PurgeExpired evicts all expired entries. They're otherwise evicted on lookups, to make room,
+// and once in a while as the cache grows.
+func (c *Cache[K, V]) PurgeExpired() {
+	c.mu.Lock()
+	evictions := c.purgeExpiredLocked(c.timeSvc.Now(), nil)
+	c.mu.Unlock()
+
+	c.notify(evictions)
+}
+
+func (c *Cache[K, V]) set(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	c.discardCallLocked(key)
+	evictions := c.storeLocked(key, value, ttl)
+	c.mu.Unlock()
+
+	c.notify(evictions)
+}
+
+func (c *Cache[K, V]) ttlOf(key K, value V) time.Duration {
+	if c.cfg.TtlFunc != nil {
+		return c.cfg.TtlFunc(key, value)
+	}
+	return c.cfg.Ttl
+}
+
+// getLocked returns the entry of key (nil if missing), marking it used, and evicting it if expired.
+func (c *Cache[K, V]) getLocked(key K, now time.Time) (*cacheEntry[K, V], []eviction[K, V]) {
+	entry := c.entries[key]
+	if entry == nil {
+		return nil, nil
+	}
+	if entry.expired(now) {
+		c.removeLocked(entry)
+		return nil, c.evictedLocked(nil, entry, EvictedExpired)
+	}
+
+	c.useSeq++
+	entry.lastUsed = c.useSeq
+	entry.uses++
+	heap.Fix(&c.heap, entry.index)
+	return entry, nil
+}
+
+// startCallLocked starts a load via the loader, which caches its value once done.
+func (c *Cache[K, V]) startCallLocked(ctx context.Context, key K) *cacheCall[V] {
+	call := &cacheCall[V]{done: make(chan any)}
+	c.calls[key] = call
+
+	go func() {
+		call.value, call.err = c.load(ctx, key)
+
+		var evictions []eviction[K, V]
+		func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if call.discarded {
+				return
+			}
+			delete(c.calls, key)
+			if call.err == nil {
+				evictions = c.storeLocked(key, call.value, c.ttlOf(key, call.value))
+			}
+		}()
+
+		close(call.done)
+		c.notify(evictions)
+	}()
+
+	return call
+}
+
+// load calls the loader, turning panics into errors.
+func (c *Cache[K, V]) load(ctx context.Context, key K) (value V, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Wrapf(ErrLoaderPanicked, "%v", r)
+		}
+	}()
+	return c.cfg.Loader(ctx, key)
+}
+
+// discardCallLocked makes a load of key in progress not cache its value.
+func (c *Cache[K, V]) discardCallLocked(key K) {
+	if call := c.calls[key]; call != nil {
+		call.discarded = true
+		delete(c.calls, key)
+	}
+}
+
+// storeLocked caches the value, evicting entries to make room for it.
+func (c *Cache[K, V]) storeLocked(key K, value V, ttl time.Duration) []eviction[K, V] {
+	if old := c.entries[key]; old != nil {
+		c.removeLocked(old)
+	}
+
+	cost := c.cfg.Cost(key, value)
+	if c.cfg.MaxCost > 0 && cost > c.cfg.MaxCost {
+		return nil
+	}
+
+	now := c.timeSvc.Now()
+	var evictions []eviction[K, V]
+
+	if len(c.entries) >= c.nextPurge {
+		evictions = c.purgeExpiredLocked(now, evictions)
+		c.nextPurge = max(2*len(c.entries), minPurgeSize)
+	}
+
+	for c.heap.Len() > 0 &&
+		(c.cfg.MaxEntries > 0 && len(c.entries) >= c.cfg.MaxEntries ||
+			c.cfg.MaxCost > 0 && c.cost+cost > c.cfg.MaxCost) {
+		victim := c.heap.entries[0]
+		c.removeLocked(victim)
+		reason := EvictedCapacity
+		if victim.expired(now) {
+			reason = EvictedExpired
+		}
+		evictions = c.evictedLocked(evictions, victim, reason)
+	}
+
+	entry := &cacheEntry[K, V]{key: key, value: value, cost: cost, uses: 1}
+	if ttl > 0 {
+		entry.expires = now.Add(ttl)
+	}
+	c.useSeq++
+	entry.lastUsed = c.useSeq
+	c.entries[key] = entry
+	heap.Push(&c.heap, entry)
+	c.cost += cost
+	return evictions
+}
+
+func (c *Cache[K, V]) purgeExpiredLocked(now time.Time, evictions []eviction[K, V]) []eviction[K, V] {
+	for _, entry := range c.entries {
+		if entry.expired(now) {
+			c.removeLocked(entry)
+			evictions = c.evictedLocked(evictions, entry, EvictedExpired)
+		}
+	}
+	return evictions
+}
+
+func (c *Cache[K, V]) removeLocked(entry *cacheEntry[K, V]) {
+	delete(c.entries, entry.key)
+	heap.Remove(&c.heap, entry.index)
+	c.cost -= entry.cost
+}
+
+// evictedLocked counts the eviction, and appends it to evictions for notify().
+func (c *Cache[K, V]) evictedLocked(evictions []eviction[K, V], entry *cacheEntry[K, V], reason EvictionReason) []eviction[K, V] {
+	c.evicted.WithLabelValues(string(reason)).Inc()
+	if c.cfg.OnEvict == nil {
+		return evictions
+	}
+	return append(evictions, eviction[K, V]{entry, reason})
+}
+
+// notify calls OnEvict with evictions. Must be called without c.mu held.
+func (c *Cache[K, V]) notify(evictions []eviction[K, V]) {
+	for _, e := range evictions {
+		c.cfg.OnEvict(e.entry.key, e.entry.value, e.reason)
+	}
+}
+
+func (e *cacheEntry[K, V]) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// cacheHeap orders entries by eviction priority, the next one to evict first (see heap.Interface).
+type cacheHeap[K comparable, V any] struct {
+	lfu     bool
+	entries []*cacheEntry[K, V]
+}
+
+func (h *cacheHeap[K, V]) Len() int { return len(h.entries) }
+
+func (h *cacheHeap[K, V]) Less(i, j int) bool {
+	a, b := h.entries[i], h.entries[j]
+	if h.lfu && a.uses != b.uses {
+		return a.uses < b.uses
+	}
+	return a.lastUsed < b.lastUsed
+}
+
+func (h *cacheHeap[K, V]) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.entries[i].index = i
+	h.entries[j].index = j
+}
+
+func (h *cacheHeap[K, V]) Push(x any) {
+	entry := x.(*cacheEntry[K, V])
+	entry.index = len(h.entries)
+	h.entries = append(h.entries, entry)
+}
+
+func (h *cacheHeap[K, V]) Pop() any {
+	last := len(h.entries) - 1
+	entry := h.entries[last]
+	h.entries[last] = nil
+	h.entries = h.entries[:last]
+	return entry
+}
@@ -0,0 +1,401 @@
+package typesafe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kattecon/akgoli/absos"
+	"github.com/kattecon/akgoli/appinfo"
+	"github.com/kattecon/akgoli/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+type cacheEvent struct {
+	key    string
+	value  int
+	reason EvictionReason
+}
+
+func assertCacheKeys(t *testing.T, cache *Cache[string, int], keys ...string) {
+	t.Helper()
+	assert.Equal(t, len(keys), cache.Len())
+	for _, key := range keys {
+		_, ok := cache.Get(key)
+		assert.True(t, ok, key)
+	}
+}
+
+func TestCacheGetSetDelete(t *testing.T) {
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	var evicted []cacheEvent
+	cache := NewCache(CacheConfig[string, int]{
+		Name: "test",
+		OnEvict: func(key string, value int, reason EvictionReason) {
+			evicted = append(evicted, cacheEvent{key, value, reason})
+		},
+	}, absos.NewTimeSvcMock(), m)
+
+	_, ok := cache.Get("x")
+	assert.False(t, ok)
+
+	cache.Set("x", 1)
+	cache.Set("x", 2)
+	v, ok := cache.Get("x")
+	assert.True(t, ok)
+	assert.Equal(t, 2, v)
+
+	assert.True(t, cache.Delete("x"))
+	assert.False(t, cache.Delete("x"))
+	_, ok = cache.Get("x")
+	assert.False(t, ok)
+	assert.Equal(t, 0, cache.Len())
+
+	// Not evictions.
+	assert.Empty(t, evicted)
+
+	dump := m.DumpAsTextForTest()
+	assert.Contains(t, dump, `mock_cache_hits{cache="test"} 1`)
+	assert.Contains(t, dump, `mock_cache_misses{cache="test"} 2`)
+	assert.Contains(t, dump, `mock_cache_evictions{cache="test",reason="capacity"} 0`)
+	assert.Contains(t, dump, `mock_cache_evictions{cache="test",reason="expired"} 0`)
+}
+
+func TestCacheLru(t *testing.T) {
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	var evicted []cacheEvent
+	cache := NewCache(CacheConfig[string, int]{
+		Name:       "test",
+		MaxEntries: 3,
+		OnEvict: func(key string, value int, reason EvictionReason) {
+			evicted = append(evicted, cacheEvent{key, value, reason})
+		},
+	}, absos.NewTimeSvcMock(), m)
+
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	cache.Set("c", 3)
+	cache.Get("a")
+	cache.Set("d", 4)
+	assert.Equal(t, []cacheEvent{{"b", 2, EvictedCapacity}}, evicted)
+	evicted = nil
+
+	// Replacing doesn't evict.
+	cache.Set("d", 5)
+	assert.Empty(t, evicted)
+
+	cache.Set("e", 6)
+	assert.Equal(t, []cacheEvent{{"c", 3, EvictedCapacity}}, evicted)
+	assertCacheKeys(t, cache, "a", "d", "e")
+	assert.Contains(t, m.DumpAsTextForTest(), `mock_cache_evictions{cache="test",reason="capacity"} 2`)
+}
+
+func TestCacheLfu(t *testing.T) {
+	var evicted []cacheEvent
+	cache := NewCache(CacheConfig[string, int]{
+		Policy:     EvictLfu,
+		MaxEntries: 3,
+		OnEvict: func(key string, value int, reason EvictionReason) {
+			evicted = append(evicted, cacheEvent{key, value, reason})
+		},
+	}, absos.NewTimeSvcMock(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	cache.Set("c", 3)
+	for range 3 {
+		cache.Get("a")
+	}
+	cache.Get("b")
+	cache.Get("c")
+
+	// Least recently used of the least frequently used.
+	cache.Set("d", 4)
+	assert.Equal(t, []cacheEvent{{"b", 2, EvictedCapacity}}, evicted)
+	evicted = nil
+
+	cache.Set("e", 5)
+	assert.Equal(t, []cacheEvent{{"d", 4, EvictedCapacity}}, evicted)
+	assertCacheKeys(t, cache, "a", "c", "e")
+}
+
+func TestCacheMaxCost(t *testing.T) {
+	var evicted []cacheEvent
+	cache := NewCache(CacheConfig[string, int]{
+		MaxCost: 10,
+		Cost:    func(key string, value int) int64 { return int64(value) },
+		OnEvict: func(key string, value int, reason EvictionReason) {
+			evicted = append(evicted, cacheEvent{key, value, reason})
+		},
+	}, absos.NewTimeSvcMock(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+
+	cache.Set("a", 4)
+	cache.Set("b", 4)
+	assert.Equal(t, int64(8), cache.Cost())
+
+	cache.Set("c", 5)
+	assert.Equal(t, []cacheEvent{{"a", 4, EvictedCapacity}}, evicted)
+	evicted = nil
+	assert.Equal(t, int64(9), cache.Cost())
+
+	cache.Set("d", 10)
+	assert.Equal(t, []cacheEvent{{"b", 4, EvictedCapacity}, {"c", 5, EvictedCapacity}}, evicted)
+	evicted = nil
+	assert.Equal(t, int64(10), cache.Cost())
+
+	// Too costly.
+	cache.Set("e", 11)
+	assert.Empty(t, evicted)
+	assertCacheKeys(t, cache, "d")
+
+	cache.Set("d", 11)
+	assertCacheKeys(t, cache)
+	assert.Equal(t, int64(0), cache.Cost())
+}
+
+func TestCacheTtl(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	var evicted []cacheEvent
+	cache := NewCache(CacheConfig[string, int]{
+		Name:       "test",
+		MaxEntries: 2,
+		Ttl:        time.Minute,
+		TtlFunc: func(key string, value int) time.Duration {
+			if key == "forever" {
+				return 0
+			}
+			return time.Duration(value) * time.Second
+		},
+		OnEvict: func(key string, value int, reason EvictionReason) {
+			evicted = append(evicted, cacheEvent{key, value, reason})
+		},
+	}, timeSvc, m)
+
+	cache.Set("a", 10)
+	cache.SetWithTtl("forever", 1, 0)
+
+	timeSvc.Add(9 * time.Second)
+	assertCacheKeys(t, cache, "a", "forever")
+
+	timeSvc.Add(time.Second)
+	_, ok := cache.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, []cacheEvent{{"a", 10, EvictedExpired}}, evicted)
+	evicted = nil
+
+	// Expired entries evicted to make room are reported as such.
+	cache.Set("b", 5)
+	timeSvc.Add(5 * time.Second)
+	cache.Get("forever")
+	cache.Set("c", 5)
+	assert.Equal(t, []cacheEvent{{"b", 5, EvictedExpired}}, evicted)
+	evicted = nil
+
+	timeSvc.Add(time.Hour)
+	cache.PurgeExpired()
+	assert.Equal(t, []cacheEvent{{"c", 5, EvictedExpired}}, evicted)
+	assertCacheKeys(t, cache, "forever")
+	assert.Contains(t, m.DumpAsTextForTest(), `mock_cache_evictions{cache="test",reason="expired"} 3`)
+}
+
+func TestCacheDefaultTtl(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	var evicted []cacheEvent
+	cache := NewCache(CacheConfig[string, int]{
+		Ttl: time.Minute,
+		OnEvict: func(key string, value int, reason EvictionReason) {
+			evicted = append(evicted, cacheEvent{key, value, reason})
+		},
+	}, timeSvc, metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+
+	cache.Set("a", 1)
+	cache.SetWithTtl("b", 2, time.Hour)
+	timeSvc.Add(time.Minute)
+	cache.PurgeExpired()
+	assert.Equal(t, []cacheEvent{{"a", 1, EvictedExpired}}, evicted)
+	assertCacheKeys(t, cache, "b")
+}
+
+func TestCacheGetOrLoad(t *testing.T) {
+	errLoad := errors.New("load failed")
+	var loads atomic.Int32
+	release := make(chan any)
+	m := metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock())
+	cache := NewCache(CacheConfig[string, int]{
+		Name: "test",
+		Loader: func(ctx context.Context, key string) (int, error) {
+			loads.Add(1)
+			<-release
+			if key == "bad" {
+				return 0, errLoad
+			}
+			return len(key), nil
+		},
+	}, absos.NewTimeSvcMock(), m)
+
+	// Collapsed.
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			v, err := cache.GetOrLoad(context.Background(), "xyz")
+			assert.Nil(t, err)
+			assert.Equal(t, 3, v)
+		})
+	}
+	assert.Eventually(t, func() bool { return loads.Load() == 1 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), loads.Load())
+
+	v, err := cache.GetOrLoad(context.Background(), "xyz")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, v)
+	assert.Equal(t, int32(1), loads.Load())
+
+	// Errors aren't cached.
+	for i := range 2 {
+		_, err = cache.GetOrLoad(context.Background(), "bad")
+		assert.Equal(t, errLoad, err)
+		assert.Equal(t, int32(2+i), loads.Load())
+	}
+	assert.Equal(t, 1, cache.Len())
+
+	dump := m.DumpAsTextForTest()
+	assert.Contains(t, dump, `mock_cache_hits{cache="test"} 1`)
+	assert.Contains(t, dump, `mock_cache_misses{cache="test"} 12`)
+}
+
+func TestCacheGetOrLoadCancel(t *testing.T) {
+	release := make(chan any)
+	cache := NewCache(CacheConfig[string, int]{
+		Loader: func(ctx context.Context, key string) (int, error) {
+			<-release
+			return 1, ctx.Err()
+		},
+	}, absos.NewTimeSvcMock(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := cache.GetOrLoad(ctx, "x")
+	assert.Equal(t, context.Canceled, err)
+
+	// The load goes on once the caller gives up.
+	ctx, cancel = context.WithCancel(context.Background())
+	go cancel()
+	_, err = cache.GetOrLoad(ctx, "x")
+	assert.Equal(t, context.Canceled, err)
+	close(release)
+	assert.Eventually(t, func() bool { return cache.Len() == 1 }, time.Second, time.Millisecond)
+}
+
+func TestCacheGetOrLoadDiscarded(t *testing.T) {
+	started := make(chan any)
+	release := make(chan any)
+	cache := NewCache(CacheConfig[string, int]{
+		Loader: func(ctx context.Context, key string) (int, error) {
+			started <- nil
+			<-release
+			return 1, nil
+		},
+	}, absos.NewTimeSvcMock(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+
+	done := make(chan any)
+	go func() {
+		defer close(done)
+		v, err := cache.GetOrLoad(context.Background(), "x")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, v)
+	}()
+	<-started
+	cache.Set("x", 2)
+	close(release)
+	<-done
+
+	// Set during the load wins.
+	v, ok := cache.Get("x")
+	assert.True(t, ok)
+	assert.Equal(t, 2, v)
+}
+
+func TestCacheGetOrLoadPanic(t *testing.T) {
+	var loads atomic.Int32
+	cache := NewCache(CacheConfig[string, int]{
+		Loader: func(ctx context.Context, key string) (int, error) {
+			if loads.Add(1) == 1 {
+				panic("oops")
+			}
+			return 1, nil
+		},
+	}, absos.NewTimeSvcMock(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+
+	_, err := cache.GetOrLoad(context.Background(), "x")
+	assert.ErrorIs(t, err, ErrLoaderPanicked)
+	assert.EqualError(t, err, "oops: cache loader panicked")
+	assert.Equal(t, 0, cache.Len())
+
+	// Not stuck.
+	v, err := cache.GetOrLoad(context.Background(), "x")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, v)
+}
+
+func TestCacheNoLoader(t *testing.T) {
+	cache := NewCache(CacheConfig[string, int]{}, absos.NewTimeSvcMock(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+	_, err := cache.GetOrLoad(context.Background(), "x")
+	assert.ErrorIs(t, err, ErrNoLoader)
+}
+
+func TestCachePurgeOnGrowth(t *testing.T) {
+	timeSvc := absos.NewTimeSvcMock()
+	var evicted []cacheEvent
+	cache := NewCache(CacheConfig[string, int]{
+		Ttl: time.Second,
+		OnEvict: func(key string, value int, reason EvictionReason) {
+			evicted = append(evicted, cacheEvent{key, value, reason})
+		},
+	}, timeSvc, metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+
+	for i := range minPurgeSize {
+		cache.Set(fmt.Sprint(i), i)
+	}
+	timeSvc.Add(time.Second)
+	assert.Equal(t, minPurgeSize, cache.Len())
+
+	cache.Set("x", 1)
+	assert.Equal(t, 1, cache.Len())
+	assert.Len(t, evicted, minPurgeSize)
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	cache := NewCache(CacheConfig[string, int]{
+		MaxEntries: 50,
+		Loader:     func(ctx context.Context, key string) (int, error) { return len(key), nil },
+	}, absos.NewTimeSvcMock(), metrics.NewMetricsWithoutDefaultCollectors(appinfo.Mock()))
+
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Go(func() {
+			for i := range 1000 {
+				key := fmt.Sprint((g*i)%100, "-", i%7)
+				switch i % 4 {
+				case 0:
+					cache.Set(key, i)
+				case 1:
+					cache.Get(key)
+				case 2:
+					_, err := cache.GetOrLoad(context.Background(), key)
+					assert.Nil(t, err)
+				default:
+					cache.Delete(key)
+				}
+			}
+		})
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, cache.Len(), 50)
+}
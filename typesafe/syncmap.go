@@ -1,10 +1,26 @@
 package typesafe
 
-import "sync"
+import (
+	"iter"
+	"sync"
+
+	"github.com/kattecon/akgoli/utils"
+)
+
+// ErrComputationPanicked is returned by SyncMap.LoadOrTryComputeOnce() to callers waiting for
+// a computation that panicked.
+const ErrComputationPanicked = utils.ConstError("computation panicked")
 
 type SyncMap[K comparable, V any] struct {
 	inner   sync.Map
 	noValue V
+
+	// writeMu is read-locked by writes, so Snapshot() & Len() see the map at a single point in
+	// time by write-locking it.
+	writeMu sync.RWMutex
+
+	// computing holds in-flight LoadOrTryComputeOnce() computations by key.
+	computing sync.Map
 }
 
 func (m *SyncMap[K, V]) Load(key K) (value V, ok bool) {
@@ -16,14 +32,20 @@ func (m *SyncMap[K, V]) Load(key K) (value V, ok bool) {
 }
 
 func (m *SyncMap[K, V]) Store(key K, value V) {
+	m.writeMu.RLock()
+	defer m.writeMu.RUnlock()
 	m.inner.Store(key, value)
 }
 
 func (m *SyncMap[K, V]) Delete(key K) {
+	m.writeMu.RLock()
+	defer m.writeMu.RUnlock()
 	m.inner.Delete(key)
 }
 
 func (m *SyncMap[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	m.writeMu.RLock()
+	defer m.writeMu.RUnlock()
 	a, loaded := m.inner.LoadOrStore(key, value)
 	return a.(V), loaded
 }
@@ -40,6 +62,8 @@ func (m *SyncMap[K, V]) LoadOrCompute(key K, f func() V) (actual V, loaded bool)
 }
 
 func (m *SyncMap[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	m.writeMu.RLock()
+	defer m.writeMu.RUnlock()
 	a, loaded := m.inner.LoadAndDelete(key)
 	if !loaded {
 		return m.noValue, loaded
@@ -47,8 +71,153 @@ func (m *SyncMap[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
 	return a.(V), loaded
 }
 
+// Swap stores value for key, returns the previous value if any.
+func (m *SyncMap[K, V]) Swap(key K, value V) (previous V, loaded bool) {
+	m.writeMu.RLock()
+	defer m.writeMu.RUnlock()
+	p, loaded := m.inner.Swap(key, value)
+	if !loaded {
+		return m.noValue, loaded
+	}
+	return p.(V), loaded
+}
+
+// Clear deletes all entries.
+func (m *SyncMap[K, V]) Clear() {
+	m.writeMu.RLock()
+	defer m.writeMu.RUnlock()
+	m.inner.Clear()
+}
+
 func (m *SyncMap[K, V]) Range(f func(key K, value V) bool) {
 	m.inner.Range(func(key, value any) bool {
 		return f(key.(K), value.(V))
 	})
 }
+
+// All returns an iterator over entries, with the same (lack of) consistency as Range().
+func (m *SyncMap[K, V]) All() iter.Seq2[K, V] {
+	return m.Range
+}
+
+// Keys returns an iterator over keys, with the same (lack of) consistency as Range().
+func (m *SyncMap[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		m.Range(func(key K, _ V) bool { return yield(key) })
+	}
+}
+
+// Values returns an iterator over values, with the same (lack of) consistency as Range().
+func (m *SyncMap[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		m.Range(func(_ K, value V) bool { return yield(value) })
+	}
+}
+
+// Len returns the number of entries at a single point in time. O(n), blocks writes meanwhile.
+func (m *SyncMap[K, V]) Len() int {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	n := 0
+	m.inner.Range(func(_, _ any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// Snapshot returns a copy of the entries at a single point in time (unlike Range()), blocks
+// writes meanwhile.
+func (m *SyncMap[K, V]) Snapshot() map[K]V {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	snapshot := make(map[K]V)
+	m.inner.Range(func(key, value any) bool {
+		snapshot[key.(K)] = value.(V)
+		return true
+	})
+	return snapshot
+}
+
+// ComparableSyncMap is SyncMap with comparable values, adding compare-and-swap/delete. Values of
+// interface types must hold comparable values, or these panic (like the sync.Map ones).
+type ComparableSyncMap[K comparable, V comparable] struct {
+	SyncMap[K, V]
+}
+
+// CompareAndSwap stores new for key if its value is old, tells whether it did.
+func (m *ComparableSyncMap[K, V]) CompareAndSwap(key K, old, new V) (swapped bool) {
+	m.writeMu.RLock()
+	defer m.writeMu.RUnlock()
+	return m.inner.CompareAndSwap(key, old, new)
+}
+
+// CompareAndDelete deletes key if its value is old, tells whether it did.
+func (m *ComparableSyncMap[K, V]) CompareAndDelete(key K, old V) (deleted bool) {
+	m.writeMu.RLock()
+	defer m.writeMu.RUnlock()
+	return m.inner.CompareAndDelete(key, old)
+}
+
+// computation is an in-flight LoadOrTryComputeOnce() computation other callers of the key wait for.
+type computation[V any] struct {
+	done  chan any
+	value V
+	err   error
+}
+
+// LoadOrComputeOnce is LoadOrCompute() calling f at most once per key at a time: concurrent
+// callers of the same missing key wait for the first one's f instead of calling theirs.
+// If the f waited for panics, the waiting callers start over (one of them calling its f).
+func (m *SyncMap[K, V]) LoadOrComputeOnce(key K, f func() V) (actual V, loaded bool) {
+	for {
+		actual, loaded, err := m.LoadOrTryComputeOnce(key, func() (V, error) {
+			return f(), nil
+		})
+		// Only ErrComputationPanicked, f doesn't fail.
+		if err == nil {
+			return actual, loaded
+		}
+	}
+}
+
+// LoadOrTryComputeOnce is LoadOrComputeOnce() for f that may fail. Its error isn't stored, but
+// returned to the callers waiting for it (with loaded false), so later ones call f again.
+// If f panics, the waiting callers get ErrComputationPanicked.
+func (m *SyncMap[K, V]) LoadOrTryComputeOnce(key K, f func() (V, error)) (actual V, loaded bool, err error) {
+	if a, loaded := m.Load(key); loaded {
+		return a, loaded, nil
+	}
+
+	c := &computation[V]{done: make(chan any)}
+	if other, computing := m.computing.LoadOrStore(key, c); computing {
+		oc := other.(*computation[V])
+		<-oc.done
+		if oc.err != nil {
+			return m.noValue, false, oc.err
+		}
+		return oc.value, true, nil
+	}
+
+	c.err = ErrComputationPanicked
+	defer func() {
+		m.computing.Delete(key)
+		close(c.done)
+	}()
+
+	// May be stored by a computation finished since the Load() above.
+	if a, loaded := m.Load(key); loaded {
+		c.value, c.err = a, nil
+		return a, loaded, nil
+	}
+
+	value, err := f()
+	if err != nil {
+		c.err = err
+		return m.noValue, false, err
+	}
+
+	c.value, loaded = m.LoadOrStore(key, value)
+	c.err = nil
+	return c.value, loaded, nil
+}
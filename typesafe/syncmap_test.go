@@ -1,7 +1,13 @@
 package typesafe
 
 import (
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -88,3 +94,252 @@ func TestSyncMapLoadOrCompute(t *testing.T) {
 	assert.Equal(t, 10, v)
 
 }
+
+func TestSyncMapLoadOrComputeOnce(t *testing.T) {
+	var m SyncMap[string, int]
+
+	var calls atomic.Int32
+	release := make(chan any)
+	var wg sync.WaitGroup
+	var loadedCount atomic.Int32
+	for i := range 10 {
+		wg.Go(func() {
+			v, loaded := m.LoadOrComputeOnce("x", func() int {
+				calls.Add(1)
+				<-release
+				return 10 + i
+			})
+			if loaded {
+				loadedCount.Add(1)
+			}
+			stored, _ := m.Load("x")
+			assert.Equal(t, stored, v)
+		})
+	}
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Equal(t, int32(9), loadedCount.Load())
+
+	v, loaded := m.LoadOrComputeOnce("x", func() int {
+		t.Fatal("called")
+		return 0
+	})
+	assert.True(t, loaded)
+	stored, _ := m.Load("x")
+	assert.Equal(t, stored, v)
+}
+
+func TestSyncMapLoadOrTryComputeOnce(t *testing.T) {
+	var m SyncMap[string, int]
+	errCompute := errors.New("compute failed")
+
+	// Shared failure.
+	started := make(chan any)
+	release := make(chan any)
+	done := make(chan any)
+	go func() {
+		defer close(done)
+		_, loaded, err := m.LoadOrTryComputeOnce("x", func() (int, error) {
+			close(started)
+			<-release
+			return 0, errCompute
+		})
+		assert.False(t, loaded)
+		assert.Equal(t, errCompute, err)
+	}()
+	<-started
+
+	waiterDone := make(chan any)
+	go func() {
+		defer close(waiterDone)
+		_, loaded, err := m.LoadOrTryComputeOnce("x", func() (int, error) {
+			t.Error("called")
+			return 0, nil
+		})
+		assert.False(t, loaded)
+		assert.Equal(t, errCompute, err)
+	}()
+	// Let the waiter block on the computation.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	<-done
+	<-waiterDone
+
+	// Not stored, so computed again.
+	_, loaded := m.Load("x")
+	assert.False(t, loaded)
+
+	v, loaded, err := m.LoadOrTryComputeOnce("x", func() (int, error) { return 5, nil })
+	assert.Nil(t, err)
+	assert.False(t, loaded)
+	assert.Equal(t, 5, v)
+
+	v, loaded, err = m.LoadOrTryComputeOnce("x", func() (int, error) { return 6, errCompute })
+	assert.Nil(t, err)
+	assert.True(t, loaded)
+	assert.Equal(t, 5, v)
+}
+
+func TestSyncMapLoadOrTryComputeOncePanic(t *testing.T) {
+	var m SyncMap[string, int]
+
+	started := make(chan any)
+	release := make(chan any)
+	done := make(chan any)
+	go func() {
+		defer close(done)
+		assert.PanicsWithValue(t, "oops", func() {
+			m.LoadOrTryComputeOnce("x", func() (int, error) {
+				close(started)
+				<-release
+				panic("oops")
+			})
+		})
+	}()
+	<-started
+
+	waiterDone := make(chan any)
+	go func() {
+		defer close(waiterDone)
+		_, _, err := m.LoadOrTryComputeOnce("x", func() (int, error) { return 1, nil })
+		assert.ErrorIs(t, err, ErrComputationPanicked)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	<-done
+	<-waiterDone
+
+	v, loaded := m.LoadOrComputeOnce("x", func() int { return 2 })
+	assert.False(t, loaded)
+	assert.Equal(t, 2, v)
+}
+
+func TestSyncMapLoadOrComputeOncePanic(t *testing.T) {
+	var m SyncMap[string, int]
+
+	started := make(chan any)
+	release := make(chan any)
+	done := make(chan any)
+	go func() {
+		defer close(done)
+		assert.PanicsWithValue(t, "oops", func() {
+			m.LoadOrComputeOnce("x", func() int {
+				close(started)
+				<-release
+				panic("oops")
+			})
+		})
+	}()
+	<-started
+
+	// The waiter computes its value once the first computation panics.
+	waiterDone := make(chan any)
+	go func() {
+		defer close(waiterDone)
+		v, loaded := m.LoadOrComputeOnce("x", func() int { return 1 })
+		assert.False(t, loaded)
+		assert.Equal(t, 1, v)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	<-done
+	<-waiterDone
+
+	v, loaded := m.Load("x")
+	assert.True(t, loaded)
+	assert.Equal(t, 1, v)
+}
+
+func TestSyncMapSwapClear(t *testing.T) {
+	var m SyncMap[string, int]
+
+	_, loaded := m.Swap("x", 1)
+	assert.False(t, loaded)
+	previous, loaded := m.Swap("x", 2)
+	assert.True(t, loaded)
+	assert.Equal(t, 1, previous)
+
+	m.Store("y", 3)
+	assert.Equal(t, 2, m.Len())
+
+	m.Clear()
+	assert.Equal(t, 0, m.Len())
+	_, loaded = m.Load("x")
+	assert.False(t, loaded)
+}
+
+func TestSyncMapIterators(t *testing.T) {
+	var m SyncMap[string, int]
+	assert.Empty(t, m.Snapshot())
+
+	m.Store("a", 1)
+	m.Store("b", 2)
+	m.Store("c", 3)
+
+	all := map[string]int{}
+	for k, v := range m.All() {
+		all[k] = v
+	}
+	assert.Equal(t, map[string]int{"a": 1, "b": 2, "c": 3}, all)
+
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, slices.Collect(m.Keys()))
+	assert.ElementsMatch(t, []int{1, 2, 3}, slices.Collect(m.Values()))
+
+	// Early break.
+	n := 0
+	for range m.Keys() {
+		n++
+		break
+	}
+	assert.Equal(t, 1, n)
+
+	snapshot := m.Snapshot()
+	assert.Equal(t, map[string]int{"a": 1, "b": 2, "c": 3}, snapshot)
+	snapshot["d"] = 4
+	assert.Equal(t, 3, m.Len())
+}
+
+func TestSyncMapSnapshotConsistent(t *testing.T) {
+	var m SyncMap[int, int]
+	m.Store(0, 0)
+
+	// A key moving forward: there are always 1 or 2 consecutive keys at any point in time.
+	done := make(chan any)
+	go func() {
+		defer close(done)
+		for i := range 20_000 {
+			m.Store(i+1, 0)
+			m.Delete(i)
+		}
+	}()
+
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		keys := slices.Sorted(maps.Keys(m.Snapshot()))
+		if !assert.True(t, len(keys) == 1 || len(keys) == 2 && keys[1] == keys[0]+1, keys) {
+			break
+		}
+	}
+}
+
+func TestComparableSyncMap(t *testing.T) {
+	var m ComparableSyncMap[string, int]
+
+	assert.False(t, m.CompareAndSwap("x", 0, 1))
+	m.Store("x", 1)
+	assert.False(t, m.CompareAndSwap("x", 2, 3))
+	assert.True(t, m.CompareAndSwap("x", 1, 3))
+	v, _ := m.Load("x")
+	assert.Equal(t, 3, v)
+
+	assert.False(t, m.CompareAndDelete("x", 1))
+	assert.True(t, m.CompareAndDelete("x", 3))
+	assert.Equal(t, 0, m.Len())
+}
@@ -1,12 +1,21 @@
 package utils
 
-import "crypto/rand"
+import (
+	"crypto/rand"
+	"io"
+)
 
 var secRndLetters = []byte("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
 
 func GenSecureRandomId(n int) string {
+	return GenSecureRandomIdWithRand(rand.Reader, n)
+}
+
+// GenSecureRandomIdWithRand is GenSecureRandomId() reading random bytes from rnd, e.g. absos.RandSvc
+// (which makes the IDs reproducible with absos.RandSvcMockImpl). Panics if rnd fails.
+func GenSecureRandomIdWithRand(rnd io.Reader, n int) string {
 	b := make([]byte, n)
-	nr, err := rand.Read(b)
+	nr, err := io.ReadFull(rnd, b)
 	if nr != n || err != nil {
 		panic(err)
 	}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"math/rand/v2"
+	"strings"
 	"testing"
 
 	"github.com/agnivade/levenshtein"
@@ -21,3 +23,14 @@ func TestGenSecureRandomId(t *testing.T) {
 		}
 	}
 }
+
+func TestGenSecureRandomIdWithRand(t *testing.T) {
+	seed := [32]byte{1}
+	id1 := GenSecureRandomIdWithRand(rand.NewChaCha8(seed), 20)
+	id2 := GenSecureRandomIdWithRand(rand.NewChaCha8(seed), 20)
+	assert.Equal(t, id1, id2)
+	assert.Len(t, id1, 20)
+	assert.Regexp(t, "^[a-zA-Z0-9]+$", id1)
+
+	assert.Panics(t, func() { GenSecureRandomIdWithRand(strings.NewReader("short"), 20) })
+}